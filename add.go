@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// addCardArgs are the arguments of the "add" command, as they're sent to a running instance.
+type addCardArgs struct {
+	Project  string `json:"project,omitempty"` // Absolute filepath
+	Page     string `json:"page"`              // Page name or ID; empty for the root Page
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Deadline string `json:"deadline,omitempty"`
+	Under    *int64 `json:"under,omitempty"` // ID of a Card in the stack to add the new Card to the bottom of
+	Save     bool   `json:"save"`
+}
+
+type addCardResult struct {
+	ID   int64  `json:"id"`
+	Page uint64 `json:"page"`
+}
+
+func init() {
+	instanceHandlers["add"] = handleAddRequest
+	instanceHandlers["create"] = handleAddRequest
+}
+
+// findPage returns the valid Page in the Project with the given name or ID, or nil if there's none.
+func (project *Project) findPage(nameOrID string) *Page {
+
+	for _, page := range project.Pages {
+		if page.Valid() && page.Name() == nameOrID {
+			return page
+		}
+	}
+
+	for _, page := range project.Pages {
+		if page.Valid() && strconv.FormatUint(page.ID, 10) == nameOrID {
+			return page
+		}
+	}
+
+	return nil
+
+}
+
+// handleAddRequest adds a Card to a Project open in this instance (or the current one, if no project is given), the same way it'd be added
+// to the file by "masterplan add".
+func handleAddRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &addCardArgs{}
+	if err := json.Unmarshal(data, args); err != nil {
+		return nil, err
+	}
+
+	project, err := instanceProject(args.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := project.addCard(args)
+	if err != nil {
+		return nil, err
+	}
+
+	globals.EventLog.Log("Added a card to %s from the command line.", false, card.Page.Name())
+
+	if args.Save {
+		project.Save()
+		if project.Modified {
+			return nil, errors.New("the project couldn't be saved")
+		}
+	}
+
+	return &addCardResult{ID: card.ID, Page: card.Page.ID}, nil
+
+}
+
+// addCard adds a Card to the Project as described by the arguments, placing it at the bottom of the stack args.Under is in (or below the
+// Page's other Cards). The Card's creation can be undone.
+func (project *Project) addCard(args *addCardArgs) (*Card, error) {
+
+	if args.Type = plan.ContentTypeNamed(args.Type); args.Type == "" {
+		return nil, fmt.Errorf("unknown card type; it should be one of: %v", plan.ContentTypes)
+	}
+
+	if args.Deadline != "" {
+		if _, err := time.Parse(plan.DeadlineFormat, args.Deadline); err != nil {
+			return nil, fmt.Errorf("couldn't read deadline %s; it should be written as YYYY-MM-DD", args.Deadline)
+		}
+	}
+
+	if project.ReadOnly {
+		return nil, errors.New("the project is open read-only")
+	}
+
+	page := project.Pages[0]
+	if args.Page != "" {
+		if page = project.findPage(args.Page); page == nil {
+			return nil, fmt.Errorf("there's no page named %s", args.Page)
+		}
+	}
+
+	var under *Card
+	if args.Under != nil {
+		if under = page.CardByID(*args.Under); under == nil || !under.Valid {
+			return nil, fmt.Errorf("there's no card %d on page %s", *args.Under, page.Name())
+		}
+	}
+
+	card := page.CreateNewCard(args.Type)
+
+	if under != nil {
+		bottom := under.Stack.Bottom()
+		card.Rect.X = under.Rect.X
+		card.Rect.Y = bottom.Rect.Y + bottom.Rect.H
+	} else {
+
+		var lowest *Card
+		for _, other := range page.Cards {
+			if other != card && other.Valid && (lowest == nil || other.Rect.Y+other.Rect.H > lowest.Rect.Y+lowest.Rect.H) {
+				lowest = other
+			}
+		}
+
+		card.Rect.X, card.Rect.Y = 0, 0
+		if lowest != nil {
+			card.Rect.X = lowest.Rect.X
+			card.Rect.Y = lowest.Rect.Y + lowest.Rect.H + globals.GridSize
+		}
+
+	}
+
+	card.Properties.Get("description").Set(args.Text)
+	if args.Deadline != "" {
+		card.Properties.Get("deadline").Set(args.Deadline)
+	}
+
+	card.LockPosition()
+	project.UndoHistory.Capture(NewUndoState(card))
+	project.SetModifiedState()
+
+	return card, nil
+
+}
+
+// addCardToFile adds a Card to the project file directly, for when it isn't open in a running instance.
+func addCardToFile(args *addCardArgs, passphrase string) (*addCardResult, error) {
+
+	project, bundle, closeProject, err := readProjectForEditing(args.Project, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeProject()
+
+	page := project.Root()
+	if args.Page != "" {
+		if page = project.FindPage(args.Page); page == nil || (page != project.Root() && project.SubpageCard(page) == nil) {
+			return nil, fmt.Errorf("there's no page named %s", args.Page)
+		}
+	}
+
+	var under *plan.Card
+	if args.Under != nil {
+		if under = page.CardByID(*args.Under); under == nil {
+			return nil, fmt.Errorf("there's no card %d on page %s", *args.Under, project.PageName(page))
+		}
+	}
+
+	card := page.AddCardToStack(args.Type, under)
+	card.Properties.Set("description", args.Text)
+	if args.Deadline != "" {
+		card.Properties.Set("deadline", args.Deadline)
+	}
+
+	if bundle {
+		err = project.SaveBundle(args.Project)
+	} else {
+		err = project.Save(args.Project)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := project.WriteCalendarFeed(args.Project); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write the calendar feed of %s: %s\n", filepath.Base(args.Project), err)
+	}
+
+	return &addCardResult{ID: card.ID, Page: page.ID}, nil
+
+}
+
+func runAddCommand(command *Command, args []string) int {
+
+	flags := command.Flags()
+	projectPath := flags.String("project", "", "The project to add the card to.")
+	page := flags.String("page", "", "Name or ID of the page to add the card to; defaults to the root page.")
+	cardType := flags.String("type", plan.ContentTypeCheckbox, "Content type of the card (e.g. Checkbox, Number, Note).")
+	text := flags.String("text", "", "The card's text.")
+	deadline := flags.String("deadline", "", "The card's deadline, as YYYY-MM-DD.")
+	under := flags.Int64("under", -1, "ID of a card to add the new card below, at the bottom of its stack.")
+	save := flags.Bool("save", false, "If the project is open in a running instance, save it after adding the card.")
+	if flags.Parse(args) != nil {
+		return 2
+	}
+
+	if *projectPath == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	addArgs := &addCardArgs{
+		Page:     *page,
+		Type:     plan.ContentTypeNamed(*cardType),
+		Text:     *text,
+		Deadline: *deadline,
+		Save:     *save,
+	}
+
+	if addArgs.Type == "" {
+		fmt.Fprintf(os.Stderr, "Unknown card type %s; it should be one of: %v.\n", *cardType, plan.ContentTypes)
+		return 2
+	}
+
+	if *deadline != "" {
+		if _, err := time.Parse(plan.DeadlineFormat, *deadline); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't read deadline %s; it should be written as YYYY-MM-DD.\n", *deadline)
+			return 2
+		}
+	}
+
+	if *under >= 0 {
+		addArgs.Under = under
+	}
+
+	var err error
+	if addArgs.Project, err = filepath.Abs(*projectPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't find %s: %s\n", *projectPath, err)
+		return 2
+	}
+
+	result := &addCardResult{}
+
+	// If the project's open, the running instance adds the card, so it isn't overwritten the next time the project's saved there.
+	err = SendInstanceRequest("add", addArgs, result)
+
+	if err == ErrNoInstance || err == ErrInstanceProjectNotOpen {
+		result, err = addCardToFile(addArgs, os.Getenv("MASTERPLAN_PASSPHRASE"))
+	} else if err == nil {
+		fmt.Fprintf(os.Stderr, "%s is open in MasterPlan; the card was added there.\n", filepath.Base(addArgs.Project))
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't add card to %s: %s\n", *projectPath, err)
+		return 1
+	}
+
+	fmt.Println(result.ID)
+
+	return 0
+
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// The local API is an opt-in HTTP server, bound to localhost, that exposes the current Project's Pages, Cards, and their properties as JSON.
+// Requests must carry the token from the settings, either as an "Authorization: Bearer <token>" header or a "token" query parameter (for
+// EventSource clients, which can't set headers). Like the control socket's requests, they're handled on the main thread, and changes made
+// through it can be undone in MasterPlan.
+//
+//	GET    /api/pages                   Pages
+//	GET    /api/cards[?page=name|id]    Cards, optionally only on one Page
+//	GET    /api/cards/<id>              A Card
+//	POST   /api/cards                   Creates a Card: {"page", "type", "text", "deadline", "under", "properties"}
+//	PATCH  /api/cards/<id>              Sets properties of a Card: {"properties": {"name": value, ...}}
+//	DELETE /api/cards/<id>              Deletes a Card
+//	GET    /api/events                  A server-sent event stream of the Messages Cards and Pages receive (see apiMessages)
+
+type apiPage struct {
+	ID        uint64   `json:"id"`
+	Name      string   `json:"name"`
+	Path      []string `json:"path"`
+	CardCount int      `json:"card_count"`
+}
+
+type apiRect struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+	W float32 `json:"w"`
+	H float32 `json:"h"`
+}
+
+type apiCard struct {
+	ID         int64                  `json:"id"`
+	Page       uint64                 `json:"page"`
+	Type       string                 `json:"type"`
+	Rect       apiRect                `json:"rect"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type apiEvent struct {
+	Type    string `json:"type"`
+	Project string `json:"project"`
+	Page    uint64 `json:"page"`
+	Card    *int64 `json:"card,omitempty"`
+}
+
+// apiMessages are the Message types sent to the event stream. Those that are true are about a single Card, and are sent as each Card
+// receives them; the rest are about a Page.
+var apiMessages = map[string]bool{
+	MessageCardSelected:        true,
+	MessageCardDeselected:      true,
+	MessageCardDeleted:         true,
+	MessageCardRestored:        true,
+	MessageCardResizeCompleted: true,
+	MessageCardMoveStack:       true,
+	MessageContentSwitched:     true,
+	MessageUndoRedo:            true,
+	MessageLinkCreated:         true,
+	MessageLinkDeleted:         true,
+	MessagePageChanged:         false,
+}
+
+// errAPIReadOnly is returned for changes to read-only Projects.
+var errAPIReadOnly = errors.New("the project is open read-only")
+
+type apiHTTPError struct {
+	Status int
+	Err    error
+}
+
+func (err *apiHTTPError) Error() string { return err.Err.Error() }
+
+func apiError(status int, format string, args ...interface{}) error {
+	return &apiHTTPError{Status: status, Err: fmt.Errorf(format, args...)}
+}
+
+var localAPI = struct {
+	Server      *http.Server
+	Port        int
+	Subscribers map[chan *apiEvent]bool
+	Lock        sync.Mutex
+}{Subscribers: map[chan *apiEvent]bool{}}
+
+// UpdateLocalAPIServer starts or stops the local API server to match the settings, restarting it if its port changed.
+func UpdateLocalAPIServer() {
+
+	enabled := globals.Settings.Get(SettingsLocalAPI).AsBool()
+	port := int(globals.Settings.Get(SettingsLocalAPIPort).AsFloat())
+
+	if localAPI.Server != nil && (!enabled || port != localAPI.Port) {
+		StopLocalAPIServer()
+	}
+
+	if !enabled || localAPI.Server != nil {
+		return
+	}
+
+	if globals.Settings.Get(SettingsLocalAPIToken).AsString() == "" {
+		ResetLocalAPIToken()
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		globals.EventLog.Log("Error: Couldn't start the local API: %s", true, err.Error())
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/pages", apiHandler(serveAPIPages))
+	mux.HandleFunc("/api/cards", apiHandler(serveAPICards))
+	mux.HandleFunc("/api/cards/", apiHandler(serveAPICard))
+	mux.HandleFunc("/api/events", serveAPIEvents)
+
+	localAPI.Server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	localAPI.Port = port
+
+	go localAPI.Server.Serve(listener)
+
+	globals.EventLog.Log("Local API listening on http://127.0.0.1:%d/api/.", false, port)
+
+}
+
+// StopLocalAPIServer stops the local API server, if it's running.
+func StopLocalAPIServer() {
+	if localAPI.Server != nil {
+		localAPI.Server.Close()
+		localAPI.Server = nil
+	}
+}
+
+// ResetLocalAPIToken replaces the local API's token with a new, random one.
+func ResetLocalAPIToken() {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	globals.Settings.Get(SettingsLocalAPIToken).Set(hex.EncodeToString(token))
+	SaveSettings()
+}
+
+func apiAuthorized(request *http.Request) bool {
+
+	token := request.URL.Query().Get("token")
+	if header := request.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	// The settings are only read on the main thread, so the token is compared against a copy taken when the request was authorized.
+	expected := ""
+	if !callOnMainThread(func() { expected = globals.Settings.Get(SettingsLocalAPIToken).AsString() }) {
+		return false
+	}
+
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+
+}
+
+// apiHandler wraps a handler for the local API, checking the token, running the handler on the main thread, and writing its result (or
+// error) as JSON.
+func apiHandler(handler func(request *http.Request, body []byte) (int, interface{}, error)) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if !apiAuthorized(request) {
+			writeAPIError(writer, http.StatusUnauthorized, errors.New("missing or wrong token"))
+			return
+		}
+
+		body, err := readAPIBody(request)
+		if err != nil {
+			writeAPIError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		var status int
+		var result interface{}
+
+		if !callOnMainThread(func() { status, result, err = handler(request, body) }) {
+			writeAPIError(writer, http.StatusServiceUnavailable, errors.New("timed out waiting for the request to be handled"))
+			return
+		}
+
+		if err != nil {
+			status = http.StatusBadRequest
+			if httpErr, ok := err.(*apiHTTPError); ok {
+				status = httpErr.Status
+			} else if err == errAPIReadOnly {
+				status = http.StatusForbidden
+			}
+			writeAPIError(writer, status, err)
+			return
+		}
+
+		writer.WriteHeader(status)
+		if result != nil {
+			json.NewEncoder(writer).Encode(result)
+		}
+
+	}
+
+}
+
+// readAPIBody reads a request's body, up to a megabyte.
+func readAPIBody(request *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(request.Body, 1<<20+1))
+	if err == nil && len(body) > 1<<20 {
+		err = errors.New("request body is too large")
+	}
+	return body, err
+}
+
+func writeAPIError(writer http.ResponseWriter, status int, err error) {
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(map[string]string{"error": err.Error()})
+}
+
+// apiPagePath returns the names of the Pages leading from the root Page down to the given one, through the Sub-Page Cards pointing to them
+// (like plan.Project.PagePath(), and likewise stopping at loops).
+func apiPagePath(page *Page) []string {
+	path := []string{page.Name()}
+	visited := map[*Page]bool{page: true}
+	for page.PointingSubpageCard != nil && !visited[page.PointingSubpageCard.Page] {
+		page = page.PointingSubpageCard.Page
+		visited[page] = true
+		path = append([]string{page.Name()}, path...)
+	}
+	return path
+}
+
+func newAPIPage(page *Page) *apiPage {
+	count := 0
+	for _, card := range page.Cards {
+		if card.Valid {
+			count++
+		}
+	}
+	return &apiPage{ID: page.ID, Name: page.Name(), Path: apiPagePath(page), CardCount: count}
+}
+
+func newAPICard(card *Card) *apiCard {
+	return &apiCard{
+		ID:         card.ID,
+		Page:       card.Page.ID,
+		Type:       card.ContentType,
+		Rect:       apiRect{card.Rect.X, card.Rect.Y, card.Rect.W, card.Rect.H},
+		Properties: card.Properties.ToModel(true).Values,
+	}
+}
+
+func serveAPIPages(request *http.Request, body []byte) (int, interface{}, error) {
+
+	if request.Method != http.MethodGet {
+		return 0, nil, apiError(http.StatusMethodNotAllowed, "method %s isn't allowed", request.Method)
+	}
+
+	pages := []*apiPage{}
+	for _, page := range globals.Project.Pages {
+		if page.Valid() {
+			pages = append(pages, newAPIPage(page))
+		}
+	}
+
+	return http.StatusOK, pages, nil
+
+}
+
+func serveAPICards(request *http.Request, body []byte) (int, interface{}, error) {
+
+	project := globals.Project
+
+	switch request.Method {
+
+	case http.MethodGet:
+
+		var only *Page
+		if name := request.URL.Query().Get("page"); name != "" {
+			if only = project.findPage(name); only == nil {
+				return 0, nil, apiError(http.StatusNotFound, "there's no page named %s", name)
+			}
+		}
+
+		cards := []*apiCard{}
+		for _, page := range project.Pages {
+			if !page.Valid() || (only != nil && page != only) {
+				continue
+			}
+			for _, card := range page.Cards {
+				if card.Valid {
+					cards = append(cards, newAPICard(card))
+				}
+			}
+		}
+
+		return http.StatusOK, cards, nil
+
+	case http.MethodPost:
+
+		if project.ReadOnly {
+			return 0, nil, errAPIReadOnly
+		}
+
+		args := &struct {
+			addCardArgs
+			Properties map[string]interface{} `json:"properties"`
+		}{}
+
+		if err := json.Unmarshal(body, args); err != nil {
+			return 0, nil, err
+		}
+
+		if err := checkAPIProperties(nil, args.Properties); err != nil {
+			return 0, nil, err
+		}
+
+		card, err := project.addCard(&args.addCardArgs)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		setAPIProperties(card, args.Properties)
+
+		return http.StatusCreated, newAPICard(card), nil
+
+	}
+
+	return 0, nil, apiError(http.StatusMethodNotAllowed, "method %s isn't allowed", request.Method)
+
+}
+
+func serveAPICard(request *http.Request, body []byte) (int, interface{}, error) {
+
+	project := globals.Project
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(request.URL.Path, "/api/cards/"), 10, 64)
+	if err != nil {
+		return 0, nil, apiError(http.StatusNotFound, "%s isn't a card ID", strings.TrimPrefix(request.URL.Path, "/api/cards/"))
+	}
+
+	card := project.CardByID(id)
+	if card == nil || !card.Valid {
+		return 0, nil, apiError(http.StatusNotFound, "there's no card %d", id)
+	}
+
+	switch request.Method {
+
+	case http.MethodGet:
+		return http.StatusOK, newAPICard(card), nil
+
+	case http.MethodPatch:
+
+		if project.ReadOnly {
+			return 0, nil, errAPIReadOnly
+		}
+
+		args := &struct {
+			Properties map[string]interface{} `json:"properties"`
+		}{}
+
+		if err := json.Unmarshal(body, args); err != nil {
+			return 0, nil, err
+		}
+
+		if err := checkAPIProperties(card, args.Properties); err != nil {
+			return 0, nil, err
+		}
+
+		setAPIProperties(card, args.Properties)
+
+		return http.StatusOK, newAPICard(card), nil
+
+	case http.MethodDelete:
+
+		if project.ReadOnly {
+			return 0, nil, errAPIReadOnly
+		}
+
+		// Deleting the Card captures an undo state for it, so it can be restored.
+		card.Page.DeleteCards(card)
+		card.Page.Selection.Remove(card)
+		project.SetModifiedState()
+
+		return http.StatusNoContent, nil, nil
+
+	}
+
+	return 0, nil, apiError(http.StatusMethodNotAllowed, "method %s isn't allowed", request.Method)
+
+}
+
+// checkAPIProperties returns an error (a 400 Bad Request) if any of the property values can't be set on the Card (see
+// Properties.CheckValue()); a nil Card is one that's about to be created.
+func checkAPIProperties(card *Card, properties map[string]interface{}) error {
+	for name, value := range properties {
+		var err error
+		if card != nil {
+			err = card.Properties.CheckValue(name, value)
+		} else {
+			err = plan.CheckPropertyValue(name, value, nil)
+		}
+		if err != nil {
+			return apiError(http.StatusBadRequest, "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// setAPIProperties sets the Card's properties, capturing an undo state for the change.
+func setAPIProperties(card *Card, properties map[string]interface{}) {
+
+	if len(properties) == 0 {
+		return
+	}
+
+	for name, value := range properties {
+		card.Properties.Get(name).Set(value)
+	}
+
+	card.Page.Project.UndoHistory.Capture(NewUndoState(card))
+	card.Page.Project.SetModifiedState()
+
+}
+
+// PublishCardMessage sends a Message a Card received to the local API's event stream, if it's one of the apiMessages about Cards.
+func PublishCardMessage(card *Card, message *Message) {
+	if apiMessages[message.Type] {
+		id := card.ID
+		publishAPIEvent(&apiEvent{Type: message.Type, Project: card.Page.Project.Filepath, Page: card.Page.ID, Card: &id})
+	}
+}
+
+// PublishPageMessage sends a Message a Page received to the local API's event stream, if it's one of the apiMessages about Pages.
+func PublishPageMessage(page *Page, message *Message) {
+	if cardMessage, exists := apiMessages[message.Type]; exists && !cardMessage {
+		publishAPIEvent(&apiEvent{Type: message.Type, Project: page.Project.Filepath, Page: page.ID})
+	}
+}
+
+func publishAPIEvent(event *apiEvent) {
+
+	localAPI.Lock.Lock()
+	defer localAPI.Lock.Unlock()
+
+	for subscriber := range localAPI.Subscribers {
+		// Events are dropped for clients that can't keep up, rather than holding up the main thread.
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+
+}
+
+func serveAPIEvents(writer http.ResponseWriter, request *http.Request) {
+
+	if !apiAuthorized(request) {
+		writeAPIError(writer, http.StatusUnauthorized, errors.New("missing or wrong token"))
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeAPIError(writer, http.StatusInternalServerError, errors.New("streaming isn't supported"))
+		return
+	}
+
+	events := make(chan *apiEvent, 64)
+
+	localAPI.Lock.Lock()
+	localAPI.Subscribers[events] = true
+	localAPI.Lock.Unlock()
+
+	defer func() {
+		localAPI.Lock.Lock()
+		delete(localAPI.Subscribers, events)
+		localAPI.Lock.Unlock()
+	}()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+
+		select {
+
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			fmt.Fprint(writer, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case <-request.Context().Done():
+			return
+
+		}
+
+	}
+
+}
@@ -10,14 +10,13 @@ import (
 	"time"
 
 	"github.com/hako/durafmt"
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
+	"github.com/solarlune/masterplan/plan"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
-	CollapsedNone  = "CollapsedNone"
-	CollapsedShade = "CollapsedShade"
+	CollapsedNone  = plan.CollapsedNone
+	CollapsedShade = plan.CollapsedShade
 
 	ResizeUR = "resizecorner_ur"
 	ResizeR  = "resizehorizontal_r"
@@ -337,8 +336,6 @@ type Card struct {
 	onScreen bool
 }
 
-var globalCardID = int64(0)
-
 func NewCard(page *Page, contentType string) *Card {
 
 	card := &Card{
@@ -346,7 +343,7 @@ func NewCard(page *Page, contentType string) *Card {
 		DisplayRect:     &sdl.FRect{},
 		Page:            page,
 		ContentsLibrary: map[string]Contents{},
-		ID:              globalCardID,
+		ID:              page.Project.nextCardID,
 		Highlighter:     NewHighlighter(&sdl.FRect{0, 0, 32, 32}, true),
 		Collapsed:       CollapsedNone,
 		Draggable:       true,
@@ -369,11 +366,11 @@ func NewCard(page *Page, contentType string) *Card {
 		card.CreateUndoState = true
 	}
 
-	globalCardID++
+	page.Project.nextCardID++
 
 	card.SetContents(contentType)
 
-	globals.Hierarchy.AddCard(card)
+	page.Project.Hierarchy.AddCard(card)
 
 	return card
 
@@ -1131,16 +1128,24 @@ func (card *Card) NearestPointInRect(in Point, perpendicular bool) Point {
 }
 
 func (card *Card) DeadlineState() int {
+	if !card.Properties.Has("deadline") {
+		return DeadlineStateDone
+	}
+	return deadlineState(card.Properties.Get("deadline").AsString(), card.Completed())
+}
+
+// deadlineState returns the state of a deadline (in the "2006-01-02" format) as of today; it's DeadlineStateDone if done is true.
+func deadlineState(deadlineText string, done bool) int {
 
 	state := DeadlineStateDone
 
-	if card.Properties.Has("deadline") && !card.Completed() {
+	if !done {
 
 		state = DeadlineStateTimeRemains
 
 		now := time.Now()
 		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		deadline, _ := time.ParseInLocation("2006-01-02", card.Properties.Get("deadline").AsString(), today.Location())
+		deadline, _ := time.ParseInLocation("2006-01-02", deadlineText, today.Location())
 		timeDiffDuration := deadline.Sub(today).Round(time.Hour * 24)
 
 		if timeDiffDuration == 0 {
@@ -1353,6 +1358,11 @@ func (card *Card) DrawLinks() {
 
 func (card *Card) Color() Color {
 
+	// Cards with merge conflicts are tinted until they're resolved, without changing their own color.
+	if card.Properties.Has(plan.MergeConflictProperty) {
+		return ColorFromHexString(plan.MergeConflictColor)
+	}
+
 	if card.Contents != nil {
 		return card.Contents.Color()
 	}
@@ -1433,7 +1443,7 @@ func (card *Card) HandleUndos() {
 
 		card.CreateUndoState = false
 
-		globals.Hierarchy.AddCard(card)
+		card.Page.Project.Hierarchy.AddCard(card)
 
 	}
 
@@ -1562,61 +1572,50 @@ func (card *Card) Completable() bool {
 	return card.ContentType == ContentTypeCheckbox || card.ContentType == ContentTypeNumbered
 }
 
-func (card *Card) Serialize(toSave bool) string {
+// ToModel returns the Card as a plan.Card. Only Links that start from this Card (and that connect valid Cards) are included, as that's where they're saved.
+func (card *Card) ToModel(toSave bool) *plan.Card {
 
-	data := "{}"
-	data, _ = sjson.Set(data, "id", card.ID)
+	model := &plan.Card{
+		ID:              card.ID,
+		Rect:            plan.Rect{X: card.Rect.X, Y: card.Rect.Y, W: card.Rect.W, H: card.Rect.H},
+		Collapsed:       card.Collapsed,
+		UncollapsedSize: plan.Point{X: card.UncollapsedSize.X, Y: card.UncollapsedSize.Y},
+		ContentType:     card.ContentType,
+		Properties:      card.Properties.ToModel(toSave),
+		Links:           []*plan.Link{},
+	}
 
-	data, _ = sjson.Set(data, "rect", card.Rect)
-	data, _ = sjson.Set(data, "collapsed", card.Collapsed)
-	data, _ = sjson.Set(data, "uncollapsedSizeX", card.UncollapsedSize.X)
-	data, _ = sjson.Set(data, "uncollapsedSizeY", card.UncollapsedSize.Y)
-	data, _ = sjson.Set(data, "contents", card.ContentType)
 	if card.CustomColor != nil {
-		data, _ = sjson.Set(data, "custom color", card.CustomColor.ToHexString())
+		model.CustomColor = card.CustomColor.ToHexString()
 	}
 	if card.FontColor != nil {
-		data, _ = sjson.Set(data, "font color", card.FontColor.ToHexString())
+		model.FontColor = card.FontColor.ToHexString()
 	}
-	data, _ = sjson.SetRaw(data, "properties", card.Properties.Serialize(toSave))
-
-	if len(card.Links) > 0 {
-
-		existingLinks := "["
 
-		for _, link := range card.Links {
-
-			if link.End.Valid && link.Start.Valid && link.Start == card {
+	for _, link := range card.Links {
 
-				dataOut := "{}"
-				dataOut, _ = sjson.Set(dataOut, "start", link.Start.ID)
-				dataOut, _ = sjson.Set(dataOut, "end", link.End.ID)
-				jointPos := []Point{}
-				for _, p := range link.Joints {
-					jointPos = append(jointPos, p.Position)
-				}
-				dataOut, _ = sjson.Set(dataOut, "joints", jointPos)
-				existingLinks += dataOut + ","
+		if link.End.Valid && link.Start.Valid && link.Start == card {
 
+			modelLink := &plan.Link{Start: link.Start.ID, End: link.End.ID, Joints: []plan.Point{}}
+			for _, p := range link.Joints {
+				modelLink.Joints = append(modelLink.Joints, plan.Point{X: p.Position.X, Y: p.Position.Y})
 			}
+			model.Links = append(model.Links, modelLink)
 
 		}
 
-		// It's easiest to simply remove the last "," after the fact than
-		// detect to see if we're done or not
-		existingLinks = existingLinks[:len(existingLinks)-1] + "]"
-
-		if len(existingLinks) > 2 {
-			data, _ = sjson.SetRaw(data, "links", existingLinks)
-		}
-
 	}
 
-	return data
+	return model
 
 }
 
-func (card *Card) Deserialize(data string) {
+func (card *Card) Serialize(toSave bool) string {
+	return card.ToModel(toSave).Serialize()
+}
+
+// FromModel sets the Card's state from the given plan.Card. Links are queued up on the Card's Page, to be created once all Cards exist (see Page.UpdateLinks()).
+func (card *Card) FromModel(model *plan.Card) {
 
 	for _, link := range append([]*LinkEnding{}, card.Links...) {
 		if link.Start == card {
@@ -1624,79 +1623,58 @@ func (card *Card) Deserialize(data string) {
 		}
 	}
 
-	rect := gjson.Get(data, "rect")
-	card.Rect.X = float32(rect.Get("X").Float())
-	card.Rect.Y = float32(rect.Get("Y").Float())
+	card.Rect.X = model.Rect.X
+	card.Rect.Y = model.Rect.Y
 
-	if gjson.Get(data, "collapsed").Exists() {
-		card.Collapsed = gjson.Get(data, "collapsed").String()
-		card.UncollapsedSize.X = float32(gjson.Get(data, "uncollapsedSizeX").Float())
-		card.UncollapsedSize.Y = float32(gjson.Get(data, "uncollapsedSizeY").Float())
-	}
-
-	if card.Page.Project.Loading && gjson.Get(data, "id").Exists() {
-		card.LoadedID = gjson.Get(data, "id").Int()
-	}
+	card.Collapsed = model.Collapsed
+	card.UncollapsedSize = Point{model.UncollapsedSize.X, model.UncollapsedSize.Y}
 
-	if gjson.Get(data, "links").Exists() {
-
-		links := []string{}
-
-		for _, linkEnd := range gjson.Get(data, "links").Array() {
-			links = append(links, linkEnd.String())
+	if card.Page.Project.Loading && model.ID >= 0 {
+		card.LoadedID = model.ID
+		// Keep the saved ID if it's free, so Card IDs stay the same between saving and loading (which the journal relies on).
+		if existing := card.Page.Project.CardByID(model.ID); existing == nil || existing == card {
+			card.ID = model.ID
+			if card.Page.Project.nextCardID <= card.ID {
+				card.Page.Project.nextCardID = card.ID + 1
+			}
 		}
-
-		card.Page.DeserializationLinks = append(card.Page.DeserializationLinks, links...)
-
 	}
 
-	if gjson.Get(data, "custom color").Exists() {
-		cc := gjson.Get(data, "custom color")
-		card.CustomColor = ColorFromHexString(cc.String())
+	card.Page.DeserializationLinks = append(card.Page.DeserializationLinks, model.Links...)
+
+	if model.CustomColor != "" {
+		card.CustomColor = ColorFromHexString(model.CustomColor)
 	} else {
 		card.CustomColor = nil
 	}
 
-	if gjson.Get(data, "font color").Exists() {
-		cc := gjson.Get(data, "font color")
-		card.FontColor = ColorFromHexString(cc.String())
+	if model.FontColor != "" {
+		card.FontColor = ColorFromHexString(model.FontColor)
 	} else {
 		card.FontColor = nil
 	}
 
-	// for _, link := range card.Links {
-	// 	found := false
-	// 	// for _, gl := range linkedTo {
-	// 	// 	if gl == link.End.ID {
-	// 	// 		found = true
-	// 	// 		break
-	// 	// 	}
-	// 	// }
-	// 	// Unlink Cards that are no longer linked to according to the deserialized data
-	// 	if !found {
-	// 		card.Unlink(link.End)
-	// 	}
-	// }
-
 	// Set Rect Position and Size before deserializing properties and setting contents so the contents can know the actual correct, current size of the Card (important for Map Contents)
-	card.Recreate(float32(rect.Get("W").Float()), float32(rect.Get("H").Float()))
-
-	card.Properties.Deserialize(gjson.Get(data, "properties").Raw)
+	card.Recreate(model.Rect.W, model.Rect.H)
 
-	// card.ReceiveMessage(NewMessage(MessageCardDeserialized, nil, nil))
+	card.Properties.FromModel(model.Properties)
 
-	card.SetContents(gjson.Get(data, "contents").String())
+	card.SetContents(model.ContentType)
 
 	// Call update on the contents and then recreate directly afterward
 	card.Contents.Update()
 
 	// We call Recreate again afterwards because otherwise Images reform their size after copy+paste
-	card.Recreate(float32(rect.Get("W").Float()), float32(rect.Get("H").Float()))
+	card.Recreate(model.Rect.W, model.Rect.H)
 
 	card.LockPosition() // We call this to lock the position of the card, but also to update the Card's position on the underlying Grid.
 
 }
 
+func (card *Card) Deserialize(data string) {
+	card.FromModel(plan.ParseCard(data))
+}
+
 func (card *Card) Select() {
 	if !card.selected {
 		card.Page.Raise(card)
@@ -1837,6 +1815,27 @@ func (card *Card) SetCenter(position Point) {
 
 }
 
+// FitToText resizes the Card to fit the given text; Notes wider than 512 pixels are wrapped to fit instead.
+func (card *Card) FitToText(text string) {
+
+	size := globals.TextRenderer.MeasureText([]rune(text), 1)
+
+	if card.ContentType != ContentTypeNote {
+		card.Recreate(size.X+(globals.GridSize*2), size.Y+(card.Contents.DefaultSize().Y-globals.GridSize))
+		return
+	}
+
+	maxWidth := float32(512)
+
+	if size.X > maxWidth {
+		newSize := globals.TextRenderer.MeasureTextAutowrap(maxWidth, text)
+		card.Recreate(newSize.X+(globals.GridSize*4), newSize.Y)
+	} else {
+		card.Recreate(size.X+(globals.GridSize*2), size.Y)
+	}
+
+}
+
 func (card *Card) Recreate(newWidth, newHeight float32) {
 
 	newWidth = float32(math.Ceil(float64(newWidth/globals.GridSize))) * globals.GridSize
@@ -1974,6 +1973,8 @@ func (card *Card) Recreate(newWidth, newHeight float32) {
 
 func (card *Card) ReceiveMessage(message *Message) {
 
+	PublishCardMessage(card, message)
+
 	if card.Contents != nil {
 		card.Contents.ReceiveMessage(message)
 	}
@@ -2006,7 +2007,7 @@ func (card *Card) ReceiveMessage(message *Message) {
 		card.Page.Grid.Put(card)
 		card.Page.UpdateStacks = true
 	} else if message.Type == MessageUndoRedo {
-		globals.Hierarchy.AddCard(card)
+		card.Page.Project.Hierarchy.AddCard(card)
 	} else if message.Type == MessageCardMoveStack {
 		// Card resized, let's update the stack
 
@@ -2032,6 +2033,10 @@ func (card *Card) ReceiveMessage(message *Message) {
 
 }
 
+// cardMetadataProperties are the names of Properties that Cards of any content type keep, like the UID of the calendar entry a Card was
+// imported from (see Page.ImportCalendar()).
+var cardMetadataProperties = []string{"calendar uid"}
+
 func (card *Card) SetContents(contentType string) {
 
 	prevContents := card.Contents
@@ -2077,6 +2082,13 @@ func (card *Card) SetContents(contentType string) {
 			panic("Creation of card contents that haven't been implemented: " + contentType)
 		}
 
+		// Properties that aren't used by any contents, but are still kept with the Card
+		for _, name := range cardMetadataProperties {
+			if card.Properties.Has(name) {
+				card.Properties.Get(name)
+			}
+		}
+
 		w := card.Rect.W
 		if w <= 0 {
 			w = card.Contents.DefaultSize().X
@@ -2095,6 +2107,8 @@ func (card *Card) SetContents(contentType string) {
 	}
 
 	if prevContents != nil && prevContents != card.Contents {
+		// Both Contents are told directly rather than through Card.ReceiveMessage(), so the switch is published to the local API here.
+		PublishCardMessage(card, NewMessage(MessageContentSwitched, card, nil))
 		prevContents.ReceiveMessage(NewMessage(MessageContentSwitched, card, nil))
 		card.Contents.ReceiveMessage(NewMessage(MessageContentSwitched, card, nil))
 		card.CreateUndoState = true
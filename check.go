@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// CheckProblems checks the Project for problems (see plan.Check()), returning them along with the model they were found in.
+func (project *Project) CheckProblems() (*plan.Project, []*plan.Problem, error) {
+
+	model, err := project.ToModel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return model, plan.Check(model, project.Filepath), nil
+
+}
+
+// FixProblems fixes the Project's problems in the given categories (or all of them, if none are given). The fixes are worked out on a model
+// of the Project (see plan.FixProblems()), and then made to the Project's own Cards, so they can be undone like any other change.
+func (project *Project) FixProblems(categories ...string) {
+
+	if project.ReadOnly {
+		globals.EventLog.Log("Error: Read-only projects can't be fixed.", true)
+		return
+	}
+
+	model, problems, err := project.CheckProblems()
+	if err != nil {
+		globals.EventLog.Log("Error: Couldn't check project: %s", true, err.Error())
+		return
+	}
+
+	// The model's Pages and Cards are matched up with the Project's before they're fixed, as fixing duplicate IDs changes them.
+	pages := map[*plan.Page]*Page{}
+	cards := map[*plan.Card]*Card{}
+	unfixed := map[*plan.Card]*plan.Card{}
+
+	for _, modelPage := range model.Pages {
+		for _, page := range project.Pages {
+			if page.ID == modelPage.ID {
+				pages[modelPage] = page
+				for i, modelCard := range modelPage.Cards {
+					if i >= len(page.Cards) {
+						break
+					}
+					cards[modelCard] = page.Cards[i]
+					unfixed[modelCard] = plan.ParseCard(modelCard.Serialize())
+				}
+			}
+		}
+	}
+
+	modelPages := append([]*plan.Page{}, model.Pages...)
+
+	fixed := plan.FixProblems(problems, categories...)
+	if fixed == 0 {
+		return
+	}
+
+	globals.EventLog.On = false
+
+	for _, modelPage := range model.Pages {
+
+		page := pages[modelPage]
+		if page == nil {
+			continue
+		}
+
+		for _, modelCard := range modelPage.Cards {
+
+			card, exists := cards[modelCard]
+
+			// Cards added by the fixes (like Sub-Page Cards for orphaned Pages) are created like pasted Cards are.
+			if !exists {
+				card = page.CreateNewCard(ContentTypeCheckbox)
+				modelCard.ID = card.ID
+				card.FromModel(modelCard)
+				project.UndoHistory.Capture(NewUndoState(card))
+				continue
+			}
+
+			before := unfixed[modelCard]
+			changed := false
+
+			if modelCard.ID != before.ID {
+				card.ID = project.nextCardID
+				project.nextCardID++
+				changed = true
+			}
+
+			if modelCard.Properties.Serialize() != before.Properties.Serialize() {
+
+				// The Card's own model is updated, rather than using the fixed one, which has had its filepaths made relative for saving.
+				updated := card.ToModel(true)
+
+				for _, name := range before.Properties.DefinitionOrder {
+					if !modelCard.Properties.Has(name) {
+						updated.Properties.Remove(name)
+					}
+				}
+
+				for _, name := range modelCard.Properties.DefinitionOrder {
+					if value := modelCard.Properties.Get(name); !before.Properties.Has(name) || !reflect.DeepEqual(value, before.Properties.Get(name)) {
+						updated.Properties.Set(name, value)
+					}
+				}
+
+				card.FromModel(updated)
+				changed = true
+
+			}
+
+			if changed {
+				project.UndoHistory.Capture(NewUndoState(card))
+			}
+
+		}
+
+		page.UpdateLinks()
+		page.UpdateStacks = true
+
+	}
+
+	// Empty orphaned Pages are removed outright, as there's nothing on them to undo.
+	for _, modelPage := range modelPages {
+		if model.PageByID(modelPage.ID) == nil {
+			project.RemovePage(pages[modelPage])
+		}
+	}
+
+	globals.EventLog.On = true
+
+	project.SetModifiedState()
+
+	globals.EventLog.Log("Fixed %d problem(s).", true, fixed)
+
+}
+
+// problemText describes a problem found in the given model, naming the Page it's on.
+func problemText(model *plan.Project, problem *plan.Problem) string {
+
+	// Orphaned Pages have no Sub-Page Card to take their name from.
+	pageName := fmt.Sprintf("Page %d", problem.PageID)
+	if page := model.PageByID(problem.PageID); page != nil && (page == model.Root() || model.SubpageCard(page) != nil) {
+		pageName = model.PageName(page)
+	}
+
+	if problem.CardID < 0 {
+		return fmt.Sprintf("%s: %s", pageName, problem.Description)
+	}
+
+	return fmt.Sprintf("%s, card %d: %s", pageName, problem.CardID, problem.Description)
+
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// Command is a subcommand MasterPlan can be run with from the command line (e.g. "masterplan merge base.plan ours.plan theirs.plan").
+// Commands work on project files directly through the plan package, and run without opening a window.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(command *Command, args []string) int // Returns the exit code
+}
+
+var commands = []*Command{
+	{
+		Name:  "merge",
+		Usage: "merge [-o output] base.plan ours.plan theirs.plan",
+		Description: "Merges the changes made to a project on two sides (ours and theirs) from a common ancestor (base), card by card.\n" +
+			"The result overwrites ours unless an output file is given. Cards that were changed differently on both sides are listed,\n" +
+			"and tinted (without changing their own colors) until they're resolved from the Edit menu; the exit code is 1. Bundles and\n" +
+			"encrypted projects (opened with the passphrase in the MASTERPLAN_PASSPHRASE environment variable) are merged too, and the\n" +
+			"result is written the same way as ours. To use this as a git merge driver, add this to .git/config (or ~/.gitconfig):\n\n" +
+			"\t[merge \"masterplan\"]\n\t\tname = MasterPlan project merge\n\t\tdriver = masterplan merge %O %A %B\n\n" +
+			"and this to .gitattributes:\n\n\t*.plan merge=masterplan\n\t*.planz merge=masterplan",
+		Run: runMergeCommand,
+	},
+	{
+		Name:  "check",
+		Usage: "check [--fix categories|all] [-o output] project.plan",
+		Description: "Checks a project for problems, listing them by category: dangling links and Link card targets (links), missing files or\n" +
+			"programs (files), duplicate card IDs (ids), orphaned pages (pages), malformed table and map data (data), and deadlines that\n" +
+			"can't be read (deadlines). --fix fixes the problems in the given comma-separated categories (or all of them), and saves the\n" +
+			"result over the project unless an output file is given. The exit code is 1 if problems remain, and 2 on errors. Encrypted\n" +
+			"projects are opened with the passphrase in the MASTERPLAN_PASSPHRASE environment variable.",
+		Run: runCheckCommand,
+	},
+	{
+		Name:  "export",
+		Usage: "export [--format png|pdf|md|opml|svg|html] [--out dir] [--background normal|nogrid|transparent] [--subpage-files] project.plan",
+		Description: "Exports every page of a project the same way Tools > Export does - as a PNG image per page, a single PDF, Markdown, OPML,\n" +
+			"an SVG image per page, or a single HTML page - without showing a window. The project is drawn in software using SDL's offscreen\n" +
+			"video driver (set SDL_VIDEODRIVER to use a different one). Encrypted projects are opened with the passphrase in the\n" +
+			"MASTERPLAN_PASSPHRASE environment variable. The exit code is non-zero if the export failed.",
+		Run: runExportCommand,
+	},
+	{
+		Name:  "query",
+		Usage: "query [--page name|id] [--type types] [--completed true|false] [--deadline states] project.plan",
+		Description: "Prints a project's cards as JSON, along with their completion totals (as the Stats menu counts them) and their overdue,\n" +
+			"due-today, and upcoming deadlines (as the Deadlines menu lists them). Each card includes its stack number and the path of pages\n" +
+			"leading to it through sub-pages. The filters narrow down which cards are included (and counted); types and deadline states are\n" +
+			"comma-separated lists. The project file is read directly, without opening a window, and MASTERPLAN_PASSPHRASE is read for encrypted\n" +
+			"projects.",
+		Run: runQueryCommand,
+	},
+	{
+		Name:  "add",
+		Usage: "add --project project.plan [--page name|id] [--type type] [--text text] [--deadline YYYY-MM-DD] [--under card-id] [--save]",
+		Description: "Adds a card to a project, printing its ID. With --under, the card is added at the bottom of the stack that card is in (lined\n" +
+			"up with it); otherwise, it's added below everything else on the page. If the project is open in a running instance of\n" +
+			"MasterPlan, the card is added there (where it can be undone), so it isn't lost when the project's saved; --save saves the\n" +
+			"project there afterwards. Otherwise, the project file is edited directly. Encrypted projects are opened with the passphrase\n" +
+			"in the MASTERPLAN_PASSPHRASE environment variable.",
+		Run: runAddCommand,
+	},
+	{
+		Name:  "control",
+		Usage: "control command [json-args]",
+		Description: "Sends a command to the running instance of MasterPlan over its control socket, printing the result as JSON. Commands are:\n\n" +
+			"\topen {\"project\"}                          Opens a project, or switches to its tab\n" +
+			"\tfocus {\"project\", \"card\"}                 Switches to a card's page and focuses on it\n" +
+			"\tcreate {\"project\", \"page\", \"type\", \"text\", \"deadline\", \"under\"}\n" +
+			"\t                                           Creates a card, like the add command\n" +
+			"\tset-property {\"project\", \"card\", \"name\", \"value\"}\n" +
+			"\t                                           Sets a card's property to a string, number, or boolean, of its type\n" +
+			"\ttrigger {\"project\", \"card\", \"mode\"}       Activates a Link card, or starts or stops (set, clear, toggle) a Timer\n" +
+			"\tscreenshot {\"project\", \"filename\"}        Takes a screenshot of a project's current view\n" +
+			"\tsave {\"project\"}                          Saves a project\n\n" +
+			"Projects are absolute filepaths; without one, the current project is used. Changes can be undone in MasterPlan. The socket\n" +
+			"($XDG_RUNTIME_DIR/masterplan/instance.sock) takes one request per connection as a line of JSON, like {\"command\": \"focus\",\n" +
+			"\"args\": {\"card\": 12}}, and replies with a line like {\"ok\": true, \"result\": ...} or {\"ok\": false, \"error\": \"...\"}.",
+		Run: runControlCommand,
+	},
+}
+
+// RunCommand runs the command named by the first argument, if there is one, returning its exit code and true. If the arguments
+// don't name a command (e.g. they're a project to open), it returns false.
+func RunCommand(args []string) (int, bool) {
+
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Println("Usage: masterplan [project file]")
+		for _, command := range commands {
+			fmt.Printf("       masterplan %s\n", command.Usage)
+		}
+		fmt.Println("\nRun \"masterplan help <command>\" for details on a command.")
+		if len(args) > 1 {
+			for _, command := range commands {
+				if command.Name == args[1] {
+					fmt.Printf("\nmasterplan %s\n\n%s\n", command.Usage, command.Description)
+				}
+			}
+		}
+		return 0, true
+	}
+
+	for _, command := range commands {
+		if command.Name == args[0] {
+			return command.Run(command, args[1:]), true
+		}
+	}
+
+	return 0, false
+
+}
+
+// Flags returns a new FlagSet for the command's arguments that prints the command's usage on error.
+func (command *Command) Flags() *flag.FlagSet {
+	flags := flag.NewFlagSet(command.Name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: masterplan %s\n\n%s\n", command.Usage, command.Description)
+	}
+	return flags
+}
+
+// readProjectForEditing reads the project at the given filepath, decrypting it with the passphrase if it's encrypted, so it can be edited and
+// saved back. If it's a bundle, its media files are extracted to a temporary directory (so they can be bundled again when it's saved), and
+// bundle is true. The returned function removes the temporary directory, and should be called when done with the project.
+func readProjectForEditing(filePath, passphrase string) (project *plan.Project, bundle bool, closeProject func(), err error) {
+
+	closeProject = func() {}
+
+	keys := plan.NewKeys()
+
+	data, err := plan.ReadProjectFile(filePath, passphrase, keys)
+	if err != nil {
+		return nil, false, closeProject, err
+	}
+
+	bundle = plan.IsBundleData(data)
+
+	if bundle {
+		var mediaDir string
+		if mediaDir, err = os.MkdirTemp("", "masterplan_edit_*"); err != nil {
+			return nil, false, closeProject, err
+		}
+		closeProject = func() { os.RemoveAll(mediaDir) }
+		project, err = plan.ExtractBundle(data, mediaDir)
+	} else {
+		project, err = plan.Parse(data)
+	}
+
+	if err != nil {
+		closeProject()
+		return nil, false, func() {}, err
+	}
+
+	project.Passphrase = passphrase
+	project.Keys = keys
+
+	return project, bundle, closeProject, nil
+
+}
+
+func runMergeCommand(command *Command, args []string) int {
+
+	flags := command.Flags()
+	output := flags.String("o", "", "File to write the merged project to; defaults to ours.")
+	if flags.Parse(args) != nil {
+		return 2
+	}
+
+	if flags.NArg() != 3 {
+		flags.Usage()
+		return 2
+	}
+
+	projects := []*plan.Project{}
+	oursBundle := false
+
+	for i, file := range flags.Args() {
+		// Bundled media are extracted, so the merged project can bundle them again; they're kept until it's been saved.
+		project, bundle, closeProject, err := readProjectForEditing(file, os.Getenv("MASTERPLAN_PASSPHRASE"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't load %s: %s\n", file, err)
+			return 2
+		}
+		defer closeProject()
+		projects = append(projects, project)
+		if i == 1 {
+			oursBundle = bundle
+		}
+	}
+
+	// The merged project is a copy of ours, so it's encrypted (and bundled) the same way.
+	merged, conflicts := plan.Merge(projects[0], projects[1], projects[2])
+
+	target := *output
+	if target == "" {
+		target = flags.Arg(1)
+	}
+
+	var err error
+	if oursBundle {
+		err = merged.SaveBundle(target)
+	} else {
+		err = merged.Save(target)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't save %s: %s\n", target, err)
+		return 2
+	}
+
+	if len(conflicts) > 0 {
+		fmt.Printf("%s: %d conflict(s); conflicting cards have been tinted:\n", filepath.Base(target), len(conflicts))
+		for _, conflict := range conflicts {
+			fmt.Println("\t" + conflict.String())
+		}
+		return 1
+	}
+
+	return 0
+
+}
+
+func runExportCommand(command *Command, args []string) int {
+
+	flags := command.Flags()
+	format := flags.String("format", "png", "Format to export to: png (an image per page), pdf (a single document, with bookmarks and links between pages), md (Markdown), opml (the root page's outline, with sub-pages nested), svg (a vector image per page), or html (a single page to view in a browser, with every page of the project).")
+	output := flags.String("out", "", "Directory to export to; defaults to the project's directory.")
+	background := flags.String("background", "normal", "Background to draw behind cards: normal, nogrid, or transparent.")
+	subpageFiles := flags.Bool("subpage-files", false, "For Markdown, write each sub-page to its own file rather than as a section.")
+	if flags.Parse(args) != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	options := &ScreenshotOptions{
+		Exporting: true,
+		HideGUI:   true,
+	}
+
+	switch strings.ToLower(*format) {
+	case "png":
+		options.ExportMode = ExportModePNG
+	case "pdf":
+		options.ExportMode = ExportModePDF
+	case "md", "markdown":
+		options.ExportMode = ExportModeMarkdown
+	case "opml":
+		options.ExportMode = ExportModeOPML
+	case "svg":
+		options.ExportMode = ExportModeSVG
+	case "html":
+		options.ExportMode = ExportModeHTML
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown export format %s; it should be png, pdf, md, opml, svg, or html.\n", *format)
+		return 2
+	}
+
+	switch strings.ToLower(*background) {
+	case "normal":
+		options.BackgroundOption = BackgroundNormal
+	case "nogrid":
+		options.BackgroundOption = BackgroundNoGrid
+	case "transparent":
+		options.BackgroundOption = BackgroundTransparent
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown background %s; it should be normal, nogrid, or transparent.\n", *background)
+		return 2
+	}
+
+	projectPath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't find %s: %s\n", flags.Arg(0), err)
+		return 2
+	}
+
+	options.Filename = *output
+	if options.Filename == "" {
+		options.Filename = filepath.Dir(projectPath)
+	}
+
+	if err := os.MkdirAll(options.Filename, os.ModePerm); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't create %s: %s\n", options.Filename, err)
+		return 2
+	}
+
+	switch options.ExportMode {
+	case ExportModeMarkdown:
+		err = ExportMarkdownHeadless(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), *subpageFiles, options.Filename)
+	case ExportModeOPML:
+		err = ExportOPMLHeadless(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), options.Filename)
+	case ExportModePDF:
+		err = ExportPDFHeadless(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), options.BackgroundOption, options.Filename)
+	case ExportModeSVG:
+		err = ExportSVGHeadless(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), options.BackgroundOption, options.Filename)
+	case ExportModeHTML:
+		err = ExportHTMLHeadless(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), options.BackgroundOption, options.Filename)
+	default:
+		err = ExportHeadless(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), options)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't export %s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	fmt.Printf("Exported %s to %s.\n", filepath.Base(projectPath), options.Filename)
+
+	return 0
+
+}
+
+func runCheckCommand(command *Command, args []string) int {
+
+	flags := command.Flags()
+	fix := flags.String("fix", "", "Categories of problems to fix (comma-separated), or all.")
+	output := flags.String("o", "", "File to write the fixed project to; defaults to the project itself.")
+	if flags.Parse(args) != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	categories := []string{}
+	if *fix != "all" {
+		for category := range commaSet(*fix) {
+			if _, known := plan.ProblemCategoryNames[category]; !known {
+				fmt.Fprintf(os.Stderr, "Unknown category %s; it should be one of: %s.\n", category, strings.Join(plan.ProblemCategories, ", "))
+				return 2
+			}
+			categories = append(categories, category)
+		}
+	}
+
+	file := flags.Arg(0)
+	passphrase := os.Getenv("MASTERPLAN_PASSPHRASE")
+
+	// Bundled media are extracted, so they can be checked for (and bundled again if the project's fixed).
+	project, bundle, closeProject, err := readProjectForEditing(file, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't load %s: %s\n", file, err)
+		return 2
+	}
+
+	defer closeProject()
+
+	problems := plan.Check(project, file)
+
+	if *fix != "" && len(problems) > 0 {
+
+		fixed := plan.FixProblems(problems, categories...)
+
+		target := *output
+		if target == "" {
+			target = file
+		}
+
+		if bundle {
+			err = project.SaveBundle(target)
+		} else {
+			err = project.Save(target)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't save %s: %s\n", target, err)
+			return 2
+		}
+
+		if err := project.WriteCalendarFeed(target); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't write the calendar feed of %s: %s\n", target, err)
+		}
+
+		fmt.Printf("%s: fixed %d problem(s).\n", filepath.Base(target), fixed)
+
+		problems = plan.Check(project, target)
+
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("%s: no problems found.\n", filepath.Base(file))
+		return 0
+	}
+
+	fmt.Printf("%s: %d problem(s):\n", filepath.Base(file), len(problems))
+
+	for _, category := range plan.ProblemCategories {
+		for _, problem := range problems {
+			if problem.Category == category {
+				fmt.Printf("\t%s: %s (fix: %s)\n", plan.ProblemCategoryNames[category], problem, problem.Fix)
+			}
+		}
+	}
+
+	return 1
+
+}
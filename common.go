@@ -302,20 +302,28 @@ func formatTime(t time.Duration, showMilliseconds bool) string {
 
 }
 
-func WriteImageToTemp(clipboardImg []byte) (string, error) {
-
-	var file *os.File
-	var err error
+// TempDirectory returns MasterPlan's directory for temporary files, creating it if it doesn't exist.
+func TempDirectory() string {
 
 	// Make the directory if it doesn't exist
 	mpTmpDir := filepath.Join(os.TempDir(), "masterplan")
 
-	if err = os.Mkdir(mpTmpDir, os.ModeDir+os.ModeAppend+os.ModePerm); err != nil && !os.IsExist(err) {
+	if err := os.Mkdir(mpTmpDir, os.ModeDir+os.ModeAppend+os.ModePerm); err != nil && !os.IsExist(err) {
 		// We're going to assume past any error from os.Mkdir, if there is one, as that just means the folder must exist already.
 		globals.EventLog.Log(err.Error(), false)
 	}
 
-	file, err = os.CreateTemp(mpTmpDir, "screenshot_*.png")
+	return mpTmpDir
+
+}
+
+// WriteImageToTemp writes the image data to a new temporary file in the given directory, returning its filepath.
+func WriteImageToTemp(dir string, clipboardImg []byte) (string, error) {
+
+	var file *os.File
+	var err error
+
+	file, err = os.CreateTemp(dir, "screenshot_*.png")
 
 	if err != nil {
 		return "", err
@@ -381,7 +389,9 @@ func HandleFontReload() {
 
 			if globals.Project != nil {
 				// We call this specifically because reloading fonts causes textures to be recreated, meaning Map images turn blank after changing fonts
-				globals.Project.SendMessage(NewMessage(MessageRenderTextureRefresh, nil, nil))
+				for _, project := range globals.Projects {
+					project.SendMessage(NewMessage(MessageRenderTextureRefresh, nil, nil))
+				}
 			}
 
 		}
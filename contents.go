@@ -8,8 +8,10 @@ import (
 	"image/png"
 	"log"
 	"math"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,28 +30,29 @@ import (
 	"github.com/ncruces/zenity"
 	"github.com/pkg/browser"
 	"github.com/skratchdot/open-golang/open"
+	"github.com/solarlune/masterplan/plan"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
-	ContentTypeCheckbox = "Checkbox"
-	ContentTypeNumbered = "Number"
-	ContentTypeNote     = "Note"
-	ContentTypeSound    = "Sound"
-	ContentTypeImage    = "Image"
-	ContentTypeTimer    = "Timer"
-	ContentTypeMap      = "Map"
-	ContentTypeSubpage  = "Sub-Page"
-	ContentTypeLink     = "Link"
-	ContentTypeTable    = "Table"
-	ContentTypeWeb      = "web"
+	ContentTypeCheckbox = plan.ContentTypeCheckbox
+	ContentTypeNumbered = plan.ContentTypeNumbered
+	ContentTypeNote     = plan.ContentTypeNote
+	ContentTypeSound    = plan.ContentTypeSound
+	ContentTypeImage    = plan.ContentTypeImage
+	ContentTypeTimer    = plan.ContentTypeTimer
+	ContentTypeMap      = plan.ContentTypeMap
+	ContentTypeSubpage  = plan.ContentTypeSubpage
+	ContentTypeLink     = plan.ContentTypeLink
+	ContentTypeTable    = plan.ContentTypeTable
+	ContentTypeWeb      = plan.ContentTypeWeb
 )
 const (
-	TriggerTypeSet = iota
-	TriggerTypeToggle
-	TriggerTypeClear
+	TriggerTypeSet    = plan.TriggerTypeSet
+	TriggerTypeToggle = plan.TriggerTypeToggle
+	TriggerTypeClear  = plan.TriggerTypeClear
 )
 
 var icons map[string]*sdl.Rect = map[string]*sdl.Rect{
@@ -1500,8 +1503,8 @@ func (ic *ImageContents) ReceiveMessage(msg *Message) {
 }
 
 const (
-	TimerModeStopwatch = iota
-	TimerModeCountdown
+	TimerModeStopwatch = plan.TimerModeStopwatch
+	TimerModeCountdown = plan.TimerModeCountdown
 )
 
 type TimerContents struct {
@@ -2889,7 +2892,7 @@ func (sb *SubPageContents) ReceiveMessage(msg *Message) {
 
 	if sb.SubPage != nil {
 		if msg.Type == MessageCardDeleted {
-			globals.Hierarchy.AddPage(sb.SubPage)
+			sb.SubPage.Project.Hierarchy.AddPage(sb.SubPage)
 		}
 	}
 
@@ -2927,10 +2930,74 @@ type LinkContents struct {
 	TargetName *Label
 	targetCard *Card
 	DefaultContents
-	ProgramRow *ContainerRow
-	CardRow    *ContainerRow
-	linkedIcon *GUIImage
-	loaded     bool
+	ProgramRow    *ContainerRow
+	CardRow       *ContainerRow
+	RemoteRow     *ContainerRow
+	linkedIcon    *GUIImage
+	loaded        bool
+	remoteChecked time.Time
+}
+
+// linkedProject is a project read from disk to look up the targets of Link Cards pointing into it.
+type linkedProject struct {
+	ModTime    time.Time
+	Size       int64
+	Passphrase string // The passphrase the project was read with
+	Project    *plan.Project
+	Err        error
+}
+
+// linkedProjects caches the projects that Link Cards point into, keyed by filepath. Entries are replaced when their files change, and
+// removed when their files are gone or no open Project links into them anymore (see evictLinkedProjects()).
+var linkedProjects = map[string]*linkedProject{}
+
+// readLinkedProject returns the project at the given filepath for looking up the target of a Link Card in the given Project; it's only read
+// again if the file changed. Encrypted projects are read with the linking Project's passphrase, as projects that link to each other are
+// often encrypted with the same one.
+func readLinkedProject(filename string, linking *Project) (*plan.Project, error) {
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		delete(linkedProjects, filename)
+		return nil, err
+	}
+
+	if cached, exists := linkedProjects[filename]; exists && cached.ModTime.Equal(info.ModTime()) && cached.Size == info.Size() && cached.Passphrase == linking.Passphrase {
+		return cached.Project, cached.Err
+	}
+
+	project, err := plan.ReadProject(filename, linking.Passphrase, linking.Keys)
+	if err == plan.ErrWrongPassphrase {
+		err = plan.ErrEncrypted
+	}
+
+	linkedProjects[filename] = &linkedProject{ModTime: info.ModTime(), Size: info.Size(), Passphrase: linking.Passphrase, Project: project, Err: err}
+
+	return project, err
+
+}
+
+// evictLinkedProjects removes the cached projects that no Link Card in an open Project points into anymore.
+func evictLinkedProjects() {
+
+	linked := map[string]bool{}
+
+	for _, project := range globals.Projects {
+		for _, page := range project.Pages {
+			for _, card := range page.Cards {
+				if lc, ok := card.Contents.(*LinkContents); ok && card.Valid && lc.RemoteTarget() != "" {
+					linked[filepath.Clean(lc.RemoteTarget())] = true
+				}
+			}
+		}
+	}
+
+	for filename := range linkedProjects {
+		if !linked[filepath.Clean(filename)] {
+			delete(linkedProjects, filename)
+		}
+	}
+
 }
 
 func NewLinkContents(card *Card) *LinkContents {
@@ -2950,6 +3017,9 @@ func NewLinkContents(card *Card) *LinkContents {
 	}
 	// We Get() "target" either way because we want it to be "registered" as a property that's in use and that should cause undo / redo when changed
 	lc.Card.Properties.Get("target")
+	// The project the target is in, for links to Cards in other projects; it's empty for Cards in the same project
+	targetProject := lc.Card.Properties.Get("target project")
+	targetProject.Set(card.Page.Project.PathToAbsolute(targetProject.AsString(), false))
 
 	lc.Label.Editable = true
 	lc.Label.Property = card.Properties.Get("description")
@@ -2966,8 +3036,8 @@ func NewLinkContents(card *Card) *LinkContents {
 	lc.CardRow.HorizontalSpacing = 16
 	lc.CardRow.Add("link", NewButton("Link", nil, nil, true, func() {
 		globals.State = StateCardLink
-		card.Page.Project.LinkingCard = card
-		globals.EventLog.Log("Linking mode activated. Select a card to link to it. Right click or press escape to cancel.", false)
+		globals.linkingCard = card
+		globals.EventLog.Log("Linking mode activated. Select a card to link to it (switch tabs to link to a card in another project). Right click or press escape to cancel.", false)
 	}))
 
 	lc.CardRow.Add("jump", NewButton("Jump", nil, nil, true, func() {
@@ -2977,6 +3047,9 @@ func NewLinkContents(card *Card) *LinkContents {
 		lc.SetTarget(nil)
 	}))
 
+	lc.RemoteRow = lc.container.AddRow(AlignCenter)
+	lc.RemoteRow.Add("target", lc.TargetName)
+
 	lc.ProgramRow = lc.container.AddRow(AlignCenter)
 	lc.ProgramRow.HorizontalSpacing = 16
 	lc.ProgramRow.Add("browse", NewButton("Browse", nil, nil, true, func() {
@@ -3084,7 +3157,13 @@ func (lc *LinkContents) Update() {
 	// During loading, Card.Contents.Update() gets called and doing this may not work if the card refers to another one that has yet to
 	// be deserialized.
 
-	if lc.targetCard != nil {
+	if lc.RemoteTarget() != "" {
+		// Looking the target up means reading the other project, so it's not done every frame.
+		if time.Since(lc.remoteChecked) > time.Second {
+			lc.remoteChecked = time.Now()
+			lc.TargetName.SetText([]rune(lc.remoteTargetName()))
+		}
+	} else if lc.targetCard != nil {
 		targetName := "(Unnamed)"
 		if lc.targetCard.Properties.Has("description") && lc.targetCard.Properties.Get("description").InUse {
 			targetName = lc.targetCard.Properties.Get("description").AsString()
@@ -3108,6 +3187,7 @@ func (lc *LinkContents) Update() {
 
 	lc.ProgramRow.Visible = programMode
 	lc.CardRow.Visible = !programMode
+	lc.RemoteRow.Visible = !programMode && lc.RemoteTarget() != ""
 
 	lc.linkedIcon.Visible = (lc.Card.Properties.Get("link mode").AsFloat() == 0 && lc.Card.Properties.Get("target").AsFloat() >= 0) || (lc.Card.Properties.Get("link mode").AsFloat() == 1 && lc.Card.Properties.Get("run").AsString() != "")
 
@@ -3115,7 +3195,17 @@ func (lc *LinkContents) Update() {
 }
 
 func (lc *LinkContents) Jump() {
-	if lc.targetCard != nil {
+	if targetProject := lc.RemoteTarget(); targetProject != "" {
+
+		if ProjectTab(targetProject) == nil && !FileExists(targetProject) {
+			globals.EventLog.Log("Error: Link Card [%s] links to %s, which can't be found.", true, lc.Card.Properties.Get("description").AsString(), targetProject)
+			return
+		}
+
+		globals.EventLog.Log("Jumped to target: %s.", false, lc.TargetName.TextAsString())
+		FocusCardInProject(targetProject, int64(lc.Card.Properties.Get("target").AsFloat()))
+
+	} else if lc.targetCard != nil {
 
 		if !lc.targetCard.Valid {
 			lc.SetTarget(nil)
@@ -3163,6 +3253,7 @@ func (lc *LinkContents) Run() {
 
 func (lc *LinkContents) SetTarget(targetCard *Card) {
 	lc.targetCard = targetCard
+	lc.Card.Properties.Get("target project").Set("")
 	target := lc.Card.Properties.Get("target")
 	if targetCard == nil {
 		target.Set(-1.0)
@@ -3173,6 +3264,67 @@ func (lc *LinkContents) SetTarget(targetCard *Card) {
 	globals.EventLog.Log("Card link erased.", false)
 }
 
+// SetRemoteTarget links to the Card with the given ID in the (saved) project at the given filepath.
+func (lc *LinkContents) SetRemoteTarget(projectPath string, cardID int64) {
+	lc.targetCard = nil
+	lc.Card.Properties.Get("target project").Set(projectPath)
+	lc.Card.Properties.Get("target").Set(float64(cardID))
+	lc.remoteChecked = time.Time{}
+	lc.Card.CreateUndoState = true
+}
+
+// RemoteTarget returns the filepath of the project the Link Card's target is in, or an empty string if it's in the same project.
+func (lc *LinkContents) RemoteTarget() string {
+	if lc.Card.Properties.Get("target").AsFloat() < 0 {
+		return ""
+	}
+	return lc.Card.Properties.Get("target project").AsString()
+}
+
+// remoteTargetName returns the name of the Link Card's target in another project, or why it can't be found.
+func (lc *LinkContents) remoteTargetName() string {
+
+	targetProject := lc.RemoteTarget()
+	targetID := int64(lc.Card.Properties.Get("target").AsFloat())
+	fileName := filepath.Base(targetProject)
+
+	name := ""
+
+	// Open projects may have changed since they were last saved, so they're checked first.
+	if project := ProjectTab(targetProject); project != nil {
+		if card := project.CardByID(targetID); card != nil && card.Valid {
+			name = card.Name()
+		} else {
+			return "[Card Not Found in " + fileName + "]"
+		}
+	} else {
+
+		model, err := readLinkedProject(targetProject, lc.Card.Page.Project)
+
+		if os.IsNotExist(err) {
+			return "[File Not Found: " + fileName + "]"
+		} else if err == plan.ErrEncrypted {
+			return "[Card in " + fileName + " (Encrypted)]"
+		} else if err != nil {
+			return "[Couldn't Read " + fileName + "]"
+		}
+
+		card := model.FindCard(targetID)
+		if card == nil {
+			return "[Card Not Found in " + fileName + "]"
+		}
+		name = card.Name()
+
+	}
+
+	if name == "" {
+		name = "(Unnamed)"
+	}
+
+	return name + " (in " + fileName + ")"
+
+}
+
 func (lc *LinkContents) Draw() {
 	lc.DefaultContents.Draw()
 }
@@ -3202,7 +3354,7 @@ func (lc *LinkContents) ReceiveMessage(msg *Message) {
 
 		lc.loaded = true
 
-		if lc.Card.Properties.Get("target").AsFloat() >= 0 {
+		if lc.Card.Properties.Get("target").AsFloat() >= 0 && lc.RemoteTarget() == "" {
 
 			found := false
 
@@ -3253,16 +3405,12 @@ func (tdc *TableDataContents) OnClick(rightClick bool) {
 }
 
 const (
-	ValueDisplayModeCheck  = iota
-	ValueDisplayModeLetter = iota
-	ValueDisplayModeNumber = iota
+	ValueDisplayModeCheck  = plan.ValueDisplayModeCheck
+	ValueDisplayModeLetter = plan.ValueDisplayModeLetter
+	ValueDisplayModeNumber = plan.ValueDisplayModeNumber
 )
 
-var valueDisplayModeSizes map[int]int = map[int]int{
-	ValueDisplayModeCheck:  3,
-	ValueDisplayModeLetter: 7,
-	ValueDisplayModeNumber: 11,
-}
+var valueDisplayModeSizes map[int]int = plan.ValueDisplayModeSizes
 
 type TableData struct {
 	Table             *TableContents
@@ -4160,6 +4308,19 @@ func (tc *TableContents) Color() Color {
 	return color
 }
 
+// CSV returns the Table's contents as CSV (or TSV, if comma is a tab); see plan.TableData.CSV().
+func (tc *TableContents) CSV(comma rune) string {
+	return plan.ParseTableData(tc.TableData.Serialize()).CSV(comma)
+}
+
+// SetData replaces the Table's contents with the serialized table data (see plan.TableData), resizing the Card to fit.
+func (tc *TableContents) SetData(data string) {
+	tc.TableData.Deserialize(data)
+	tc.Card.Recreate(float32(tc.TableData.Width)*globals.GridSize, float32(tc.TableData.Height)*globals.GridSize)
+	tc.Card.Properties.Get("contents").SetRaw(tc.TableData.Serialize())
+	tc.Card.CreateUndoState = true
+}
+
 func (tc *TableContents) ReceiveMessage(msg *Message) {
 	if msg.Type == MessageCardResizeCompleted {
 		w := int(tc.Card.Rect.W / 32)
@@ -405,7 +405,9 @@ func handleEvents() {
 			// if baseEvent.GetType() == sdl.RENDER_TARGETS_RESET || baseEvent.GetType() == sdl.RENDER_DEVICE_RESET || baseEvent.GetType() == sdl.WINDOWEVENT_MINIMIZED || baseEvent.GetType() == sdl.WINDOWEVENT_MAXIMIZED {
 			if baseEvent.GetType() == sdl.RENDER_TARGETS_RESET || baseEvent.GetType() == sdl.RENDER_DEVICE_RESET {
 				RefreshRenderTextures()
-				globals.Project.SendMessage(NewMessage(MessageRenderTextureRefresh, nil, nil))
+				for _, project := range globals.Projects {
+					project.SendMessage(NewMessage(MessageRenderTextureRefresh, nil, nil))
+				}
 			}
 
 		}
@@ -12,13 +12,16 @@ import (
 	"strings"
 	"time"
 
-	"github.com/signintech/gopdf"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
-	ExportModePNG = "PNG"
-	ExportModePDF = "PDF"
+	ExportModePNG      = "PNG"
+	ExportModePDF      = "PDF"      // Written directly by ExportPDF()
+	ExportModeMarkdown = "Markdown" // Written directly by ExportMarkdown(), rather than through screenshots
+	ExportModeOPML     = "OPML"     // Written directly by ExportOPML()
+	ExportModeSVG      = "SVG"      // Written directly by ExportSVG()
+	ExportModeHTML     = "HTML"     // Written directly by ExportHTML()
 )
 
 const (
@@ -36,6 +39,8 @@ type ScreenshotOptions struct {
 
 	ExportMode string
 	Filename   string
+
+	Err error // Set if writing the screenshot or export failed
 }
 
 type screenshotOutput struct {
@@ -46,6 +51,25 @@ type screenshotOutput struct {
 var activeScreenshotOutputs []screenshotOutput
 var activeScreenshot *ScreenshotOptions
 
+// exportBaseName returns the name the exported files of the Project are based on.
+func exportBaseName(project *Project) string {
+	if project.Filepath == "" {
+		return "Export"
+	}
+	name := filepath.Base(project.Filepath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// oneLine joins the lines of the text with spaces, for exports that only have room for a single line.
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// formatExportNumber formats the number as briefly as possible, without an exponent.
+func formatExportNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
 func TakeScreenshot(options *ScreenshotOptions) {
 
 	if options == nil {
@@ -342,56 +366,38 @@ func handleScreenshots() {
 						globals.EventLog.Log("Screenshot saved successfully to %s.", false, activeScreenshot.Filename)
 					}
 				} else {
+					activeScreenshot.Err = err
 					globals.EventLog.Log(err.Error(), true)
 				}
+			}
 
-			case ExportModePDF:
-
-				pagePath := activeScreenshot.Filename
-
-				projectName := ""
-
-				if globals.Project.Filepath != "" {
-
-					_, projectName = filepath.Split(globals.Project.Filepath)
-					if ind := strings.Index(projectName, filepath.Ext(projectName)); ind >= 0 {
-						projectName = projectName[:ind]
-					}
-
-				}
-
-				pagePath = filepath.Join(pagePath, projectName+"_Export.pdf")
+			activeScreenshot = nil // Handled
+			activeScreenshotOutputs = []screenshotOutput{}
+			globals.State = StateNeutral
 
-				pdf := gopdf.GoPdf{}
+		}
 
-				pdf.Start(gopdf.Config{})
-				pdf.SetNoCompression()
+	}
 
-				for _, img := range activeScreenshotOutputs {
-					pageWidth := float64(img.Screenshot.Bounds().Dx()) / 3
-					pageHeight := float64(img.Screenshot.Bounds().Dy()) / 3
-					pdf.AddPageWithOption(gopdf.PageOption{PageSize: &gopdf.Rect{W: pageWidth, H: pageHeight}})
-					pdf.ImageFrom(img.Screenshot, 0, 0, &gopdf.Rect{W: pageWidth, H: pageHeight})
+}
 
-				}
+// ExportHeadless loads the project at the given filepath into a hidden window and exports every page of it, as Tools > Export does. It's used
+// by the export command, and returns once the export is finished.
+func ExportHeadless(filename, passphrase string, options *ScreenshotOptions) error {
 
-				if err := pdf.WritePdf(pagePath); err != nil {
-					globals.EventLog.Log(err.Error(), true)
-				} else {
-					if activeScreenshot.Exporting {
-						globals.EventLog.Log("Project successfully exported in [%s] format to folder: %s.", false, activeScreenshot.ExportMode, activeScreenshot.Filename)
-					} else {
-						globals.EventLog.Log("Screenshot saved successfully to %s.", false, activeScreenshot.Filename)
-					}
-				}
-			}
+	closeHeadless, err := LoadHeadless(filename, passphrase)
+	if err != nil {
+		return err
+	}
 
-			activeScreenshot = nil // Handled
-			activeScreenshotOutputs = []screenshotOutput{}
-			globals.State = StateNeutral
+	defer closeHeadless()
 
-		}
+	TakeScreenshot(options)
 
+	for activeScreenshot != nil {
+		handleScreenshots()
 	}
 
+	return options.Err
+
 }
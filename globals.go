@@ -28,8 +28,9 @@ const (
 )
 
 type Globals struct {
-	Project                  *Project
-	NextProject              *Project
+	Project                  *Project   // The Project being shown (the current tab)
+	NextProject              *Project   // A Project being loaded, to be opened on the next frame (see OpenProjectTab())
+	Projects                 []*Project // All open Projects, in tab order
 	Window                   *sdl.Window
 	WindowTransparency       float64
 	WindowTargetTransparency float64
@@ -79,10 +80,11 @@ type Globals struct {
 
 	Dispatcher *Dispatcher
 
-	Hierarchy *Hierarchy
+	HierarchyContainer *Container // Each Project has its own Hierarchy; they're shown in this Container
 
 	editingLabel    *Label
 	editingCard     *Card
+	linkingCard     *Card // The Link Card choosing its target; it can be in a different Project than the target
 	textEditingWrap *Property
 
 	DrawOnTop DrawOnTop
@@ -26,6 +26,7 @@ require (
 	github.com/tidwall/sjson v1.2.4
 	github.com/veandco/go-sdl2 v0.4.40
 	golang.design/x/clipboard v0.6.0
+	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
 )
 
 require (
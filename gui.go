@@ -91,8 +91,10 @@ func getThemeColor(colorConstant string) Color {
 
 func refreshThemes() {
 	globals.MenuSystem.Recreate()
-	globals.Project.CreateGridTexture()
-	globals.Project.SendMessage(NewMessage(MessageThemeChange, nil, nil))
+	for _, project := range globals.Projects {
+		project.CreateGridTexture()
+		project.SendMessage(NewMessage(MessageThemeChange, nil, nil))
+	}
 }
 
 func loadThemes() {
@@ -2782,6 +2784,14 @@ func (row *ContainerRow) Destroy() {
 	}
 }
 
+// Clear destroys and removes all of the ContainerRow's elements, so it can be filled again.
+func (row *ContainerRow) Clear() {
+	row.Destroy()
+	row.Elements = map[string]MenuElement{}
+	row.ElementOrder = []MenuElement{}
+	row.ExpandElementSet.SelectNone()
+}
+
 type Container struct {
 	Rect             *sdl.FRect
 	Rows             []*ContainerRow
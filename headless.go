@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// LoadHeadless opens the project at the given filepath (read-only) in a hidden window, so commands can work with it as MasterPlan does
+// without a display. The returned function closes it again.
+func LoadHeadless(filename, passphrase string) (func(), error) {
+
+	loadThemes()
+
+	globals.EventLog = NewEventLog()
+
+	window, _, err := InitGraphics(true)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start renderer: %w", err)
+	}
+
+	closeHeadless := func() {
+		for _, project := range globals.Projects {
+			project.Destroy()
+		}
+		globals.Resources.Destroy()
+		window.Destroy()
+		sdl.Quit()
+	}
+
+	model, bundleMediaDir, err := readProjectModel(filename, passphrase)
+	if err != nil {
+		closeHeadless()
+		return nil, err
+	}
+
+	LoadProjectModel(model, filename, bundleMediaDir)
+
+	project := globals.NextProject
+	project.ReadOnly = true // Commands don't write backups or journals next to the project
+	globals.NextProject = nil
+	OpenProjectTab(project)
+
+	// Online images download in the background, so we give them some time to finish (updating the project in the meantime, like the
+	// main loop would, which also lays out stacks) before carrying on.
+	deadline := time.Now().Add(30 * time.Second)
+
+	for frame := 0; frame < 2 || (!resourcesDownloaded() && time.Now().Before(deadline)); frame++ {
+		handleEvents()
+		globals.Project.Update()
+		time.Sleep(time.Second / 60)
+	}
+
+	return closeHeadless, nil
+
+}
+
+// resourcesDownloaded returns if all Resources have finished downloading.
+func resourcesDownloaded() bool {
+	for _, resource := range globals.Resources {
+		if !resource.FinishedDownloading() {
+			return false
+		}
+	}
+	return true
+}
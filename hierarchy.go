@@ -98,13 +98,13 @@ func (hier *Hierarchy) Rows(sorting, filter int) []*ContainerRow {
 
 	rows := []*ContainerRow{}
 
-	for _, page := range globals.Hierarchy.OrderOfEntry {
+	for _, page := range hier.OrderOfEntry {
 
 		if !page.Project.HasOrphanPages && !page.Valid() {
 			continue
 		}
 
-		category := globals.Hierarchy.Categories[page]
+		category := hier.Categories[page]
 
 		rows = append(rows, category.UI)
 
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExportHTML returns the Project as a single, self-contained HTML page that can be viewed in a browser without MasterPlan, a server, or an
+// internet connection. Every Page is drawn as an SVG element (see svgElement()) that can be panned by dragging and zoomed with the mouse
+// wheel. Sub-Page Cards go to their sub-pages, Link Cards go to their targets, and a sidebar lists the Pages and the Cards with deadlines.
+// Completed or incomplete Cards can be hidden.
+func ExportHTML(project *Project, backgroundOption int) string {
+
+	pages, parents := exportPageTree(project)
+
+	// Sub-Page Cards go to their Page's section, and Link Cards to their target within it, through the URL's fragment (like "#page-2:card-5").
+	href := func(card *Card, target *Page) string {
+		if card.ContentType == ContentTypeLink {
+			return fmt.Sprintf("#page-%d:card-%d", target.ID, int64(card.Properties.Get("target").AsFloat()))
+		}
+		return fmt.Sprintf("#page-%d", target.ID)
+	}
+
+	doc := &strings.Builder{}
+
+	doc.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	doc.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(doc, "<meta name=\"generator\" content=\"MasterPlan %s\">\n", globals.Version.String())
+	fmt.Fprintf(doc, "<title>%s</title>\n", html.EscapeString(exportBaseName(project)))
+
+	doc.WriteString("<style>\n")
+
+	// The font's embedded so text is drawn (and wrapped) as it is in MasterPlan, even if the viewer doesn't have it.
+	fontPath := globals.LoadedFontPath
+	if fontPath == "" {
+		fontPath = LocalRelativePath("assets/NotoSans-Bold.ttf")
+	}
+	if font, err := os.ReadFile(fontPath); err == nil {
+		fontType := "font/ttf"
+		if strings.ToLower(filepath.Ext(fontPath)) == ".otf" {
+			fontType = "font/otf"
+		}
+		fmt.Fprintf(doc, "@font-face { font-family: \"Noto Sans\"; font-weight: bold; src: url(data:%s;base64,%s); }\n", fontType, base64.StdEncoding.EncodeToString(font))
+	}
+
+	background := "transparent"
+	if backgroundOption != BackgroundTransparent {
+		background = htmlColor(getThemeColor(GUIBGColor))
+	}
+
+	fmt.Fprintf(doc, ":root { --background: %s; --menu: %s; --font: %s; --highlight: %s; }\n",
+		background, htmlColor(getThemeColor(GUIMenuColor)), htmlColor(getThemeColor(GUIFontColor)), htmlColor(getThemeColor(GUICompletedColor)))
+	doc.WriteString(htmlStyle)
+	doc.WriteString("</style>\n</head>\n")
+
+	doc.WriteString("<body class=\"show-all\">\n<header>\n<nav id=\"path\"></nav>\n")
+	doc.WriteString("<select id=\"filter\" title=\"Which cards to show\"><option value=\"all\">All Cards</option><option value=\"incomplete\">Incomplete Cards</option><option value=\"completed\">Completed Cards</option></select>\n")
+	doc.WriteString("<button id=\"zoom-out\" title=\"Zoom Out\">&minus;</button><button id=\"zoom-fit\" title=\"Fit Page\">Fit</button><button id=\"zoom-in\" title=\"Zoom In\">+</button>\n")
+	doc.WriteString("</header>\n<aside>\n<h2>Pages</h2>\n")
+
+	children := map[*Page][]*Page{}
+	for _, page := range pages {
+		children[parents[page]] = append(children[parents[page]], page)
+	}
+
+	var writeTree func(parent *Page)
+	writeTree = func(parent *Page) {
+		doc.WriteString("<ul>\n")
+		for _, page := range children[parent] {
+			fmt.Fprintf(doc, "<li><a href=\"#page-%d\">%s</a>\n", page.ID, html.EscapeString(oneLine(page.Name())))
+			if len(children[page]) > 0 {
+				writeTree(page)
+			}
+			doc.WriteString("</li>\n")
+		}
+		doc.WriteString("</ul>\n")
+	}
+
+	writeTree(nil)
+
+	deadlineCards := []*Card{}
+	for _, page := range pages {
+		for _, card := range page.Cards {
+			if card.Valid && card.Completable() && card.Properties.Has("deadline") {
+				deadlineCards = append(deadlineCards, card)
+			}
+		}
+	}
+
+	sort.SliceStable(deadlineCards, func(i, j int) bool {
+		return deadlineCards[i].Properties.Get("deadline").AsString() < deadlineCards[j].Properties.Get("deadline").AsString()
+	})
+
+	if len(deadlineCards) > 0 {
+
+		doc.WriteString("<h2>Deadlines</h2>\n<ul class=\"deadlines\">\n")
+
+		for _, card := range deadlineCards {
+
+			class := "completed"
+			switch card.DeadlineState() {
+			case DeadlineStateOverdue:
+				class = "incomplete overdue"
+			case DeadlineStateDueToday:
+				class = "incomplete due-today"
+			case DeadlineStateTimeRemains:
+				class = "incomplete upcoming"
+			}
+
+			deadline := card.Properties.Get("deadline").AsString()
+			if text := card.DeadlineText(); text != "" {
+				deadline = text
+			}
+
+			fmt.Fprintf(doc, "<li class=\"%s\"><a href=\"#page-%d:card-%d\">%s</a><span>%s &middot; %s</span></li>\n", class, card.Page.ID, card.ID,
+				html.EscapeString(oneLine(card.Name())), html.EscapeString(oneLine(card.Page.Name())), html.EscapeString(deadline))
+
+		}
+
+		doc.WriteString("</ul>\n")
+
+	}
+
+	doc.WriteString("</aside>\n<main>\n")
+
+	for _, page := range pages {
+		parent := ""
+		if parents[page] != nil {
+			parent = fmt.Sprintf("%d", parents[page].ID)
+		}
+		fmt.Fprintf(doc, "<section class=\"page\" id=\"page-%d\" data-name=\"%s\" data-parent=\"%s\" hidden>\n", page.ID, html.EscapeString(oneLine(page.Name())), parent)
+		doc.WriteString(svgElement(page, backgroundOption, fmt.Sprintf("grid-%d", page.ID), href))
+		doc.WriteString("</section>\n")
+	}
+
+	doc.WriteString("</main>\n<script>\n")
+	doc.WriteString(htmlScript)
+	doc.WriteString("</script>\n</body>\n</html>\n")
+
+	return doc.String()
+
+}
+
+// WriteHTMLFile exports the Project as an HTML page (see ExportHTML()) to the given directory.
+func WriteHTMLFile(project *Project, backgroundOption int, dir string) error {
+	return os.WriteFile(filepath.Join(dir, exportBaseName(project)+"_Export.html"), []byte(ExportHTML(project, backgroundOption)), 0644)
+}
+
+// ExportHTMLHeadless loads the project at the given filepath without showing it and writes it as an HTML page to the given directory. It's
+// used by the export command.
+func ExportHTMLHeadless(filename, passphrase string, backgroundOption int, dir string) error {
+
+	closeHeadless, err := LoadHeadless(filename, passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer closeHeadless()
+
+	return WriteHTMLFile(globals.Project, backgroundOption, dir)
+
+}
+
+func htmlColor(color Color) string {
+	return fmt.Sprintf("rgba(%d, %d, %d, %.2f)", color[0], color[1], color[2], float32(color[3])/255)
+}
+
+const htmlStyle = `
+* { box-sizing: border-box; }
+html, body { margin: 0; height: 100%; overflow: hidden; }
+body { display: grid; grid-template-columns: 16em 1fr; grid-template-rows: auto 1fr; font: bold 14px "Noto Sans", sans-serif; color: var(--font); background: var(--menu); }
+header { grid-column: 1 / 3; display: flex; align-items: center; gap: 6px; padding: 6px 8px; border-bottom: 2px solid var(--font); }
+header nav { flex: 1; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+header nav a + a::before { content: "/"; margin: 0 0.5em; color: var(--font); opacity: 0.5; }
+button, select { font: inherit; color: var(--font); background: var(--background); border: 2px solid var(--font); border-radius: 4px; padding: 2px 10px; cursor: pointer; }
+a { color: var(--font); }
+aside { overflow: auto; padding: 0 8px 8px; border-right: 2px solid var(--font); }
+aside h2 { font-size: 1em; margin: 1em 0 0.5em; opacity: 0.7; }
+aside ul { list-style: none; margin: 0; padding-left: 1em; }
+aside > ul { padding-left: 0; }
+aside li { margin: 0.25em 0; }
+aside li.current > a { text-decoration: none; background: var(--highlight); border-radius: 4px; padding: 0 4px; }
+.deadlines span { display: block; font-size: 0.85em; opacity: 0.7; }
+.deadlines .overdue span, .deadlines .due-today span { opacity: 1; color: var(--highlight); }
+main { position: relative; overflow: hidden; background: var(--background); }
+section.page { position: absolute; inset: 0; }
+section.page svg { display: block; width: 100%; height: 100%; cursor: grab; touch-action: none; user-select: none; }
+section.page svg.dragging { cursor: grabbing; }
+section.page svg a { cursor: pointer; }
+body.show-incomplete .completed, body.show-completed .incomplete, .link.hidden { display: none; }
+.card.focused { animation: focused 0.5s ease-in-out 3; }
+@keyframes focused { 50% { opacity: 0.25; } }
+`
+
+const htmlScript = `(function () {
+
+	"use strict";
+
+	var sections = {};
+	var root = null;
+	var current = null;
+
+	document.querySelectorAll("section.page").forEach(function (section) {
+		sections[section.id] = section;
+		root = root || section;
+		var svg = section.querySelector("svg");
+		var title = svg.querySelector("title");
+		if (title) {
+			svg.removeChild(title); // Otherwise it'd be shown as a tooltip everywhere
+		}
+		var box = svg.viewBox.baseVal;
+		section.home = { x: box.x, y: box.y, width: box.width, height: box.height };
+		setupPanZoom(svg);
+	});
+
+	function setView(svg, view) {
+		svg.setAttribute("viewBox", [view.x, view.y, view.width, view.height].join(" "));
+	}
+
+	function getView(svg) {
+		var box = svg.viewBox.baseVal;
+		return { x: box.x, y: box.y, width: box.width, height: box.height };
+	}
+
+	// toWorld returns where the point on the screen is in the page's coordinates.
+	function toWorld(svg, x, y) {
+		var point = svg.createSVGPoint();
+		point.x = x;
+		point.y = y;
+		return point.matrixTransform(svg.getScreenCTM().inverse());
+	}
+
+	// zoom scales the view around the given point in the page's coordinates; factors above 1 zoom out.
+	function zoom(svg, factor, center) {
+		var view = getView(svg);
+		if (!center) {
+			center = { x: view.x + view.width / 2, y: view.y + view.height / 2 };
+		}
+		setView(svg, {
+			x: center.x - (center.x - view.x) * factor,
+			y: center.y - (center.y - view.y) * factor,
+			width: view.width * factor,
+			height: view.height * factor
+		});
+	}
+
+	function setupPanZoom(svg) {
+
+		var drag = null;
+
+		svg.addEventListener("pointerdown", function (event) {
+			if (event.button !== 0) {
+				return;
+			}
+			drag = { x: event.clientX, y: event.clientY, view: getView(svg), scale: svg.getScreenCTM().a, moved: false, pointer: event.pointerId };
+		});
+
+		svg.addEventListener("pointermove", function (event) {
+			if (!drag || event.pointerId !== drag.pointer) {
+				return;
+			}
+			var dx = event.clientX - drag.x;
+			var dy = event.clientY - drag.y;
+			if (!drag.moved && Math.abs(dx) + Math.abs(dy) > 4) {
+				drag.moved = true;
+				svg.setPointerCapture(drag.pointer);
+				svg.classList.add("dragging");
+			}
+			if (drag.moved) {
+				setView(svg, { x: drag.view.x - dx / drag.scale, y: drag.view.y - dy / drag.scale, width: drag.view.width, height: drag.view.height });
+			}
+		});
+
+		function endDrag(event) {
+			if (drag && event.pointerId === drag.pointer) {
+				svg.classList.remove("dragging");
+				if (!drag.moved) {
+					drag = null;
+				}
+			}
+		}
+
+		svg.addEventListener("pointerup", endDrag);
+		svg.addEventListener("pointercancel", endDrag);
+
+		// A click at the end of a drag shouldn't follow the link it ends on.
+		svg.addEventListener("click", function (event) {
+			if (drag && drag.moved) {
+				event.preventDefault();
+				event.stopPropagation();
+			}
+			drag = null;
+		}, true);
+
+		svg.addEventListener("wheel", function (event) {
+			event.preventDefault();
+			var delta = event.deltaY * (event.deltaMode === 1 ? 16 : 1);
+			zoom(svg, Math.pow(1.0015, Math.max(-200, Math.min(200, delta))), toWorld(svg, event.clientX, event.clientY));
+		}, { passive: false });
+
+	}
+
+	function currentSVG() {
+		return current ? current.querySelector("svg") : null;
+	}
+
+	// focusCard centers the view on the card, and flashes it.
+	function focusCard(id) {
+		var card = document.getElementById("card-" + id);
+		var svg = currentSVG();
+		if (!card || !current.contains(card)) {
+			return;
+		}
+		var box = card.getBBox();
+		var view = getView(svg);
+		setView(svg, { x: box.x + box.width / 2 - view.width / 2, y: box.y + box.height / 2 - view.height / 2, width: view.width, height: view.height });
+		card.classList.remove("focused");
+		card.getBoundingClientRect(); // Restarts the animation if it's already running
+		card.classList.add("focused");
+	}
+
+	function updatePath() {
+		var path = document.getElementById("path");
+		path.innerHTML = "";
+		var links = [];
+		for (var section = current; section; section = sections["page-" + section.dataset.parent]) {
+			var link = document.createElement("a");
+			link.href = "#" + section.id;
+			link.textContent = section.dataset.name;
+			links.unshift(link);
+		}
+		links.forEach(function (link) {
+			path.appendChild(link);
+		});
+		document.querySelectorAll("aside li").forEach(function (item) {
+			var link = item.querySelector("a");
+			item.classList.toggle("current", link.getAttribute("href") === "#" + current.id);
+		});
+	}
+
+	// show shows the page (and card) in the URL's fragment, like "#page-2" or "#page-2:card-5".
+	function show() {
+		var match = /^#(page-\d+)(?::card-(-?\d+))?$/.exec(location.hash);
+		var section = (match && sections[match[1]]) || root;
+		if (section !== current) {
+			if (current) {
+				current.hidden = true;
+			}
+			current = section;
+			current.hidden = false;
+			updatePath();
+			updateLinks();
+		}
+		if (match && match[2]) {
+			focusCard(match[2]);
+		}
+	}
+
+	// updateLinks hides the links between cards that are hidden.
+	function updateLinks() {
+		if (!current) {
+			return;
+		}
+		current.querySelectorAll(".link").forEach(function (link) {
+			var start = document.getElementById("card-" + link.dataset.start);
+			var end = document.getElementById("card-" + link.dataset.end);
+			var hidden = (start && getComputedStyle(start).display === "none") || (end && getComputedStyle(end).display === "none");
+			link.classList.toggle("hidden", !!hidden);
+		});
+	}
+
+	var filter = document.getElementById("filter");
+
+	function updateFilter() {
+		document.body.className = "show-" + filter.value;
+		updateLinks();
+	}
+
+	filter.addEventListener("change", updateFilter);
+
+	document.getElementById("zoom-in").addEventListener("click", function () {
+		zoom(currentSVG(), 1 / 1.25);
+	});
+
+	document.getElementById("zoom-out").addEventListener("click", function () {
+		zoom(currentSVG(), 1.25);
+	});
+
+	document.getElementById("zoom-fit").addEventListener("click", function () {
+		setView(currentSVG(), current.home);
+	});
+
+	window.addEventListener("hashchange", show);
+
+	// Following a link to where the URL already is doesn't change it, but should still focus on the card again.
+	document.addEventListener("click", function (event) {
+		var link = event.target.closest("a");
+		if (link && !event.defaultPrevented && (link.getAttribute("href") || link.getAttribute("xlink:href")) === location.hash) {
+			show();
+		}
+	});
+
+	show();
+	updateFilter();
+
+})();
+`
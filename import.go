@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// ImportFileFilters are the kinds of files the Import action can open.
+var ImportFileFilters = []string{"*.md", "*.markdown", "*.txt", "*.opml", "*.csv", "*.tsv", "*.ics"}
+
+// ImportFile imports the file at the given path into the current Page of the current Project, placing the new Cards at the center of the
+// view. What it's imported as depends on its extension.
+func ImportFile(filename string) error {
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	page := globals.Project.CurrentPage
+	pos := globals.Project.Camera.Position.LockToGrid()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+
+	case ".md", ".markdown", ".txt":
+		cards := page.ImportOutline(string(data), pos)
+		if len(cards) == 0 {
+			return fmt.Errorf("no cards found in %s", filepath.Base(filename))
+		}
+		globals.EventLog.Log("Imported %d new Cards from %s.", false, len(cards), filepath.Base(filename))
+
+	case ".opml":
+		opml, err := plan.ParseOPML(data)
+		if err != nil {
+			return err
+		}
+		cards := page.ImportOPML(opml, pos, int(globals.Settings.Get(SettingsOPMLSubpageDepth).AsFloat()), filepath.Dir(filename))
+		globals.EventLog.Log("Imported %d new Cards from %s.", false, len(cards), filepath.Base(filename))
+
+	case ".csv", ".tsv":
+		return ImportTableFile(filename)
+
+	case ".ics":
+		entries, err := plan.ParseCalendar(data)
+		if err != nil {
+			return err
+		}
+		created, updated := page.ImportCalendar(entries, pos)
+		globals.EventLog.Log("Imported %d new Cards and updated %d from %s.", false, created, updated, filepath.Base(filename))
+
+	default:
+		return fmt.Errorf("can't import %s files", filepath.Ext(filename))
+
+	}
+
+	return nil
+
+}
+
+// ImportTableFile imports the CSV or TSV file at the given path into the current Page of the current Project as a Table (see
+// Page.ImportTable()), whatever its extension.
+func ImportTableFile(filename string) error {
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if _, err := globals.Project.CurrentPage.ImportTable(string(data), globals.Project.Camera.Position.LockToGrid()); err != nil {
+		return err
+	}
+
+	globals.EventLog.Log("Imported Table from %s.", false, filepath.Base(filename))
+
+	return nil
+
+}
+
+// ImportOutline creates a stack of Cards at the given position from Markdown or an indented outline (see plan.ParseOutline()), and selects
+// them. Tasks become Checkbox Cards, headings and paragraphs become Notes, and plain bullets become either, depending on the Import Bullets
+// As setting. Nested items are indented a grid space further in the stack. If the text isn't an outline, it's created as a single Note.
+func (page *Page) ImportOutline(text string, pos Point) []*Card {
+
+	items, ok := plan.ParseOutline(text)
+	if !ok {
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		items = []*plan.OutlineItem{{Kind: plan.OutlineText, Text: strings.TrimSpace(text)}}
+	}
+
+	bulletType := ContentTypeCheckbox
+	if globals.Settings.Get(SettingsImportBulletsAs).AsString() == ImportBulletsAsNotes {
+		bulletType = ContentTypeNote
+	}
+
+	globals.EventLog.On = false
+
+	cards := []*Card{}
+
+	for _, item := range items {
+
+		contentType := ContentTypeNote
+		if item.Kind == plan.OutlineTask || (item.Kind == plan.OutlineBullet && bulletType == ContentTypeCheckbox) {
+			contentType = ContentTypeCheckbox
+		}
+
+		card := page.CreateNewCard(contentType)
+		card.Rect.X = pos.X + float32(item.Depth)*globals.GridSize
+		card.Rect.Y = pos.Y
+		card.LockPosition()
+
+		card.Properties.Get("description").Set(item.Text)
+		card.FitToText(item.Text)
+
+		if item.Checked {
+			card.Properties.Get("checked").Set(true)
+		}
+
+		pos.Y += card.Rect.H
+		cards = append(cards, card)
+
+	}
+
+	globals.EventLog.On = true
+
+	page.Selection.Clear()
+	for _, card := range cards {
+		page.Selection.Add(card)
+	}
+
+	page.UpdateStacks = true
+
+	return cards
+
+}
+
+// ImportTable fills a Table Card from CSV or TSV data (see plan.ParseTableCSV()), and returns it. If a single Table Card is selected, it's
+// refilled; otherwise, a new Table Card is created at the given position. Numbers too big for the Table are lowered, with a warning.
+func (page *Page) ImportTable(data string, pos Point) (*Card, error) {
+
+	td, clamped, err := plan.ParseTableCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if clamped > 0 {
+		globals.EventLog.Log("Warning: %d cell(s) held numbers outside of 0 to %d, and were set to the closest of those.", true, clamped, plan.ValueDisplayModeSizes[plan.ValueDisplayModeNumber]-1)
+	}
+
+	selected := page.Selection.AsSlice()
+
+	var card *Card
+
+	if len(selected) == 1 && selected[0].ContentType == ContentTypeTable {
+		card = selected[0]
+	} else {
+		card = page.CreateNewCard(ContentTypeTable)
+		card.Rect.X = pos.X
+		card.Rect.Y = pos.Y
+		page.Selection.Clear()
+		page.Selection.Add(card)
+	}
+
+	card.Contents.(*TableContents).SetData(td.Serialize())
+	card.LockPosition()
+
+	page.UpdateStacks = true
+
+	return card, nil
+
+}
+
+// ImportCalendar creates a stack of Checkbox Cards at the given position from calendar events and to-dos, in the order given (see
+// plan.ParseCalendar()), and selects them. Each Card's description is the entry's summary, its deadline is the entry's date, and it's checked
+// if it's a completed to-do. Cards keep the UID of the entry they came from, so entries that were imported before update their Cards
+// (wherever they are in the Project) instead of creating new ones. It returns how many Cards were created and updated.
+func (page *Page) ImportCalendar(entries []*plan.CalendarEntry, pos Point) (created, updated int) {
+
+	imported := map[string]*Card{}
+	for _, p := range page.Project.Pages {
+		for _, card := range p.Cards {
+			if card.Valid && card.Properties.Has("calendar uid") {
+				imported[card.Properties.Get("calendar uid").AsString()] = card
+			}
+		}
+	}
+
+	globals.EventLog.On = false
+
+	page.Selection.Clear()
+
+	for _, entry := range entries {
+
+		card := imported[entry.UID]
+		isNew := card == nil
+
+		if isNew {
+
+			card = page.CreateNewCard(ContentTypeCheckbox)
+			card.Rect.X = pos.X
+			card.Rect.Y = pos.Y
+			card.LockPosition()
+
+			if entry.UID != "" {
+				card.Properties.Get("calendar uid").Set(entry.UID)
+				imported[entry.UID] = card
+			}
+
+			created++
+
+		} else {
+			updated++
+		}
+
+		card.Properties.Get("description").Set(entry.Summary)
+
+		if !entry.Date.IsZero() {
+			card.Properties.Get("deadline").Set(entry.Date.Format(plan.DeadlineFormat))
+		}
+
+		if entry.Todo && card.ContentType == ContentTypeCheckbox {
+			card.Properties.Get("checked").Set(entry.Completed)
+		}
+
+		if isNew {
+			card.FitToText(entry.Summary)
+			pos.Y += card.Rect.H
+		} else {
+			card.Page.Project.UndoHistory.Capture(NewUndoState(card))
+		}
+
+		if card.Page == page {
+			page.Selection.Add(card)
+		}
+
+	}
+
+	globals.EventLog.On = true
+
+	page.UpdateStacks = true
+	page.Project.SetModifiedState()
+
+	return created, updated
+
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// A running MasterPlan instance listens on a per-user Unix domain socket, so commands run from the command line can hand their work off to
+// it (rather than editing a project file it has open, and then having their changes overwritten when it saves). Each connection carries one
+// request, as a line of JSON, and gets one response back. Requests are handled on the main thread, between frames (see callOnMainThread()).
+
+// InstanceRequest is a command sent to the running instance.
+type InstanceRequest struct {
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+// InstanceResponse is the running instance's reply to an InstanceRequest.
+type InstanceResponse struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// ErrNoInstance is returned by SendInstanceRequest() if there's no running instance to send the request to.
+var ErrNoInstance = errors.New("no running instance")
+
+// ErrInstanceProjectNotOpen is returned by handlers (and so by SendInstanceRequest()) for requests about projects the instance doesn't have
+// open; they can be edited on disk instead.
+var ErrInstanceProjectNotOpen = errors.New("project isn't open")
+
+// instanceTimeout is how long a request may take, from connecting to getting the response.
+const instanceTimeout = 10 * time.Second
+
+// instanceHandlers handle requests by command name, returning a result to be encoded as JSON.
+var instanceHandlers = map[string]func(args json.RawMessage) (interface{}, error){}
+
+var instanceListener net.Listener
+
+// mainThreadCalls are functions to run on the main thread, between frames. Requests that come in on other goroutines (from the control
+// socket or the local API) are handled through it, as the Projects can only be touched from the main thread.
+var mainThreadCalls = make(chan *mainThreadCall, 16)
+
+const (
+	mainThreadCallQueued = iota
+	mainThreadCallRunning
+	mainThreadCallCancelled
+)
+
+// mainThreadCall is a function queued with callOnMainThread(). Its state is changed atomically, so a call that timed out before it started
+// is never run, and one that started is always waited for.
+type mainThreadCall struct {
+	Call  func()
+	State int32
+	Done  chan struct{}
+}
+
+// callOnMainThread runs the function on the main thread, waiting for it to finish. It returns false if it didn't start in time, in which
+// case it won't be run at all; once it's started, it's waited for, however long it takes.
+func callOnMainThread(call func()) bool {
+
+	queued := &mainThreadCall{Call: call, Done: make(chan struct{})}
+	timeout := time.After(instanceTimeout)
+
+	select {
+	case mainThreadCalls <- queued:
+	case <-timeout:
+		return false
+	}
+
+	select {
+	case <-queued.Done:
+		return true
+	case <-timeout:
+		if atomic.CompareAndSwapInt32(&queued.State, mainThreadCallQueued, mainThreadCallCancelled) {
+			return false
+		}
+		<-queued.Done
+		return true
+	}
+
+}
+
+// RunMainThreadCalls runs the functions queued with callOnMainThread() since the last frame, skipping any that timed out while they were
+// waiting. It's called once a frame, from the main loop.
+func RunMainThreadCalls() {
+	for {
+		select {
+		case queued := <-mainThreadCalls:
+			if atomic.CompareAndSwapInt32(&queued.State, mainThreadCallQueued, mainThreadCallRunning) {
+				queued.Call()
+				close(queued.Done)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// InstanceSocketPath returns the path of the running instance's control socket.
+func InstanceSocketPath() (string, error) {
+	return xdg.RuntimeFile("masterplan/instance.sock")
+}
+
+// StartInstanceServer starts listening for requests on the control socket, unless another instance is already listening on it.
+func StartInstanceServer() error {
+
+	socketPath, err := InstanceSocketPath()
+	if err != nil {
+		return err
+	}
+
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another instance is listening on %s", socketPath)
+	}
+
+	// Nothing's listening, so the socket's left over from an instance that crashed.
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	instanceListener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveInstanceConnection(conn)
+		}
+	}()
+
+	return nil
+
+}
+
+// StopInstanceServer stops listening for requests, removing the control socket.
+func StopInstanceServer() {
+	if instanceListener != nil {
+		instanceListener.Close() // Removes the socket file as well
+		instanceListener = nil
+	}
+}
+
+func serveInstanceConnection(conn net.Conn) {
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(instanceTimeout))
+
+	response := &InstanceResponse{}
+	request := &InstanceRequest{}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+
+	if err == nil {
+		err = json.Unmarshal(line, request)
+	}
+
+	if err != nil {
+		response.Error = "couldn't read request: " + err.Error()
+	} else {
+
+		handled := make(chan *InstanceResponse, 1)
+
+		if callOnMainThread(func() { handled <- handleInstanceRequest(request) }) {
+			response = <-handled
+		} else {
+			response.Error = "timed out waiting for the request to be handled"
+		}
+
+	}
+
+	// The request may have taken longer than the deadline to finish if it started just before it.
+	conn.SetWriteDeadline(time.Now().Add(instanceTimeout))
+
+	data, _ := json.Marshal(response)
+	conn.Write(append(data, '\n'))
+
+}
+
+// handleInstanceRequest handles a request on the main thread.
+func handleInstanceRequest(request *InstanceRequest) *InstanceResponse {
+
+	response := &InstanceResponse{}
+
+	if handler, exists := instanceHandlers[request.Command]; !exists {
+		response.Error = "unknown command " + request.Command
+	} else if result, err := handler(request.Args); err != nil {
+		response.Error = err.Error()
+	} else if response.Result, err = json.Marshal(result); err != nil {
+		response.Error = err.Error()
+	} else {
+		response.OK = true
+	}
+
+	return response
+
+}
+
+// SendInstanceRequest sends a request to the running instance, decoding the result into the given value (if it's not nil). ErrNoInstance
+// is returned if there's no running instance.
+func SendInstanceRequest(command string, args interface{}, result interface{}) error {
+
+	socketPath, err := InstanceSocketPath()
+	if err != nil {
+		return ErrNoInstance
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return ErrNoInstance
+	}
+
+	defer conn.Close()
+
+	// The instance gives up on requests that haven't started within instanceTimeout, but waits for ones that have, so this waits longer
+	// to make sure the response to a request that was handled isn't missed.
+	conn.SetDeadline(time.Now().Add(instanceTimeout * 2))
+
+	request := &InstanceRequest{Command: command}
+
+	if request.Args, err = json.Marshal(args); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+
+	response := &InstanceResponse{}
+	if err := json.Unmarshal(line, response); err != nil {
+		return err
+	}
+
+	if !response.OK {
+		if response.Error == ErrInstanceProjectNotOpen.Error() {
+			return ErrInstanceProjectNotOpen
+		}
+		return errors.New(response.Error)
+	}
+
+	if result != nil && len(response.Result) > 0 {
+		return json.Unmarshal(response.Result, result)
+	}
+
+	return nil
+
+}
+
+func init() {
+	instanceHandlers["open"] = handleOpenRequest
+	instanceHandlers["focus"] = handleFocusRequest
+	instanceHandlers["set-property"] = handleSetPropertyRequest
+	instanceHandlers["trigger"] = handleTriggerRequest
+	instanceHandlers["screenshot"] = handleScreenshotRequest
+	instanceHandlers["save"] = handleSaveRequest
+}
+
+// instanceCardArgs are the arguments of requests about a Card (or, without one, a Project). An empty Project means the current one.
+type instanceCardArgs struct {
+	Project string `json:"project,omitempty"` // Absolute filepath
+	Card    int64  `json:"card"`
+}
+
+// instanceProject returns the open Project saved at the given filepath, or the current Project if it's empty.
+func instanceProject(filename string) (*Project, error) {
+
+	if filename == "" {
+		return globals.Project, nil
+	}
+
+	if project := ProjectTab(filename); project != nil {
+		return project, nil
+	}
+
+	return nil, ErrInstanceProjectNotOpen
+
+}
+
+// instanceCard returns the Card a request is about, and the Project it's in.
+func instanceCard(data json.RawMessage, args interface{}, cardArgs *instanceCardArgs) (*Project, *Card, error) {
+
+	if err := json.Unmarshal(data, args); err != nil {
+		return nil, nil, err
+	}
+
+	project, err := instanceProject(cardArgs.Project)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	card := project.CardByID(cardArgs.Card)
+	if card == nil || !card.Valid {
+		return nil, nil, fmt.Errorf("there's no card %d in %s", cardArgs.Card, TabName(project))
+	}
+
+	return project, card, nil
+
+}
+
+// handleOpenRequest opens a project (or switches to its tab, if it's open already), and brings the window to the front. This is how a
+// project opened by launching MasterPlan a second time is opened in the running instance.
+func handleOpenRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &instanceCardArgs{}
+	if err := json.Unmarshal(data, args); err != nil {
+		return nil, err
+	}
+
+	if !FileExists(args.Project) {
+		return nil, fmt.Errorf("%s doesn't exist", args.Project)
+	}
+
+	LoadProject(args.Project)
+	globals.Window.Raise()
+
+	return nil, nil
+
+}
+
+// handleFocusRequest switches to the Card's Page, selecting it and moving the camera to it. If the Card's project isn't open, it's opened.
+func handleFocusRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &instanceCardArgs{}
+	if err := json.Unmarshal(data, args); err != nil {
+		return nil, err
+	}
+
+	if args.Project != "" {
+		FocusCardInProject(args.Project, args.Card)
+	} else if card := globals.Project.CardByID(args.Card); card == nil || !card.Valid {
+		return nil, fmt.Errorf("there's no card %d in %s", args.Card, TabName(globals.Project))
+	} else {
+		globals.Project.FocusOnCard(args.Card)
+	}
+
+	globals.Window.Raise()
+
+	return nil, nil
+
+}
+
+// handleSetPropertyRequest sets a property of a Card to a string, number, or boolean; it has to be the type the property already is (see
+// Properties.CheckValue()). The change can be undone.
+func handleSetPropertyRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &struct {
+		instanceCardArgs
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}{}
+
+	project, card, err := instanceCard(data, args, &args.instanceCardArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if project.ReadOnly {
+		return nil, errors.New("the project is open read-only")
+	}
+
+	if args.Name == "" {
+		return nil, errors.New("no property name given")
+	}
+
+	if err := card.Properties.CheckValue(args.Name, args.Value); err != nil {
+		return nil, err
+	}
+
+	card.Properties.Get(args.Name).Set(args.Value)
+	project.UndoHistory.Capture(NewUndoState(card))
+	project.SetModifiedState()
+
+	return nil, nil
+
+}
+
+// handleTriggerRequest triggers a Link Card (jumping to its target or running its program, as activating it does) or a Timer Card (starting
+// or stopping it; "mode" can be "set" to start it, "clear" to stop it, or "toggle", the default).
+func handleTriggerRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &struct {
+		instanceCardArgs
+		Mode string `json:"mode"`
+	}{}
+
+	project, card, err := instanceCard(data, args, &args.instanceCardArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch card.ContentType {
+
+	case ContentTypeLink:
+
+		SwitchToProject(project)
+		link := card.Contents.(*LinkContents)
+		if card.Properties.Get("link mode").AsFloat() == 1 {
+			link.Run()
+		} else {
+			link.Jump()
+		}
+
+	case ContentTypeTimer:
+
+		switch args.Mode {
+		case "set":
+			card.Contents.Trigger(TriggerTypeSet)
+		case "clear":
+			card.Contents.Trigger(TriggerTypeClear)
+		case "toggle", "":
+			card.Contents.Trigger(TriggerTypeToggle)
+		default:
+			return nil, fmt.Errorf("unknown mode %s; it should be set, clear, or toggle", args.Mode)
+		}
+
+	default:
+		return nil, fmt.Errorf("card %d is a %s card; only Link and Timer cards can be triggered", card.ID, card.ContentType)
+
+	}
+
+	return nil, nil
+
+}
+
+// handleScreenshotRequest takes a screenshot of the Project's current view, the same way the screenshot shortcut does (so it's saved to the
+// screenshot folder, unless a filename is given). It's written over the next frame, after the response is sent.
+func handleScreenshotRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &struct {
+		instanceCardArgs
+		Filename string `json:"filename,omitempty"` // Absolute filepath of the PNG to write
+	}{}
+
+	if err := json.Unmarshal(data, args); err != nil {
+		return nil, err
+	}
+
+	project, err := instanceProject(args.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	SwitchToProject(project)
+
+	if args.Filename == "" {
+		TakeScreenshot(nil)
+	} else {
+		TakeScreenshot(&ScreenshotOptions{Filename: args.Filename, ExportMode: ExportModePNG})
+	}
+
+	return map[string]string{"filename": activeScreenshot.Filename}, nil
+
+}
+
+// handleSaveRequest saves the Project.
+func handleSaveRequest(data json.RawMessage) (interface{}, error) {
+
+	args := &instanceCardArgs{}
+	if err := json.Unmarshal(data, args); err != nil {
+		return nil, err
+	}
+
+	project, err := instanceProject(args.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	if project.Filepath == "" {
+		return nil, errors.New("the project hasn't been saved to a file yet")
+	}
+
+	project.Save()
+
+	if project.Modified {
+		return nil, errors.New("the project couldn't be saved; see MasterPlan's event log")
+	}
+
+	return map[string]string{"project": project.Filepath}, nil
+
+}
+
+func runControlCommand(command *Command, args []string) int {
+
+	flags := command.Flags()
+	if flags.Parse(args) != nil {
+		return 2
+	}
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+
+	requestArgs := json.RawMessage("{}")
+	if flags.NArg() == 2 {
+		requestArgs = json.RawMessage(flags.Arg(1))
+		if !json.Valid(requestArgs) {
+			fmt.Fprintf(os.Stderr, "The arguments should be a JSON object, like {\"card\": 12}.\n")
+			return 2
+		}
+	}
+
+	result := json.RawMessage{}
+
+	if err := SendInstanceRequest(flags.Arg(0), requestArgs, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't run %s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	if len(result) > 0 && string(result) != "null" {
+		fmt.Println(string(result))
+	}
+
+	return 0
+
+}
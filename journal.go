@@ -0,0 +1,231 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/ncruces/zenity"
+	"github.com/solarlune/masterplan/plan"
+)
+
+// pendingJournal is the journal offered to be recovered in the "recover journal" menu.
+var pendingJournal string
+
+// UnsavedJournalDirectory returns the directory journals of projects that haven't been saved yet are kept in, creating it if necessary.
+func UnsavedJournalDirectory() string {
+	dir := filepath.Join(xdg.DataHome, "MasterPlan", "journals")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Println("ERROR: Couldn't create journal directory: ", err.Error())
+	}
+	return dir
+}
+
+// journalChanges appends the given changes to the Project's journal, starting one if there isn't one yet. Journals of saved Projects are kept
+// next to the project file; otherwise, they're kept in the UnsavedJournalDirectory(). Encrypted Projects' journals are encrypted as well.
+func (project *Project) journalChanges(changes []plan.JournalChange) {
+
+	if project.Loading || project.ReadOnly || len(changes) == 0 {
+		return
+	}
+
+	if project.Journal == nil {
+
+		journalPath := ""
+		if project.Filepath != "" {
+			journalPath = plan.JournalPath(project.Filepath)
+		} else {
+			journalPath = filepath.Join(UnsavedJournalDirectory(), "untitled_"+time.Now().Format(FileTimeFormat)+plan.JournalExtension)
+		}
+
+		journal, err := plan.CreateJournal(journalPath, project.Filepath, project.Passphrase, project.Keys)
+		if err != nil {
+			log.Println("ERROR: Couldn't create journal: ", err.Error())
+			return
+		}
+
+		project.Journal = journal
+
+	}
+
+	if err := project.Journal.Append(changes...); err != nil {
+		log.Println("ERROR: Couldn't write to journal: ", err.Error())
+	}
+
+}
+
+// JournalFrame records the Card states of a committed UndoFrame in the Project's journal.
+func (project *Project) JournalFrame(frame *UndoFrame) {
+
+	changes := []plan.JournalChange{}
+
+	for card, state := range frame.States {
+		changes = append(changes, plan.JournalChange{
+			PageID:  card.Page.ID,
+			CardID:  card.ID,
+			Deleted: state.Deletion,
+			Card:    state.Serialized,
+		})
+	}
+
+	project.journalChanges(changes)
+
+}
+
+// JournalCards records the current states of the given Cards in the Project's journal (used after undoing or redoing, where the Cards
+// return to earlier states).
+func (project *Project) JournalCards(cards ...*Card) {
+
+	changes := []plan.JournalChange{}
+
+	for _, card := range cards {
+		change := plan.JournalChange{PageID: card.Page.ID, CardID: card.ID, Deleted: !card.Valid}
+		if card.Valid {
+			change.Card = card.Serialize(false)
+		}
+		changes = append(changes, change)
+	}
+
+	project.journalChanges(changes)
+
+}
+
+// RemoveJournal deletes the Project's journal; this is done once its changes are saved, or when they're discarded by closing the Project.
+func (project *Project) RemoveJournal() {
+	if project.Journal != nil {
+		if err := project.Journal.Remove(); err != nil && !os.IsNotExist(err) {
+			log.Println("ERROR: Couldn't remove journal: ", err.Error())
+		}
+		project.Journal = nil
+	}
+}
+
+// OwnsJournal returns if the journal at the given filepath is the one the Project is currently writing to.
+func (project *Project) OwnsJournal(journalPath string) bool {
+	return project != nil && project.Journal != nil && project.Journal.Path == journalPath
+}
+
+// JournalInUse returns if the journal at the given filepath is being written to by one of the open Projects (or one being loaded).
+func JournalInUse(journalPath string) bool {
+	for _, project := range globals.Projects {
+		if project.OwnsJournal(journalPath) {
+			return true
+		}
+	}
+	return globals.NextProject.OwnsJournal(journalPath)
+}
+
+// CheckForJournals looks for journals left behind by MasterPlan crashing - either of unsaved projects, or of recently opened projects - and
+// offers to recover the first one found.
+func CheckForJournals() {
+
+	candidates := FilesInDirectory(UnsavedJournalDirectory(), "untitled_")
+
+	for _, recent := range globals.RecentFiles {
+		candidates = append(candidates, plan.JournalPath(recent))
+	}
+
+	for _, journalPath := range candidates {
+
+		if !FileExists(journalPath) || JournalInUse(journalPath) {
+			continue
+		}
+
+		OfferJournalRecovery(journalPath)
+		return
+
+	}
+
+}
+
+// OfferJournalRecovery opens the menu offering to recover the changes in the journal at the given filepath.
+func OfferJournalRecovery(journalPath string) {
+	pendingJournal = journalPath
+	menu := globals.MenuSystem.Get("recover journal")
+	menu.Center()
+	menu.Open()
+}
+
+// RecoverJournal replays the journal at the given filepath on top of the last saved version of its project (or a new project, if it was
+// never saved) and opens the result. The recovered project keeps writing to the same journal, so nothing is lost if MasterPlan crashes again
+// before it's saved.
+func RecoverJournal(journalPath string) {
+
+	journal, err := plan.ReadJournal(journalPath)
+	if err != nil {
+		globals.EventLog.Log("Error: Couldn't read journal %s: %s", true, journalPath, err.Error())
+		return
+	}
+
+	model := plan.NewProject()
+	bundleMediaDir := ""
+
+	if journal.Project != "" {
+		if model, bundleMediaDir, err = openProjectModel(journal.Project, ""); err != nil {
+			globals.EventLog.Log("Error: Couldn't open %s to recover changes into: %s", true, journal.Project, err.Error())
+			return
+		}
+		AddFileToRecentFilesList(journal.Project)
+	}
+
+	if journal.Encrypted {
+		if err := decryptJournal(journal, model); err == zenity.ErrCanceled {
+			return
+		} else if err != nil {
+			globals.EventLog.Log("Error: Couldn't decrypt journal %s: %s", true, journalPath, err.Error())
+			return
+		}
+	}
+
+	journal.Replay(model)
+
+	if err := journal.Open(); err != nil {
+		log.Println("ERROR: Couldn't reopen journal: ", err.Error())
+	}
+
+	LoadProjectModel(model, journal.Project, bundleMediaDir)
+
+	globals.NextProject.Journal = journal
+	globals.NextProject.Modified = true
+
+	globals.EventLog.Log("Recovered %d unsaved change(s) from %s.", true, journal.ChangeCount(), journal.Created.Format("Jan 2 15:04"))
+
+}
+
+// decryptJournal decrypts the entries of the journal with the passphrase of the project they're recovered into, asking for it if the project
+// isn't encrypted (because it was never saved, for example) or its passphrase doesn't work. zenity.ErrCanceled is returned if asking was
+// canceled. The project takes the passphrase, so the journal's changes stay encrypted when it's saved.
+func decryptJournal(journal *plan.Journal, model *plan.Project) error {
+
+	if model.Keys == nil {
+		model.Keys = plan.NewKeys()
+	}
+
+	passphrase := model.Passphrase
+
+	for {
+
+		if passphrase != "" {
+			if err := journal.Decrypt(passphrase, model.Keys); err == nil {
+				model.Passphrase = passphrase
+				return nil
+			} else if err != plan.ErrWrongPassphrase {
+				return err
+			}
+		}
+
+		text := "The unsaved changes in " + filepath.Base(journal.Path) + " are encrypted. Enter their passphrase:"
+		if passphrase != "" {
+			text = "Wrong passphrase for the unsaved changes in " + filepath.Base(journal.Path) + ". Try again:"
+		}
+
+		var err error
+		if passphrase, err = AskPassphrase(text); err != nil {
+			return err
+		}
+
+	}
+
+}
@@ -141,6 +141,9 @@ const (
 	KBOpenDeadlinesMenu = "Main Menu: Open Deadlines Menu"
 	KBHelp              = "Main Menu: Open Help (website)"
 
+	KBNextTab = "Tabs: Next Project"
+	KBPrevTab = "Tabs: Prev. Project"
+
 	KBTableAddRow       = "Table: Add 1 Row"
 	KBTableAddColumn    = "Table: Add 1 Column"
 	KBTableDeleteRow    = "Table: Remove 1 Row"
@@ -574,6 +577,9 @@ func (kb *Keybindings) Default() {
 	kb.DefineKeyShortcut(KBOpenStatsMenu, sdl.K_F5)
 	kb.DefineKeyShortcut(KBOpenDeadlinesMenu, sdl.K_F6)
 
+	kb.DefineKeyShortcut(KBNextTab, sdl.K_TAB, sdl.K_LCTRL)
+	kb.DefineKeyShortcut(KBPrevTab, sdl.K_TAB, sdl.K_LCTRL, sdl.K_LSHIFT)
+
 	kb.DefineKeyShortcut(KBTableAddColumn, sdl.K_e)
 	kb.DefineKeyShortcut(KBTableDeleteColumn, sdl.K_e, sdl.K_LSHIFT)
 	kb.DefineKeyShortcut(KBTableAddRow, sdl.K_q)
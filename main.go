@@ -27,10 +27,12 @@ import (
 	"github.com/hako/durafmt"
 	"github.com/ncruces/zenity"
 	"github.com/pkg/browser"
+	"github.com/solarlune/masterplan/plan"
 	"github.com/veandco/go-sdl2/gfx"
 	"github.com/veandco/go-sdl2/img"
 	"github.com/veandco/go-sdl2/sdl"
 	"github.com/veandco/go-sdl2/ttf"
+	"golang.design/x/clipboard"
 
 	_ "github.com/silbinarywolf/preferdiscretegpu"
 )
@@ -47,7 +49,7 @@ func init() {
 
 	runtime.LockOSThread()
 
-	globals.Version = semver.MustParse("0.8.0-alpha.8.1")
+	globals.Version = semver.MustParse(plan.Version)
 	globals.Keyboard = NewKeyboard()
 	globals.Mouse = NewMouse()
 	nm := NewMouse()
@@ -76,6 +78,18 @@ func init() {
 
 func main() {
 
+	// Command-line commands (e.g. "masterplan merge ...") run without opening a window, and before output is redirected to the log.
+	if exitCode, ran := RunCommand(os.Args[1:]); ran {
+		os.Exit(exitCode)
+	}
+
+	// If MasterPlan's already running, a project passed to it is opened there, rather than in a new window.
+	if len(os.Args) > 1 {
+		if projectPath, err := filepath.Abs(os.Args[1]); err == nil && SendInstanceRequest("open", &instanceCardArgs{Project: projectPath}, nil) == nil {
+			os.Exit(0)
+		}
+	}
+
 	// We want this here because releaseMode can change because of build tags, so we want to be sure all init() functions run to ensure the releaseMode variable is accurate
 	if globals.ReleaseMode != ReleaseModeDev {
 
@@ -170,109 +184,11 @@ func main() {
 
 	globals.EventLog = NewEventLog()
 
-	x := int32(sdl.WINDOWPOS_UNDEFINED)
-	y := int32(sdl.WINDOWPOS_UNDEFINED)
-	w := int32(960)
-	h := int32(540)
-
-	if globals.Settings.Get(SettingsSaveWindowPosition).AsBool() && globals.Settings.Has(SettingsWindowPosition) {
-		windowData := globals.Settings.Get(SettingsWindowPosition).AsMap()
-		x = int32(windowData["X"].(float64))
-		y = int32(windowData["Y"].(float64))
-		w = int32(windowData["W"].(float64))
-		h = int32(windowData["H"].(float64))
-	}
-
-	windowFlags := uint32(sdl.WINDOW_RESIZABLE)
-
-	if globals.Settings.Get(SettingsBorderlessWindow).AsBool() {
-		windowFlags |= sdl.WINDOW_BORDERLESS
-	}
-
-	if err := ttf.Init(); err != nil {
-		panic(err)
-	}
-
-	InitSpeaker()
-
-	// window, renderer, err := sdl.CreateWindowAndRenderer(w, h, windowFlags)
-	window, err := sdl.CreateWindow("MasterPlan", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, w, h, windowFlags)
-	if err != nil {
-		panic(err)
-	}
-
-	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "2")
-
-	// Should default to hardware accelerators, if available
-	renderer, err := sdl.CreateRenderer(window, 0, sdl.RENDERER_ACCELERATED+sdl.RENDERER_SOFTWARE)
-	if err != nil {
-		panic(err)
-	}
-
-	rendererInfo, err := renderer.GetInfo()
-	if err != nil {
-		panic(err)
-	}
-
-	globals.RendererInfo = rendererInfo
-
-	globals.ScreenshotTexture, err = renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_TARGET, 1920, 1080)
+	window, renderer, err := InitGraphics(false)
 	if err != nil {
 		panic(err)
 	}
 
-	globals.ScreenshotSurf, err = sdl.CreateRGBSurfaceWithFormat(0, w, h, 32, sdl.PIXELFORMAT_ARGB8888)
-	if err != nil {
-		panic(err)
-	}
-
-	globals.ExportSurf, err = sdl.CreateRGBSurfaceWithFormat(0, w, h, 32, sdl.PIXELFORMAT_ARGB8888)
-	if err != nil {
-		panic(err)
-	}
-
-	if err := img.Init(img.INIT_JPG | img.INIT_PNG | img.INIT_TIF | img.INIT_WEBP); err != nil {
-		panic(err)
-	}
-
-	LoadCursors()
-
-	icon, err := img.Load(LocalRelativePath("assets/window_icon.png"))
-	if err != nil {
-		panic(err)
-	}
-	window.SetIcon(icon)
-	window.SetPosition(x, y)
-	window.SetSize(w, h)
-
-	borderless := globals.Settings.Get(SettingsBorderlessWindow).AsBool()
-	window.SetBordered(!borderless)
-
-	sdl.SetHint(sdl.HINT_VIDEO_MINIMIZE_ON_FOCUS_LOSS, "0")
-	sdl.SetHint(sdl.HINT_RENDER_BATCHING, "1")
-	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "0")
-
-	globals.Window = window
-	globals.Renderer = renderer
-
-	res := globals.Resources.Get(LocalRelativePath("assets/gui.png"))
-	res.Destructible = false
-	globals.GUITexture = res.AsImage()
-
-	globals.Resources.Get(LocalRelativePath("assets/empty_image.png")).Destructible = false
-
-	globals.Dispatcher = NewDispatcher()
-
-	globals.TextRenderer = NewTextRenderer()
-	globals.ScreenSize = Point{float32(w), float32(h)}
-
-	globals.TriggerReloadFonts = true
-	HandleFontReload()
-
-	ConstructMenus()
-
-	globals.Project = NewProject()
-
 	// renderer.SetLogicalSize(960, 540)
 
 	showedAboutDialog := false
@@ -345,6 +261,18 @@ func main() {
 
 	}
 
+	// Offer to recover any changes left unsaved by a crash.
+	CheckForJournals()
+
+	// Listen for commands handed off from the command line (e.g. "masterplan add").
+	if err := StartInstanceServer(); err != nil {
+		log.Println("Not listening for commands:", err)
+	}
+
+	UpdateLocalAPIServer()
+	globals.Settings.Get(SettingsLocalAPI).OnChange = UpdateLocalAPIServer
+	globals.Settings.Get(SettingsLocalAPIPort).OnChange = UpdateLocalAPIServer
+
 	for !quit {
 
 		wtMode := globals.Settings.Get(SettingsWindowTransparencyMode).AsString()
@@ -431,6 +359,8 @@ func main() {
 
 		handleEvents()
 
+		RunMainThreadCalls()
+
 		// currentTime := time.Now()
 
 		// handleMouseInputs()
@@ -536,13 +466,9 @@ func main() {
 
 		// Loading a project
 		if globals.NextProject != nil {
-			globals.Project.Destroy()
-			globals.Project = globals.NextProject
+			project := globals.NextProject
 			globals.NextProject = nil
-			globals.Dispatcher.Run() // It's not modified, but we'll run the dispatcher manually
-			if globals.Project.CurrentPage.UpwardPage == nil {
-				globals.MenuSystem.Get("prev sub page").Close()
-			}
+			OpenProjectTab(project)
 		}
 
 		// y := int32(0)
@@ -715,7 +641,9 @@ func main() {
 			title += " - " + fileName
 		}
 
-		if globals.Project.Modified {
+		if globals.Project.ReadOnly {
+			title += " [READ-ONLY]"
+		} else if globals.Project.Modified {
 			title += " [MODIFIED]"
 		}
 
@@ -762,9 +690,14 @@ func main() {
 		globals.Settings.Get(SettingsWindowPosition).Set(sdl.Rect{wX, wY, wW, wH})
 	}
 
+	StopInstanceServer()
+	StopLocalAPIServer()
+
 	log.Println("MasterPlan exited successfully.")
 
-	globals.Project.Destroy()
+	for _, project := range globals.Projects {
+		project.Destroy()
+	}
 
 	globals.Resources.Destroy()
 
@@ -880,24 +813,66 @@ func ConstructMenus() {
 
 	row.ExpandElementSet.Select(timeLabel)
 
-	// File Menu
+	// Tab strip; it's only shown once there's more than one project open
 
-	fileMenu := globals.MenuSystem.Add(NewMenu("file", &sdl.FRect{0, 48, 300, 350}, MenuCloseClickOut), false)
-	root = fileMenu.Pages["root"]
+	tabRow := root.AddRow(AlignLeft)
+	tabRow.HorizontalSpacing = 4
+	tabButtons := map[*Project]*Button{}
 
-	root.AddRow(AlignCenter).Add("New Project", NewButton("New Project", nil, nil, false, func() {
+	root.OnUpdate = func() {
+
+		if tabsChanged {
+
+			tabsChanged = false
+
+			tabRow.Clear()
+			tabButtons = map[*Project]*Button{}
+
+			tabRow.Add("", NewSpacer(nil))
+
+			for _, project := range globals.Projects {
+				project := project
+				tabButtons[project] = NewButton(TabName(project), nil, nil, false, func() { SwitchToProject(project) })
+				tabRow.Add("", tabButtons[project])
+				tabRow.Add("", NewIconButton(0, 0, &sdl.Rect{176, 0, 32, 32}, globals.GUITexture, false, func() { CloseProjectTab(project) }))
+			}
+
+			tabRow.Add("new tab", NewButton("+", nil, nil, false, func() {
+				globals.NextProject = NewProject()
+				globals.EventLog.Log("New project created.", false)
+			}))
+
+			tabRow.Visible = len(globals.Projects) > 1
+
+			if tabRow.Visible {
+				mainMenu.Recreate(mainMenu.Rect.W, 88)
+			} else {
+				mainMenu.Recreate(mainMenu.Rect.W, 48)
+			}
 
-		if globals.Project.Modified {
-			confirmNewProject := globals.MenuSystem.Get("confirm new project")
-			confirmNewProject.Center()
-			confirmNewProject.Open()
-		} else {
-			globals.NextProject = NewProject()
-			globals.EventLog.Log("New project created.", false)
 		}
 
-		fileMenu.Close()
+		for project, button := range tabButtons {
+			button.Label.SetText([]rune(TabName(project)))
+			if project == globals.Project {
+				button.BackgroundColor = getThemeColor(GUIMenuColor).Accent()
+			} else {
+				button.BackgroundColor = ColorTransparent
+			}
+		}
+
+	}
+
+	// File Menu
+
+	fileMenu := globals.MenuSystem.Add(NewMenu("file", &sdl.FRect{0, 48, 300, 390}, MenuCloseClickOut), false)
+	root = fileMenu.Pages["root"]
 
+	root.AddRow(AlignCenter).Add("New Project", NewButton("New Project", nil, nil, false, func() {
+		// New projects open in a new tab, so nothing's lost.
+		globals.NextProject = NewProject()
+		globals.EventLog.Log("New project created.", false)
+		fileMenu.Close()
 	}))
 	root.AddRow(AlignCenter).Add("Load Project", NewButton("Load Project", nil, nil, false, func() {
 		globals.Project.Open()
@@ -915,6 +890,13 @@ func ConstructMenus() {
 	}
 	root.AddRow(AlignCenter).Add("Load Recent", loadRecentButton)
 
+	root.AddRow(AlignCenter).Add("Backups", NewButton("Backups...", nil, nil, false, func() {
+		backups := globals.MenuSystem.Get("backups")
+		backups.Center()
+		backups.Open()
+		fileMenu.Close()
+	}))
+
 	root.AddRow(AlignCenter).Add("Save Project", NewButton("Save Project", nil, nil, false, func() {
 
 		if globals.Project.Filepath != "" {
@@ -946,7 +928,7 @@ func ConstructMenus() {
 
 	// Export sub-menu
 
-	exportMenu := globals.MenuSystem.Add(NewMenu("export", &sdl.FRect{48, 48, 550, 350}, MenuCloseButton), false)
+	exportMenu := globals.MenuSystem.Add(NewMenu("export", &sdl.FRect{48, 48, 650, 350}, MenuCloseButton), false)
 	exportMenu.Resizeable = true
 	exportMenu.Draggable = true
 
@@ -954,7 +936,7 @@ func ConstructMenus() {
 	row = exportRoot.AddRow(AlignCenter)
 	row.Add("label", NewLabel("Export project as:", nil, false, AlignCenter))
 	row = exportRoot.AddRow(AlignCenter)
-	exportMode := NewButtonGroup(&sdl.FRect{0, 0, 256, 32}, false, func(index int) {}, nil, "PNGs", "PDF")
+	exportMode := NewButtonGroup(&sdl.FRect{0, 0, 620, 32}, false, func(index int) {}, nil, "PNGs", "PDF", "Markdown", "OPML", "SVGs", "HTML")
 	row.Add("choices", exportMode)
 
 	row = exportRoot.AddRow(AlignCenter)
@@ -986,19 +968,38 @@ func ConstructMenus() {
 	}))
 
 	bgOptions := NewButtonGroup(&sdl.FRect{0, 0, 400, 32}, false, func(index int) {}, nil, "Normal", "No Grid", "Transparent")
-	row = exportRoot.AddRow(AlignCenter)
-	row.Add("bg options label", NewLabel("Background Options:", nil, false, AlignCenter))
-	row = exportRoot.AddRow(AlignCenter)
-	row.Add("bg options", bgOptions)
+	bgLabelRow := exportRoot.AddRow(AlignCenter)
+	bgLabelRow.Add("bg options label", NewLabel("Background Options:", nil, false, AlignCenter))
+	bgRow := exportRoot.AddRow(AlignCenter)
+	bgRow.Add("bg options", bgOptions)
+
+	// Markdown is exported from the project, its current page, or the selected cards, with sub-pages as sections or as separate files.
+	markdownScope := NewButtonGroup(&sdl.FRect{0, 0, 400, 32}, false, func(index int) {}, nil, "Project", "Current Page", "Selection")
+	markdownScopeRow := exportRoot.AddRow(AlignCenter)
+	markdownScopeRow.Add("markdown scope", markdownScope)
+	markdownSubpages := NewButtonGroup(&sdl.FRect{0, 0, 400, 32}, false, func(index int) {}, nil, "Sub-Pages as Sections", "Sub-Pages as Files")
+	markdownSubpagesRow := exportRoot.AddRow(AlignCenter)
+	markdownSubpagesRow.Add("markdown sub-pages", markdownSubpages)
+	markdownCopyRow := exportRoot.AddRow(AlignCenter)
+	markdownCopyRow.Add("markdown copy", NewButton("Copy to Clipboard", nil, nil, false, func() {
+		files := ExportMarkdown(globals.Project, markdownScope.ChosenIndex, false, filepath.Dir(globals.Project.Filepath), exportBaseName(globals.Project))
+		clipboard.Write(clipboard.FmtText, []byte(files[0].Text))
+		globals.EventLog.Log("Copied Markdown to the clipboard.", false)
+	}))
+
+	exportMode.OnChoose = func(index int) {
+		markdown := index == 2
+		bgLabelRow.Visible = index != 2 && index != 3
+		bgRow.Visible = index != 2 && index != 3
+		markdownScopeRow.Visible = markdown
+		markdownSubpagesRow.Visible = markdown
+		markdownCopyRow.Visible = markdown
+	}
+	exportMode.OnChoose(exportMode.ChosenIndex)
 
 	row = exportRoot.AddRow(AlignCenter)
 	row.Add("export", NewButton("Export", nil, nil, false, func() {
 
-		exportModeOption := ExportModePNG
-		if exportMode.ChosenIndex == 1 {
-			exportModeOption = ExportModePDF
-		}
-
 		outputDir := exportPathLabel.TextAsString()
 
 		if !FolderExists(outputDir) {
@@ -1006,9 +1007,56 @@ func ConstructMenus() {
 			return
 		}
 
+		if exportMode.ChosenIndex == 1 {
+			if err := ExportPDF(globals.Project, bgOptions.ChosenIndex, outputDir); err != nil {
+				globals.EventLog.Log("Error: Couldn't export PDF: %s", true, err.Error())
+			} else {
+				globals.EventLog.Log("Project successfully exported in [%s] format to folder: %s.", false, ExportModePDF, outputDir)
+			}
+			return
+		}
+
+		if exportMode.ChosenIndex == 2 {
+			files := ExportMarkdown(globals.Project, markdownScope.ChosenIndex, markdownSubpages.ChosenIndex == 1, outputDir, exportBaseName(globals.Project)+"_Export")
+			if err := WriteMarkdownFiles(files, outputDir); err != nil {
+				globals.EventLog.Log("Error: Couldn't export Markdown: %s", true, err.Error())
+			} else {
+				globals.EventLog.Log("Project successfully exported in [%s] format to folder: %s.", false, ExportModeMarkdown, outputDir)
+			}
+			return
+		}
+
+		if exportMode.ChosenIndex == 3 {
+			filename := filepath.Join(outputDir, exportBaseName(globals.Project)+"_Export.opml")
+			if err := WriteOPML(ExportOPML(globals.Project.CurrentPage, filepath.Dir(filename)), filename); err != nil {
+				globals.EventLog.Log("Error: Couldn't export OPML: %s", true, err.Error())
+			} else {
+				globals.EventLog.Log("Page successfully exported in [%s] format to: %s.", false, ExportModeOPML, filename)
+			}
+			return
+		}
+
+		if exportMode.ChosenIndex == 4 {
+			if err := WriteSVGFiles(globals.Project, bgOptions.ChosenIndex, outputDir); err != nil {
+				globals.EventLog.Log("Error: Couldn't export SVG: %s", true, err.Error())
+			} else {
+				globals.EventLog.Log("Project successfully exported in [%s] format to folder: %s.", false, ExportModeSVG, outputDir)
+			}
+			return
+		}
+
+		if exportMode.ChosenIndex == 5 {
+			if err := WriteHTMLFile(globals.Project, bgOptions.ChosenIndex, outputDir); err != nil {
+				globals.EventLog.Log("Error: Couldn't export HTML: %s", true, err.Error())
+			} else {
+				globals.EventLog.Log("Project successfully exported in [%s] format to folder: %s.", false, ExportModeHTML, outputDir)
+			}
+			return
+		}
+
 		activeScreenshot = &ScreenshotOptions{
 			Exporting:        true,
-			ExportMode:       exportModeOption,
+			ExportMode:       ExportModePNG,
 			BackgroundOption: bgOptions.ChosenIndex,
 			HideGUI:          true,
 			Filename:         outputDir,
@@ -1047,6 +1095,29 @@ func ConstructMenus() {
 
 	}))
 
+	root.AddRow(AlignCenter).Add("import", NewButton("Import...", nil, nil, false, func() {
+
+		toolsMenu.Close()
+
+		if path, err := zenity.SelectFile(zenity.Title("Select File to Import..."), zenity.FileFilter{Name: "Importable Files", Patterns: ImportFileFilters}); err != nil && err != zenity.ErrCanceled {
+			globals.EventLog.Log(err.Error(), true)
+		} else if err != zenity.ErrCanceled {
+			if err := ImportFile(path); err != nil {
+				globals.EventLog.Log("Error: Couldn't import %s: %s", true, path, err.Error())
+			}
+		}
+
+	}))
+
+	root.AddRow(AlignCenter).Add("check project", NewButton("Check Project...", nil, nil, false, func() {
+
+		check := globals.MenuSystem.Get("check project")
+		check.Center()
+		check.Open()
+		toolsMenu.Close()
+
+	}))
+
 	root.AddRow(AlignCenter).Add("", NewButton("Flatten Project", nil, nil, false, func() {
 
 		common := globals.MenuSystem.Get("common")
@@ -1216,6 +1287,137 @@ func ConstructMenus() {
 
 	}
 
+	backupsMenu := globals.MenuSystem.Add(NewMenu("backups", &sdl.FRect{0, 0, 800, 400}, MenuCloseButton), false)
+	backupsMenu.Draggable = true
+	backupsMenu.Resizeable = true
+	backupsMenu.OnOpen = func() {
+
+		root = backupsMenu.Pages["root"]
+		root.Destroy()
+
+		project := globals.Project
+		target := project.Filepath
+
+		var backups []string
+		if target != "" && !project.ReadOnly {
+			backups = Backups(target)
+		}
+
+		if target == "" || project.ReadOnly {
+			root.AddRow(AlignCenter).Add("", NewLabel("Backups are only made of projects that have been saved.", nil, false, AlignCenter))
+		} else if len(backups) == 0 {
+			root.AddRow(AlignCenter).Add("", NewLabel("There are no backups of this project yet.", nil, false, AlignCenter))
+		} else {
+
+			root.AddRow(AlignCenter).Add("", NewLabel("Backups of "+filepath.Base(target)+", with changes made since each:", nil, false, AlignCenter))
+
+			current, err := project.ToModel()
+			if err != nil {
+				globals.EventLog.Log("Error: Couldn't compare backups: %s", true, err.Error())
+			}
+
+			// Newest first
+			for i := len(backups) - 1; i >= 0; i-- {
+
+				backup := backups[i]
+
+				model, err := plan.ReadProject(backup, project.Passphrase, project.Keys)
+
+				summary := "Couldn't be read"
+				if err == nil && current != nil {
+					summary = backupDiffSummary(model, current)
+				}
+
+				row = root.AddRow(AlignLeft)
+				row.Add("", NewLabel(BackupTime(backup).Format("Mon Jan 2 2006, 15:04:05")+"\n"+summary, nil, false, AlignLeft))
+
+				row = root.AddRow(AlignLeft)
+				row.Add("", NewButton("View (Read-Only)", nil, nil, false, func() {
+					ViewBackup(backup)
+					backupsMenu.Close()
+				}))
+				row.Add("", NewButton("Restore", nil, nil, false, func() {
+					ConfirmRestoreBackup(backup, target)
+					backupsMenu.Close()
+				}))
+
+			}
+
+		}
+
+		backupsMenu.Recreate(backupsMenu.Rectangle().W, root.IdealSize().Y+48)
+
+	}
+
+	checkMenu := globals.MenuSystem.Add(NewMenu("check project", &sdl.FRect{0, 0, 800, 400}, MenuCloseButton), false)
+	checkMenu.Draggable = true
+	checkMenu.Resizeable = true
+	checkMenu.OnOpen = func() {
+
+		root = checkMenu.Pages["root"]
+		root.Destroy()
+
+		project := globals.Project
+
+		model, problems, err := project.CheckProblems()
+
+		if err != nil {
+			root.AddRow(AlignCenter).Add("", NewLabel("Couldn't check the project: "+err.Error(), nil, false, AlignCenter))
+		} else if len(problems) == 0 {
+			root.AddRow(AlignCenter).Add("", NewLabel("No problems found.", nil, false, AlignCenter))
+		} else {
+
+			root.AddRow(AlignCenter).Add("", NewLabel(fmt.Sprintf("%d problem(s) found. Fixes can be undone.", len(problems)), nil, false, AlignCenter))
+
+			for _, category := range plan.ProblemCategories {
+
+				category := category
+				inCategory := []*plan.Problem{}
+
+				for _, problem := range problems {
+					if problem.Category == category {
+						inCategory = append(inCategory, problem)
+					}
+				}
+
+				if len(inCategory) == 0 {
+					continue
+				}
+
+				row = root.AddRow(AlignLeft)
+				row.Add("", NewLabel(fmt.Sprintf("%s (%d):", plan.ProblemCategoryNames[category], len(inCategory)), nil, false, AlignLeft))
+
+				if !project.ReadOnly {
+					row.Add("", NewButton("Fix", nil, nil, false, func() {
+						project.FixProblems(category)
+						checkMenu.Close()
+					}))
+				}
+
+				// Long lists are cut short so the menu doesn't become huge.
+				for i, problem := range inCategory {
+					if i >= 20 {
+						root.AddRow(AlignLeft).Add("", NewLabel(fmt.Sprintf("    ...and %d more.", len(inCategory)-i), nil, false, AlignLeft))
+						break
+					}
+					root.AddRow(AlignLeft).Add("", NewLabel("    "+problemText(model, problem)+" (Fix: "+problem.Fix+")", nil, false, AlignLeft))
+				}
+
+			}
+
+			if !project.ReadOnly {
+				root.AddRow(AlignCenter).Add("", NewButton("Fix All", nil, nil, false, func() {
+					project.FixProblems()
+					checkMenu.Close()
+				}))
+			}
+
+		}
+
+		checkMenu.Recreate(checkMenu.Rectangle().W, root.IdealSize().Y+48)
+
+	}
+
 	// Create Menu
 
 	createMenu := globals.MenuSystem.Add(NewMenu("create", &sdl.FRect{globals.ScreenSize.X, globals.ScreenSize.Y, 32, 32}, MenuCloseButton), false)
@@ -1296,6 +1498,17 @@ func ConstructMenus() {
 	root.AddRow(AlignCenter).Add("add icons", NewButton("Add Icons", nil, nil, false, func() {
 		editMenu.SetPage("add icons")
 	}))
+	root.AddRow(AlignCenter).Add("resolve conflicts", NewButton("Resolve Merge Conflicts", nil, nil, false, func() {
+		resolved := 0
+		for _, card := range globals.Project.CurrentPage.Selection.AsSlice() {
+			if card.Properties.Has(plan.MergeConflictProperty) {
+				card.Properties.Remove(plan.MergeConflictProperty)
+				card.CreateUndoState = true
+				resolved++
+			}
+		}
+		globals.EventLog.Log("Resolved merge conflicts for %d card(s).", false, resolved)
+	}))
 
 	setColor := editMenu.AddPage("set color")
 	setColor.AddRow(AlignCenter).Add("label", NewLabel("Set Color", nil, false, AlignCenter))
@@ -1817,25 +2030,73 @@ func ConstructMenus() {
 	confirmQuit.Draggable = true
 	root = confirmQuit.Pages["root"]
 	root.AddRow(AlignCenter).Add("label", NewLabel("Are you sure you wish to quit?", nil, false, AlignCenter))
-	root.AddRow(AlignCenter).Add("label-2", NewLabel("Any unsaved changes will be lost.", nil, false, AlignCenter))
+	confirmQuitChanges := NewLabel("Any unsaved changes will be lost.", &sdl.FRect{0, 0, 640, 32}, false, AlignCenter)
+	root.AddRow(AlignCenter).Add("label-2", confirmQuitChanges)
+	root.OnOpen = func() {
+		if modified := ModifiedProjects(); len(modified) > 1 {
+			confirmQuitChanges.SetText([]rune(strconv.Itoa(len(modified)) + " open projects have unsaved changes, which will be lost."))
+		} else if len(modified) == 1 {
+			confirmQuitChanges.SetText([]rune(TabName(modified[0]) + " has unsaved changes, which will be lost."))
+		} else {
+			confirmQuitChanges.SetText([]rune("Any unsaved changes will be lost."))
+		}
+	}
 	row = root.AddRow(AlignCenter)
 	row.Add("yes", NewButton("Yes, Quit", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { quit = true }))
 	row.Add("no", NewButton("No", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { confirmQuit.Close() }))
 	confirmQuit.Recreate(root.IdealSize().X+48, root.IdealSize().Y+32)
 
-	confirmNewProject := globals.MenuSystem.Add(NewMenu("confirm new project", &sdl.FRect{0, 0, 32, 32}, MenuCloseButton), true)
-	confirmNewProject.Draggable = true
-	root = confirmNewProject.Pages["root"]
-	root.AddRow(AlignCenter).Add("label", NewLabel("Create a new project?", nil, false, AlignCenter))
-	root.AddRow(AlignCenter).Add("label-2", NewLabel("Any unsaved changes will be lost.", nil, false, AlignCenter))
+	confirmCloseTab := globals.MenuSystem.Add(NewMenu("confirm close tab", &sdl.FRect{0, 0, 32, 32}, MenuCloseButton), true)
+	confirmCloseTab.Draggable = true
+	root = confirmCloseTab.Pages["root"]
+	confirmCloseTabLabel := NewLabel("Close project?", &sdl.FRect{0, 0, 640, 32}, false, AlignCenter)
+	root.AddRow(AlignCenter).Add("label", confirmCloseTabLabel)
+	root.AddRow(AlignCenter).Add("label-2", NewLabel("It has unsaved changes.", nil, false, AlignCenter))
+	root.OnOpen = func() {
+		confirmCloseTabLabel.SetText([]rune("Close " + TabName(pendingTabClose) + "?"))
+	}
 	row = root.AddRow(AlignCenter)
-	row.Add("yes", NewButton("Yes", &sdl.FRect{0, 0, 128, 32}, nil, false, func() {
-		globals.NextProject = NewProject()
-		globals.EventLog.Log("New project created.", false)
-		confirmNewProject.Close()
+	row.Add("save", NewButton("Save and Close", &sdl.FRect{0, 0, 192, 32}, nil, false, func() {
+		project := pendingTabClose
+		if project.Filepath != "" {
+			project.Save()
+		} else {
+			project.SaveAs()
+		}
+		// Saving can fail or be canceled, in which case the project stays open.
+		if !project.Modified {
+			closeProject(project)
+		}
+		confirmCloseTab.Close()
 	}))
-	row.Add("no", NewButton("No", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { confirmNewProject.Close() }))
-	confirmNewProject.Recreate(root.IdealSize().X+48, root.IdealSize().Y+32)
+	row.Add("discard", NewButton("Close Without Saving", &sdl.FRect{0, 0, 256, 32}, nil, false, func() {
+		closeProject(pendingTabClose)
+		confirmCloseTab.Close()
+	}))
+	row.Add("cancel", NewButton("Cancel", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { confirmCloseTab.Close() }))
+	confirmCloseTab.Recreate(root.IdealSize().X+48, root.IdealSize().Y+32)
+
+	confirmRestoreChanges := globals.MenuSystem.Add(NewMenu("confirm restore over changes", &sdl.FRect{0, 0, 32, 32}, MenuCloseButton), true)
+	confirmRestoreChanges.Draggable = true
+	root = confirmRestoreChanges.Pages["root"]
+	confirmRestoreChangesLabel := NewLabel("Restore backup?", &sdl.FRect{0, 0, 640, 32}, false, AlignCenter)
+	root.AddRow(AlignCenter).Add("label", confirmRestoreChangesLabel)
+	confirmRestoreChangesProject := NewLabel("It has unsaved changes.", &sdl.FRect{0, 0, 640, 32}, false, AlignCenter)
+	root.AddRow(AlignCenter).Add("label-2", confirmRestoreChangesProject)
+	root.AddRow(AlignCenter).Add("label-3", NewLabel("They'll be lost.", nil, false, AlignCenter))
+	root.OnOpen = func() {
+		confirmRestoreChangesLabel.SetText([]rune("Restore the backup from " + BackupTime(pendingRestoreBackup).Format("Jan 2 15:04") + "?"))
+		if project := ProjectTab(pendingRestoreTarget); project != nil {
+			confirmRestoreChangesProject.SetText([]rune(TabName(project) + " has unsaved changes."))
+		}
+	}
+	row = root.AddRow(AlignCenter)
+	row.Add("restore", NewButton("Restore", &sdl.FRect{0, 0, 128, 32}, nil, false, func() {
+		RestoreBackup(pendingRestoreBackup, pendingRestoreTarget)
+		confirmRestoreChanges.Close()
+	}))
+	row.Add("cancel", NewButton("Cancel", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { confirmRestoreChanges.Close() }))
+	confirmRestoreChanges.Recreate(root.IdealSize().X+48, root.IdealSize().Y+32)
 
 	confirmLoad := globals.MenuSystem.Add(NewMenu("confirm load", &sdl.FRect{0, 0, 32, 32}, MenuCloseButton), true)
 	confirmLoad.Draggable = true
@@ -1846,15 +2107,66 @@ func ConstructMenus() {
 	root.OnOpen = func() {
 		confirmLoadFilepath.SetText([]rune(SimplifyPathString(globals.Project.LoadConfirmationTo, 50)))
 	}
-	root.AddRow(AlignCenter).Add("label3", NewLabel("Any unsaved changes will be lost.", nil, false, AlignCenter))
+	root.AddRow(AlignCenter).Add("label3", NewLabel("It will be opened in a new tab.", nil, false, AlignCenter))
 	row = root.AddRow(AlignCenter)
 	row.Add("yes", NewButton("Yes", &sdl.FRect{0, 0, 128, 32}, nil, false, func() {
-		OpenProjectFrom(globals.Project.LoadConfirmationTo)
+		LoadProject(globals.Project.LoadConfirmationTo)
 		confirmLoad.Close()
 	}))
 	row.Add("no", NewButton("No", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { confirmLoad.Close() }))
 	confirmLoad.Recreate(root.IdealSize().X+48, root.IdealSize().Y+16)
 
+	confirmRestore := globals.MenuSystem.Add(NewMenu("confirm restore backup", &sdl.FRect{0, 0, 32, 32}, MenuCloseButton), true)
+	confirmRestore.Draggable = true
+	root = confirmRestore.Pages["root"]
+	root.AddRow(AlignCenter).Add("label", NewLabel("The project couldn't be opened.", nil, false, AlignCenter))
+	root.AddRow(AlignCenter).Add("label2", NewLabel("Restore the newest automatic backup?", nil, false, AlignCenter))
+	confirmRestoreFilepath := NewLabel("Backup Filepath: ", &sdl.FRect{0, 0, 800, 32}, false, AlignCenter)
+	root.AddRow(AlignCenter).Add("label3", confirmRestoreFilepath)
+	root.OnOpen = func() {
+		confirmRestoreFilepath.SetText([]rune(SimplifyPathString(globals.Project.RecoveryBackup, 50)))
+	}
+	root.AddRow(AlignCenter).Add("label4", NewLabel("Saving will then replace the damaged project.", nil, false, AlignCenter))
+	row = root.AddRow(AlignCenter)
+	row.Add("yes", NewButton("Restore", &sdl.FRect{0, 0, 128, 32}, nil, false, func() {
+		// Point the restored project to the damaged file so saving fixes it
+		RestoreBackup(globals.Project.RecoveryBackup, globals.Project.RecoveryTarget)
+		confirmRestore.Close()
+	}))
+	row.Add("no", NewButton("Cancel", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { confirmRestore.Close() }))
+	confirmRestore.Recreate(root.IdealSize().X+48, root.IdealSize().Y+16)
+
+	recoverJournal := globals.MenuSystem.Add(NewMenu("recover journal", &sdl.FRect{0, 0, 32, 32}, MenuCloseButton), true)
+	recoverJournal.Draggable = true
+	root = recoverJournal.Pages["root"]
+	root.AddRow(AlignCenter).Add("label", NewLabel("MasterPlan didn't close properly, and there are unsaved changes to:", nil, false, AlignCenter))
+	recoverJournalProject := NewLabel("Project: ", &sdl.FRect{0, 0, 800, 32}, false, AlignCenter)
+	root.AddRow(AlignCenter).Add("label2", recoverJournalProject)
+	root.OnOpen = func() {
+		name := "A new, unsaved project"
+		if journal, err := plan.ReadJournal(pendingJournal); err == nil && journal.Project != "" {
+			name = SimplifyPathString(journal.Project, 50)
+		}
+		recoverJournalProject.SetText([]rune(name))
+	}
+	root.AddRow(AlignCenter).Add("label3", NewLabel("Recover them?", nil, false, AlignCenter))
+	row = root.AddRow(AlignCenter)
+	row.Add("yes", NewButton("Recover", &sdl.FRect{0, 0, 128, 32}, nil, false, func() {
+		recoverJournal.Close()
+		RecoverJournal(pendingJournal)
+		CheckForJournals()
+	}))
+	row.Add("discard", NewButton("Discard", &sdl.FRect{0, 0, 128, 32}, nil, false, func() {
+		recoverJournal.Close()
+		if err := os.Remove(pendingJournal); err != nil {
+			globals.EventLog.Log("Error: Couldn't remove journal: %s", true, err.Error())
+			return
+		}
+		CheckForJournals()
+	}))
+	row.Add("no", NewButton("Later", &sdl.FRect{0, 0, 128, 32}, nil, false, func() { recoverJournal.Close() }))
+	recoverJournal.Recreate(root.IdealSize().X+48, root.IdealSize().Y+16)
+
 	// // Confirm Load Menu - do this after Project.Modified works again.
 
 	// confirmQuit := globals.MenuSystem.Add(NewMenu(&sdl.FRect{0, 0, 32, 32}, true), "confirm quit", true)
@@ -1921,7 +2233,9 @@ func ConstructMenus() {
 	row.Add("", NewLabel("Audio Volume:", nil, false, AlignCenter))
 	number := NewNumberSpinner(&sdl.FRect{0, 0, 256, 32}, false, globals.Settings.Get(SettingsAudioVolume))
 	number.OnChange = func() {
-		globals.Project.SendMessage(NewMessage(MessageVolumeChange, nil, nil))
+		for _, project := range globals.Projects {
+			project.SendMessage(NewMessage(MessageVolumeChange, nil, nil))
+		}
 	}
 	row.Add("", number)
 
@@ -2085,6 +2399,29 @@ in the same stack.`))
 	row.Add("", NewLabel("Place Newly Created Cards in Selected Stack:", nil, false, AlignLeft))
 	row.Add("", NewCheckbox(0, 0, false, globals.Settings.Get(SettingsPlaceNewCardsInStack)))
 
+	row = general.AddRow(AlignCenter)
+	row.Add("hint", NewTooltip(`Import Bullets As:
+When pasting or importing Markdown or an
+indented outline, this is what plain bullet
+points become. Task list items ("- [ ]")
+always become Checkbox Cards, and headings
+and paragraphs become Notes.`))
+	row.Add("", NewLabel("Import Bullets As:", nil, false, AlignLeft))
+	row.Add("", NewButtonGroup(&sdl.FRect{0, 0, 256, 32}, false, nil, globals.Settings.Get(SettingsImportBulletsAs), ImportBulletsAsCheckboxes, ImportBulletsAsNotes))
+
+	row = general.AddRow(AlignCenter)
+	row.Add("hint", NewTooltip(`OPML Sub-Page Depth:
+When importing OPML, outlines nested this
+many levels deep that have outlines of their
+own become Sub-Page Cards, with their outlines
+inside. 0 keeps every outline on the same page,
+indented in its stack.`))
+	row.Add("", NewLabel("OPML Sub-Page Depth:", nil, false, AlignLeft))
+	spinner = NewNumberSpinner(nil, false, globals.Settings.Get(SettingsOPMLSubpageDepth))
+	spinner.MinValue = 0
+	spinner.MaxValue = 10
+	row.Add("", spinner)
+
 	row = general.AddRow(AlignCenter)
 	row.Add("", NewSpacer(nil))
 
@@ -2102,10 +2439,6 @@ from this directory.`))
 	cachePath.RegexString = RegexNoNewlines
 	row.Add("", cachePath)
 
-	general.OnUpdate = func() {
-		cachePath.Property = globals.Project.Properties.Get(ProjectCacheDirectory)
-	}
-
 	row = general.AddRow(AlignCenter)
 	row.Add("", NewButton("Browse", nil, nil, false, func() {
 
@@ -2122,6 +2455,59 @@ from this directory.`))
 	row = general.AddRow(AlignCenter)
 	row.Add("", NewSpacer(nil))
 
+	row = general.AddRow(AlignCenter)
+	row.Add("hint", NewTooltip(`Encryption:
+When a passphrase is set, the current project is
+encrypted with it when saved, along with its backups
+and any media bundled with it. The passphrase is
+asked for when opening the project; if it's
+forgotten, the project can't be recovered.`))
+	row.Add("", NewLabel("Encryption For Current Project:", nil, false, AlignLeft))
+	encryptionStatus := NewLabel("Not Encrypted", nil, false, AlignLeft)
+	row.Add("", encryptionStatus)
+
+	row = general.AddRow(AlignCenter)
+	row.Add("", NewButton("Set Passphrase...", nil, nil, false, func() {
+		if passphrase, err := AskNewPassphrase(); err == nil {
+			globals.Project.SetPassphrase(passphrase)
+			globals.EventLog.Log("Project passphrase set.", false)
+		} else if err != zenity.ErrCanceled {
+			globals.EventLog.Log("Error: Passphrase not set: %s", true, err.Error())
+		}
+	}))
+
+	row.Add("", NewButton("Remove Passphrase", nil, nil, false, func() {
+		if globals.Project.Passphrase != "" {
+			globals.Project.SetPassphrase("")
+			globals.EventLog.Log("Project passphrase removed; the project is no longer encrypted.", false)
+		}
+	}))
+
+	row = general.AddRow(AlignCenter)
+	row.Add("hint", NewTooltip(`Calendar Feed:
+When enabled, an iCalendar (.ics) file with a
+to-do for each card in the current project that
+has a deadline is written next to the project
+file every time it's saved. Calendar apps can
+subscribe to it to show your deadlines. Encrypted
+projects don't have one, as it couldn't be encrypted.`))
+	row.Add("", NewLabel("Calendar Feed For Current Project:", nil, false, AlignLeft))
+	calendarFeed := NewCheckbox(0, 0, false, nil)
+	row.Add("", calendarFeed)
+
+	general.OnUpdate = func() {
+		cachePath.Property = globals.Project.Properties.Get(ProjectCacheDirectory)
+		calendarFeed.Property = globals.Project.Properties.Get(ProjectCalendarFeed)
+		if globals.Project.Passphrase != "" {
+			encryptionStatus.SetText([]rune("Encrypted"))
+		} else {
+			encryptionStatus.SetText([]rune("Not Encrypted"))
+		}
+	}
+
+	row = general.AddRow(AlignCenter)
+	row.Add("", NewSpacer(nil))
+
 	row = general.AddRow(AlignCenter)
 	row.Add("hint", NewTooltip(`Where to find the browser to use for Web Cards.
 Defaults to your local Chrome / Chromium installation.
@@ -2202,6 +2588,40 @@ This folder should be something like:
 		globals.Settings.Get(SettingsScreenshotPath).Set("")
 	}))
 
+	row = general.AddRow(AlignCenter)
+	row.Add("", NewSpacer(nil))
+
+	row = general.AddRow(AlignCenter)
+	row.Add("hint", NewTooltip(`Local API:
+When enabled, MasterPlan serves the current
+project's pages and cards as JSON over HTTP,
+only to programs on this computer that have
+the API token. Changes made through the API
+can be undone.`))
+	row.Add("", NewLabel("Local API:", nil, false, AlignLeft))
+	row.Add("", NewCheckbox(0, 0, false, globals.Settings.Get(SettingsLocalAPI)))
+
+	row = general.AddRow(AlignCenter)
+	row.Add("", NewLabel("Local API Port:", nil, false, AlignLeft))
+	spinner = NewNumberSpinner(nil, false, globals.Settings.Get(SettingsLocalAPIPort))
+	spinner.MinValue = 1024
+	spinner.MaxValue = 65535
+	row.Add("", spinner)
+
+	row = general.AddRow(AlignCenter)
+	row.Add("", NewButton("Copy API Token", nil, nil, false, func() {
+		if globals.Settings.Get(SettingsLocalAPIToken).AsString() == "" {
+			ResetLocalAPIToken()
+		}
+		clipboard.Write(clipboard.FmtText, []byte(globals.Settings.Get(SettingsLocalAPIToken).AsString()))
+		globals.EventLog.Log("Copied the local API token to the clipboard.", false)
+	}))
+
+	row.Add("", NewButton("Reset API Token", nil, nil, false, func() {
+		ResetLocalAPIToken()
+		globals.EventLog.Log("The local API token was reset; programs using the old one will need the new one.", false)
+	}))
+
 	for _, row := range general.Rows {
 		row.ExpandElementSet.SelectIf(func(me MenuElement) bool {
 			_, isTooltip := me.(*Tooltip)
@@ -2763,14 +3183,14 @@ where the cursor is over the window.`))
 	listPIP := NewContainer(&sdl.FRect{0, 0, 320, 128}, false)
 	row.Add("container", listPIP)
 
-	globals.Hierarchy = NewHierarchy(listPIP)
+	globals.HierarchyContainer = listPIP
 
 	listPIP.OnUpdate = func() {
 
 		// listPIP.Rect.W = float32(math.Max(float64(listRoot.Rect.W)-128, 250))
 		listPIP.Rect.W = float32(math.Max(float64(listRoot.Rect.W), 250))
 		listPIP.Rect.H = listRoot.Rect.H - 190
-		listPIP.Rows = globals.Hierarchy.Rows(sorting, filter)
+		listPIP.Rows = globals.Project.Hierarchy.Rows(sorting, filter)
 
 	}
 
@@ -3439,7 +3859,7 @@ horizontally.`))
 
 	// Table menu
 
-	tableMenu := globals.MenuSystem.Add(NewMenu("table settings menu", &sdl.FRect{999999, 0, 500, 275}, MenuCloseButton), false)
+	tableMenu := globals.MenuSystem.Add(NewMenu("table settings menu", &sdl.FRect{999999, 0, 500, 400}, MenuCloseButton), false)
 	tableMenu.Resizeable = true
 	tableMenu.Draggable = true
 	tableMenu.AnchorMode = MenuAnchorTopRight
@@ -3477,6 +3897,72 @@ horizontally.`))
 		}
 	}))
 
+	row = root.AddRow(AlignCenter)
+	row.Add("", NewSpacer(nil))
+	row = root.AddRow(AlignCenter)
+	row.Add("", NewLabel("Table Data", nil, false, AlignCenter))
+
+	selectedTable := func() *TableContents {
+		for c := range globals.Project.CurrentPage.Selection.Cards {
+			if c.ContentType == ContentTypeTable {
+				return c.Contents.(*TableContents)
+			}
+		}
+		return nil
+	}
+
+	row = root.AddRow(AlignCenter)
+	row.Add("import csv", NewButton("Import CSV...", nil, nil, false, func() {
+		if path, err := zenity.SelectFile(zenity.Title("Select CSV File to Import..."), zenity.FileFilter{Name: "CSV / TSV Files", Patterns: []string{"*.csv", "*.tsv", "*.txt"}}); err != nil && err != zenity.ErrCanceled {
+			globals.EventLog.Log(err.Error(), true)
+		} else if err != zenity.ErrCanceled {
+			if err := ImportTableFile(path); err != nil {
+				globals.EventLog.Log("Error: Couldn't import %s: %s", true, path, err.Error())
+			}
+		}
+	}))
+
+	row.Add("export csv", NewButton("Export CSV...", nil, nil, false, func() {
+
+		table := selectedTable()
+		if table == nil {
+			return
+		}
+
+		if path, err := zenity.SelectFileSave(
+			zenity.Title("Export Table..."),
+			zenity.ConfirmOverwrite(),
+			zenity.FileFilter{Name: "CSV File (*.csv)", Patterns: []string{"*.csv"}},
+			zenity.FileFilter{Name: "TSV File (*.tsv)", Patterns: []string{"*.tsv"}},
+		); err != nil && err != zenity.ErrCanceled {
+			globals.EventLog.Log(err.Error(), true)
+		} else if err != zenity.ErrCanceled {
+
+			comma := ','
+			if strings.EqualFold(filepath.Ext(path), ".tsv") {
+				comma = '\t'
+			} else if filepath.Ext(path) == "" {
+				path += ".csv"
+			}
+
+			if err := os.WriteFile(path, []byte(table.CSV(comma)), 0644); err != nil {
+				globals.EventLog.Log("Error: Couldn't export Table: %s", true, err.Error())
+			} else {
+				globals.EventLog.Log("Table exported to %s.", false, path)
+			}
+
+		}
+
+	}))
+
+	row = root.AddRow(AlignCenter)
+	row.Add("copy tsv", NewButton("Copy as Spreadsheet Cells", nil, nil, false, func() {
+		if table := selectedTable(); table != nil {
+			clipboard.Write(clipboard.FmtText, []byte(table.CSV('\t')))
+			globals.EventLog.Log("Copied Table to the clipboard.", false)
+		}
+	}))
+
 	// Web menu
 
 	webMenu := globals.MenuSystem.Add(NewMenu("web card settings", &sdl.FRect{99999, 0, 650, 400}, MenuCloseButton), false)
@@ -3703,6 +4189,136 @@ func profileHeap() {
 
 }
 
+// InitGraphics creates the window and renderer, and sets up everything needed to draw projects (fonts, GUI textures, menus, and an empty
+// Project). A headless window is hidden and rendered to in software, so projects can be drawn without a display (see the export command).
+func InitGraphics(headless bool) (*sdl.Window, *sdl.Renderer, error) {
+
+	x := int32(sdl.WINDOWPOS_UNDEFINED)
+	y := int32(sdl.WINDOWPOS_UNDEFINED)
+	w := int32(960)
+	h := int32(540)
+
+	if !headless && globals.Settings.Get(SettingsSaveWindowPosition).AsBool() && globals.Settings.Has(SettingsWindowPosition) {
+		windowData := globals.Settings.Get(SettingsWindowPosition).AsMap()
+		x = int32(windowData["X"].(float64))
+		y = int32(windowData["Y"].(float64))
+		w = int32(windowData["W"].(float64))
+		h = int32(windowData["H"].(float64))
+	}
+
+	windowFlags := uint32(sdl.WINDOW_RESIZABLE)
+
+	if globals.Settings.Get(SettingsBorderlessWindow).AsBool() {
+		windowFlags |= sdl.WINDOW_BORDERLESS
+	}
+
+	rendererIndex := 0
+	rendererFlags := uint32(sdl.RENDERER_ACCELERATED + sdl.RENDERER_SOFTWARE)
+
+	if headless {
+
+		// The offscreen video driver renders without a display; it can still be overridden (e.g. with "dummy") through the environment.
+		if os.Getenv("SDL_VIDEODRIVER") == "" {
+			os.Setenv("SDL_VIDEODRIVER", "offscreen")
+		}
+
+		windowFlags = sdl.WINDOW_HIDDEN
+		rendererIndex = -1 // The first renderer that renders in software
+		rendererFlags = sdl.RENDERER_SOFTWARE
+
+	}
+
+	if err := ttf.Init(); err != nil {
+		return nil, nil, err
+	}
+
+	if !headless {
+		InitSpeaker()
+	}
+
+	// window, renderer, err := sdl.CreateWindowAndRenderer(w, h, windowFlags)
+	window, err := sdl.CreateWindow("MasterPlan", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, w, h, windowFlags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "2")
+
+	// Should default to hardware accelerators, if available
+	renderer, err := sdl.CreateRenderer(window, rendererIndex, rendererFlags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rendererInfo, err := renderer.GetInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	globals.RendererInfo = rendererInfo
+
+	globals.ScreenshotTexture, err = renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_TARGET, 1920, 1080)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	globals.ScreenshotSurf, err = sdl.CreateRGBSurfaceWithFormat(0, w, h, 32, sdl.PIXELFORMAT_ARGB8888)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	globals.ExportSurf, err = sdl.CreateRGBSurfaceWithFormat(0, 1920, 1080, 32, sdl.PIXELFORMAT_ARGB8888)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := img.Init(img.INIT_JPG | img.INIT_PNG | img.INIT_TIF | img.INIT_WEBP); err != nil {
+		return nil, nil, err
+	}
+
+	LoadCursors()
+
+	icon, err := img.Load(LocalRelativePath("assets/window_icon.png"))
+	if err != nil {
+		return nil, nil, err
+	}
+	window.SetIcon(icon)
+	window.SetPosition(x, y)
+	window.SetSize(w, h)
+
+	borderless := globals.Settings.Get(SettingsBorderlessWindow).AsBool()
+	window.SetBordered(!borderless)
+
+	sdl.SetHint(sdl.HINT_VIDEO_MINIMIZE_ON_FOCUS_LOSS, "0")
+	sdl.SetHint(sdl.HINT_RENDER_BATCHING, "1")
+	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "0")
+
+	globals.Window = window
+	globals.Renderer = renderer
+
+	res := globals.Resources.Get(LocalRelativePath("assets/gui.png"))
+	res.Destructible = false
+	globals.GUITexture = res.AsImage()
+
+	globals.Resources.Get(LocalRelativePath("assets/empty_image.png")).Destructible = false
+
+	globals.Dispatcher = NewDispatcher()
+
+	globals.TextRenderer = NewTextRenderer()
+	globals.ScreenSize = Point{float32(w), float32(h)}
+
+	globals.TriggerReloadFonts = true
+	HandleFontReload()
+
+	ConstructMenus()
+
+	globals.Project = NewProject()
+	globals.Projects = []*Project{globals.Project}
+
+	return window, renderer, nil
+
+}
+
 func InitSpeaker() {
 
 	nonPositive := false
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// What's exported to Markdown.
+const (
+	MarkdownScopeProject   = iota // The root Page, and every Sub-Page under it
+	MarkdownScopePage             // The current Page
+	MarkdownScopeSelection        // The selected Cards on the current Page
+)
+
+// MarkdownFile is a Markdown document exported from a Project.
+type MarkdownFile struct {
+	Name string // Filename, without a directory
+	Text string
+}
+
+// markdownWriter writes Pages and Cards out as Markdown: stacks become nested lists (indented the way they're numbered), Checkbox Cards
+// become task list items, Notes become paragraphs, Tables become tables, and Sub-Pages become sections (or files of their own).
+type markdownWriter struct {
+	Project      *Project
+	BaseDir      string // Directory that image and file links are made relative to
+	BaseName     string // Name of the main file, without an extension; sub-page files are named after it
+	SubpageFiles bool   // If Sub-Pages are written to files of their own, rather than as sections of the main file
+
+	files     []*MarkdownFile
+	anchors   map[string]int
+	pageLinks map[*Page]string // Where Sub-Page Cards link to, for the Pages being written
+	written   map[*Page]bool
+}
+
+// ExportMarkdown returns the Project (or part of it; see the MarkdownScope constants) as Markdown. The first file is the main one; there are
+// more only if subpageFiles is true. Links to images and other files are made relative to baseDir.
+func ExportMarkdown(project *Project, scope int, subpageFiles bool, baseDir, baseName string) []*MarkdownFile {
+
+	mw := &markdownWriter{
+		Project:      project,
+		BaseDir:      baseDir,
+		BaseName:     baseName,
+		SubpageFiles: subpageFiles,
+		anchors:      map[string]int{},
+		pageLinks:    map[*Page]string{},
+		written:      map[*Page]bool{},
+	}
+
+	main := &MarkdownFile{Name: baseName + ".md"}
+	mw.files = append(mw.files, main)
+
+	switch scope {
+
+	case MarkdownScopeProject:
+		mw.writeProject(main)
+
+	case MarkdownScopePage:
+		text := &strings.Builder{}
+		mw.writeHeading(text, 1, project.CurrentPage.Name())
+		mw.writeCards(text, project.CurrentPage.Cards)
+		main.Text = text.String()
+
+	case MarkdownScopeSelection:
+		text := &strings.Builder{}
+		mw.writeCards(text, project.CurrentPage.Selection.AsSlice())
+		main.Text = text.String()
+
+	}
+
+	for _, file := range mw.files {
+		file.Text = strings.TrimSpace(file.Text) + "\n"
+	}
+
+	return mw.files
+
+}
+
+// markdownSection is a Page written as a section of a Markdown file.
+type markdownSection struct {
+	Page  *Page
+	Title string
+	Level int // Heading level
+	File  *MarkdownFile
+}
+
+// sections returns sections for the Page and the Sub-Pages under it, in the order they're written (depth-first, in the reading order of
+// their Sub-Page Cards). Sub-Pages are sections one heading level down in the same file, or the top sections of files of their own.
+func (mw *markdownWriter) sections(page *Page, title string, level int, file *MarkdownFile) []*markdownSection {
+
+	mw.written[page] = true
+
+	sections := []*markdownSection{{Page: page, Title: title, Level: level, File: file}}
+
+	for _, card := range ReadingOrder(page.Cards) {
+
+		sp, ok := card.Contents.(*SubPageContents)
+		if !ok || sp.SubPage == nil || mw.written[sp.SubPage] {
+			continue
+		}
+
+		if mw.SubpageFiles {
+			subpageFile := &MarkdownFile{Name: mw.uniqueFilename(mw.BaseName + "_" + markdownSlug(sp.SubPage.Name()))}
+			mw.files = append(mw.files, subpageFile)
+			mw.pageLinks[sp.SubPage] = subpageFile.Name
+			sections = append(sections, mw.sections(sp.SubPage, sp.SubPage.Name(), 1, subpageFile)...)
+		} else {
+			subLevel := level + 1
+			if subLevel > 6 {
+				subLevel = 6
+			}
+			sections = append(sections, mw.sections(sp.SubPage, sp.SubPage.Name(), subLevel, file)...)
+		}
+
+	}
+
+	return sections
+
+}
+
+// writeProject writes the root Page and every Sub-Page under it.
+func (mw *markdownWriter) writeProject(main *MarkdownFile) {
+
+	sections := mw.sections(mw.Project.Pages[0], exportBaseName(mw.Project), 1, main)
+
+	// Anchors are numbered in the order their headings appear, so they're all worked out before any links to them are written.
+	if !mw.SubpageFiles {
+		for _, section := range sections {
+			if anchor := mw.anchor(section.Title); section.Page != mw.Project.Pages[0] {
+				mw.pageLinks[section.Page] = "#" + anchor
+			}
+		}
+	}
+
+	texts := map[*MarkdownFile]*strings.Builder{}
+
+	for _, section := range sections {
+		if texts[section.File] == nil {
+			texts[section.File] = &strings.Builder{}
+		}
+		mw.writeHeading(texts[section.File], section.Level, section.Title)
+		mw.writeCards(texts[section.File], section.Page.Cards)
+	}
+
+	for file, text := range texts {
+		file.Text = text.String()
+	}
+
+}
+
+func (mw *markdownWriter) writeHeading(text *strings.Builder, level int, title string) {
+	text.WriteString(strings.Repeat("#", level) + " " + markdownEscape(oneLine(title)) + "\n\n")
+}
+
+// writeCards writes the given Cards, grouped into their stacks, in reading order.
+func (mw *markdownWriter) writeCards(text *strings.Builder, cards []*Card) {
+
+	stacks, depths := StackedCards(cards)
+
+	for i, stack := range stacks {
+
+		if len(stack) == 1 && !stack[0].Stack.Numerous() {
+			mw.writeLoneCard(text, stack[0])
+			continue
+		}
+
+		for j, card := range stack {
+			mw.writeListItem(text, card, depths[i][j])
+		}
+
+		text.WriteString("\n")
+
+	}
+
+}
+
+// writeLoneCard writes a Card that isn't in a stack; Notes are written as paragraphs and Tables as tables, while everything else is written
+// as a single list item.
+func (mw *markdownWriter) writeLoneCard(text *strings.Builder, card *Card) {
+
+	switch card.ContentType {
+
+	case ContentTypeNote:
+		text.WriteString(markdownEscape(strings.TrimSpace(card.Properties.Get("description").AsString())) + mw.deadline(card) + "\n\n")
+
+	case ContentTypeTable:
+		text.WriteString(mw.table(card, "") + "\n")
+
+	default:
+		mw.writeListItem(text, card, 0)
+		text.WriteString("\n")
+
+	}
+
+}
+
+func (mw *markdownWriter) writeListItem(text *strings.Builder, card *Card, depth int) {
+
+	indent := strings.Repeat("  ", depth)
+	lines := strings.Split(mw.itemText(card), "\n")
+
+	text.WriteString(indent + "- " + lines[0] + "\n")
+	for _, line := range lines[1:] {
+		text.WriteString(indent + "  " + line + "\n")
+	}
+
+	if card.ContentType == ContentTypeTable {
+		text.WriteString("\n" + mw.table(card, indent+"  ") + "\n")
+	}
+
+}
+
+// itemText returns the text of a list item for the Card.
+func (mw *markdownWriter) itemText(card *Card) string {
+
+	description := markdownEscape(strings.TrimSpace(card.Properties.Get("description").AsString()))
+	deadline := mw.deadline(card)
+
+	switch card.ContentType {
+
+	case ContentTypeCheckbox:
+		check := "[ ] "
+		if card.Properties.Get("checked").AsBool() {
+			check = "[x] "
+		}
+		return check + description + deadline
+
+	case ContentTypeNumbered:
+		return fmt.Sprintf("%s (%s/%s)%s", description, formatExportNumber(card.Properties.Get("current").AsFloat()), formatExportNumber(card.Properties.Get("maximum").AsFloat()), deadline)
+
+	case ContentTypeImage:
+		return fmt.Sprintf("![%s](%s)", markdownEscape(card.Name()), mw.fileLink(card.Properties.Get("filepath").AsString()))
+
+	case ContentTypeSound:
+		return fmt.Sprintf("[%s](%s)", markdownEscape(card.Name()), mw.fileLink(card.Properties.Get("filepath").AsString()))
+
+	case ContentTypeSubpage:
+		if sp, ok := card.Contents.(*SubPageContents); ok && mw.pageLinks[sp.SubPage] != "" {
+			return fmt.Sprintf("[%s](%s)", description, mw.pageLinks[sp.SubPage])
+		}
+		return description
+
+	case ContentTypeLink:
+		if lc, ok := card.Contents.(*LinkContents); ok && (lc.targetCard != nil || lc.RemoteTarget() != "") {
+			return description + " → " + markdownEscape(oneLine(lc.TargetName.TextAsString()))
+		}
+		return description
+
+	case ContentTypeWeb:
+		if url := card.Properties.Get("url").AsString(); url != "" {
+			return fmt.Sprintf("[%s](%s)", url, url)
+		}
+
+	case ContentTypeNote, ContentTypeTimer:
+		return description + deadline
+
+	}
+
+	return markdownEscape(card.Name()) + deadline
+
+}
+
+// deadline returns the Card's deadline as text to go after its description, or an empty string if it has none.
+func (mw *markdownWriter) deadline(card *Card) string {
+	if card.Properties.Has("deadline") && card.Properties.Get("deadline").AsString() != "" {
+		return " (due " + card.Properties.Get("deadline").AsString() + ")"
+	}
+	return ""
+}
+
+// table returns the Table Card's contents as a Markdown table, with each line prefixed with the indentation.
+func (mw *markdownWriter) table(card *Card, indent string) string {
+
+	tc, ok := card.Contents.(*TableContents)
+	if !ok {
+		return ""
+	}
+
+	td := plan.ParseTableData(tc.TableData.Serialize())
+
+	cell := func(text string) string {
+		return strings.ReplaceAll(markdownEscape(oneLine(text)), "|", "\\|")
+	}
+
+	text := &strings.Builder{}
+
+	text.WriteString(indent + "| |")
+	for x := 0; x < td.Width; x++ {
+		heading := ""
+		if x < len(td.ColumnHeadings) {
+			heading = td.ColumnHeadings[x]
+		}
+		text.WriteString(" " + cell(heading) + " |")
+	}
+	text.WriteString("\n" + indent + "|---|" + strings.Repeat(":---:|", td.Width) + "\n")
+
+	for y := 0; y < td.Height; y++ {
+		heading := ""
+		if y < len(td.RowHeadings) {
+			heading = td.RowHeadings[y]
+		}
+		text.WriteString(indent + "| " + cell(heading) + " |")
+		for x := 0; x < td.Width; x++ {
+			text.WriteString(" " + plan.ValueText(td.ValueDisplayMode, td.Value(x, y)) + " |")
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+
+}
+
+// fileLink returns a link to the file at the given (possibly project-relative) path, relative to the export directory if possible.
+func (mw *markdownWriter) fileLink(path string) string {
+
+	if path == "" {
+		return ""
+	}
+
+	path = mw.Project.PathToAbsolute(path, false)
+
+	if filepath.IsAbs(path) && mw.BaseDir != "" {
+		if rel, err := filepath.Rel(mw.BaseDir, path); err == nil {
+			path = rel
+		}
+	}
+
+	return strings.ReplaceAll(filepath.ToSlash(path), " ", "%20")
+
+}
+
+// anchor returns the anchor a heading with the given title gets (as GitHub generates them), making it unique within the file.
+func (mw *markdownWriter) anchor(title string) string {
+
+	slug := markdownSlug(title)
+	count := mw.anchors[slug]
+	mw.anchors[slug]++
+
+	if count > 0 {
+		return slug + "-" + strconv.Itoa(count)
+	}
+	return slug
+
+}
+
+func (mw *markdownWriter) uniqueFilename(name string) string {
+
+	filename := name + ".md"
+
+	for i := 2; ; i++ {
+		taken := false
+		for _, file := range mw.files {
+			if strings.EqualFold(file.Name, filename) {
+				taken = true
+			}
+		}
+		if !taken {
+			return filename
+		}
+		filename = fmt.Sprintf("%s_%d.md", name, i)
+	}
+
+}
+
+var markdownSlugRemove = regexp.MustCompile(`[^\p{L}\p{N}\s_-]`)
+
+// markdownSlug turns a heading into the anchor GitHub would generate for it.
+func markdownSlug(title string) string {
+	slug := markdownSlugRemove.ReplaceAllString(strings.ToLower(oneLine(title)), "")
+	return strings.ReplaceAll(strings.TrimSpace(slug), " ", "-")
+}
+
+var markdownSpecial = regexp.MustCompile("([\\\\`*_\\[\\]<>#])")
+
+// markdownEscape escapes the characters in the text that Markdown would otherwise read as formatting.
+func markdownEscape(text string) string {
+	return markdownSpecial.ReplaceAllString(text, "\\$1")
+}
+
+// WriteMarkdownFiles writes the exported Markdown files into the given directory.
+func WriteMarkdownFiles(files []*MarkdownFile, directory string) error {
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(directory, file.Name), []byte(file.Text), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportMarkdownHeadless loads the project at the given filepath without showing it and writes the whole project as Markdown to the given directory.
+// It's used by the export command.
+func ExportMarkdownHeadless(filename, passphrase string, subpageFiles bool, dir string) error {
+
+	closeHeadless, err := LoadHeadless(filename, passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer closeHeadless()
+
+	return WriteMarkdownFiles(ExportMarkdown(globals.Project, MarkdownScopeProject, subpageFiles, dir, exportBaseName(globals.Project)+"_Export"), dir)
+
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// ExportOPML returns the Page's stacks as an OPML document to be written to the given directory. Cards indented in a stack are nested under
+// the Card above them, and the Cards of Sub-Pages are nested under their Sub-Page Cards. Each Card's outline is made by plan.CardOutline(),
+// so the outlines can be imported as they were; filepaths are made relative to the directory.
+func ExportOPML(page *Page, dir string) *plan.OPML {
+	opml := plan.NewOPML(page.Name())
+	opml.Outlines = opmlOutlines(page, map[*Page]bool{page: true}, dir)
+	return opml
+}
+
+func opmlOutlines(page *Page, exported map[*Page]bool, dir string) []*plan.OPMLOutline {
+
+	outlines := []*plan.OPMLOutline{}
+
+	stacks, depths := StackedCards(page.Cards)
+
+	for i, stack := range stacks {
+
+		parents := []*plan.OPMLOutline{} // The last outline at each depth of the stack so far
+
+		for j, card := range stack {
+
+			outline := opmlOutline(card, exported, dir)
+			depth := depths[i][j]
+
+			// Sub-Page outlines hold their Sub-Page's Cards, so Cards indented under a Sub-Page Card are nested with it instead.
+			parent := depth - 1
+			for parent >= 0 && parents[parent].Attr("_cardType") == ContentTypeSubpage {
+				parent--
+			}
+
+			if parent >= 0 {
+				parents[parent].Outlines = append(parents[parent].Outlines, outline)
+			} else {
+				outlines = append(outlines, outline)
+			}
+
+			parents = append(parents[:depth], outline)
+
+		}
+
+	}
+
+	return outlines
+
+}
+
+func opmlOutline(card *Card, exported map[*Page]bool, dir string) *plan.OPMLOutline {
+
+	model := card.ToModel(true)
+	if fp := model.Properties.String("filepath"); fp != "" {
+		model.Properties.Set("filepath", card.Page.Project.PathToAbsolute(fp, false))
+	}
+
+	outline := plan.CardOutline(model, dir)
+
+	if sp, ok := card.Contents.(*SubPageContents); ok && card.ContentType == ContentTypeSubpage && sp.SubPage != nil && !exported[sp.SubPage] {
+		exported[sp.SubPage] = true
+		outline.Outlines = opmlOutlines(sp.SubPage, exported, dir)
+	}
+
+	return outline
+
+}
+
+// WriteOPML writes the OPML document to the given file.
+func WriteOPML(opml *plan.OPML, filename string) error {
+	data, err := opml.Serialize()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// ExportOPMLHeadless loads the project at the given filepath without showing it and writes its root Page (with its Sub-Pages nested) as
+// OPML to the given directory. It's used by the export command.
+func ExportOPMLHeadless(filename, passphrase string, dir string) error {
+
+	closeHeadless, err := LoadHeadless(filename, passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer closeHeadless()
+
+	return WriteOPML(ExportOPML(globals.Project.Pages[0], dir), filepath.Join(dir, exportBaseName(globals.Project)+"_Export.opml"))
+
+}
+
+// ImportOPML creates stacks of Cards on the Page from the OPML document's outlines at the given position, and selects them. Outlines become
+// the kind of Card they were exported from (see plan.OPMLOutline.Card()); others become Checkbox Cards if they have a checked state, and
+// otherwise Checkbox Cards or Notes, depending on the Import Bullets As setting. Nested outlines are indented in the stack, except that
+// outlines exported from Sub-Page Cards, and outlines with children nested subpageDepth or more levels deep (if subpageDepth is above 0),
+// become Sub-Page Cards holding their children. Relative filepaths are resolved against baseDir, the directory of the OPML file.
+func (page *Page) ImportOPML(opml *plan.OPML, pos Point, subpageDepth int, baseDir string) []*Card {
+
+	globals.EventLog.On = false
+
+	cards := page.importOPMLOutlines(opml.Outlines, pos, subpageDepth, baseDir)
+
+	globals.EventLog.On = true
+
+	page.Selection.Clear()
+	for _, card := range cards {
+		page.Selection.Add(card)
+	}
+
+	return cards
+
+}
+
+func (page *Page) importOPMLOutlines(outlines []*plan.OPMLOutline, pos Point, subpageDepth int, baseDir string) []*Card {
+
+	bulletType := ContentTypeCheckbox
+	if globals.Settings.Get(SettingsImportBulletsAs).AsString() == ImportBulletsAsNotes {
+		bulletType = ContentTypeNote
+	}
+
+	cards := []*Card{}
+	y := pos.Y
+
+	var importOutlines func(outlines []*plan.OPMLOutline, depth int)
+
+	importOutlines = func(outlines []*plan.OPMLOutline, depth int) {
+
+		for _, outline := range outlines {
+
+			contentType := outline.CardType(bulletType)
+
+			if len(outline.Outlines) > 0 && subpageDepth > 0 && depth >= subpageDepth {
+				contentType = ContentTypeSubpage
+			}
+
+			model := outline.Card(contentType, baseDir)
+			model.Rect.X = pos.X + float32(depth)*globals.GridSize
+			model.Rect.Y = y
+
+			// Cards are created like they are when loading a project, so their contents are made from their properties.
+			card := page.CreateNewCard(ContentTypeCheckbox)
+			card.FromModel(model)
+
+			switch contentType {
+			case ContentTypeCheckbox, ContentTypeNumbered, ContentTypeNote:
+				card.FitToText(card.Properties.Get("description").AsString())
+			}
+
+			card.LockPosition()
+
+			y += card.Rect.H
+			cards = append(cards, card)
+
+			if contentType == ContentTypeSubpage {
+				if sp, ok := card.Contents.(*SubPageContents); ok {
+					sp.SubPage.importOPMLOutlines(outline.Outlines, Point{}, subpageDepth, baseDir)
+					sp.SubPage.UpdateStacks = true
+				}
+			} else {
+				importOutlines(outline.Outlines, depth+1)
+			}
+
+		}
+
+	}
+
+	importOutlines(outlines, 0)
+
+	page.UpdateStacks = true
+
+	return cards
+
+}
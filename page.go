@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/solarlune/masterplan/plan"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"golang.design/x/clipboard"
@@ -33,17 +34,15 @@ type Page struct {
 	Zoom           float32
 
 	Arrowing             *Card // The card that we're in the process of linking from one to another
-	DeserializationLinks []string
+	DeserializationLinks []*plan.Link
 
 	PointingSubpageCard *Card
 }
 
-var globalPageID = uint64(0)
-
 func NewPage(project *Project) *Page {
 
 	page := &Page{
-		ID:        globalPageID,
+		ID:        project.nextPageID,
 		Project:   project,
 		Cards:     []*Card{},
 		Drawables: []*Drawable{},
@@ -53,11 +52,11 @@ func NewPage(project *Project) *Page {
 
 	page.Grid = NewGrid(page)
 
-	globalPageID++
+	project.nextPageID++
 
 	page.Selection = NewSelection(page)
 
-	globals.Hierarchy.AddPage(page)
+	project.Hierarchy.AddPage(page)
 
 	return page
 
@@ -238,60 +237,50 @@ func (page *Page) Name() string {
 	return "Root"
 }
 
-func (page *Page) Serialize() string {
-
-	pageData := "{}"
-
-	pageData, _ = sjson.Set(pageData, "id", page.ID)
-	pageData, _ = sjson.Set(pageData, "pan", page.Pan)
-	pageData, _ = sjson.Set(pageData, "zoom", page.Zoom)
+// ToModel returns the Page, along with all of its Cards, as a plan.Page.
+func (page *Page) ToModel() *plan.Page {
 
-	// Sort the cards by their position so the serialization is more stable. (Otherwise, clicking on
-	// a Card adjusts the sort order, and therefore the order in which Cards are serialized.)
-	cards := append([]*Card{}, page.Cards...)
+	model := plan.NewPage(page.ID)
+	model.Pan = plan.Point{X: page.Pan.X, Y: page.Pan.Y}
+	model.Zoom = page.Zoom
 
-	sort.Slice(cards, func(i, j int) bool {
-		return cards[i].Rect.Y < cards[j].Rect.Y || (cards[i].Rect.Y == cards[j].Rect.Y && cards[i].Rect.X < cards[j].Rect.X)
-	})
-
-	for _, card := range cards {
-		pageData, _ = sjson.SetRaw(pageData, "cards.-1", card.Serialize(true))
+	for _, card := range page.Cards {
+		model.Add(card.ToModel(true))
 	}
 
-	return pageData
+	return model
 
 }
 
-func (page *Page) DeserializePageData(data string) {
+func (page *Page) Serialize() string {
+	return page.ToModel().Serialize()
+}
 
-	if id := gjson.Get(data, "id"); id.Exists() {
-		page.ID = id.Uint()
-	}
+// DeserializePageData sets the Page's ID, pan, and zoom from the given plan.Page.
+func (page *Page) DeserializePageData(model *plan.Page) {
+
+	page.ID = model.ID
 
 	log.Println("Deserializing page ", page.ID)
 
-	lp := gjson.Get(data, "pan").Map()
-	page.Pan.X = float32(lp["X"].Float())
-	page.Pan.Y = float32(lp["Y"].Float())
-	page.Zoom = float32(gjson.Get(data, "zoom").Float())
-	if page.Zoom == 0 {
-		page.Zoom = 1
-	}
+	page.Pan = Point{model.Pan.X, model.Pan.Y}
+	page.Zoom = model.Zoom
 
-	if globalPageID < page.ID {
-		globalPageID = page.ID + 1
+	if page.Project.nextPageID < page.ID {
+		page.Project.nextPageID = page.ID + 1
 	}
 
 }
 
-func (page *Page) DeserializeCards(data string) {
+// DeserializeCards creates Cards on the Page for each Card in the given plan.Page.
+func (page *Page) DeserializeCards(model *plan.Page) {
 
-	for _, cardData := range gjson.Get(data, "cards").Array() {
+	for _, cardModel := range model.Cards {
 
-		log.Println("Deserializing card ", cardData.Get("id").Int())
+		log.Println("Deserializing card ", cardModel.ID)
 
 		newCard := page.CreateNewCard(ContentTypeCheckbox)
-		newCard.Deserialize(cardData.Raw)
+		newCard.FromModel(cardModel)
 
 	}
 
@@ -313,34 +302,32 @@ func (page *Page) RemoveDrawable(drawable *Drawable) {
 
 func (page *Page) UpdateLinks() {
 
-	for _, linkString := range page.DeserializationLinks {
+	for _, modelLink := range page.DeserializationLinks {
 
 		var start, end *Card
 
 		if page.Project.Loading {
-			start = page.CardByLoadedID(gjson.Get(linkString, "start").Int())
-			end = page.CardByLoadedID(gjson.Get(linkString, "end").Int())
+			start = page.CardByLoadedID(modelLink.Start)
+			end = page.CardByLoadedID(modelLink.End)
 		} else {
-			start = page.CardByID(gjson.Get(linkString, "start").Int())
-			end = page.CardByID(gjson.Get(linkString, "end").Int())
+			start = page.CardByID(modelLink.Start)
+			end = page.CardByID(modelLink.End)
 		}
 
 		if start != nil && end != nil {
 			link, fresh := start.Link(end)
-			joints := gjson.Get(linkString, "joints").Array()
 			// If the link wasn't freshly created, then the joints should have been set already
 			if link != nil && fresh {
 				link.Joints = []*LinkJoint{}
-				for _, joint := range joints {
-					jm := joint.Map()
-					link.Joints = append(link.Joints, NewLinkJoint(float32(jm["X"].Float()), float32(jm["Y"].Float())))
+				for _, joint := range modelLink.Joints {
+					link.Joints = append(link.Joints, NewLinkJoint(joint.X, joint.Y))
 				}
 			}
 		}
 
 	}
 
-	page.DeserializationLinks = []string{}
+	page.DeserializationLinks = []*plan.Link{}
 
 }
 
@@ -455,6 +442,11 @@ func (page *Page) PasteCards(offset Point, adhereToMousePosition bool) []*Card {
 		serialized := globals.CopyBuffer.CardsToSerialized[card]
 		serialized, _ = sjson.Set(serialized, "id", oldToNew[card].ID)
 
+		// Sub-pages belong to the project they were copied from, so sub-page Cards pasted into another project get a new, empty sub-page.
+		if card.Page.Project != page.Project {
+			serialized, _ = sjson.Delete(serialized, "properties.subpage")
+		}
+
 		if links := gjson.Get(serialized, "links"); links.Exists() {
 			for linkIndex, link := range links.Array() {
 				for old, new := range oldToNew {
@@ -586,7 +578,7 @@ func (page *Page) HandleExternalPaste() {
 
 	if clipboardImg := clipboard.Read(clipboard.FmtImage); clipboardImg != nil {
 
-		if filePath, err := WriteImageToTemp(clipboardImg); err != nil {
+		if filePath, err := WriteImageToTemp(page.Project.MediaDirectory(), clipboardImg); err != nil {
 			globals.EventLog.Log(err.Error(), false)
 		} else {
 
@@ -650,7 +642,16 @@ func (page *Page) HandleExternalPaste() {
 
 			todoList := strings.HasPrefix(tl[0], "[")
 
-			if todoList {
+			if plan.IsTSV(text) {
+
+				// Cells copied from a spreadsheet fill the selected Table, or a new one
+				if _, err := page.ImportTable(text, globals.Mouse.WorldPosition().LockToGrid()); err != nil {
+					globals.EventLog.Log("Error: Couldn't paste table: %s", true, err.Error())
+				} else {
+					globals.EventLog.Log("Pasted Table from clipboard content.", false)
+				}
+
+			} else if todoList {
 
 				linesOut := []string{}
 
@@ -688,8 +689,7 @@ func (page *Page) HandleExternalPaste() {
 						taskLine = taskLine[3:]
 						taskLine = strings.TrimSpace(taskLine)
 
-						textMeasure := globals.TextRenderer.MeasureText([]rune(taskLine), 1)
-						card.Recreate(textMeasure.X+(globals.GridSize*2), textMeasure.Y+(card.Contents.DefaultSize().Y-globals.GridSize))
+						card.FitToText(taskLine)
 
 						card.Properties.Get("description").Set(taskLine)
 
@@ -719,8 +719,7 @@ func (page *Page) HandleExternalPaste() {
 							card.Properties.Get("maximum").Set(max)
 						}
 
-						textMeasure := globals.TextRenderer.MeasureText([]rune(taskLineText), 1)
-						card.Recreate(textMeasure.X+(globals.GridSize*2), textMeasure.Y+(card.Contents.DefaultSize().Y-globals.GridSize))
+						card.FitToText(taskLineText)
 
 						card.Properties.Get("description").Set(taskLineText)
 
@@ -734,26 +733,22 @@ func (page *Page) HandleExternalPaste() {
 
 				globals.EventLog.Log("Pasted %d new Checkbox Tasks from clipboard content.", false, len(linesOut))
 
-			} else {
+			} else if _, outline := plan.ParseOutline(text); outline {
+
+				// Markdown lists, headings, and indented outlines become a stack of Cards
+				cards := page.ImportOutline(text, globals.Mouse.WorldPosition().LockToGrid())
 
-				maxWidth := float32(512)
+				globals.EventLog.Log("Pasted %d new Cards from clipboard content.", false, len(cards))
+
+			} else {
 
 				card := page.CreateNewCard(ContentTypeNote)
 				card.Properties.Get("description").Set(text)
-				size := globals.TextRenderer.MeasureText([]rune(text), 1)
 
 				note := card.Contents.(*NoteContents)
 				note.Label.SetText([]rune(text))
 
-				if size.X > maxWidth {
-					newSize := globals.TextRenderer.MeasureTextAutowrap(maxWidth, text)
-					card.Recreate(newSize.X+(globals.GridSize*4), newSize.Y)
-				} else {
-					width := size.X + (globals.GridSize * 2)
-					height := size.Y
-
-					card.Recreate(width, height)
-				}
+				card.FitToText(text)
 
 			}
 
@@ -833,6 +828,8 @@ func (page *Page) SelectNextCard() *Card {
 
 func (page *Page) SendMessage(msg *Message) {
 
+	PublishPageMessage(page, msg)
+
 	for _, card := range page.Cards {
 		card.ReceiveMessage(msg)
 	}
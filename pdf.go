@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signintech/gopdf"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// pdfScale is how many points a pixel of the world takes up in PDF exports, so text comes out at a readable size when printed.
+const pdfScale = 0.5
+
+// pdfMaxPageSize is the largest a PDF page can be on either side, in points.
+const pdfMaxPageSize = 14400
+
+// ExportPDF writes the Project as a PDF document to the given directory, with a page for each of its Pages. Everything is drawn as it is in
+// SVG exports (see drawVectorPage()), so text can be selected and searched. Pages come in the order they're reached from the root Page
+// (see exportPageTree()), and the document's bookmarks follow the same tree. Sub-Page Cards and Link Cards link to the pages they go to.
+func ExportPDF(project *Project, backgroundOption int, dir string) error {
+
+	pages, parents := exportPageTree(project)
+
+	areas := map[*Page]*sdl.FRect{}
+	anchors := map[*Page]string{}
+
+	// Bookmarks and link destinations are placed from the top of the document's default page size, rather than the page they're on, so it's
+	// made as big as the biggest page; that way they all point to the tops of their pages.
+	pageSize := gopdf.Rect{}
+
+	scale := float32(pdfScale)
+
+	for i, page := range pages {
+		area := exportArea(page)
+		areas[page] = area
+		anchors[page] = fmt.Sprintf("page-%d", i+1)
+		if area.W*scale > pdfMaxPageSize {
+			scale = pdfMaxPageSize / area.W
+		}
+		if area.H*scale > pdfMaxPageSize {
+			scale = pdfMaxPageSize / area.H
+		}
+	}
+
+	for _, area := range areas {
+		if w := float64(area.W * scale); w > pageSize.W {
+			pageSize.W = w
+		}
+		if h := float64(area.H * scale); h > pageSize.H {
+			pageSize.H = h
+		}
+	}
+
+	pdf := &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: pageSize})
+	pdf.SetInfo(gopdf.PdfInfo{Title: exportBaseName(project), Creator: "MasterPlan " + globals.Version.String(), CreationDate: time.Now()})
+
+	canvas := &pdfCanvas{
+		PDF:          pdf,
+		Scale:        float64(scale),
+		ConfigHeight: pageSize.H,
+		Anchors:      anchors,
+		Dropped:      map[rune]bool{},
+	}
+
+	// Characters the font doesn't have are drawn as a substitute, but noted so they can be reported.
+	fontOption := gopdf.TtfOption{
+		OnGlyphNotFound:           func(r rune) { canvas.Dropped[r] = true },
+		OnGlyphNotFoundSubstitute: gopdf.DefaultOnGlyphNotFoundSubstitute,
+	}
+
+	fontPath := globals.LoadedFontPath
+	if fontPath == "" || pdf.AddTTFFontWithOption("font", fontPath, fontOption) != nil {
+		if err := pdf.AddTTFFontWithOption("font", LocalRelativePath("assets/NotoSans-Bold.ttf"), fontOption); err != nil {
+			return err
+		}
+	}
+
+	outlines := map[*Page]*gopdf.OutlineNode{}
+	topOutlines := gopdf.OutlineNodes{}
+
+	for _, page := range pages {
+
+		area := areas[page]
+		canvas.Area = area
+		canvas.PageHeight = float64(area.H * scale)
+
+		pdf.AddPageWithOption(gopdf.PageOption{PageSize: &gopdf.Rect{W: float64(area.W * scale), H: canvas.PageHeight}})
+		pdf.SetX(0)
+		pdf.SetY(0)
+		pdf.SetAnchor(anchors[page])
+
+		outline := &gopdf.OutlineNode{Obj: pdf.AddOutlineWithPosition(oneLine(page.Name()))}
+		outlines[page] = outline
+		if parent := parents[page]; parent != nil {
+			outlines[parent].Children = append(outlines[parent].Children, outline)
+		} else {
+			topOutlines = append(topOutlines, outline)
+		}
+
+		drawVectorPage(page, canvas, backgroundOption, area)
+
+	}
+
+	topOutlines.Parse()
+
+	if len(canvas.Dropped) > 0 {
+		dropped := []rune{}
+		for r := range canvas.Dropped {
+			dropped = append(dropped, r)
+		}
+		sort.Slice(dropped, func(i, j int) bool { return dropped[i] < dropped[j] })
+		log.Printf("WARNING: PDF export: the font can't draw these characters, so they were substituted or left out: %q", string(dropped))
+	}
+
+	return pdf.WritePdf(filepath.Join(dir, exportBaseName(project)+"_Export.pdf"))
+
+}
+
+// ExportPDFHeadless loads the project at the given filepath without showing it and writes it as a PDF document to the given directory. It's
+// used by the export command.
+func ExportPDFHeadless(filename, passphrase string, backgroundOption int, dir string) error {
+
+	closeHeadless, err := LoadHeadless(filename, passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer closeHeadless()
+
+	return ExportPDF(globals.Project, backgroundOption, dir)
+
+}
+
+// pdfCanvas draws Pages onto the current page of a PDF document, with the given area of the world filling the page.
+type pdfCanvas struct {
+	PDF          *gopdf.GoPdf
+	Area         *sdl.FRect
+	Scale        float64
+	PageHeight   float64
+	ConfigHeight float64 // The height of the document's default page size
+	Anchors      map[*Page]string
+	Dropped      map[rune]bool // Characters the font couldn't draw
+}
+
+// point returns where the world position is on the page.
+func (pc *pdfCanvas) point(p Point) gopdf.Point {
+	return gopdf.Point{X: float64(p.X-pc.Area.X) * pc.Scale, Y: float64(p.Y-pc.Area.Y) * pc.Scale}
+}
+
+// paint sets the fill or stroke color, along with its transparency.
+func (pc *pdfCanvas) paint(color Color, stroke bool) {
+	if stroke {
+		pc.PDF.SetStrokeColor(color[0], color[1], color[2])
+	} else {
+		pc.PDF.SetFillColor(color[0], color[1], color[2])
+	}
+	pc.PDF.ClearTransparency()
+	if color[3] < 255 {
+		pc.PDF.SetTransparency(gopdf.Transparency{Alpha: float64(color[3]) / 255, BlendModeType: gopdf.NormalBlendMode})
+	}
+}
+
+func (pc *pdfCanvas) Rect(rect *sdl.FRect, radius float32, fill, stroke Color, strokeWidth float32) {
+
+	topLeft := pc.point(Point{rect.X, rect.Y})
+	bottomRight := pc.point(Point{rect.X + rect.W, rect.Y + rect.H})
+
+	r := float64(radius) * pc.Scale
+	if w := (bottomRight.X - topLeft.X) / 2; r > w {
+		r = w
+	}
+	if h := (bottomRight.Y - topLeft.Y) / 2; r > h {
+		r = h
+	}
+
+	if fill != nil {
+		pc.paint(fill, false)
+		pc.PDF.Rectangle(topLeft.X, topLeft.Y, bottomRight.X, bottomRight.Y, "F", r, 4)
+	}
+
+	if stroke != nil {
+		pc.paint(stroke, true)
+		pc.PDF.SetLineWidth(float64(strokeWidth) * pc.Scale)
+		pc.PDF.Rectangle(topLeft.X, topLeft.Y, bottomRight.X, bottomRight.Y, "D", r, 4)
+	}
+
+	pc.PDF.ClearTransparency()
+
+}
+
+func (pc *pdfCanvas) Polyline(points []Point, width float32, color Color) {
+
+	pc.paint(color, true)
+	pc.PDF.SetLineWidth(float64(width) * pc.Scale)
+
+	for i := 1; i < len(points); i++ {
+		start, end := pc.point(points[i-1]), pc.point(points[i])
+		pc.PDF.Line(start.X, start.Y, end.X, end.Y)
+	}
+
+	pc.PDF.ClearTransparency()
+
+	// Lines are drawn with square ends, so the points are rounded off to join them smoothly.
+	for _, p := range points {
+		pc.Circle(p, width/2, color, nil)
+	}
+
+}
+
+func (pc *pdfCanvas) Polygon(points []Point, fill, stroke Color) {
+
+	pdfPoints := []gopdf.Point{}
+	for _, p := range points {
+		pdfPoints = append(pdfPoints, pc.point(p))
+	}
+
+	if fill != nil {
+		pc.paint(fill, false)
+		pc.PDF.Polygon(pdfPoints, "F")
+	}
+
+	if stroke != nil {
+		pc.paint(stroke, true)
+		pc.PDF.SetLineWidth(2 * pc.Scale)
+		pc.PDF.Polygon(pdfPoints, "D")
+	}
+
+	pc.PDF.ClearTransparency()
+
+}
+
+func (pc *pdfCanvas) Circle(center Point, radius float32, fill, stroke Color) {
+	pc.Rect(&sdl.FRect{center.X - radius, center.Y - radius, radius * 2, radius * 2}, radius, fill, stroke, 2)
+}
+
+func (pc *pdfCanvas) Grid(rect *sdl.FRect, color Color) {
+
+	gs := globals.GridSize
+
+	pc.paint(color, true)
+	pc.PDF.SetLineWidth(pc.Scale)
+
+	topLeft := pc.point(Point{rect.X, rect.Y})
+	bottomRight := pc.point(Point{rect.X + rect.W, rect.Y + rect.H})
+
+	for x := float32(int(rect.X/gs)) * gs; x <= rect.X+rect.W; x += gs {
+		if x >= rect.X {
+			p := pc.point(Point{x, rect.Y})
+			pc.PDF.Line(p.X, topLeft.Y, p.X, bottomRight.Y)
+		}
+	}
+
+	for y := float32(int(rect.Y/gs)) * gs; y <= rect.Y+rect.H; y += gs {
+		if y >= rect.Y {
+			p := pc.point(Point{rect.X, y})
+			pc.PDF.Line(topLeft.X, p.Y, bottomRight.X, p.Y)
+		}
+	}
+
+	pc.PDF.ClearTransparency()
+
+}
+
+func (pc *pdfCanvas) Text(lines []string, pos Point, anchor string, color Color, vertical bool) {
+
+	pc.PDF.SetFont("font", "", float64(vectorFontSize)*pc.Scale)
+	pc.PDF.SetTextColor(color[0], color[1], color[2])
+
+	origin := pc.point(pos)
+
+	if vertical {
+		pc.PDF.Rotate(90, origin.X, origin.Y)
+	}
+
+	for i, line := range lines {
+
+		line = pc.drawableText(line)
+
+		x := origin.X
+		if width, err := pc.PDF.MeasureTextWidth(line); err == nil {
+			switch anchor {
+			case "middle":
+				x -= width / 2
+			case "end":
+				x -= width
+			}
+		}
+
+		pc.PDF.SetX(x)
+		pc.PDF.SetY(origin.Y + float64(vectorBaseline+float32(i)*globals.GridSize)*pc.Scale)
+		if err := pc.PDF.Text(line); err != nil {
+			log.Println("ERROR: PDF export couldn't draw text: ", err.Error())
+		}
+
+	}
+
+	if vertical {
+		pc.PDF.RotateReset()
+	}
+
+}
+
+// drawableText returns the text without any characters gopdf fails to draw in the current font (which would otherwise leave out the whole
+// text), noting them in Dropped.
+func (pc *pdfCanvas) drawableText(text string) string {
+
+	if _, err := pc.PDF.MeasureTextWidth(text); err == nil {
+		return text
+	}
+
+	drawable := strings.Builder{}
+
+	for _, r := range text {
+		if _, err := pc.PDF.MeasureTextWidth(string(r)); err == nil {
+			drawable.WriteRune(r)
+		} else {
+			pc.Dropped[r] = true
+		}
+	}
+
+	return drawable.String()
+
+}
+
+func (pc *pdfCanvas) Image(filename string, rect *sdl.FRect) bool {
+
+	topLeft := pc.point(Point{rect.X, rect.Y})
+	size := &gopdf.Rect{W: float64(rect.W) * pc.Scale, H: float64(rect.H) * pc.Scale}
+
+	// gopdf reads JPEGs and PNGs itself; other images are decoded first.
+	if pc.PDF.Image(filename, topLeft.X, topLeft.Y, size) == nil {
+		return true
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return false
+	}
+
+	return pc.PDF.ImageFrom(img, topLeft.X, topLeft.Y, size) == nil
+
+}
+
+func (pc *pdfCanvas) BeginCard(card *Card, target *Page) {}
+
+func (pc *pdfCanvas) BeginLink(link *LinkEnding) {}
+
+func (pc *pdfCanvas) EndLink(link *LinkEnding) {}
+
+func (pc *pdfCanvas) EndCard(card *Card, target *Page) {
+
+	anchor := pc.Anchors[target]
+	if target == nil || anchor == "" {
+		return
+	}
+
+	topLeft := pc.point(Point{card.Rect.X, card.Rect.Y})
+
+	// gopdf places links from the top of the document's default page size rather than the current page's, so they're moved to make up for it.
+	pc.PDF.AddInternalLink(anchor, topLeft.X, topLeft.Y+pc.ConfigHeight-pc.PageHeight, float64(card.Rect.W)*pc.Scale, float64(card.Rect.H)*pc.Scale)
+
+}
@@ -0,0 +1,326 @@
+package plan
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BundleExtension is the file extension of project bundles - zip archives containing the project (BundleProjectFile) and every file
+// its Cards point to (in BundleMediaDirectory), so the project can be moved to another machine and still open intact.
+const BundleExtension = ".planz"
+
+const (
+	BundleProjectFile    = "project.json"
+	BundleMediaDirectory = "media/"
+)
+
+// IsBundleData returns if the given (decrypted) data is a project bundle, rather than a plain project.
+func IsBundleData(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// IsBundle returns if the file at the given filepath is an unencrypted project bundle, rather than a plain .plan file.
+func IsBundle(filePath string) bool {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+
+	return IsBundleData(header)
+
+}
+
+// Clone returns a deep copy of the Project.
+func (project *Project) Clone() *Project {
+
+	clone := &Project{
+		Version:     project.Version,
+		Pan:         project.Pan,
+		Zoom:        project.Zoom,
+		CurrentPage: project.CurrentPage,
+		Properties:  project.Properties.Clone(),
+		Pages:       []*Page{},
+		SavedImages: map[string][]byte{},
+		Passphrase:  project.Passphrase,
+		Keys:        project.keys(),
+	}
+
+	for fp, data := range project.SavedImages {
+		clone.SavedImages[fp] = append([]byte{}, data...)
+	}
+
+	for _, page := range project.Pages {
+
+		pageClone := NewPage(page.ID)
+		pageClone.Pan = page.Pan
+		pageClone.Zoom = page.Zoom
+
+		for _, card := range page.Cards {
+
+			cardClone := *card
+			cardClone.Properties = card.Properties.Clone()
+			cardClone.Links = []*Link{}
+			for _, link := range card.Links {
+				cardClone.Links = append(cardClone.Links, &Link{Start: link.Start, End: link.End, Joints: append([]Point{}, link.Joints...)})
+			}
+			pageClone.Add(&cardClone)
+
+		}
+
+		clone.addParsedPage(pageClone)
+
+	}
+
+	return clone
+
+}
+
+// SaveBundle writes the Project as a bundle to the given filepath. Every file that a Card's "filepath" property points to (and every
+// saved image) is copied into the bundle, and the property is rewritten to point to the copy. Relative filepaths are resolved against the
+// bundle's directory. Filepaths that don't point to local files (URLs, for example) are left as they are. The Project itself isn't modified.
+func (project *Project) SaveBundle(bundlePath string) error {
+
+	project = project.Clone()
+
+	baseDir := filepath.Dir(bundlePath)
+
+	media := map[string][]byte{}
+	mediaNames := map[string]string{} // Source filepath to path within the bundle
+	mediaOrder := []string{}
+
+	addMedia := func(source string, data []byte) string {
+
+		if name, exists := mediaNames[source]; exists {
+			return name
+		}
+
+		base := filepath.Base(filepath.FromSlash(source))
+		ext := path.Ext(base)
+		name := BundleMediaDirectory + base
+		for i := 2; media[name] != nil; i++ {
+			name = BundleMediaDirectory + strings.TrimSuffix(base, ext) + "_" + strconv.Itoa(i) + ext
+		}
+
+		media[name] = data
+		mediaNames[source] = name
+		mediaOrder = append(mediaOrder, name)
+		return name
+
+	}
+
+	for _, page := range project.Pages {
+
+		for _, card := range page.Cards {
+
+			fp := card.Properties.String("filepath")
+			if fp == "" {
+				continue
+			}
+
+			if data, saved := project.SavedImages[fp]; saved {
+				card.Properties.Set("filepath", addMedia(fp, data))
+				card.Properties.Remove("saveimage")
+				continue
+			}
+
+			local := filepath.FromSlash(fp)
+			if !filepath.IsAbs(local) {
+				local = filepath.Join(baseDir, local)
+			}
+
+			if info, err := os.Stat(local); err != nil || info.IsDir() {
+				continue
+			}
+
+			data, err := os.ReadFile(local)
+			if err != nil {
+				return err
+			}
+
+			card.Properties.Set("filepath", addMedia(local, data))
+
+		}
+
+	}
+
+	// Everything that was saved as an image is in the media folder now.
+	project.SavedImages = map[string][]byte{}
+
+	out := &bytes.Buffer{}
+	archive := zip.NewWriter(out)
+
+	writer, err := archive.Create(BundleProjectFile)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write([]byte(project.Serialize())); err != nil {
+		return err
+	}
+
+	for _, name := range mediaOrder {
+		// Media are usually compressed already, so they're just stored.
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(media[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	// Encrypting the bundle as a whole encrypts the media along with the project.
+	data, err := project.encode(out.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return WriteFileVerified(bundlePath, data, func(data []byte) error {
+		decoded, err := project.decode(data)
+		if err == nil {
+			_, _, err = parseBundle(decoded)
+		}
+		return err
+	})
+
+}
+
+// ReadBundle reads the project bundle at the given filepath, returning the Project and the contents of the bundle's media files, keyed by their
+// path within the bundle (which is what the Project's Cards' "filepath" properties point to).
+func ReadBundle(bundlePath string) (*Project, map[string][]byte, error) {
+
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project, media, err := parseBundle(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't read bundle %s: %w", bundlePath, err)
+	}
+
+	return project, media, nil
+
+}
+
+func parseBundle(data []byte) (*Project, map[string][]byte, error) {
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var project *Project
+	media := map[string][]byte{}
+
+	for _, file := range archive.File {
+
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if file.Name == BundleProjectFile {
+			if project, err = Parse(data); err != nil {
+				return nil, nil, err
+			}
+		} else if strings.HasPrefix(file.Name, BundleMediaDirectory) {
+			media[file.Name] = data
+		}
+
+	}
+
+	if project == nil {
+		return nil, nil, fmt.Errorf("no %s in bundle", BundleProjectFile)
+	}
+
+	return project, media, nil
+
+}
+
+// LoadBundle loads the project bundle at the given filepath, extracting its media files into mediaDir and pointing the Project's Cards to
+// the extracted files.
+func LoadBundle(bundlePath, mediaDir string) (*Project, error) {
+
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := ExtractBundle(data, mediaDir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read bundle %s: %w", bundlePath, err)
+	}
+
+	return project, nil
+
+}
+
+// ExtractBundle parses the given project bundle, extracting its media files into mediaDir and pointing the Project's Cards to the extracted files.
+func ExtractBundle(data []byte, mediaDir string) (*Project, error) {
+
+	project, media, err := parseBundle(data)
+	if err != nil {
+		return nil, err
+	}
+
+	extracted := map[string]string{}
+
+	for name, data := range media {
+
+		// Guard against entries that would be extracted outside of the media directory.
+		target := filepath.Join(mediaDir, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(mediaDir, target); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("invalid media path: %s", name)
+		}
+
+		// Media may come from an encrypted bundle, so only the current user can read them.
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile(target, data, 0600); err != nil {
+			return nil, err
+		}
+
+		extracted[name] = target
+
+	}
+
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			if target, exists := extracted[card.Properties.String("filepath")]; exists {
+				card.Properties.Set("filepath", target)
+			}
+		}
+	}
+
+	return project, nil
+
+}
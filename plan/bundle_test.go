@@ -0,0 +1,99 @@
+package plan
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "project"+BundleExtension)
+
+	picture := []byte("not really a png")
+	if err := os.WriteFile(filepath.Join(dir, "picture.png"), picture, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	screenshot := []byte("pasted image")
+
+	project := NewProject()
+
+	linked := project.Root().AddCard(ContentTypeImage)
+	linked.Properties.Set("filepath", "picture.png")
+
+	pasted := project.Root().AddCard(ContentTypeImage)
+	pasted.Properties.Set("filepath", "/tmp/screenshot_1.png")
+	pasted.Properties.Set("saveimage", true)
+	project.SavedImages["/tmp/screenshot_1.png"] = screenshot
+
+	web := project.Root().AddCard(ContentTypeImage)
+	web.Properties.Set("filepath", "https://example.com/image.png")
+
+	if err := project.SaveBundle(bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsBundle(bundlePath) {
+		t.Fatal("saved file isn't a bundle")
+	}
+
+	if linked.Properties.String("filepath") != "picture.png" || len(project.SavedImages) != 1 {
+		t.Error("saving a bundle modified the project")
+	}
+
+	read, media, err := ReadBundle(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(media) != 2 {
+		t.Fatalf("bundle has %d media files, not 2", len(media))
+	}
+
+	for _, test := range []struct {
+		card *Card
+		data []byte
+	}{
+		{linked, picture},
+		{pasted, screenshot},
+	} {
+		card := read.FindCard(test.card.ID)
+		fp := card.Properties.String("filepath")
+		if !strings.HasPrefix(fp, BundleMediaDirectory) || !bytes.Equal(media[fp], test.data) {
+			t.Errorf("card %d points to %q in the bundle", card.ID, fp)
+		}
+	}
+
+	if read.FindCard(pasted.ID).Properties.Has("saveimage") || len(read.SavedImages) != 0 {
+		t.Error("saved image wasn't moved into the bundle's media")
+	}
+
+	if fp := read.FindCard(web.ID).Properties.String("filepath"); fp != "https://example.com/image.png" {
+		t.Errorf("URL was changed to %q", fp)
+	}
+
+	mediaDir := filepath.Join(dir, "extracted")
+
+	loaded, err := LoadBundle(bundlePath, mediaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		card *Card
+		data []byte
+	}{
+		{linked, picture},
+		{pasted, screenshot},
+	} {
+		fp := loaded.FindCard(test.card.ID).Properties.String("filepath")
+		if data, err := os.ReadFile(fp); err != nil || !bytes.Equal(data, test.data) || !strings.HasPrefix(fp, mediaDir) {
+			t.Errorf("card %d's media was extracted to %q", test.card.ID, fp)
+		}
+	}
+
+}
@@ -0,0 +1,295 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProjectCalendarFeed is the name of the per-project property that, when true, has an iCalendar file of the Project's deadlines written next
+// to it whenever it's saved (see Calendar()).
+const ProjectCalendarFeed = "CalendarFeed"
+
+// CalendarFeedPath returns the path of the calendar feed for the project file at the given path - the same path, with an .ics extension.
+func CalendarFeedPath(projectPath string) string {
+	return strings.TrimSuffix(projectPath, filepath.Ext(projectPath)) + ".ics"
+}
+
+// PagePath returns the names of the Page and the Pages above it, starting from the root Page.
+func (project *Project) PagePath(page *Page) []string {
+
+	path := []string{project.PageName(page)}
+	visited := map[*Page]bool{page: true}
+
+	for sp := project.SubpageCard(page); sp != nil && sp.Page != nil && !visited[sp.Page]; sp = project.SubpageCard(sp.Page) {
+		visited[sp.Page] = true
+		path = append([]string{project.PageName(sp.Page)}, path...)
+	}
+
+	return path
+
+}
+
+// Calendar returns an iCalendar (RFC 5545) document with a to-do for each Card with a deadline, due on that date. Each to-do has the
+// Card's name as its summary, the path of the Page it's on as its description, whether it's completed as its status, and a UID made from
+// the Card's ID (and the Project's Identifier(), so Cards in different projects don't clash), so calendar apps can follow a Card between saves.
+func (project *Project) Calendar(name string, now time.Time) string {
+
+	type todo struct {
+		card *Card
+		due  time.Time
+	}
+
+	todos := []todo{}
+
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			if due, err := time.Parse(DeadlineFormat, card.Properties.String("deadline")); err == nil {
+				todos = append(todos, todo{card: card, due: due})
+			}
+		}
+	}
+
+	sort.SliceStable(todos, func(i, j int) bool {
+		if !todos[i].due.Equal(todos[j].due) {
+			return todos[i].due.Before(todos[j].due)
+		}
+		return todos[i].card.ID < todos[j].card.ID
+	})
+
+	id := project.Identifier()
+
+	calendar := &strings.Builder{}
+
+	writeLine := func(property, value string) {
+		calendar.WriteString(foldCalendarLine(property + ":" + value))
+	}
+
+	writeLine("BEGIN", "VCALENDAR")
+	writeLine("VERSION", "2.0")
+	writeLine("PRODID", "-//SolarLune//MasterPlan "+Version+"//EN")
+	writeLine("CALSCALE", "GREGORIAN")
+	writeLine("X-WR-CALNAME", escapeCalendarText(name))
+
+	for _, todo := range todos {
+
+		card := todo.card
+
+		writeLine("BEGIN", "VTODO")
+		writeLine("UID", fmt.Sprintf("card-%d-%s@masterplan", card.ID, id))
+		writeLine("DTSTAMP", now.UTC().Format("20060102T150405Z"))
+		writeLine("SUMMARY", escapeCalendarText(strings.Join(strings.Fields(card.Name()), " ")))
+		writeLine("DESCRIPTION", escapeCalendarText(strings.Join(project.PagePath(card.Page), " / ")))
+		writeLine("DUE;VALUE=DATE", todo.due.Format("20060102"))
+
+		if card.Completed() {
+			writeLine("STATUS", "COMPLETED")
+			writeLine("PERCENT-COMPLETE", "100")
+		} else {
+			writeLine("STATUS", "NEEDS-ACTION")
+		}
+
+		writeLine("END", "VTODO")
+
+	}
+
+	writeLine("END", "VCALENDAR")
+
+	return calendar.String()
+
+}
+
+// WriteCalendarFeed writes the Project's calendar (see Calendar()) to the feed of the project file at projectPath (see CalendarFeedPath()) if
+// the Project has its ProjectCalendarFeed property set. Encrypted Projects don't have a feed, as calendar apps couldn't read it if it were
+// encrypted too.
+func (project *Project) WriteCalendarFeed(projectPath string) error {
+
+	if !project.Properties.Bool(ProjectCalendarFeed) || project.Passphrase != "" {
+		return nil
+	}
+
+	name := strings.TrimSuffix(filepath.Base(projectPath), filepath.Ext(projectPath))
+
+	return WriteFileVerified(CalendarFeedPath(projectPath), []byte(project.Calendar(name, time.Now())), nil)
+
+}
+
+// escapeCalendarText escapes text for an iCalendar TEXT value.
+func escapeCalendarText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// foldCalendarLine ends an iCalendar content line with CRLF, folding it so no line is longer than 75 bytes (without splitting characters).
+func foldCalendarLine(line string) string {
+
+	folded := &strings.Builder{}
+	length := 0
+
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+		folded.WriteRune(r)
+		length += size
+	}
+
+	folded.WriteString("\r\n")
+
+	return folded.String()
+
+}
+
+// CalendarEntry is an event (VEVENT) or to-do (VTODO) read from an iCalendar document.
+type CalendarEntry struct {
+	UID       string
+	Summary   string
+	Date      time.Time // When the event starts, or when the to-do is due (or starts, if it has no due date); zero if it has neither
+	Todo      bool
+	Completed bool // If the to-do is completed
+}
+
+// ParseCalendar reads the events and to-dos of an iCalendar (RFC 5545) document, sorted by date; entries without a date come last. Cancelled
+// entries are skipped. Dates with times are converted to the local time zone.
+func ParseCalendar(data []byte) ([]*CalendarEntry, error) {
+
+	// Lines starting with a space or tab continue the line before them.
+	text := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(string(data))
+
+	if !strings.Contains(strings.ToUpper(text), "BEGIN:VCALENDAR") {
+		return nil, errors.New("data isn't an iCalendar document")
+	}
+
+	entries := []*CalendarEntry{}
+
+	var entry *CalendarEntry
+	var due, start time.Time
+	cancelled := false
+	nested := 0 // How many components (like alarms) deep in the entry the line is
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+
+		params := strings.Split(line[:colon], ";")
+		name := strings.ToUpper(params[0])
+		value := line[colon+1:]
+
+		switch name {
+
+		case "BEGIN":
+			if component := strings.ToUpper(value); entry == nil && (component == "VEVENT" || component == "VTODO") {
+				entry = &CalendarEntry{Todo: component == "VTODO"}
+				due, start = time.Time{}, time.Time{}
+				cancelled = false
+				continue
+			} else if entry != nil {
+				nested++
+			}
+
+		case "END":
+			if entry != nil && nested > 0 {
+				nested--
+				continue
+			} else if entry != nil {
+				entry.Date = start
+				if entry.Todo && !due.IsZero() {
+					entry.Date = due
+				}
+				if !cancelled {
+					entries = append(entries, entry)
+				}
+				entry = nil
+			}
+
+		}
+
+		if entry == nil || nested > 0 {
+			continue
+		}
+
+		switch name {
+
+		case "UID":
+			entry.UID = value
+
+		case "SUMMARY":
+			entry.Summary = unescapeCalendarText(value)
+
+		case "DTSTART":
+			start = parseCalendarDate(params[1:], value)
+
+		case "DUE":
+			due = parseCalendarDate(params[1:], value)
+
+		case "STATUS":
+			switch strings.ToUpper(value) {
+			case "COMPLETED":
+				entry.Completed = true
+			case "CANCELLED":
+				cancelled = true
+			}
+
+		case "COMPLETED":
+			entry.Completed = true
+
+		case "PERCENT-COMPLETE":
+			if value == "100" {
+				entry.Completed = true
+			}
+
+		}
+
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date.IsZero() != entries[j].Date.IsZero() {
+			return !entries[i].Date.IsZero()
+		}
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	return entries, nil
+
+}
+
+// parseCalendarDate parses an iCalendar DATE or DATE-TIME value, with its parameters (for its time zone). It returns a zero time if the
+// value can't be parsed.
+func parseCalendarDate(params []string, value string) time.Time {
+
+	location := time.Local
+	for _, param := range params {
+		if strings.HasPrefix(strings.ToUpper(param), "TZID=") {
+			if tz, err := time.LoadLocation(strings.Trim(param[5:], `"`)); err == nil {
+				location = tz
+			}
+		}
+	}
+
+	if date, err := time.ParseInLocation("20060102T150405Z", value, time.UTC); err == nil {
+		return date.Local()
+	}
+
+	if date, err := time.ParseInLocation("20060102T150405", value, location); err == nil {
+		return date.Local()
+	}
+
+	if date, err := time.ParseInLocation("20060102", value, time.Local); err == nil {
+		return date
+	}
+
+	return time.Time{}
+
+}
+
+// unescapeCalendarText reverses escapeCalendarText().
+func unescapeCalendarText(text string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(text)
+}
@@ -0,0 +1,148 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+
+	project := NewProject()
+	project.Properties.Set(ProjectIdentifier, "0123abcd")
+
+	sub := project.Root().AddCard(ContentTypeSubpage)
+	sub.Properties.Set("description", "Chores, Weekly")
+	page := project.AddPage()
+	sub.Properties.Set("subpage", float64(page.ID))
+
+	later := page.AddCard(ContentTypeCheckbox)
+	later.Properties.Set("description", "Take out the trash")
+	later.Properties.Set("deadline", "2026-11-02")
+	later.Properties.Set("checked", true)
+
+	sooner := project.Root().AddCard(ContentTypeNumbered)
+	sooner.Properties.Set("description", "Pages read")
+	sooner.Properties.Set("deadline", "2026-11-01")
+	sooner.Properties.Set("current", 3.0)
+	sooner.Properties.Set("maximum", 10.0)
+
+	project.Root().AddCard(ContentTypeNote).Properties.Set("description", "No deadline")
+
+	calendar := project.Calendar("Home", time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+
+	if strings.Count(calendar, "BEGIN:VTODO") != 2 {
+		t.Fatalf("expected two to-dos:\n%s", calendar)
+	}
+
+	for _, expected := range []string{
+		"UID:card-" + strconv.FormatInt(sooner.ID, 10) + "-0123abcd@masterplan\r\n",
+		"DTSTAMP:20261018T120000Z\r\n",
+		"DESCRIPTION:Root / Chores\\, Weekly\r\n",
+		"DUE;VALUE=DATE:20261102\r\nSTATUS:COMPLETED\r\n",
+		"DUE;VALUE=DATE:20261101\r\nSTATUS:NEEDS-ACTION\r\n",
+	} {
+		if !strings.Contains(calendar, expected) {
+			t.Errorf("calendar doesn't contain %q:\n%s", expected, calendar)
+		}
+	}
+
+	if strings.Index(calendar, "Pages read") > strings.Index(calendar, "Take out the trash") {
+		t.Error("to-dos aren't sorted by their due dates")
+	}
+
+	if folded := foldCalendarLine(strings.Repeat("é", 60)); strings.Contains(folded, "\r\n \r\n") || len(strings.Split(folded, "\r\n")[0]) > 75 {
+		t.Errorf("line wasn't folded correctly: %q", folded)
+	}
+
+}
+
+func TestParseCalendar(t *testing.T) {
+
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\nUID:release@example.com\r\nSUMMARY:Release\\, v2\r\nDTSTART;VALUE=DATE:20261120\r\n" +
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nSUMMARY:Not the event\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+		"BEGIN:VTODO\r\nUID:sprint@example.com\r\nSUMMARY:Sprint planning with a\r\n  long summary\r\nDTSTART:20261101T090000\r\nDUE:20261102T170000\r\n" +
+		"STATUS:COMPLETED\r\nEND:VTODO\r\n" +
+		"BEGIN:VEVENT\r\nUID:cancelled@example.com\r\nSUMMARY:Cancelled\r\nDTSTART:20261105\r\nSTATUS:CANCELLED\r\nEND:VEVENT\r\n" +
+		"BEGIN:VTODO\r\nUID:someday@example.com\r\nSUMMARY:Someday\r\nEND:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+
+	entries, err := ParseCalendar([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	if entries[0].UID != "sprint@example.com" || entries[0].Summary != "Sprint planning with a long summary" || !entries[0].Completed ||
+		entries[0].Date.Format(DeadlineFormat) != "2026-11-02" {
+		t.Errorf("to-do wasn't read correctly: %+v", entries[0])
+	}
+
+	if entries[1].Summary != "Release, v2" || entries[1].Todo || entries[1].Date.Format(DeadlineFormat) != "2026-11-20" {
+		t.Errorf("event wasn't read correctly: %+v", entries[1])
+	}
+
+	if entries[2].UID != "someday@example.com" || !entries[2].Date.IsZero() {
+		t.Errorf("to-do without a date wasn't last: %+v", entries[2])
+	}
+
+	// The calendar feed is read back the same way.
+	project := NewProject()
+	card := project.Root().AddCard(ContentTypeCheckbox)
+	card.Properties.Set("description", "Ship it")
+	card.Properties.Set("deadline", "2026-12-01")
+
+	entries, err = ParseCalendar([]byte(project.Calendar("Work", time.Now())))
+	if err != nil || len(entries) != 1 || entries[0].Summary != "Ship it" || entries[0].Date.Format(DeadlineFormat) != "2026-12-01" {
+		t.Errorf("calendar feed wasn't read back: %v %+v", err, entries)
+	}
+
+	if _, err := ParseCalendar([]byte("not a calendar")); err == nil {
+		t.Error("expected an error for data that isn't a calendar")
+	}
+
+}
+
+func TestWriteCalendarFeed(t *testing.T) {
+
+	dir := t.TempDir()
+	projectPath := filepath.Join(dir, "project.plan")
+
+	project := NewProject()
+	project.Root().AddCard(ContentTypeCheckbox).Properties.Set("deadline", "2026-11-01")
+
+	if err := project.WriteCalendarFeed(projectPath); err != nil || fileExists(CalendarFeedPath(projectPath)) {
+		t.Fatalf("feed was written without being turned on (%v)", err)
+	}
+
+	project.Properties.Set(ProjectCalendarFeed, true)
+	project.Passphrase = "passphrase"
+
+	if err := project.WriteCalendarFeed(projectPath); err != nil || fileExists(CalendarFeedPath(projectPath)) {
+		t.Fatalf("feed was written for an encrypted project (%v)", err)
+	}
+
+	project.Passphrase = ""
+
+	if err := project.WriteCalendarFeed(projectPath); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(CalendarFeedPath(projectPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := project.Identifier()
+	if len(id) != 32 || !strings.Contains(string(data), "-"+id+"@masterplan") {
+		t.Errorf("feed's UIDs don't use the project's identifier %q:\n%s", id, data)
+	}
+
+}
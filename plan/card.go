@@ -0,0 +1,339 @@
+package plan
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Link is a link (arrow) from one Card to another on the same Page, with any joints the line bends at.
+type Link struct {
+	Start  int64
+	End    int64
+	Joints []Point
+}
+
+func (link *Link) Serialize() string {
+
+	joints := link.Joints
+	if joints == nil {
+		joints = []Point{}
+	}
+
+	data := "{}"
+	data, _ = sjson.Set(data, "start", link.Start)
+	data, _ = sjson.Set(data, "end", link.End)
+	data, _ = sjson.Set(data, "joints", joints)
+	return data
+
+}
+
+func ParseLink(data string) *Link {
+
+	link := &Link{
+		Start:  gjson.Get(data, "start").Int(),
+		End:    gjson.Get(data, "end").Int(),
+		Joints: []Point{},
+	}
+
+	for _, joint := range gjson.Get(data, "joints").Array() {
+		link.Joints = append(link.Joints, Point{float32(joint.Get("X").Float()), float32(joint.Get("Y").Float())})
+	}
+
+	return link
+
+}
+
+type Card struct {
+	ID              int64
+	Page            *Page
+	Rect            Rect
+	Collapsed       string
+	UncollapsedSize Point
+	ContentType     string
+	CustomColor     string // Hex string (RRGGBBAA); empty if the Card uses the theme's colors
+	FontColor       string // Hex string (RRGGBBAA); empty if the Card uses the theme's colors
+	Properties      *Properties
+	Links           []*Link
+}
+
+// NewCard creates a new Card of the given content type and default size; it isn't added to any Page.
+func NewCard(id int64, contentType string) *Card {
+	size := DefaultCardSize(contentType)
+	return &Card{
+		ID:          id,
+		Rect:        Rect{0, 0, size.X, size.Y},
+		Collapsed:   CollapsedNone,
+		ContentType: contentType,
+		Properties:  NewProperties(),
+		Links:       []*Link{},
+	}
+}
+
+// Name returns the name of the card - this is usually its description, but can also be the file name for images or sounds, or just "Map" for maps.
+func (card *Card) Name() string {
+
+	switch card.ContentType {
+	case ContentTypeImage:
+		fallthrough
+	case ContentTypeSound:
+		if fp := card.Properties.String("filepath"); fp != "" {
+			_, fn := filepath.Split(fp)
+			return fn
+		} else if card.ContentType == ContentTypeImage {
+			return "No Image Loaded"
+		}
+		return "No Sound Loaded"
+	case ContentTypeMap:
+		return "Map"
+	case ContentTypeTable:
+		return "Table"
+	case ContentTypeWeb:
+		return "Web"
+	}
+
+	return card.Properties.String("description")
+
+}
+
+func (card *Card) Numberable() bool {
+	return card.ContentType == ContentTypeCheckbox || card.ContentType == ContentTypeNumbered || card.ContentType == ContentTypeTable
+}
+
+func (card *Card) Completable() bool {
+	return card.ContentType == ContentTypeCheckbox || card.ContentType == ContentTypeNumbered
+}
+
+// CompletionLevel returns how far along the Card is, as MasterPlan counts it: 1 for a checked Checkbox, the current value of a Numbered Card
+// (up to its maximum), or the number of checked cells in a Table. A Checkbox with dependent Cards (see dependentCards()) counts theirs instead.
+func (card *Card) CompletionLevel() float32 {
+	return card.completionLevel(map[*Card]bool{})
+}
+
+// MaximumCompletionLevel returns the CompletionLevel() the Card has when it's completed.
+func (card *Card) MaximumCompletionLevel() float32 {
+	return card.maximumCompletionLevel(map[*Card]bool{})
+}
+
+// Completed returns if the Card is completed - a checked Checkbox (or one with all of its dependent Cards completed), a Numbered Card at its
+// maximum, or a Table with every cell checked.
+func (card *Card) Completed() bool {
+	max := card.MaximumCompletionLevel()
+	return max > 0 && card.CompletionLevel() >= max
+}
+
+// completionLevel and maximumCompletionLevel skip Cards that are already being counted, in case dependent Cards lead back to themselves.
+func (card *Card) completionLevel(counting map[*Card]bool) float32 {
+
+	counting[card] = true
+	defer delete(counting, card)
+
+	switch card.ContentType {
+
+	case ContentTypeCheckbox:
+		if dependents := card.dependentCards(); len(dependents) > 0 {
+			level := float32(0)
+			for _, dependent := range dependents {
+				if !counting[dependent] {
+					level += dependent.completionLevel(counting)
+				}
+			}
+			return level
+		}
+		if card.Properties.Bool("checked") {
+			return 1
+		}
+
+	case ContentTypeNumbered:
+		current, max := float32(card.Properties.Float("current")), float32(card.Properties.Float("maximum"))
+		if current > max {
+			return max
+		}
+		return current
+
+	case ContentTypeTable:
+		return card.TableData().CompletionLevel()
+
+	}
+
+	return 0
+
+}
+
+func (card *Card) maximumCompletionLevel(counting map[*Card]bool) float32 {
+
+	counting[card] = true
+	defer delete(counting, card)
+
+	switch card.ContentType {
+
+	case ContentTypeCheckbox:
+		if dependents := card.dependentCards(); len(dependents) > 0 {
+			max := float32(0)
+			for _, dependent := range dependents {
+				if !counting[dependent] {
+					max += dependent.maximumCompletionLevel(counting)
+				}
+			}
+			return max
+		}
+		return 1
+
+	case ContentTypeNumbered:
+		return float32(card.Properties.Float("maximum"))
+
+	case ContentTypeTable:
+		return card.TableData().MaximumCompletionLevel()
+
+	}
+
+	return 0
+
+}
+
+// dependentCards returns the Cards a Checkbox's completion depends on: the Cards numbered under it in its stack, and the numberable Cards it
+// links to outside of its stack (unless following links from them leads around in a loop).
+func (card *Card) dependentCards() []*Card {
+
+	if card.Page == nil {
+		return []*Card{}
+	}
+
+	dependents := card.Page.StackChildren(card)
+
+	inStack := map[*Card]bool{card: true}
+	for c := card.Page.CardAbove(card); c != nil && !inStack[c]; c = card.Page.CardAbove(c) {
+		inStack[c] = true
+	}
+	for c := card.Page.CardBelow(card); c != nil && !inStack[c]; c = card.Page.CardBelow(c) {
+		inStack[c] = true
+	}
+
+	for _, link := range card.Links {
+		if end := card.Page.CardByID(link.End); end != nil && end != card && !inStack[end] && end.Numberable() && !card.Page.linksLoop(end) {
+			dependents = append(dependents, end)
+		}
+	}
+
+	return dependents
+
+}
+
+// linksLoop returns if following the Links from the given Card reaches any Card more than once.
+func (page *Page) linksLoop(card *Card) bool {
+
+	visited := map[*Card]bool{card: true}
+	toVisit := []*Card{}
+
+	follow := func(from *Card) {
+		for _, link := range from.Links {
+			if end := page.CardByID(link.End); end != nil && end != from {
+				toVisit = append(toVisit, end)
+			}
+		}
+	}
+
+	follow(card)
+
+	for len(toVisit) > 0 {
+		next := toVisit[0]
+		toVisit = toVisit[1:]
+		if visited[next] {
+			return true
+		}
+		visited[next] = true
+		follow(next)
+	}
+
+	return false
+
+}
+
+// LinkTo links the Card to another Card, returning the Link. If the Cards are already linked, the existing Link is returned.
+func (card *Card) LinkTo(other *Card) *Link {
+
+	if card.Page != nil {
+		for _, c := range card.Page.Cards {
+			for _, link := range c.Links {
+				if (link.Start == card.ID && link.End == other.ID) || (link.Start == other.ID && link.End == card.ID) {
+					return link
+				}
+			}
+		}
+	}
+
+	link := &Link{Start: card.ID, End: other.ID, Joints: []Point{}}
+	card.Links = append(card.Links, link)
+	return link
+
+}
+
+func (card *Card) Serialize() string {
+
+	data := "{}"
+	data, _ = sjson.Set(data, "id", card.ID)
+
+	data, _ = sjson.Set(data, "rect", card.Rect)
+	data, _ = sjson.Set(data, "collapsed", card.Collapsed)
+	data, _ = sjson.Set(data, "uncollapsedSizeX", card.UncollapsedSize.X)
+	data, _ = sjson.Set(data, "uncollapsedSizeY", card.UncollapsedSize.Y)
+	data, _ = sjson.Set(data, "contents", card.ContentType)
+	if card.CustomColor != "" {
+		data, _ = sjson.Set(data, "custom color", card.CustomColor)
+	}
+	if card.FontColor != "" {
+		data, _ = sjson.Set(data, "font color", card.FontColor)
+	}
+	data, _ = sjson.SetRaw(data, "properties", card.Properties.Serialize())
+
+	if len(card.Links) > 0 {
+		for i, link := range card.Links {
+			data, _ = sjson.SetRaw(data, "links."+strconv.Itoa(i), link.Serialize())
+		}
+	}
+
+	return data
+
+}
+
+// ParseCard parses a serialized Card. If the data has no "id" field, the returned Card's ID is -1.
+func ParseCard(data string) *Card {
+
+	card := &Card{
+		ID:         -1,
+		Collapsed:  CollapsedNone,
+		Properties: NewProperties(),
+		Links:      []*Link{},
+	}
+
+	if id := gjson.Get(data, "id"); id.Exists() {
+		card.ID = id.Int()
+	}
+
+	rect := gjson.Get(data, "rect")
+	card.Rect.X = float32(rect.Get("X").Float())
+	card.Rect.Y = float32(rect.Get("Y").Float())
+	card.Rect.W = float32(rect.Get("W").Float())
+	card.Rect.H = float32(rect.Get("H").Float())
+
+	if collapsed := gjson.Get(data, "collapsed"); collapsed.Exists() {
+		card.Collapsed = collapsed.String()
+		card.UncollapsedSize.X = float32(gjson.Get(data, "uncollapsedSizeX").Float())
+		card.UncollapsedSize.Y = float32(gjson.Get(data, "uncollapsedSizeY").Float())
+	}
+
+	card.ContentType = gjson.Get(data, "contents").String()
+	card.CustomColor = gjson.Get(data, "custom color").String()
+	card.FontColor = gjson.Get(data, "font color").String()
+
+	card.Properties.Deserialize(gjson.Get(data, "properties").Raw)
+
+	for _, link := range gjson.Get(data, "links").Array() {
+		card.Links = append(card.Links, ParseLink(link.Raw))
+	}
+
+	return card
+
+}
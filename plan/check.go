@@ -0,0 +1,572 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// Categories of problems found by Check().
+const (
+	ProblemDanglingLinks = "links"
+	ProblemMissingFiles  = "files"
+	ProblemDuplicateIDs  = "ids"
+	ProblemOrphanPages   = "pages"
+	ProblemMalformedData = "data"
+	ProblemBadDeadlines  = "deadlines"
+)
+
+// ProblemCategories lists the categories of problems in the order Check() looks for them.
+var ProblemCategories = []string{ProblemDanglingLinks, ProblemMissingFiles, ProblemDuplicateIDs, ProblemOrphanPages, ProblemMalformedData, ProblemBadDeadlines}
+
+// ProblemCategoryNames are the readable names of the problem categories.
+var ProblemCategoryNames = map[string]string{
+	ProblemDanglingLinks: "Dangling links",
+	ProblemMissingFiles:  "Missing files",
+	ProblemDuplicateIDs:  "Duplicate card IDs",
+	ProblemOrphanPages:   "Orphan pages",
+	ProblemMalformedData: "Malformed table and map data",
+	ProblemBadDeadlines:  "Unparseable deadlines",
+}
+
+// deadlineFallbackFormats are other date formats deadlines are recognized in when fixing them.
+var deadlineFallbackFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006/01/02", "2006.01.02", "01/02/2006", "Jan 2 2006", "January 2, 2006"}
+
+// Problem is something wrong with a Project, found by Check().
+type Problem struct {
+	Category    string
+	PageID      uint64
+	CardID      int64  // ID of the Card with the problem, or -1 if it's about the Page as a whole
+	Description string // What's wrong
+	Fix         string // What fixing it does
+	fix         func()
+}
+
+func (problem *Problem) String() string {
+	if problem.CardID < 0 {
+		return fmt.Sprintf("page %d: %s", problem.PageID, problem.Description)
+	}
+	return fmt.Sprintf("card %d on page %d: %s", problem.CardID, problem.PageID, problem.Description)
+}
+
+// checker holds what's needed while checking a Project.
+type checker struct {
+	Project    *Project
+	ProjectDir string
+	Problems   []*Problem
+}
+
+func (c *checker) report(category string, page *Page, card *Card, fixDescription string, fix func(), description string, args ...interface{}) {
+
+	problem := &Problem{
+		Category:    category,
+		PageID:      page.ID,
+		CardID:      -1,
+		Description: fmt.Sprintf(description, args...),
+		Fix:         fixDescription,
+		fix:         fix,
+	}
+
+	if card != nil {
+		problem.CardID = card.ID
+		if name := card.Name(); name != "" {
+			problem.Description = fmt.Sprintf("%q: %s", truncateName(name), problem.Description)
+		}
+	}
+
+	c.Problems = append(c.Problems, problem)
+
+}
+
+// truncateName shortens a Card's name to its first line, and to a reasonable length for reports.
+func truncateName(name string) string {
+	name = strings.SplitN(name, "\n", 2)[0]
+	if runes := []rune(name); len(runes) > 40 {
+		name = string(runes[:40]) + "..."
+	}
+	return name
+}
+
+// resolvePath makes the given (possibly relative) filepath absolute, relative to the Project's directory.
+func (c *checker) resolvePath(path string) string {
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.ProjectDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// Check looks for problems in the Project - links to Cards that don't exist, files that are missing, duplicate Card IDs, orphaned Pages,
+// Table and Map data that's malformed, and deadlines that can't be parsed. projectPath is where the Project is saved, which relative
+// filepaths are resolved against; it can be empty if the Project hasn't been saved. The Problems can be fixed with FixProblems().
+func Check(project *Project, projectPath string) []*Problem {
+
+	c := &checker{Project: project, Problems: []*Problem{}}
+
+	if projectPath != "" {
+		c.ProjectDir = filepath.Dir(projectPath)
+	}
+
+	c.checkLinks()
+	c.checkFiles()
+	c.checkIDs()
+	c.checkPages()
+	c.checkData()
+	c.checkDeadlines()
+
+	return c.Problems
+
+}
+
+// FixProblems fixes the given Problems in the categories given (or all of them if no categories are given), returning how many were fixed.
+// The Problems must have been found by Check() in the same Project, and it should be checked again afterwards.
+func FixProblems(problems []*Problem, categories ...string) int {
+
+	fixed := 0
+
+	for _, problem := range problems {
+
+		if len(categories) > 0 {
+			included := false
+			for _, category := range categories {
+				included = included || problem.Category == category
+			}
+			if !included {
+				continue
+			}
+		}
+
+		problem.fix()
+		fixed++
+
+	}
+
+	return fixed
+
+}
+
+func (c *checker) checkLinks() {
+
+	for _, page := range c.Project.Pages {
+
+		for _, card := range page.Cards {
+
+			for _, link := range card.Links {
+
+				link := link
+				card := card
+
+				if page.CardByID(link.End) == nil {
+					c.report(ProblemDanglingLinks, page, card, "remove the link", func() { removeLink(card, link) }, "links to card %d, which isn't on the same page", link.End)
+				} else if link.Start != card.ID {
+					c.report(ProblemDanglingLinks, page, card, "remove the link", func() { removeLink(card, link) }, "has a link starting from card %d instead of itself", link.Start)
+				}
+
+			}
+
+			if card.ContentType != ContentTypeLink || !card.Properties.Has("target") || card.Properties.Float("target") < 0 {
+				continue
+			}
+
+			card := card
+			target := int64(card.Properties.Float("target"))
+			clearTarget := func() {
+				card.Properties.Set("target", -1)
+				if card.Properties.Has("target project") {
+					card.Properties.Set("target project", "")
+				}
+			}
+
+			if targetProject := card.Properties.String("target project"); targetProject != "" {
+
+				targetPath := c.resolvePath(targetProject)
+
+				if !fileExists(targetPath) {
+					c.report(ProblemDanglingLinks, page, card, "clear the target", clearTarget, "targets a card in %s, which doesn't exist", targetProject)
+				} else if other, err := ReadProject(targetPath, "", nil); err == nil && other.FindCard(target) == nil {
+					// Encrypted or unreadable projects can't be checked, so they're left alone.
+					c.report(ProblemDanglingLinks, page, card, "clear the target", clearTarget, "targets card %d in %s, which doesn't exist", target, targetProject)
+				}
+
+			} else if c.Project.FindCard(target) == nil {
+				c.report(ProblemDanglingLinks, page, card, "clear the target", clearTarget, "targets card %d, which doesn't exist", target)
+			}
+
+		}
+
+	}
+
+}
+
+// removeLink removes the given Link from the Card.
+func removeLink(card *Card, link *Link) {
+	for i, l := range card.Links {
+		if l == link {
+			card.Links = append(card.Links[:i], card.Links[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *checker) checkFiles() {
+
+	for _, page := range c.Project.Pages {
+
+		for _, card := range page.Cards {
+
+			card := card
+
+			if fp := card.Properties.String("filepath"); fp != "" && !strings.Contains(fp, "://") {
+				if _, saved := c.Project.SavedImages[fp]; !saved && !fileExists(c.resolvePath(fp)) {
+					c.report(ProblemMissingFiles, page, card, "clear the filepath", func() { card.Properties.Set("filepath", "") }, "uses %s, which doesn't exist", fp)
+				}
+			}
+
+			// Programs to run can also be commands found in the PATH.
+			if run := card.Properties.String("run"); run != "" && !strings.Contains(run, "://") && !fileExists(c.resolvePath(run)) {
+				if _, err := exec.LookPath(run); err != nil {
+					c.report(ProblemMissingFiles, page, card, "clear the program", func() { card.Properties.Set("run", "") }, "runs %s, which doesn't exist", run)
+				}
+			}
+
+		}
+
+	}
+
+}
+
+func (c *checker) checkIDs() {
+
+	seen := map[int64]bool{}
+
+	for _, page := range c.Project.Pages {
+
+		for _, card := range page.Cards {
+
+			if !seen[card.ID] {
+				seen[card.ID] = true
+				continue
+			}
+
+			card := card
+
+			c.report(ProblemDuplicateIDs, page, card, "give the card a new ID", func() {
+				id := c.Project.NextCardID()
+				for _, link := range card.Links {
+					if link.Start == card.ID {
+						link.Start = id
+					}
+				}
+				card.ID = id
+			}, "has ID %d, which another card also has", card.ID)
+
+		}
+
+	}
+
+}
+
+// ReachablePages returns the Pages that can be reached from the root Page through Sub-Page Cards.
+func ReachablePages(project *Project) map[*Page]bool {
+
+	reachable := map[*Page]bool{}
+
+	toVisit := []*Page{project.Root()}
+
+	for len(toVisit) > 0 {
+
+		page := toVisit[0]
+		toVisit = toVisit[1:]
+
+		if page == nil || reachable[page] {
+			continue
+		}
+
+		reachable[page] = true
+
+		for _, card := range page.Cards {
+			if sub := project.Subpage(card); sub != nil {
+				toVisit = append(toVisit, sub)
+			}
+		}
+
+	}
+
+	return reachable
+
+}
+
+func (c *checker) checkPages() {
+
+	reachable := ReachablePages(c.Project)
+
+	for _, page := range c.Project.Pages {
+
+		if reachable[page] {
+			continue
+		}
+
+		page := page
+
+		if len(page.Cards) == 0 {
+			c.report(ProblemOrphanPages, page, nil, "remove the page", func() { removePage(c.Project, page) }, "is empty, and can't be reached through any Sub-Page card")
+		} else {
+			c.report(ProblemOrphanPages, page, nil, "add a Sub-Page card for it to the root page", func() { recoverPage(c.Project, page) },
+				"has %d card(s), but can't be reached through any Sub-Page card", len(page.Cards))
+		}
+
+	}
+
+}
+
+func removePage(project *Project, page *Page) {
+	for i, p := range project.Pages {
+		if p == page {
+			project.Pages = append(project.Pages[:i], project.Pages[i+1:]...)
+			return
+		}
+	}
+}
+
+// recoverPage makes an orphaned Page reachable again by adding a Sub-Page Card pointing to it to the root Page. If the Page is a sub-page
+// of another orphaned Page, that Page is recovered instead.
+func recoverPage(project *Project, page *Page) {
+
+	top := page
+	visited := map[*Page]bool{}
+
+	for !visited[top] {
+		visited[top] = true
+		subpageCard := project.SubpageCard(top)
+		if subpageCard == nil || subpageCard.Page == nil {
+			break
+		}
+		top = subpageCard.Page
+	}
+
+	// Already recovered (along with a Page above it).
+	if ReachablePages(project)[top] {
+		return
+	}
+
+	root := project.Root()
+
+	y := float32(0)
+	for _, card := range root.Cards {
+		if bottom := card.Rect.Y + card.Rect.H + GridSize; bottom > y {
+			y = bottom
+		}
+	}
+
+	card := root.AddCard(ContentTypeSubpage)
+	card.Rect.Y = y
+	card.Properties.Set("description", "Recovered Page")
+	card.Properties.Set("subpage", top.ID)
+
+}
+
+func (c *checker) checkData() {
+
+	for _, page := range c.Project.Pages {
+
+		for _, card := range page.Cards {
+
+			if (card.ContentType != ContentTypeTable && card.ContentType != ContentTypeMap) || !card.Properties.Has("contents") {
+				continue
+			}
+
+			card := card
+			contents, isString := card.Properties.Get("contents").(string)
+
+			if !isString || !gjson.Valid(contents) || !gjson.Get(contents, "contents").IsArray() {
+				c.report(ProblemMalformedData, page, card, "reset the contents", func() { card.Properties.Remove("contents") }, "has contents that can't be read")
+				continue
+			}
+
+			if card.ContentType == ContentTypeTable {
+				if problem := tableDataProblem(contents); problem != "" {
+					c.report(ProblemMalformedData, page, card, "resize the table to fit its data", func() { card.SetTableData(repairTableData(contents)) }, "%s", problem)
+				}
+			} else if problem := mapDataProblem(contents); problem != "" {
+				c.report(ProblemMalformedData, page, card, "make the map rectangular", func() { card.SetMapData(repairMapData(contents)) }, "%s", problem)
+			}
+
+		}
+
+	}
+
+}
+
+// tableDataProblem describes what's wrong with the serialized data of a Table Card, or returns an empty string if nothing is.
+func tableDataProblem(contents string) string {
+
+	td := ParseTableData(contents)
+
+	if _, known := ValueDisplayModeSizes[td.ValueDisplayMode]; !known {
+		return fmt.Sprintf("has an unknown display mode (%d)", td.ValueDisplayMode)
+	}
+
+	if td.Width <= 0 || td.Height <= 0 {
+		return fmt.Sprintf("has an invalid size (%dx%d)", td.Width, td.Height)
+	}
+
+	if len(td.Values) != td.Height {
+		return fmt.Sprintf("has %d rows of values, but a height of %d", len(td.Values), td.Height)
+	}
+
+	for y, row := range td.Values {
+		if len(row) != td.Width {
+			return fmt.Sprintf("has %d values in row %d, but a width of %d", len(row), y+1, td.Width)
+		}
+		for _, value := range row {
+			if value < 0 || value >= ValueDisplayModeSizes[td.ValueDisplayMode] {
+				return fmt.Sprintf("has a value out of range (%d) in row %d", value, y+1)
+			}
+		}
+	}
+
+	if len(td.RowHeadings) != td.Height || len(td.ColumnHeadings) != td.Width {
+		return fmt.Sprintf("has %d row and %d column headings for a %dx%d table", len(td.RowHeadings), len(td.ColumnHeadings), td.Width, td.Height)
+	}
+
+	return ""
+
+}
+
+// repairTableData returns the serialized data of a Table Card resized to fit the values it holds, with any values out of range reset.
+func repairTableData(contents string) *TableData {
+
+	td := ParseTableData(contents)
+
+	if _, known := ValueDisplayModeSizes[td.ValueDisplayMode]; !known {
+		td.ValueDisplayMode = ValueDisplayModeCheck
+	}
+
+	width, height := td.Width, td.Height
+
+	if height <= 0 {
+		height = len(td.Values)
+	}
+
+	if width <= 0 {
+		for _, row := range td.Values {
+			if len(row) > width {
+				width = len(row)
+			}
+		}
+	}
+
+	if width <= 0 {
+		width = 1
+	}
+
+	if height <= 0 {
+		height = 1
+	}
+
+	td.Resize(width, height)
+
+	for y := range td.Values {
+		for x, value := range td.Values[y] {
+			if value < 0 || value >= ValueDisplayModeSizes[td.ValueDisplayMode] {
+				td.Values[y][x] = 0
+			}
+		}
+	}
+
+	return td
+
+}
+
+// mapDataProblem describes what's wrong with the serialized data of a Map Card, or returns an empty string if nothing is.
+func mapDataProblem(contents string) string {
+
+	mapData := ParseMapData(contents)
+
+	for y, row := range mapData.Data {
+		if len(row) != len(mapData.Data[0]) {
+			return fmt.Sprintf("has %d values in row %d, but %d in the first row", len(row), y+1, len(mapData.Data[0]))
+		}
+		for _, value := range row {
+			if value < 0 {
+				return fmt.Sprintf("has a negative value (%d) in row %d", value, y+1)
+			}
+		}
+	}
+
+	return ""
+
+}
+
+// repairMapData returns the data of a Map Card with every row padded to the length of the longest one, and negative values cleared.
+func repairMapData(contents string) *MapData {
+
+	mapData := ParseMapData(contents)
+
+	width := 0
+	for _, row := range mapData.Data {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	for y := range mapData.Data {
+		for len(mapData.Data[y]) < width {
+			mapData.Data[y] = append(mapData.Data[y], 0)
+		}
+		for x, value := range mapData.Data[y] {
+			if value < 0 {
+				mapData.Data[y][x] = 0
+			}
+		}
+	}
+
+	return mapData
+
+}
+
+func (c *checker) checkDeadlines() {
+
+	for _, page := range c.Project.Pages {
+
+		for _, card := range page.Cards {
+
+			if !card.Properties.Has("deadline") {
+				continue
+			}
+
+			deadline := card.Properties.String("deadline")
+
+			if _, err := time.Parse(DeadlineFormat, deadline); err == nil {
+				continue
+			}
+
+			card := card
+			fixDescription := "remove the deadline"
+			fix := func() { card.Properties.Remove("deadline") }
+
+			for _, format := range deadlineFallbackFormats {
+				if date, err := time.Parse(format, strings.TrimSpace(deadline)); err == nil {
+					fixDescription = "set the deadline to " + date.Format(DeadlineFormat)
+					fix = func() { card.Properties.Set("deadline", date.Format(DeadlineFormat)) }
+					break
+				}
+			}
+
+			c.report(ProblemBadDeadlines, page, card, fixDescription, fix, "has a deadline that can't be read (%v)", card.Properties.Get("deadline"))
+
+		}
+
+	}
+
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,85 @@
+package plan
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckAndFix(t *testing.T) {
+
+	dir := t.TempDir()
+	projectPath := filepath.Join(dir, "project.plan")
+
+	project := NewProject()
+	root := project.Root()
+
+	linked := root.AddCard(ContentTypeNote)
+	linked.Links = append(linked.Links, &Link{Start: linked.ID, End: 99, Joints: []Point{}})
+
+	linkCard := root.AddCard(ContentTypeLink)
+	linkCard.Properties.Set("target", 98)
+
+	image := root.AddCard(ContentTypeImage)
+	image.Properties.Set("filepath", "missing.png")
+
+	duplicate := NewCard(linked.ID, ContentTypeNote)
+	root.Add(duplicate)
+
+	orphan := project.AddPage()
+	orphan.AddCard(ContentTypeCheckbox)
+	project.AddPage() // Empty orphan
+
+	table := root.AddCard(ContentTypeTable)
+	table.Properties.Set("contents", `{"contents": [[0, 1], [1]], "rows": ["a"], "columns": ["b", "c"], "width": 2, "height": 2, "mode": 0}`)
+
+	mapCard := root.AddCard(ContentTypeMap)
+	mapCard.Properties.Set("contents", `{"contents": [[1, 2, 3], [1]]}`)
+
+	deadline := root.AddCard(ContentTypeCheckbox)
+	deadline.Properties.Set("deadline", "2021/03/04")
+
+	problems := Check(project, projectPath)
+
+	found := map[string]int{}
+	for _, problem := range problems {
+		found[problem.Category]++
+	}
+
+	expected := map[string]int{
+		ProblemDanglingLinks: 2,
+		ProblemMissingFiles:  1,
+		ProblemDuplicateIDs:  1,
+		ProblemOrphanPages:   2,
+		ProblemMalformedData: 2,
+		ProblemBadDeadlines:  1,
+	}
+
+	for category, count := range expected {
+		if found[category] != count {
+			t.Errorf("found %d problem(s) of category %s, expected %d", found[category], category, count)
+		}
+	}
+
+	if fixed := FixProblems(problems, ProblemBadDeadlines); fixed != 1 || deadline.Properties.String("deadline") != "2021-03-04" {
+		t.Errorf("fixing deadlines fixed %d problem(s), leaving the deadline as %q", fixed, deadline.Properties.String("deadline"))
+	}
+
+	FixProblems(problems)
+
+	if remaining := Check(project, projectPath); len(remaining) > 0 {
+		t.Errorf("%d problem(s) remain after fixing, starting with: %s", len(remaining), remaining[0])
+	}
+
+	if len(project.Pages) != 2 || project.SubpageCard(orphan) == nil {
+		t.Error("orphan page wasn't recovered, or the empty one wasn't removed")
+	}
+
+	if duplicate.ID == linked.ID {
+		t.Error("duplicate ID wasn't changed")
+	}
+
+	if td := table.TableData(); td.Width != 2 || td.Height != 2 || len(td.RowHeadings) != 2 {
+		t.Errorf("table wasn't repaired: %+v", td)
+	}
+
+}
@@ -0,0 +1,240 @@
+package plan
+
+import (
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	ValueDisplayModeCheck = iota
+	ValueDisplayModeLetter
+	ValueDisplayModeNumber
+)
+
+// ValueDisplayModeSizes is the number of distinct values a Table cell can hold in each display mode.
+var ValueDisplayModeSizes = map[int]int{
+	ValueDisplayModeCheck:  3,
+	ValueDisplayModeLetter: 7,
+	ValueDisplayModeNumber: 11,
+}
+
+// valueTexts are the texts Table cells are displayed with in the check and letter display modes, by value; in the number mode, they show
+// the value itself.
+var valueTexts = map[int][]string{
+	ValueDisplayModeCheck:  {"", "✓", "✗"},
+	ValueDisplayModeLetter: {"S", "A", "B", "C", "D", "E", "F"},
+}
+
+// ValueText returns the text a Table cell with the given value is displayed as in the given display mode (e.g. "✓", "B", or "7").
+func ValueText(displayMode, value int) string {
+	if texts, exists := valueTexts[displayMode]; exists {
+		if value < 0 || value >= len(texts) {
+			return ""
+		}
+		return texts[value]
+	}
+	return strconv.Itoa(value)
+}
+
+// TableData is the data of a Table Card, stored as JSON in its "contents" property.
+type TableData struct {
+	Values           [][]int // Values[y][x]
+	RowHeadings      []string
+	ColumnHeadings   []string
+	Width, Height    int
+	ValueDisplayMode int
+}
+
+// NewTableData creates a new TableData of the given size, with empty headings and all values set to zero.
+func NewTableData(width, height int) *TableData {
+	td := &TableData{RowHeadings: []string{}, ColumnHeadings: []string{}}
+	td.Resize(width, height)
+	return td
+}
+
+// ParseTableData parses the "contents" property of a Table Card.
+func ParseTableData(data string) *TableData {
+
+	td := &TableData{
+		Values:         [][]int{},
+		RowHeadings:    []string{},
+		ColumnHeadings: []string{},
+	}
+
+	for y, row := range gjson.Get(data, "contents").Array() {
+		td.Values = append(td.Values, []int{})
+		for _, value := range row.Array() {
+			td.Values[y] = append(td.Values[y], int(value.Int()))
+		}
+	}
+
+	for _, heading := range gjson.Get(data, "rows").Array() {
+		td.RowHeadings = append(td.RowHeadings, heading.String())
+	}
+
+	for _, heading := range gjson.Get(data, "columns").Array() {
+		td.ColumnHeadings = append(td.ColumnHeadings, heading.String())
+	}
+
+	td.Width = int(gjson.Get(data, "width").Int())
+	td.Height = int(gjson.Get(data, "height").Int())
+	td.ValueDisplayMode = int(gjson.Get(data, "mode").Int())
+
+	return td
+
+}
+
+// Resize resizes the table, keeping existing values and headings where they still fit.
+func (td *TableData) Resize(width, height int) {
+
+	values := make([][]int, height)
+	for y := range values {
+		values[y] = make([]int, width)
+		for x := range values[y] {
+			values[y][x] = td.Value(x, y)
+		}
+	}
+	td.Values = values
+
+	for len(td.RowHeadings) < height {
+		td.RowHeadings = append(td.RowHeadings, "")
+	}
+	td.RowHeadings = td.RowHeadings[:height]
+
+	for len(td.ColumnHeadings) < width {
+		td.ColumnHeadings = append(td.ColumnHeadings, "")
+	}
+	td.ColumnHeadings = td.ColumnHeadings[:width]
+
+	td.Width = width
+	td.Height = height
+
+}
+
+// Value returns the value of the cell at the given position, or 0 if it's outside of the table.
+func (td *TableData) Value(x, y int) int {
+	if y < 0 || y >= len(td.Values) || x < 0 || x >= len(td.Values[y]) {
+		return 0
+	}
+	return td.Values[y][x]
+}
+
+func (td *TableData) SetValue(x, y, value int) {
+	if y < 0 || y >= len(td.Values) || x < 0 || x >= len(td.Values[y]) {
+		return
+	}
+	td.Values[y][x] = value
+}
+
+// CompletionLevel returns the number of checked cells; only tables displaying checks can be completed.
+func (td *TableData) CompletionLevel() float32 {
+
+	if td.ValueDisplayMode != ValueDisplayModeCheck {
+		return 0
+	}
+
+	completion := float32(0)
+	for y := 0; y < td.Height; y++ {
+		for x := 0; x < td.Width; x++ {
+			if td.Value(x, y) == 1 {
+				completion++
+			}
+		}
+	}
+	return completion
+
+}
+
+// MaximumCompletionLevel returns the number of cells that can be checked (i.e. cells that aren't marked as not applicable).
+func (td *TableData) MaximumCompletionLevel() float32 {
+
+	if td.ValueDisplayMode != ValueDisplayModeCheck {
+		return 0
+	}
+
+	max := float32(0)
+	for y := 0; y < td.Height; y++ {
+		for x := 0; x < td.Width; x++ {
+			if td.Value(x, y) != 2 {
+				max++
+			}
+		}
+	}
+	return max
+
+}
+
+func (td *TableData) Serialize() string {
+
+	serialized := [][]int{}
+
+	for y := 0; y < td.Height; y++ {
+		serialized = append(serialized, []int{})
+		for x := 0; x < td.Width; x++ {
+			serialized[y] = append(serialized[y], td.Value(x, y))
+		}
+	}
+
+	dataStr, _ := sjson.Set("{}", "contents", serialized)
+	dataStr, _ = sjson.Set(dataStr, "rows", td.RowHeadings)
+	dataStr, _ = sjson.Set(dataStr, "columns", td.ColumnHeadings)
+	dataStr, _ = sjson.Set(dataStr, "width", td.Width)
+	dataStr, _ = sjson.Set(dataStr, "height", td.Height)
+	dataStr, _ = sjson.Set(dataStr, "mode", td.ValueDisplayMode)
+	return dataStr
+
+}
+
+// MapData is the data of a Map Card, stored as JSON in its "contents" property. Each value is a palette color index combined with a pattern.
+type MapData struct {
+	Data [][]int // Data[y][x]
+}
+
+// ParseMapData parses the "contents" property of a Map Card.
+func ParseMapData(data string) *MapData {
+
+	mapData := &MapData{Data: [][]int{}}
+
+	for y, row := range gjson.Get(data, "contents").Array() {
+		mapData.Data = append(mapData.Data, []int{})
+		for _, value := range row.Array() {
+			mapData.Data[y] = append(mapData.Data[y], int(value.Int()))
+		}
+	}
+
+	return mapData
+
+}
+
+func (mapData *MapData) Serialize() string {
+	dataStr, _ := sjson.Set("{}", "contents", mapData.Data)
+	return dataStr
+}
+
+// TableData returns the parsed table of a Table Card, or nil if the Card isn't a Table.
+func (card *Card) TableData() *TableData {
+	if card.ContentType != ContentTypeTable {
+		return nil
+	}
+	return ParseTableData(card.Properties.String("contents"))
+}
+
+// SetTableData stores the given table in the Card's "contents" property.
+func (card *Card) SetTableData(td *TableData) {
+	card.Properties.Set("contents", td.Serialize())
+}
+
+// MapData returns the parsed map of a Map Card, or nil if the Card isn't a Map.
+func (card *Card) MapData() *MapData {
+	if card.ContentType != ContentTypeMap {
+		return nil
+	}
+	return ParseMapData(card.Properties.String("contents"))
+}
+
+// SetMapData stores the given map in the Card's "contents" property.
+func (card *Card) SetMapData(mapData *MapData) {
+	card.Properties.Set("contents", mapData.Serialize())
+}
@@ -0,0 +1,295 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrNoTableData is returned when CSV data has no cells to make a table from.
+var ErrNoTableData = errors.New("no table cells found")
+
+// valueAliases are other texts (in lowercase) that are read as values when importing, by display mode.
+var valueAliases = map[int]map[string]int{
+	ValueDisplayModeCheck: {
+		"✔": 1, "☑": 1, "x": 1, "[x]": 1, "y": 1, "yes": 1, "true": 1, "done": 1,
+		"✘": 2, "☒": 2, "n/a": 2, "na": 2, "-": 2,
+	},
+}
+
+// ParseValueText returns the value of a Table cell displayed as the given text in the given display mode; it's the reverse of ValueText().
+// Empty cells are 0 in every mode, and whole numbers outside of the number mode's range are clamped to it. If the text isn't a value of the
+// mode, ParseValueText returns false.
+func ParseValueText(displayMode int, text string) (int, bool) {
+
+	text = strings.TrimSpace(text)
+
+	if text == "" {
+		return 0, true
+	}
+
+	if displayMode == ValueDisplayModeNumber {
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return 0, false
+		}
+		if max := ValueDisplayModeSizes[ValueDisplayModeNumber] - 1; value > max {
+			value = max
+		} else if value < 0 {
+			value = 0
+		}
+		return value, true
+	}
+
+	for value, valueText := range valueTexts[displayMode] {
+		if valueText != "" && strings.EqualFold(valueText, text) {
+			return value, true
+		}
+	}
+
+	if value, exists := valueAliases[displayMode][strings.ToLower(text)]; exists {
+		return value, true
+	}
+
+	return 0, false
+
+}
+
+// CSV returns the table as CSV (or TSV, if comma is a tab), with a header row of column headings and a header column of row headings. Cells
+// are written as they're displayed (see ValueText()).
+func (td *TableData) CSV(comma rune) string {
+
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	writer.Comma = comma
+
+	header := []string{""}
+	for x := 0; x < td.Width; x++ {
+		header = append(header, td.heading(td.ColumnHeadings, x))
+	}
+	writer.Write(header)
+
+	for y := 0; y < td.Height; y++ {
+		record := []string{td.heading(td.RowHeadings, y)}
+		for x := 0; x < td.Width; x++ {
+			record = append(record, ValueText(td.ValueDisplayMode, td.Value(x, y)))
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+
+	return buffer.String()
+
+}
+
+func (td *TableData) heading(headings []string, index int) string {
+	if index < len(headings) {
+		return headings[index]
+	}
+	return ""
+}
+
+// ParseTableCSV creates TableData from CSV or TSV data (it's TSV if the first line has a tab in it). The first row and column are read as
+// headings if they're empty or have cells that aren't values, and the display mode is the first of checks, letters, and numbers that every
+// cell can be read as. Cells that can't be read as a number in the number mode are 0, and numbers outside of its range are clamped to it;
+// clamped is how many cells were.
+func ParseTableCSV(data string) (td *TableData, clamped int, err error) {
+
+	data = strings.TrimRight(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if firstLine := strings.SplitN(data, "\n", 2)[0]; strings.Contains(firstLine, "\t") {
+		reader.Comma = '\t'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	width := 0
+	for _, record := range records {
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+
+	cell := func(x, y int) string {
+		if y < len(records) && x < len(records[y]) {
+			return strings.TrimSpace(records[y][x])
+		}
+		return ""
+	}
+
+	// isHeading returns if the cells are headings - if they're all empty, or any of them can't be read as a value in the given mode
+	// (or any mode, if it's negative). Numbers that would be clamped (like years) are headings as well.
+	isHeading := func(cells []string, mode int) bool {
+		empty := true
+		for _, text := range cells {
+			if text == "" {
+				continue
+			}
+			empty = false
+			if outOfRange(text) {
+				return true
+			} else if mode >= 0 {
+				if _, ok := ParseValueText(mode, text); !ok {
+					return true
+				}
+			} else if valueDisplayModeOf([]string{text}) < 0 {
+				return true
+			}
+		}
+		return empty
+	}
+
+	firstRow := func() []string {
+		cells := []string{}
+		for x := 1; x < width; x++ {
+			cells = append(cells, cell(x, 0))
+		}
+		return cells
+	}
+
+	firstColumn := func() []string {
+		cells := []string{}
+		for y := 1; y < len(records); y++ {
+			cells = append(cells, cell(0, y))
+		}
+		return cells
+	}
+
+	headingRow := len(records) > 1 && isHeading(firstRow(), -1)
+	headingColumn := width > 1 && isHeading(firstColumn(), -1)
+
+	body := func() []string {
+		cells := []string{}
+		for y := 0; y < len(records); y++ {
+			for x := 0; x < width; x++ {
+				if (!headingRow || y > 0) && (!headingColumn || x > 0) {
+					cells = append(cells, cell(x, y))
+				}
+			}
+		}
+		return cells
+	}
+
+	mode := valueDisplayModeOf(body())
+
+	// A first row or column of values that don't suit the rest of the table (like letters over a table of checks) are headings, too.
+	if !headingRow && len(records) > 1 {
+		headingRow = true
+		if rest := valueDisplayModeOf(body()); rest >= 0 && isHeading(firstRow(), rest) {
+			mode = rest
+		} else {
+			headingRow = false
+		}
+	}
+
+	if !headingColumn && width > 1 {
+		headingColumn = true
+		if rest := valueDisplayModeOf(body()); rest >= 0 && isHeading(firstColumn(), rest) {
+			mode = rest
+		} else {
+			headingColumn = false
+		}
+	}
+
+	if mode < 0 {
+		mode = ValueDisplayModeNumber
+	}
+
+	startX, startY := 0, 0
+	if headingColumn {
+		startX = 1
+	}
+	if headingRow {
+		startY = 1
+	}
+
+	if width-startX <= 0 || len(records)-startY <= 0 {
+		return nil, 0, ErrNoTableData
+	}
+
+	td = NewTableData(width-startX, len(records)-startY)
+	td.ValueDisplayMode = mode
+
+	for y := 0; y < td.Height; y++ {
+		if headingColumn {
+			td.RowHeadings[y] = cell(0, y+startY)
+		}
+		for x := 0; x < td.Width; x++ {
+			text := cell(x+startX, y+startY)
+			value, _ := ParseValueText(mode, text)
+			if mode == ValueDisplayModeNumber && outOfRange(text) {
+				clamped++
+			}
+			td.SetValue(x, y, value)
+		}
+	}
+
+	for x := 0; x < td.Width; x++ {
+		if headingRow {
+			td.ColumnHeadings[x] = cell(x+startX, 0)
+		}
+	}
+
+	return td, clamped, nil
+
+}
+
+// IsTSV returns whether the text looks like cells copied from a spreadsheet - two or more tab-separated cells on every line, the same number
+// on each (and not just a tab-indented list).
+func IsTSV(text string) bool {
+
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+
+	columns := strings.Count(lines[0], "\t") + 1
+	if columns < 2 {
+		return false
+	}
+
+	indented := true
+	for _, line := range lines {
+		if strings.Count(line, "\t")+1 != columns {
+			return false
+		}
+		if !strings.HasPrefix(line, "\t") {
+			indented = false
+		}
+	}
+
+	return !indented
+
+}
+
+// outOfRange returns if the text is a whole number outside of the number mode's range, which ParseValueText() clamps to it.
+func outOfRange(text string) bool {
+	value, err := strconv.Atoi(strings.TrimSpace(text))
+	return err == nil && (value < 0 || value >= ValueDisplayModeSizes[ValueDisplayModeNumber])
+}
+
+// valueDisplayModeOf returns the first display mode (of checks, letters, and numbers) that every cell can be read as, or -1 if there's none.
+func valueDisplayModeOf(cells []string) int {
+
+	for _, mode := range []int{ValueDisplayModeCheck, ValueDisplayModeLetter, ValueDisplayModeNumber} {
+		fits := true
+		for _, text := range cells {
+			if _, ok := ParseValueText(mode, text); !ok {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return mode
+		}
+	}
+
+	return -1
+
+}
@@ -0,0 +1,82 @@
+package plan
+
+import "testing"
+
+func TestTableCSVRoundTrip(t *testing.T) {
+
+	for mode, values := range map[int][]int{
+		ValueDisplayModeCheck:  {0, 1, 2, 1},
+		ValueDisplayModeLetter: {0, 3, 6, 1},
+		ValueDisplayModeNumber: {0, 7, 10, 3},
+	} {
+
+		td := NewTableData(2, 2)
+		td.ValueDisplayMode = mode
+		td.RowHeadings = []string{"Mon", "Tue"}
+		td.ColumnHeadings = []string{"Gym, morning", "Run"}
+		for i, value := range values {
+			td.SetValue(i%2, i/2, value)
+		}
+
+		for _, comma := range []rune{',', '\t'} {
+
+			parsed, clamped, err := ParseTableCSV(td.CSV(comma))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if clamped != 0 {
+				t.Errorf("%d cells were clamped", clamped)
+			}
+
+			if parsed.Serialize() != td.Serialize() {
+				t.Errorf("table didn't round-trip through %q:\n%s\nexpected %s\ngot      %s", comma, td.CSV(comma), td.Serialize(), parsed.Serialize())
+			}
+
+		}
+
+	}
+
+}
+
+func TestParseTableCSV(t *testing.T) {
+
+	// Spreadsheet cells, without headings; numbers over the maximum are clamped to it
+	td, clamped, err := ParseTableCSV("3\t4\n5\t12\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if td.Width != 2 || td.Height != 2 || td.ValueDisplayMode != ValueDisplayModeNumber || td.Value(0, 1) != 5 || td.Value(1, 1) != 10 || clamped != 1 {
+		t.Errorf("cells weren't read as numbers (%d clamped): %s", clamped, td.Serialize())
+	}
+
+	// Years are headings, rather than clamped numbers
+	td, clamped, err = ParseTableCSV(",2025,2026\nPages,3,12\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if td.Width != 2 || td.Height != 1 || td.ColumnHeadings[1] != "2026" || td.RowHeadings[0] != "Pages" || td.Value(1, 0) != 10 || clamped != 1 {
+		t.Errorf("years weren't read as headings (%d clamped): %s", clamped, td.Serialize())
+	}
+
+	// Letters over a column of checks are headings
+	td, _, err = ParseTableCSV("A,B\nx,\n,done\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if td.Height != 2 || td.ValueDisplayMode != ValueDisplayModeCheck || td.ColumnHeadings[1] != "B" || td.Value(1, 1) != 1 {
+		t.Errorf("letters weren't read as headings over checks: %s", td.Serialize())
+	}
+
+	if !IsTSV("3\t4\n5\t12\n") || IsTSV("Project\n\tDesign\n") || IsTSV("\tDesign\n\tBuild") || IsTSV("Just text") {
+		t.Error("spreadsheet cells weren't told apart from other text")
+	}
+
+	if _, _, err := ParseTableCSV(""); err == nil {
+		t.Error("expected an error for empty data")
+	}
+
+}
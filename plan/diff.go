@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PageDiff lists the Cards that differ on a Page between two versions of a Project.
+type PageDiff struct {
+	PageID  uint64
+	Name    string
+	Added   []*Card // Cards only in the newer version
+	Removed []*Card // Cards only in the older version
+	Changed []*Card // Cards in both versions that differ (as they are in the newer version)
+}
+
+func (diff *PageDiff) String() string {
+
+	parts := []string{}
+
+	if len(diff.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("%d added", len(diff.Added)))
+	}
+	if len(diff.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d removed", len(diff.Removed)))
+	}
+	if len(diff.Changed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d changed", len(diff.Changed)))
+	}
+
+	return diff.Name + ": " + strings.Join(parts, ", ")
+
+}
+
+// Diff compares two versions of a Project, returning the Cards added, removed, and changed going from older to newer, grouped by Page.
+// Cards are matched by ID; a Card that moved to another Page counts as changed, and is listed under the Page it's on in the newer version.
+// Pages without differences are left out.
+func Diff(older, newer *Project) []*PageDiff {
+
+	diffs := []*PageDiff{}
+	diffsByPage := map[uint64]*PageDiff{}
+
+	pageDiff := func(project *Project, page *Page) *PageDiff {
+		if diff, exists := diffsByPage[page.ID]; exists {
+			return diff
+		}
+		diff := &PageDiff{PageID: page.ID, Name: project.PageName(page), Added: []*Card{}, Removed: []*Card{}, Changed: []*Card{}}
+		diffsByPage[page.ID] = diff
+		diffs = append(diffs, diff)
+		return diff
+	}
+
+	olderCards := cardsByID(older)
+	newerCards := cardsByID(newer)
+
+	for _, page := range newer.Pages {
+		for _, card := range page.SortedCards() {
+			if olderCard, exists := olderCards[card.ID]; !exists {
+				diff := pageDiff(newer, page)
+				diff.Added = append(diff.Added, card)
+			} else if !cardsEqual(olderCard, card) {
+				diff := pageDiff(newer, page)
+				diff.Changed = append(diff.Changed, card)
+			}
+		}
+	}
+
+	for _, page := range older.Pages {
+		for _, card := range page.SortedCards() {
+			if _, exists := newerCards[card.ID]; !exists {
+				diff := pageDiff(older, page)
+				diff.Removed = append(diff.Removed, card)
+			}
+		}
+	}
+
+	return diffs
+
+}
@@ -0,0 +1,132 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+
+	// diffIDs is a PageDiff reduced to the IDs of its Cards.
+	type diffIDs struct {
+		Name                    string
+		Added, Removed, Changed []int64
+	}
+
+	for _, test := range []struct {
+		name string
+		edit func(project *Project)
+		want []diffIDs
+	}{
+		{
+			name: "unchanged",
+			edit: func(project *Project) {},
+			want: []diffIDs{},
+		},
+		{
+			name: "added",
+			edit: func(project *Project) {
+				project.Root().AddCard(ContentTypeNote)
+			},
+			want: []diffIDs{{"Root", []int64{2}, nil, nil}},
+		},
+		{
+			// Removing B removes A's link to it, so A changes as well.
+			name: "removed",
+			edit: func(project *Project) {
+				project.Root().Remove(project.FindCard(1))
+			},
+			want: []diffIDs{{"Root", nil, []int64{1}, []int64{0}}},
+		},
+		{
+			name: "changed property",
+			edit: func(project *Project) {
+				project.FindCard(0).Properties.Set("checked", true)
+			},
+			want: []diffIDs{{"Root", nil, nil, []int64{0}}},
+		},
+		{
+			name: "moved",
+			edit: func(project *Project) {
+				project.FindCard(1).Rect.X = 128
+			},
+			want: []diffIDs{{"Root", nil, nil, []int64{1}}},
+		},
+		{
+			name: "unlinked",
+			edit: func(project *Project) {
+				project.FindCard(0).Links = []*Link{}
+			},
+			want: []diffIDs{{"Root", nil, nil, []int64{0}}},
+		},
+		{
+			name: "added, removed, and changed",
+			edit: func(project *Project) {
+				project.Root().AddCard(ContentTypeNote)
+				project.FindCard(0).Properties.Set("description", "A, edited")
+				project.Root().Remove(project.FindCard(1))
+			},
+			want: []diffIDs{{"Root", []int64{2}, []int64{1}, []int64{0}}},
+		},
+		{
+			name: "sub-page",
+			edit: func(project *Project) {
+				page := project.AddPage()
+				subpage := project.Root().AddCard(ContentTypeSubpage)
+				subpage.Properties.Set("description", "Details")
+				subpage.Properties.Set("subpage", float64(page.ID))
+				page.AddCard(ContentTypeNote)
+			},
+			want: []diffIDs{{"Root", []int64{2}, nil, nil}, {"Details", []int64{3}, nil, nil}},
+		},
+		{
+			name: "moved to another page",
+			edit: func(project *Project) {
+				page := project.AddPage()
+				subpage := project.Root().AddCard(ContentTypeSubpage)
+				subpage.Properties.Set("description", "Details")
+				subpage.Properties.Set("subpage", float64(page.ID))
+				card := project.FindCard(1)
+				project.Root().Remove(card)
+				page.Add(card)
+			},
+			want: []diffIDs{{"Root", []int64{2}, nil, []int64{0}}, {"Details", nil, nil, []int64{1}}},
+		},
+	} {
+
+		older := mergeBase()
+		newer := older.Clone()
+		test.edit(newer)
+
+		got := []diffIDs{}
+		for _, diff := range Diff(older, newer) {
+			ids := diffIDs{Name: diff.Name}
+			for _, card := range diff.Added {
+				ids.Added = append(ids.Added, card.ID)
+			}
+			for _, card := range diff.Removed {
+				ids.Removed = append(ids.Removed, card.ID)
+			}
+			for _, card := range diff.Changed {
+				ids.Changed = append(ids.Changed, card.ID)
+			}
+			got = append(got, ids)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, expected %+v", test.name, got, test.want)
+		}
+
+	}
+
+}
+
+func TestPageDiffString(t *testing.T) {
+
+	diff := &PageDiff{Name: "Root", Added: []*Card{{}, {}}, Changed: []*Card{{}}}
+
+	if diff.String() != "Root: 2 added, 1 changed" {
+		t.Errorf("got %q", diff.String())
+	}
+
+}
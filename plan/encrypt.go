@@ -0,0 +1,402 @@
+package plan
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptedMagic begins every encrypted project file. It's followed by a single line of JSON holding the encryption parameters, and then the
+// encrypted project (either a plain project or a bundle) - see Keys.Encrypt().
+const EncryptedMagic = "MasterPlan Encrypted Project\n"
+
+const (
+	encryptionKDF    = "argon2id"
+	encryptionCipher = "aes-256-gcm"
+)
+
+// The Argon2id parameters used to derive keys from passphrases; files store the parameters they were encrypted with.
+const (
+	Argon2Time    = 1
+	Argon2Memory  = 64 * 1024 // In KiB
+	Argon2Threads = 4
+)
+
+// argon2MaxMemory and argon2MaxTime are the most memory (in KiB) and passes a file may ask for to derive its key, so a damaged or malicious
+// file can't exhaust memory or hang whatever's opening it.
+const (
+	argon2MaxMemory = 1024 * 1024
+	argon2MaxTime   = 16
+)
+
+// maxCachedKeys is how many derived keys a Keys holds on to.
+const maxCachedKeys = 4
+
+var (
+	// ErrEncrypted is returned when trying to parse an encrypted project without decrypting it first.
+	ErrEncrypted = errors.New("project is encrypted, and needs a passphrase to be opened")
+	// ErrWrongPassphrase is returned when decryption fails - either the passphrase is wrong, or the file has been tampered with or damaged.
+	ErrWrongPassphrase = errors.New("wrong passphrase, or the encrypted project is damaged")
+)
+
+// kdfParams are the parameters a key was derived from a passphrase with.
+type kdfParams struct {
+	Salt    string // Base64-encoded
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+type derivedKey struct {
+	Passphrase string
+	Params     kdfParams
+	Key        []byte
+}
+
+// Keys holds the keys derived from passphrases to encrypt and decrypt projects with. Deriving a key is slow on purpose, so rather than doing
+// it for every save, each open project keeps its own Keys (see Project.Keys), and the keys are gone along with it. The derived key is only
+// a master key, though; every file is encrypted with a key of its own, made from the master key and a random salt - see Encrypt().
+type Keys struct {
+	lock    sync.Mutex
+	derived []*derivedKey // Most recently used first
+}
+
+// NewKeys returns a new, empty Keys.
+func NewKeys() *Keys {
+	return &Keys{}
+}
+
+// masterKey returns the key derived from the passphrase with the given parameters, deriving it if it isn't held already.
+func (keys *Keys) masterKey(passphrase string, params kdfParams) ([]byte, error) {
+
+	keys.lock.Lock()
+	defer keys.lock.Unlock()
+
+	for i, key := range keys.derived {
+		if key.Passphrase == passphrase && key.Params == params {
+			copy(keys.derived[1:i+1], keys.derived[:i])
+			keys.derived[0] = key
+			return key.Key, nil
+		}
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(params.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &derivedKey{
+		Passphrase: passphrase,
+		Params:     params,
+		Key:        argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, 32),
+	}
+
+	keys.derived = append([]*derivedKey{key}, keys.derived...)
+	if len(keys.derived) > maxCachedKeys {
+		keys.derived = keys.derived[:maxCachedKeys]
+	}
+
+	return key.Key, nil
+
+}
+
+// encryptionParams returns the parameters to derive the master key to encrypt with from - those of the last key used with the passphrase
+// if there is one (so it needn't be derived again), or new ones with a random salt otherwise.
+func (keys *Keys) encryptionParams(passphrase string) (kdfParams, error) {
+
+	keys.lock.Lock()
+	defer keys.lock.Unlock()
+
+	for _, key := range keys.derived {
+		if key.Passphrase == passphrase && key.Params.Time == Argon2Time && key.Params.Memory == Argon2Memory && key.Params.Threads == Argon2Threads {
+			return key.Params, nil
+		}
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return kdfParams{}, err
+	}
+
+	return kdfParams{
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Time:    Argon2Time,
+		Memory:  Argon2Memory,
+		Threads: Argon2Threads,
+	}, nil
+
+}
+
+// fileCipher returns the cipher to encrypt or decrypt a single file with, using a key made from the master key and the file's salt.
+func fileCipher(masterKey, fileSalt []byte) (cipher.AEAD, error) {
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, masterKey, fileSalt, []byte("MasterPlan file key")), key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+
+}
+
+// IsEncrypted returns if the given data is an encrypted project.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(EncryptedMagic))
+}
+
+// Encrypt encrypts the data (a serialized project or bundle) with the passphrase. A master key is derived from the passphrase using Argon2id
+// (or the one held for it is used), and the data is encrypted using AES-256-GCM with a key made from the master key and a new random salt
+// using HKDF-SHA256. The header (including the salts and nonce) is authenticated along with the data, so any tampering is detected on decryption.
+func (keys *Keys) Encrypt(data []byte, passphrase string) ([]byte, error) {
+
+	params, err := keys.encryptionParams(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := keys.masterKey(passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSalt := make([]byte, 16)
+	if _, err := rand.Read(fileSalt); err != nil {
+		return nil, err
+	}
+
+	aead, err := fileCipher(masterKey, fileSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header, _ := sjson.Set("{}", "kdf", encryptionKDF)
+	header, _ = sjson.Set(header, "time", params.Time)
+	header, _ = sjson.Set(header, "memory", params.Memory)
+	header, _ = sjson.Set(header, "threads", params.Threads)
+	header, _ = sjson.Set(header, "salt", params.Salt)
+	header, _ = sjson.Set(header, "cipher", encryptionCipher)
+	header, _ = sjson.Set(header, "filesalt", base64.StdEncoding.EncodeToString(fileSalt))
+	header, _ = sjson.Set(header, "nonce", base64.StdEncoding.EncodeToString(nonce))
+
+	out := []byte(EncryptedMagic + header + "\n")
+
+	return aead.Seal(out, nonce, data, out), nil
+
+}
+
+// Decrypt decrypts data encrypted with Encrypt(). ErrWrongPassphrase is returned if the passphrase is wrong or the data was altered.
+func (keys *Keys) Decrypt(data []byte, passphrase string) ([]byte, error) {
+
+	if !IsEncrypted(data) {
+		return nil, errors.New("data isn't an encrypted project")
+	}
+
+	headerEnd := bytes.IndexByte(data[len(EncryptedMagic):], '\n')
+	if headerEnd < 0 {
+		return nil, ErrWrongPassphrase
+	}
+	headerEnd += len(EncryptedMagic) + 1
+
+	header := string(data[len(EncryptedMagic) : headerEnd-1])
+
+	if gjson.Get(header, "kdf").String() != encryptionKDF || gjson.Get(header, "cipher").String() != encryptionCipher {
+		return nil, errors.New("project is encrypted in an unsupported way; it may have been saved by a newer version of MasterPlan")
+	}
+
+	// The parameters are checked before they're narrowed, so out-of-range values can't wrap around into allowed ones.
+	passes, memory, threads := gjson.Get(header, "time").Uint(), gjson.Get(header, "memory").Uint(), gjson.Get(header, "threads").Uint()
+
+	if passes == 0 || passes > argon2MaxTime || memory == 0 || memory > argon2MaxMemory || threads == 0 || threads > 255 {
+		return nil, ErrWrongPassphrase
+	}
+
+	params := kdfParams{
+		Salt:    gjson.Get(header, "salt").String(),
+		Time:    uint32(passes),
+		Memory:  uint32(memory),
+		Threads: uint8(threads),
+	}
+
+	fileSalt, err := base64.StdEncoding.DecodeString(gjson.Get(header, "filesalt").String())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(gjson.Get(header, "nonce").String())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	masterKey, err := keys.masterKey(passphrase, params)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	aead, err := fileCipher(masterKey, fileSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	decrypted, err := aead.Open(nil, nonce, data[headerEnd:], data[:headerEnd])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return decrypted, nil
+
+}
+
+// Encrypt encrypts the data with the passphrase like Keys.Encrypt(), without holding on to the derived key.
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	return NewKeys().Encrypt(data, passphrase)
+}
+
+// Decrypt decrypts the data with the passphrase like Keys.Decrypt(), without holding on to the derived key.
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	return NewKeys().Decrypt(data, passphrase)
+}
+
+// ReadProjectFile reads the project file at the given filepath, decrypting it with the passphrase if it's encrypted. The key derived from the
+// passphrase is kept in keys, if it isn't nil. ErrEncrypted is returned if it's encrypted and no passphrase is given.
+func ReadProjectFile(filePath, passphrase string, keys *Keys) ([]byte, error) {
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	if passphrase == "" {
+		return nil, ErrEncrypted
+	}
+
+	if keys == nil {
+		keys = NewKeys()
+	}
+
+	return keys.Decrypt(data, passphrase)
+
+}
+
+// ReadProject reads the project or bundle at the given filepath, decrypting it with the passphrase if it's encrypted (keeping the key derived
+// from it in keys, if it isn't nil). Bundled media files aren't extracted; use ExtractBundle() for that.
+func ReadProject(filePath, passphrase string, keys *Keys) (*Project, error) {
+
+	data, err := ReadProjectFile(filePath, passphrase, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsBundleData(data) {
+		project, _, err := parseBundle(data)
+		return project, err
+	}
+
+	return Parse(data)
+
+}
+
+// ReencryptFile rewrites the project file (or bundle) at the given filepath encrypted with newPassphrase, or unencrypted if it's empty. If it's
+// encrypted, it's read with oldPassphrase. Derived keys are kept in keys, if it isn't nil. The file is written safely - see WriteFileVerified().
+func ReencryptFile(filePath, oldPassphrase, newPassphrase string, keys *Keys) error {
+
+	if keys == nil {
+		keys = NewKeys()
+	}
+
+	data, err := ReadProjectFile(filePath, oldPassphrase, keys)
+	if err != nil {
+		return err
+	}
+
+	encoded := data
+	if newPassphrase != "" {
+		if encoded, err = keys.Encrypt(data, newPassphrase); err != nil {
+			return err
+		}
+	}
+
+	return WriteFileVerified(filePath, encoded, func(written []byte) error {
+		if newPassphrase != "" {
+			if written, err = keys.Decrypt(written, newPassphrase); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(written, data) {
+			return errors.New("the decrypted data doesn't match")
+		}
+		return nil
+	})
+
+}
+
+// IsEncryptedFile returns if the file at the given filepath is an encrypted project.
+func IsEncryptedFile(filePath string) bool {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(EncryptedMagic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+
+	return IsEncrypted(header)
+
+}
+
+// keys returns the Project's Keys, creating them if it has none.
+func (project *Project) keys() *Keys {
+	if project.Keys == nil {
+		project.Keys = NewKeys()
+	}
+	return project.Keys
+}
+
+// encode prepares serialized data to be written to disk, encrypting it if the Project has a passphrase.
+func (project *Project) encode(data []byte) ([]byte, error) {
+	if project.Passphrase == "" {
+		return data, nil
+	}
+	return project.keys().Encrypt(data, project.Passphrase)
+}
+
+// decode reverses encode().
+func (project *Project) decode(data []byte) ([]byte, error) {
+	if project.Passphrase == "" {
+		return data, nil
+	}
+	return project.keys().Decrypt(data, project.Passphrase)
+}
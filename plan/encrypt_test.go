@@ -0,0 +1,186 @@
+package plan
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+func TestEncryptedSave(t *testing.T) {
+
+	dir := t.TempDir()
+	projectPath := filepath.Join(dir, "secret.plan")
+
+	project := NewProject()
+	project.Passphrase = "correct horse"
+	card := project.Root().AddCard(ContentTypeNote)
+	card.Properties.Set("description", "Top secret")
+
+	if err := project.Save(projectPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncryptedFile(projectPath) {
+		t.Fatal("project wasn't encrypted")
+	}
+
+	if _, err := Load(projectPath); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("loading without a passphrase gave %v", err)
+	}
+
+	if _, err := ReadProjectFile(projectPath, "wrong horse", nil); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("decrypting with the wrong passphrase gave %v", err)
+	}
+
+	data, err := ReadProjectFile(projectPath, "correct horse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded := loaded.FindCard(card.ID); loaded == nil || loaded.Properties.String("description") != "Top secret" {
+		t.Error("card didn't survive encryption")
+	}
+
+}
+
+func TestDecryptTampered(t *testing.T) {
+
+	encrypted, err := Encrypt([]byte("{}"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted[len(encrypted)-1] ^= 1
+
+	if _, err := Decrypt(encrypted, "passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("decrypting tampered data gave %v", err)
+	}
+
+}
+
+func TestDecryptOversizedParameters(t *testing.T) {
+
+	encrypted, err := Encrypt([]byte("{}"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerEnd := len(EncryptedMagic) + bytes.IndexByte(encrypted[len(EncryptedMagic):], '\n')
+	header := string(encrypted[len(EncryptedMagic):headerEnd])
+
+	for _, param := range []struct {
+		name  string
+		value uint64
+	}{
+		{"time", argon2MaxTime + 1},
+		{"time", 1<<32 + 1}, // Would wrap around to 1 if it were narrowed first
+		{"memory", argon2MaxMemory + 1},
+		{"threads", 256 + 4},
+	} {
+
+		tampered, _ := sjson.Set(header, param.name, param.value)
+		data := append([]byte(EncryptedMagic+tampered), encrypted[headerEnd:]...)
+
+		if _, err := Decrypt(data, "passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("decrypting with %s %d gave %v", param.name, param.value, err)
+		}
+
+	}
+
+}
+
+func TestReencryptFile(t *testing.T) {
+
+	projectPath := filepath.Join(t.TempDir(), "project.plan")
+
+	project := NewProject()
+	project.Root().AddCard(ContentTypeNote).Properties.Set("description", "Backed up")
+
+	if err := project.Save(projectPath); err != nil {
+		t.Fatal(err)
+	}
+
+	original, _ := os.ReadFile(projectPath)
+
+	if err := ReencryptFile(projectPath, "", "first", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncryptedFile(projectPath) {
+		t.Fatal("file wasn't encrypted")
+	}
+
+	if err := ReencryptFile(projectPath, "first", "second", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadProjectFile(projectPath, "first", nil); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("reading with the old passphrase gave %v", err)
+	}
+
+	if err := ReencryptFile(projectPath, "wrong", "third", nil); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("re-encrypting with the wrong passphrase gave %v", err)
+	}
+
+	if err := ReencryptFile(projectPath, "second", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(projectPath); !bytes.Equal(data, original) {
+		t.Errorf("decrypted file doesn't match the original:\n%s", data)
+	}
+
+}
+
+func TestEncryptionSalts(t *testing.T) {
+
+	header := func(data []byte) string {
+		return string(data[len(EncryptedMagic) : len(EncryptedMagic)+bytes.IndexByte(data[len(EncryptedMagic):], '\n')])
+	}
+
+	keys := NewKeys()
+
+	first, err := keys.Encrypt([]byte("first"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := keys.Encrypt([]byte("second"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewKeys().Encrypt([]byte("other"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gjson.Get(header(first), "salt").String() != gjson.Get(header(second), "salt").String() {
+		t.Error("the same Keys derived a new key for the same passphrase")
+	}
+
+	if gjson.Get(header(first), "filesalt").String() == gjson.Get(header(second), "filesalt").String() {
+		t.Error("two files were encrypted with the same salt")
+	}
+
+	if gjson.Get(header(first), "salt").String() == gjson.Get(header(other), "salt").String() {
+		t.Error("separate Keys derived keys with the same salt")
+	}
+
+	for _, data := range [][]byte{first, second, other} {
+		if _, err := Decrypt(data, "passphrase"); err != nil {
+			t.Error(err)
+		}
+	}
+
+}
@@ -0,0 +1,358 @@
+package plan
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// JournalExtension is the file extension of journals.
+const JournalExtension = ".journal"
+
+// ErrNotAJournal is returned when reading a file that isn't a journal.
+var ErrNotAJournal = errors.New("file doesn't appear to be a MasterPlan journal")
+
+// JournalChange is the state of a single Card after a change was made to it.
+type JournalChange struct {
+	PageID  uint64
+	CardID  int64
+	Deleted bool
+	Card    string // The serialized Card; empty if the Card was deleted
+}
+
+// JournalEntry is a set of changes that were made together (i.e. one undo step).
+type JournalEntry struct {
+	Time    time.Time
+	Changes []JournalChange
+}
+
+// A Journal is a write-ahead log of the changes made to a Project since it was last saved. Each change is appended and synced to disk as
+// it's made, so if MasterPlan crashes, the changes can be replayed on top of the last saved version of the Project to recover them. Journals
+// are stored as JSON lines - a header, followed by one line per entry. The entries of encrypted Projects' Journals are encrypted (see
+// Keys.Encrypt()) with the Project's passphrase, each on a line of its own.
+type Journal struct {
+	Path       string
+	Project    string    // Filepath of the Project the Journal belongs to; empty for Projects that haven't been saved yet
+	Created    time.Time // When the Journal was started (i.e. when the Project was last saved or opened)
+	Encrypted  bool
+	Entries    []*JournalEntry
+	file       *os.File
+	sealed     []string // Encrypted entries that haven't been decrypted yet; see Decrypt()
+	passphrase string
+	keys       *Keys
+}
+
+// JournalPath returns the filepath of the journal of the project at the given filepath; it's a hidden file next to the project.
+func JournalPath(projectPath string) string {
+	dir, base := filepath.Split(projectPath)
+	return filepath.Join(dir, "."+base+JournalExtension)
+}
+
+// CreateJournal starts a new Journal at the given filepath for the Project at projectPath (which can be empty for an unsaved Project),
+// replacing any Journal that already exists there. If passphrase isn't empty, the Journal's entries are encrypted with it, using keys.
+func CreateJournal(journalPath, projectPath, passphrase string, keys *Keys) (*Journal, error) {
+
+	if keys == nil {
+		keys = NewKeys()
+	}
+
+	journal := &Journal{
+		Path:       journalPath,
+		Project:    projectPath,
+		Created:    time.Now(),
+		Encrypted:  passphrase != "",
+		Entries:    []*JournalEntry{},
+		passphrase: passphrase,
+		keys:       keys,
+	}
+
+	file, err := os.Create(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	journal.file = file
+
+	header, _ := sjson.Set("{}", "journal", "masterplan")
+	header, _ = sjson.Set(header, "version", Version)
+	header, _ = sjson.Set(header, "project", projectPath)
+	header, _ = sjson.Set(header, "created", journal.Created.Format(time.RFC3339))
+	if journal.Encrypted {
+		header, _ = sjson.Set(header, "encrypted", true)
+	}
+
+	if err := journal.writeLine(header); err != nil {
+		journal.Close()
+		return nil, err
+	}
+
+	return journal, nil
+
+}
+
+// ReadJournal reads the Journal at the given filepath. An incomplete last entry (as left by a crash while it was being written) is ignored.
+// The entries of encrypted Journals are only read once they're decrypted with Decrypt(). The Journal can be continued with Open().
+func ReadJournal(journalPath string) (*Journal, error) {
+
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	header, err := reader.ReadString('\n')
+	if err != nil || gjson.Get(header, "journal").String() != "masterplan" {
+		return nil, ErrNotAJournal
+	}
+
+	journal := &Journal{
+		Path:      journalPath,
+		Project:   gjson.Get(header, "project").String(),
+		Encrypted: gjson.Get(header, "encrypted").Bool(),
+		Entries:   []*JournalEntry{},
+	}
+	journal.Created, _ = time.Parse(time.RFC3339, gjson.Get(header, "created").String())
+
+	for {
+
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break // Any partial line left over wasn't completely written.
+		} else if err != nil {
+			return nil, err
+		}
+
+		if journal.Encrypted {
+			journal.sealed = append(journal.sealed, strings.TrimSuffix(line, "\n"))
+			continue
+		}
+
+		if !gjson.Valid(line) {
+			break
+		}
+
+		journal.Entries = append(journal.Entries, parseJournalEntry(line))
+
+	}
+
+	return journal, nil
+
+}
+
+func parseJournalEntry(line string) *JournalEntry {
+
+	entry := &JournalEntry{Changes: []JournalChange{}}
+	entry.Time, _ = time.Parse(time.RFC3339Nano, gjson.Get(line, "time").String())
+
+	for _, change := range gjson.Get(line, "changes").Array() {
+		entry.Changes = append(entry.Changes, JournalChange{
+			PageID:  change.Get("page").Uint(),
+			CardID:  change.Get("id").Int(),
+			Deleted: change.Get("deleted").Bool(),
+			Card:    change.Get("card").Raw,
+		})
+	}
+
+	return entry
+
+}
+
+// Decrypt decrypts the entries of an encrypted Journal read with ReadJournal() using the passphrase, keeping the key derived from it in keys.
+// Entries appended afterwards are encrypted the same way. ErrWrongPassphrase is returned if the passphrase is wrong; an entry that can't be
+// decrypted after others could is taken to be damaged, and it's left out along with any after it.
+func (journal *Journal) Decrypt(passphrase string, keys *Keys) error {
+
+	if !journal.Encrypted {
+		return nil
+	}
+
+	if keys == nil {
+		keys = NewKeys()
+	}
+
+	entries := []*JournalEntry{}
+
+	for _, line := range journal.sealed {
+
+		data, err := base64.StdEncoding.DecodeString(line)
+		if err == nil {
+			data, err = keys.Decrypt(data, passphrase)
+		}
+
+		if err == nil && !gjson.ValidBytes(data) {
+			err = ErrWrongPassphrase
+		}
+
+		if err != nil {
+			if len(entries) == 0 {
+				return ErrWrongPassphrase
+			}
+			break
+		}
+
+		entries = append(entries, parseJournalEntry(string(data)))
+
+	}
+
+	journal.Entries = entries
+	journal.sealed = nil
+	journal.passphrase = passphrase
+	journal.keys = keys
+
+	return nil
+
+}
+
+// Open opens a Journal that was read using ReadJournal() so that further entries can be appended to it.
+func (journal *Journal) Open() error {
+	file, err := os.OpenFile(journal.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	journal.file = file
+	return nil
+}
+
+// Append writes the given changes to the Journal as a single entry, syncing it to disk before returning.
+func (journal *Journal) Append(changes ...JournalChange) error {
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	entry := &JournalEntry{Time: time.Now(), Changes: changes}
+
+	data, _ := sjson.Set("{}", "time", entry.Time.Format(time.RFC3339Nano))
+
+	for _, change := range changes {
+		changeData, _ := sjson.Set("{}", "page", change.PageID)
+		changeData, _ = sjson.Set(changeData, "id", change.CardID)
+		if change.Deleted {
+			changeData, _ = sjson.Set(changeData, "deleted", true)
+		} else {
+			changeData, _ = sjson.SetRaw(changeData, "card", change.Card)
+		}
+		data, _ = sjson.SetRaw(data, "changes.-1", changeData)
+	}
+
+	if journal.Encrypted {
+
+		// Entries can only be added once the Journal has been decrypted.
+		if journal.keys == nil {
+			return ErrEncrypted
+		}
+
+		encrypted, err := journal.keys.Encrypt([]byte(data), journal.passphrase)
+		if err != nil {
+			return err
+		}
+
+		data = base64.StdEncoding.EncodeToString(encrypted)
+
+	}
+
+	if err := journal.writeLine(data); err != nil {
+		return err
+	}
+
+	journal.Entries = append(journal.Entries, entry)
+
+	return nil
+
+}
+
+func (journal *Journal) writeLine(line string) error {
+
+	if journal.file == nil {
+		return os.ErrClosed
+	}
+
+	if _, err := journal.file.WriteString(line + "\n"); err != nil {
+		return err
+	}
+
+	return journal.file.Sync()
+
+}
+
+// Close closes the Journal's file, leaving it on disk.
+func (journal *Journal) Close() error {
+	if journal.file == nil {
+		return nil
+	}
+	err := journal.file.Close()
+	journal.file = nil
+	return err
+}
+
+// Remove closes and deletes the Journal; this is done once the changes it holds are saved (or discarded).
+func (journal *Journal) Remove() error {
+	journal.Close()
+	return os.Remove(journal.Path)
+}
+
+// ChangeCount returns the number of changes recorded in the Journal.
+func (journal *Journal) ChangeCount() int {
+	count := 0
+	for _, entry := range journal.Entries {
+		count += len(entry.Changes)
+	}
+	return count
+}
+
+// Replay applies the Journal's entries in order to the given Project, which should be the last saved version of the Project the Journal
+// belongs to (or a new Project for unsaved Projects). Cards are matched by ID; Pages that changed Cards are on are created if they don't exist.
+func (journal *Journal) Replay(project *Project) {
+
+	for _, entry := range journal.Entries {
+
+		for _, change := range entry.Changes {
+
+			existing := project.FindCard(change.CardID)
+
+			if change.Deleted {
+				if existing != nil {
+					existing.Page.Remove(existing)
+				}
+				continue
+			}
+
+			card := ParseCard(change.Card)
+			card.ID = change.CardID
+
+			page := project.PageByID(change.PageID)
+			if page == nil {
+				page = NewPage(change.PageID)
+				project.addParsedPage(page)
+			}
+
+			if existing != nil && existing.Page == page {
+				card.Page = page
+				for i, c := range page.Cards {
+					if c == existing {
+						page.Cards[i] = card
+					}
+				}
+				continue
+			}
+
+			if existing != nil {
+				existing.Page.Remove(existing)
+			}
+
+			page.Add(card)
+
+		}
+
+	}
+
+}
@@ -0,0 +1,137 @@
+package plan
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalReplay(t *testing.T) {
+
+	dir := t.TempDir()
+	projectPath := filepath.Join(dir, "project.plan")
+
+	saved := NewProject()
+	kept := saved.Root().AddCard(ContentTypeCheckbox)
+	kept.Properties.Set("description", "Kept")
+	removed := saved.Root().AddCard(ContentTypeNote)
+	removed.Properties.Set("description", "Removed")
+
+	if err := saved.Save(projectPath); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := CreateJournal(JournalPath(projectPath), projectPath, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := *kept
+	edited.Properties = kept.Properties.Clone()
+	edited.Properties.Set("description", "Edited")
+
+	added := NewCard(2, ContentTypeNote)
+	added.Properties.Set("description", "Added")
+
+	journal.Append(JournalChange{PageID: 0, CardID: kept.ID, Card: edited.Serialize()})
+	journal.Append(JournalChange{PageID: 0, CardID: removed.ID, Deleted: true}, JournalChange{PageID: 1, CardID: added.ID, Card: added.Serialize()})
+	journal.Close()
+
+	// Simulate a crash partway through writing an entry.
+	file, _ := os.OpenFile(journal.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"time": "2021-01-01T00:00:00Z", "changes": [{"page": 0, "id"`)
+	file.Close()
+
+	read, err := ReadJournal(journal.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.Project != projectPath || len(read.Entries) != 2 || read.ChangeCount() != 3 {
+		t.Fatalf("read journal for %q with %d entries and %d changes", read.Project, len(read.Entries), read.ChangeCount())
+	}
+
+	project, err := Load(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read.Replay(project)
+
+	if card := project.FindCard(kept.ID); card == nil || card.Properties.String("description") != "Edited" {
+		t.Error("edited card wasn't replayed")
+	}
+
+	if project.FindCard(removed.ID) != nil {
+		t.Error("deleted card is still there")
+	}
+
+	if card := project.FindCard(added.ID); card == nil || card.Page.ID != 1 {
+		t.Error("added card isn't on the page it was added to")
+	}
+
+}
+
+func TestEncryptedJournal(t *testing.T) {
+
+	journalPath := filepath.Join(t.TempDir(), "project.journal")
+
+	card := NewCard(1, ContentTypeNote)
+	card.Properties.Set("description", "Top secret")
+
+	journal, err := CreateJournal(journalPath, "", "correct horse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal.Append(JournalChange{PageID: 0, CardID: card.ID, Card: card.Serialize()})
+	journal.Close()
+
+	if data, _ := os.ReadFile(journalPath); strings.Contains(string(data), "Top secret") {
+		t.Fatal("journal wasn't encrypted")
+	}
+
+	read, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !read.Encrypted || len(read.Entries) != 0 {
+		t.Fatalf("encrypted journal was read with %d entries", len(read.Entries))
+	}
+
+	if err := read.Decrypt("wrong horse", nil); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("decrypting with the wrong passphrase gave %v", err)
+	}
+
+	if err := read.Decrypt("correct horse", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := read.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	read.Append(JournalChange{PageID: 0, CardID: card.ID, Deleted: true})
+	read.Close()
+
+	reread, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reread.Decrypt("correct horse", nil); err != nil || reread.ChangeCount() != 2 {
+		t.Fatalf("decrypted %d changes (%v)", reread.ChangeCount(), err)
+	}
+
+	project := NewProject()
+	reread.Entries = reread.Entries[:1]
+	reread.Replay(project)
+
+	if replayed := project.FindCard(card.ID); replayed == nil || replayed.Properties.String("description") != "Top secret" {
+		t.Error("encrypted change wasn't replayed")
+	}
+
+}
@@ -0,0 +1,465 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// MergeConflictProperty is the name of the Card property Merge() marks Cards with conflicting changes with; it holds the reasons for the
+// conflicts, one per line. The property is kept apart from the Card's own color, so resolving the conflict leaves the Card as it was.
+const MergeConflictProperty = "merge conflict"
+
+// MergeConflictColor is the color (RRGGBBAA) Cards marked with MergeConflictProperty are tinted with, so they're easy to spot.
+const MergeConflictColor = "e03c3cff"
+
+// MergeConflict is a change that was made differently on both sides of a merge, and so couldn't be merged automatically.
+// Our side of the change is kept (apart from descriptions, which get both versions between conflict markers).
+type MergeConflict struct {
+	CardID int64  // ID of the conflicting Card, or -1 for the Project's properties
+	PageID uint64 // ID of the Page the Card ended up on
+	Name   string // Name of the Card at the time of the merge
+	Reason string // What conflicted, e.g. "position changed on both sides"
+}
+
+func (conflict MergeConflict) String() string {
+	if conflict.CardID < 0 {
+		return "project: " + conflict.Reason
+	}
+	return fmt.Sprintf("card %d (%q) on page %d: %s", conflict.CardID, conflict.Name, conflict.PageID, conflict.Reason)
+}
+
+// cardField is a part of a Card that's merged as a whole.
+type cardField struct {
+	Name  string
+	Value func(card *Card) string
+	Copy  func(dst, src *Card)
+}
+
+var mergedCardFields = []cardField{
+	{
+		Name:  "position",
+		Value: func(card *Card) string { return fmt.Sprint(card.Rect.X, card.Rect.Y) },
+		Copy:  func(dst, src *Card) { dst.Rect.X, dst.Rect.Y = src.Rect.X, src.Rect.Y },
+	},
+	{
+		Name:  "size",
+		Value: func(card *Card) string { return fmt.Sprint(card.Rect.W, card.Rect.H) },
+		Copy:  func(dst, src *Card) { dst.Rect.W, dst.Rect.H = src.Rect.W, src.Rect.H },
+	},
+	{
+		Name:  "collapsed state",
+		Value: func(card *Card) string { return fmt.Sprint(card.Collapsed, card.UncollapsedSize) },
+		Copy:  func(dst, src *Card) { dst.Collapsed, dst.UncollapsedSize = src.Collapsed, src.UncollapsedSize },
+	},
+	{
+		Name:  "content type",
+		Value: func(card *Card) string { return card.ContentType },
+		Copy:  func(dst, src *Card) { dst.ContentType = src.ContentType },
+	},
+	{
+		Name:  "color",
+		Value: func(card *Card) string { return card.CustomColor },
+		Copy:  func(dst, src *Card) { dst.CustomColor = src.CustomColor },
+	},
+	{
+		Name:  "font color",
+		Value: func(card *Card) string { return card.FontColor },
+		Copy:  func(dst, src *Card) { dst.FontColor = src.FontColor },
+	},
+}
+
+func changedOnBothSides(what string) string {
+	return what + " changed on both sides"
+}
+
+// merge3 merges a single value that was possibly changed on either side, returning the merged value and if both sides changed it differently.
+func merge3(base, ours, theirs string) (string, bool) {
+	if ours == theirs || theirs == base {
+		return ours, false
+	}
+	if ours == base {
+		return theirs, false
+	}
+	return ours, true
+}
+
+// missingValue stands in for a property that doesn't exist; it can't be confused with a serialized JSON value.
+const missingValue = "\x00"
+
+func propertyValue(properties *Properties, name string) string {
+	if !properties.Has(name) {
+		return missingValue
+	}
+	data, _ := sjson.Set("{}", "v", properties.Get(name))
+	return gjson.Get(data, "v").Raw
+}
+
+// mergeProperties merges theirs into ours, property by property; the names of the properties that conflicted are returned.
+func mergeProperties(base, ours, theirs *Properties) []string {
+
+	conflicts := []string{}
+
+	names := append([]string{}, ours.DefinitionOrder...)
+	for _, name := range theirs.DefinitionOrder {
+		if !ours.Has(name) {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+
+		baseValue, ourValue, theirValue := propertyValue(base, name), propertyValue(ours, name), propertyValue(theirs, name)
+
+		merged, conflict := merge3(baseValue, ourValue, theirValue)
+
+		if conflict {
+			conflicts = append(conflicts, name)
+			ourText, ourString := ours.Get(name).(string)
+			theirText, theirString := theirs.Get(name).(string)
+			if name == "description" && ourString && theirString {
+				ours.Set(name, "<<<<<<< ours\n"+ourText+"\n=======\n"+theirText+"\n>>>>>>> theirs")
+			}
+			continue
+		}
+
+		if merged == ourValue {
+			continue
+		}
+
+		if merged == missingValue {
+			ours.Remove(name)
+		} else {
+			ours.Set(name, theirs.Get(name))
+		}
+
+	}
+
+	return conflicts
+
+}
+
+// cardsEqual returns if two versions of a Card are identical, including the Page they're on.
+func cardsEqual(a, b *Card) bool {
+	return a.Page.ID == b.Page.ID && a.Serialize() == b.Serialize()
+}
+
+func cardsByID(project *Project) map[int64]*Card {
+	cards := map[int64]*Card{}
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			cards[card.ID] = card
+		}
+	}
+	return cards
+}
+
+// resolveIDCollisions gives Pages and Cards that were added on both sides with the same ID (which is likely, as new IDs are handed out
+// sequentially) new IDs in theirs, unless they're identical to ours. theirs is modified in place.
+func resolveIDCollisions(base, ours, theirs *Project) {
+
+	nextPageID := uint64(0)
+	for _, project := range []*Project{ours, theirs} {
+		for _, page := range project.Pages {
+			if page.ID >= nextPageID {
+				nextPageID = page.ID + 1
+			}
+		}
+	}
+
+	for _, page := range theirs.Pages {
+
+		ourPage := ours.PageByID(page.ID)
+		if base.PageByID(page.ID) != nil || ourPage == nil || ourPage.Serialize() == page.Serialize() {
+			continue
+		}
+
+		oldID := page.ID
+		page.ID = nextPageID
+		nextPageID++
+
+		for _, p := range theirs.Pages {
+			for _, card := range p.Cards {
+				if card.ContentType == ContentTypeSubpage && card.Properties.Has("subpage") && uint64(card.Properties.Float("subpage")) == oldID {
+					card.Properties.Set("subpage", page.ID)
+				}
+			}
+		}
+
+	}
+
+	baseCards := cardsByID(base)
+	ourCards := cardsByID(ours)
+
+	nextCardID := ours.NextCardID()
+	if id := theirs.NextCardID(); id > nextCardID {
+		nextCardID = id
+	}
+
+	remapped := map[int64]int64{}
+
+	for _, page := range theirs.Pages {
+		for _, card := range page.Cards {
+			ourCard := ourCards[card.ID]
+			if baseCards[card.ID] != nil || ourCard == nil || cardsEqual(ourCard, card) {
+				continue
+			}
+			remapped[card.ID] = nextCardID
+			card.ID = nextCardID
+			nextCardID++
+		}
+	}
+
+	for _, page := range theirs.Pages {
+		for _, card := range page.Cards {
+			for _, link := range card.Links {
+				if id, exists := remapped[link.Start]; exists {
+					link.Start = id
+				}
+				if id, exists := remapped[link.End]; exists {
+					link.End = id
+				}
+			}
+		}
+	}
+
+}
+
+// mergeLinks merges the Links starting from theirs into ours; Links are matched by the Card they end at. A Link removed on one side is
+// removed (unless the other side changed it, which is a conflict, and keeps it), and a Link added on either side is added. The reasons for
+// any conflicts are returned.
+func mergeLinks(base, ours, theirs *Card) []string {
+
+	conflicts := []string{}
+
+	linksByEnd := func(card *Card) map[int64]*Link {
+		links := map[int64]*Link{}
+		if card != nil {
+			for _, link := range card.Links {
+				links[link.End] = link
+			}
+		}
+		return links
+	}
+
+	baseLinks, ourLinks, theirLinks := linksByEnd(base), linksByEnd(ours), linksByEnd(theirs)
+
+	merged := []*Link{}
+
+	for _, link := range ours.Links {
+
+		baseLink, inBase := baseLinks[link.End]
+		theirLink, inTheirs := theirLinks[link.End]
+
+		if inBase && !inTheirs {
+			if link.Serialize() == baseLink.Serialize() {
+				continue // Removed by them
+			}
+			conflicts = append(conflicts, fmt.Sprintf("link to card %d changed by us, but removed by them", link.End))
+		}
+
+		if inBase && inTheirs {
+			joints, conflict := merge3(baseLink.Serialize(), link.Serialize(), theirLink.Serialize())
+			if conflict {
+				conflicts = append(conflicts, changedOnBothSides(fmt.Sprintf("link to card %d", link.End)))
+			} else if joints != link.Serialize() {
+				link.Joints = append([]Point{}, theirLink.Joints...)
+			}
+		}
+
+		merged = append(merged, link)
+
+	}
+
+	for _, link := range theirs.Links {
+		if _, inOurs := ourLinks[link.End]; inOurs {
+			continue
+		}
+		if baseLink, inBase := baseLinks[link.End]; inBase {
+			if link.Serialize() == baseLink.Serialize() {
+				continue // Removed by us
+			}
+			conflicts = append(conflicts, fmt.Sprintf("link to card %d removed by us, but changed by them", link.End))
+		}
+		merged = append(merged, &Link{Start: ours.ID, End: link.End, Joints: append([]Point{}, link.Joints...)})
+	}
+
+	ours.Links = merged
+
+	return conflicts
+
+}
+
+// Merge performs a three-way merge of two Projects (ours and theirs) that were both changed from a common ancestor (base), such as two
+// branches of a project kept in version control. Cards are matched by their IDs and merged field by field (position, size, colors, the Page
+// they're on) and property by property, so that, for example, one side moving a Card and the other editing its description merges cleanly;
+// Links are merged as sets. Changes made differently on both sides are returned as conflicts; our side of such changes is kept, and
+// conflicting Cards are marked with MergeConflictProperty. None of the given Projects are modified.
+func Merge(base, ours, theirs *Project) (*Project, []MergeConflict) {
+
+	result := ours.Clone()
+	theirs = theirs.Clone()
+
+	resolveIDCollisions(base, result, theirs)
+
+	conflicts := []MergeConflict{}
+
+	for _, name := range mergeProperties(base.Properties, result.Properties, theirs.Properties) {
+		conflicts = append(conflicts, MergeConflict{CardID: -1, Reason: changedOnBothSides(name)})
+	}
+
+	for fp, data := range theirs.SavedImages {
+		if _, exists := result.SavedImages[fp]; !exists {
+			result.SavedImages[fp] = data
+		}
+	}
+
+	for _, page := range theirs.Pages {
+		if result.PageByID(page.ID) == nil && base.PageByID(page.ID) == nil {
+			newPage := NewPage(page.ID)
+			newPage.Pan = page.Pan
+			newPage.Zoom = page.Zoom
+			result.addParsedPage(newPage)
+		}
+	}
+
+	baseCards, ourCards, theirCards := cardsByID(base), cardsByID(result), cardsByID(theirs)
+
+	ids := []int64{}
+	for _, cards := range []map[int64]*Card{baseCards, ourCards, theirCards} {
+		for id := range cards {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	conflicted := map[*Card][]string{}
+
+	// addTheirs adds a copy of their version of a Card to the result; the Card's Page is created if it doesn't exist in the result (i.e. we removed it).
+	addTheirs := func(card *Card) *Card {
+		page := result.PageByID(card.Page.ID)
+		if page == nil {
+			page = NewPage(card.Page.ID)
+			page.Pan = card.Page.Pan
+			page.Zoom = card.Page.Zoom
+			result.addParsedPage(page)
+		}
+		clone := *card
+		clone.Properties = card.Properties.Clone()
+		clone.Links = []*Link{}
+		for _, link := range card.Links {
+			clone.Links = append(clone.Links, &Link{Start: link.Start, End: link.End, Joints: append([]Point{}, link.Joints...)})
+		}
+		page.Add(&clone)
+		return &clone
+	}
+
+	for i, id := range ids {
+
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+
+		baseCard, ourCard, theirCard := baseCards[id], ourCards[id], theirCards[id]
+
+		switch {
+
+		case baseCard == nil:
+			// Added on one side (or both identically, as collisions were resolved beforehand).
+			if ourCard == nil && theirCard != nil {
+				addTheirs(theirCard)
+			}
+
+		case ourCard == nil && theirCard == nil:
+			// Removed on both sides.
+
+		case ourCard == nil:
+			if !cardsEqual(baseCard, theirCard) {
+				card := addTheirs(theirCard)
+				conflicted[card] = append(conflicted[card], "removed by us, but changed by them")
+			}
+
+		case theirCard == nil:
+			if cardsEqual(baseCard, ourCard) {
+				ourCard.Page.Remove(ourCard)
+			} else {
+				conflicted[ourCard] = append(conflicted[ourCard], "changed by us, but removed by them")
+			}
+
+		default:
+
+			pageID, conflict := merge3(fmt.Sprint(baseCard.Page.ID), fmt.Sprint(ourCard.Page.ID), fmt.Sprint(theirCard.Page.ID))
+			if conflict {
+				conflicted[ourCard] = append(conflicted[ourCard], changedOnBothSides("page"))
+			} else if pageID != fmt.Sprint(ourCard.Page.ID) {
+				page := result.PageByID(theirCard.Page.ID)
+				if page == nil {
+					page = NewPage(theirCard.Page.ID)
+					result.addParsedPage(page)
+				}
+				ourCard.Page.Remove(ourCard)
+				page.Add(ourCard)
+			}
+
+			for _, field := range mergedCardFields {
+				value, conflict := merge3(field.Value(baseCard), field.Value(ourCard), field.Value(theirCard))
+				if conflict {
+					conflicted[ourCard] = append(conflicted[ourCard], changedOnBothSides(field.Name))
+				} else if value != field.Value(ourCard) {
+					field.Copy(ourCard, theirCard)
+				}
+			}
+
+			for _, name := range mergeProperties(baseCard.Properties, ourCard.Properties, theirCard.Properties) {
+				conflicted[ourCard] = append(conflicted[ourCard], changedOnBothSides(name))
+			}
+
+			conflicted[ourCard] = append(conflicted[ourCard], mergeLinks(baseCard, ourCard, theirCard)...)
+
+		}
+
+	}
+
+	// Links can only connect Cards on the same Page, so drop any that point to Cards that were removed or moved elsewhere.
+	for _, page := range result.Pages {
+		for _, card := range page.Cards {
+			links := []*Link{}
+			for _, link := range card.Links {
+				if page.CardByID(link.Start) != nil && page.CardByID(link.End) != nil {
+					links = append(links, link)
+				}
+			}
+			card.Links = links
+		}
+	}
+
+	// Remove Pages that one side removed, as long as nothing is left on them.
+	pages := []*Page{}
+	for _, page := range result.Pages {
+		if page != result.Root() && len(page.Cards) == 0 && base.PageByID(page.ID) != nil && (ours.PageByID(page.ID) == nil || theirs.PageByID(page.ID) == nil) {
+			continue
+		}
+		pages = append(pages, page)
+	}
+	result.Pages = pages
+
+	for _, page := range result.Pages {
+		for _, card := range page.SortedCards() {
+			for _, reason := range conflicted[card] {
+				conflicts = append(conflicts, MergeConflict{CardID: card.ID, PageID: page.ID, Name: card.Name(), Reason: reason})
+			}
+			if len(conflicted[card]) > 0 {
+				card.Properties.Set(MergeConflictProperty, strings.Join(conflicted[card], "\n"))
+			}
+		}
+	}
+
+	result.Schema = SchemaVersion
+	result.Migrations = nil
+
+	return result, conflicts
+
+}
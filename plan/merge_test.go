@@ -0,0 +1,144 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+)
+
+// mergeBase creates a small project with two linked Cards, as the common ancestor of a merge.
+func mergeBase() *Project {
+
+	project := NewProject()
+	root := project.Root()
+
+	a := root.AddCard(ContentTypeCheckbox)
+	a.Properties.Set("description", "A")
+	a.Properties.Set("checked", false)
+
+	b := root.AddCard(ContentTypeNote)
+	b.Rect.Y = 64
+	b.Properties.Set("description", "B")
+
+	a.LinkTo(b)
+
+	return project
+
+}
+
+func TestMergeClean(t *testing.T) {
+
+	base := mergeBase()
+	ours := base.Clone()
+	theirs := base.Clone()
+
+	// We move A and add a card; they edit A's description, unlink A from B, and add a card of their own.
+	ours.FindCard(0).Rect.X = 320
+	ours.Root().AddCard(ContentTypeNote).Properties.Set("description", "Ours")
+
+	theirs.FindCard(0).Properties.Set("description", "A, edited")
+	theirs.FindCard(0).Links = []*Link{}
+	theirs.Root().AddCard(ContentTypeNote).Properties.Set("description", "Theirs")
+
+	merged, conflicts := Merge(base, ours, theirs)
+
+	if len(conflicts) > 0 {
+		t.Fatalf("unexpected conflicts: %v", conflicts)
+	}
+
+	a := merged.FindCard(0)
+	if a.Rect.X != 320 || a.Properties.String("description") != "A, edited" {
+		t.Errorf("card A wasn't merged: %s", a.Serialize())
+	}
+
+	if len(a.Links) != 0 {
+		t.Errorf("link removed by them is still there: %v", a.Links)
+	}
+
+	if len(merged.Root().Cards) != 4 {
+		t.Fatalf("merged project has %d cards, expected 4", len(merged.Root().Cards))
+	}
+
+	names := map[string]bool{}
+	ids := map[int64]bool{}
+	for _, card := range merged.Root().Cards {
+		names[card.Properties.String("description")] = true
+		if ids[card.ID] {
+			t.Errorf("card ID %d is used twice", card.ID)
+		}
+		ids[card.ID] = true
+	}
+
+	if !names["Ours"] || !names["Theirs"] {
+		t.Errorf("cards added on either side are missing: %v", names)
+	}
+
+}
+
+func TestMergeConflict(t *testing.T) {
+
+	base := mergeBase()
+	ours := base.Clone()
+	theirs := base.Clone()
+
+	ours.FindCard(1).Properties.Set("description", "Ours")
+	theirs.FindCard(1).Properties.Set("description", "Theirs")
+
+	// One side removing a card the other side changed is a conflict, too.
+	ours.FindCard(0).Properties.Set("checked", true)
+	theirs.Root().Remove(theirs.FindCard(0))
+
+	merged, conflicts := Merge(base, ours, theirs)
+
+	if len(conflicts) != 2 {
+		t.Fatalf("got %d conflicts, expected 2: %v", len(conflicts), conflicts)
+	}
+
+	b := merged.FindCard(1)
+	if b.Properties.String(MergeConflictProperty) != "description changed on both sides" || b.CustomColor != "" {
+		t.Errorf("conflicting card was marked with %q and colored %q", b.Properties.String(MergeConflictProperty), b.CustomColor)
+	}
+
+	if desc := b.Properties.String("description"); !strings.Contains(desc, "Ours") || !strings.Contains(desc, "Theirs") {
+		t.Errorf("conflicting description doesn't contain both versions: %q", desc)
+	}
+
+	if a := merged.FindCard(0); a == nil || !a.Properties.Bool("checked") {
+		t.Error("card changed by us but removed by them wasn't kept")
+	}
+
+}
+
+func TestMergeLinkConflict(t *testing.T) {
+
+	// changed bends A's link to B; removed unlinks A from B.
+	changed := func(project *Project) { project.FindCard(0).Links[0].Joints = []Point{{200, 32}} }
+	removed := func(project *Project) { project.FindCard(0).Links = []*Link{} }
+
+	for _, test := range []struct {
+		name         string
+		ours, theirs func(project *Project)
+		reason       string
+	}{
+		{"changed by us", changed, removed, "link to card 1 changed by us, but removed by them"},
+		{"removed by us", removed, changed, "link to card 1 removed by us, but changed by them"},
+	} {
+
+		base := mergeBase()
+		ours := base.Clone()
+		theirs := base.Clone()
+		test.ours(ours)
+		test.theirs(theirs)
+
+		merged, conflicts := Merge(base, ours, theirs)
+
+		if len(conflicts) != 1 || conflicts[0].CardID != 0 || conflicts[0].Reason != test.reason {
+			t.Errorf("%s: got conflicts %v", test.name, conflicts)
+		}
+
+		if links := merged.FindCard(0).Links; len(links) != 1 || len(links[0].Joints) != 1 || links[0].Joints[0] != (Point{200, 32}) {
+			t.Errorf("%s: the changed link wasn't kept: %+v", test.name, links)
+		}
+
+	}
+
+}
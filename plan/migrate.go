@@ -0,0 +1,570 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Schema versions of the .plan format. The schema version of a project is stored in its "schema" field; projects saved before it
+// existed have their schema version detected from their layout (see DetectSchema()).
+const (
+	SchemaV07      = iota // MasterPlan v0.7; a completely different layout made up of Tasks on Boards
+	SchemaFolders         // Early v0.8 alphas (v0.8.0-alpha.3 and below); Pages organized into folders
+	SchemaPages           // v0.8.0-alpha.4 and up; a flat list of Pages, without an explicit schema version
+	SchemaExplicit        // The schema version is stored in the project
+
+	// SchemaVersion is the current schema version, which is the one projects are saved in.
+	SchemaVersion = SchemaExplicit
+)
+
+// ErrNewerSchema is returned when a project was saved by a newer version of MasterPlan than this one.
+var ErrNewerSchema = errors.New("project was saved by a newer version of MasterPlan")
+
+// Migration upgrades serialized projects from one schema version to a later one.
+type Migration struct {
+	From, To    int
+	Description string
+	Migrate     func(json string) (string, error)
+}
+
+var migrations = []*Migration{}
+
+// RegisterMigration registers a Migration to be run when loading projects. Only one Migration can be registered for each schema version.
+func RegisterMigration(migration *Migration) {
+
+	if migration.To <= migration.From {
+		panic(fmt.Sprintf("migration from schema %d must upgrade to a later schema, not %d", migration.From, migration.To))
+	}
+
+	for _, m := range migrations {
+		if m.From == migration.From {
+			panic(fmt.Sprintf("a migration from schema %d is already registered", migration.From))
+		}
+	}
+
+	migrations = append(migrations, migration)
+
+}
+
+func init() {
+
+	RegisterMigration(&Migration{
+		From:        SchemaV07,
+		To:          SchemaPages,
+		Description: "Imported MasterPlan v0.7 project",
+		Migrate:     migrateV07,
+	})
+
+	RegisterMigration(&Migration{
+		From:        SchemaFolders,
+		To:          SchemaPages,
+		Description: "Flattened folder-organized Pages",
+		Migrate:     migrateFolders,
+	})
+
+	RegisterMigration(&Migration{
+		From:        SchemaPages,
+		To:          SchemaExplicit,
+		Description: "Added explicit schema version",
+		Migrate: func(json string) (string, error) {
+			return sjson.Set(json, "schema", SchemaExplicit)
+		},
+	})
+
+}
+
+// DetectSchema returns the schema version of the given serialized project.
+func DetectSchema(json string) (int, error) {
+
+	if !gjson.Valid(json) {
+		return 0, ErrNotAProject
+	}
+
+	if schema := gjson.Get(json, "schema"); schema.Exists() {
+		return int(schema.Int()), nil
+	}
+
+	version := gjson.Get(json, "version")
+
+	if gjson.Get(json, "Version").Exists() {
+		return SchemaV07, nil
+	} else if version.Exists() {
+		if ver, err := semver.Parse(version.String()); err != nil || ver.Minor < 8 {
+			return SchemaV07, nil
+		}
+	}
+
+	// Really early v0.8 alphas didn't store a version at all; the project was just the root folder.
+	if gjson.Get(json, "pagecontenttype").Exists() || gjson.Get(json, "root").Exists() || gjson.Get(json, "pages.0.type").Exists() {
+		return SchemaFolders, nil
+	}
+
+	if version.Exists() {
+		return SchemaPages, nil
+	}
+
+	return 0, ErrNotAProject
+
+}
+
+// Migrate upgrades the given serialized project to the current schema version, running each registered Migration needed in turn.
+// The descriptions of the Migrations that were run are returned, in order.
+func Migrate(data []byte) ([]byte, []string, error) {
+
+	json := string(data)
+	applied := []string{}
+
+	schema, err := DetectSchema(json)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if schema > SchemaVersion {
+		return nil, nil, ErrNewerSchema
+	}
+
+	for schema < SchemaVersion {
+
+		var migration *Migration
+		for _, m := range migrations {
+			if m.From == schema {
+				migration = m
+				break
+			}
+		}
+
+		if migration == nil {
+			return nil, nil, fmt.Errorf("no migration registered from schema %d", schema)
+		}
+
+		if json, err = migration.Migrate(json); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", migration.Description, err)
+		}
+
+		applied = append(applied, migration.Description)
+		schema = migration.To
+
+	}
+
+	return []byte(json), applied, nil
+
+}
+
+// migrateFolders flattens the folders that Pages were organized into in early v0.8 alphas. Every Page becomes a Page of its own, with
+// Sub-Page Cards on the root Page pointing to all Pages after the first, so they remain reachable.
+func migrateFolders(json string) (string, error) {
+
+	type folderPage struct {
+		Name  string
+		Data  string
+		Cards []string
+	}
+
+	pages := []*folderPage{}
+
+	if typed := gjson.Get(json, "pages"); typed.Exists() {
+
+		// Pages and folders in a flat list, with the Cards stored separately and pointing to the Page they're on
+		byID := map[int64]*folderPage{}
+		for _, p := range typed.Array() {
+			if p.Get("type").String() == "Page" {
+				page := &folderPage{Name: p.Get("name").String(), Data: "{}"}
+				pages = append(pages, page)
+				byID[p.Get("id").Int()] = page
+			}
+		}
+
+		for _, card := range gjson.Get(json, "cards").Array() {
+			if page, exists := byID[card.Get("page").Int()]; exists {
+				cardData, _ := sjson.Delete(card.Raw, "page")
+				page.Cards = append(page.Cards, cardData)
+			}
+		}
+
+	} else {
+
+		root := gjson.Get(json, "root")
+		if !root.Exists() {
+			root = gjson.Parse(json)
+		}
+
+		var walk func(folder gjson.Result)
+		walk = func(folder gjson.Result) {
+			for _, content := range folder.Get("contents").Array() {
+				if content.Get("pagecontenttype").String() == "PageContentFolder" {
+					walk(content)
+				} else {
+					page := &folderPage{Name: content.Get("name").String(), Data: content.Raw}
+					for _, card := range content.Get("cards").Array() {
+						page.Cards = append(page.Cards, card.Raw)
+					}
+					pages = append(pages, page)
+				}
+			}
+		}
+
+		walk(root)
+
+	}
+
+	if len(pages) == 0 {
+		pages = append(pages, &folderPage{Name: "Root", Data: "{}"})
+	}
+
+	// Give Cards without IDs (which really early alphas didn't store) fresh ones.
+	nextID := int64(0)
+	for _, page := range pages {
+		for _, card := range page.Cards {
+			if id := gjson.Get(card, "id"); id.Exists() && id.Int() >= nextID {
+				nextID = id.Int() + 1
+			}
+		}
+	}
+
+	out := "{}"
+	out, _ = sjson.Set(out, "version", gjson.Get(json, "version").String())
+	if pan := gjson.Get(json, "pan"); pan.Exists() {
+		out, _ = sjson.SetRaw(out, "pan", pan.Raw)
+	}
+	if zoom := gjson.Get(json, "zoom"); zoom.Exists() {
+		out, _ = sjson.SetRaw(out, "zoom", zoom.Raw)
+	}
+
+	pageData := []string{}
+
+	for i, page := range pages {
+
+		data := "{}"
+		data, _ = sjson.Set(data, "id", i)
+		if pan := gjson.Get(page.Data, "pan"); pan.Exists() {
+			data, _ = sjson.SetRaw(data, "pan", pan.Raw)
+		}
+		data, _ = sjson.Set(data, "zoom", 1)
+		if zoom := gjson.Get(page.Data, "zoom"); zoom.Exists() {
+			data, _ = sjson.SetRaw(data, "zoom", zoom.Raw)
+		}
+
+		for _, card := range page.Cards {
+
+			if !gjson.Get(card, "id").Exists() {
+				card, _ = sjson.Set(card, "id", nextID)
+				nextID++
+			}
+
+			// Links used to be stored as pairs of Card IDs, on both Cards they connected; they're stored on the starting Card only now.
+			if links := gjson.Get(card, "links"); links.Exists() && links.Get("0").Type == gjson.Number {
+				id := gjson.Get(card, "id").Int()
+				ids := links.Array()
+				card, _ = sjson.Delete(card, "links")
+				for i := 0; i+1 < len(ids); i += 2 {
+					if ids[i].Int() == id {
+						link := &Link{Start: ids[i].Int(), End: ids[i+1].Int()}
+						card, _ = sjson.SetRaw(card, "links.-1", link.Serialize())
+					}
+				}
+			}
+
+			data, _ = sjson.SetRaw(data, "cards.-1", card)
+
+		}
+
+		pageData = append(pageData, data)
+
+	}
+
+	// Point Sub-Page Cards to the Pages after the root, placing them in a row above everything else on the root Page.
+	if len(pages) > 1 {
+
+		top := float32(0)
+		for _, card := range gjson.Get(pageData[0], "cards").Array() {
+			if y := float32(card.Get("rect.Y").Float()); y < top {
+				top = y
+			}
+		}
+
+		x := float32(0)
+		size := DefaultCardSize(ContentTypeSubpage)
+
+		for i, page := range pages[1:] {
+			card := NewCard(nextID, ContentTypeSubpage)
+			nextID++
+			card.Rect.X = x
+			card.Rect.Y = top - size.Y - GridSize
+			card.Properties.Set("description", page.Name)
+			card.Properties.Set("subpage", i+1)
+			pageData[0], _ = sjson.SetRaw(pageData[0], "cards.-1", card.Serialize())
+			x += size.X + GridSize
+		}
+
+	}
+
+	out, _ = sjson.SetRaw(out, "pages", "["+strings.Join(pageData, ", ")+"]")
+
+	if savedImages := gjson.Get(json, "savedimages"); savedImages.Exists() {
+		out, _ = sjson.SetRaw(out, "savedimages", savedImages.Raw)
+	}
+
+	return out, nil
+
+}
+
+// migrateV07 imports a MasterPlan v0.7 project. v0.7 had Tasks on Boards rather than Cards on Pages; each Board becomes a Page, reachable
+// through a Sub-Page Card on the root Page. Lines don't exist anymore, so the Cards they connected are linked instead. Not everything carries
+// over; text Cards, for example, should be resized to fit their text once they're loaded.
+func migrateV07(json string) (string, error) {
+
+	gs := float32(GridSize)
+
+	project := NewProject()
+	project.Version = gjson.Get(json, "Version").String()
+	if project.Version == "" {
+		project.Version = gjson.Get(json, "version").String()
+	}
+
+	boardNames := gjson.Get(json, "BoardNames").Array()
+	for len(project.Pages) < len(boardNames) {
+		project.AddPage()
+	}
+
+	root := project.Root()
+	subpages := []*Card{}
+
+	x := float32(0)
+
+	for i, b := range boardNames {
+		if i == 0 {
+			continue
+		}
+		card := root.AddCard(ContentTypeSubpage)
+		card.Rect.X = x
+		card.Properties.Set("description", b.String())
+		card.Properties.Set("subpage", project.Pages[i].ID)
+		x += card.Rect.W + gs
+		subpages = append(subpages, card)
+	}
+
+	type line struct {
+		Page    *Page
+		Start   Point
+		Endings []Point
+	}
+
+	lines := []line{}
+
+	for _, task := range gjson.Get(json, "Tasks").Array() {
+
+		boardIndex := int(task.Get("BoardIndex").Int())
+		if boardIndex < 0 || boardIndex >= len(project.Pages) {
+			continue
+		}
+		page := project.Pages[boardIndex]
+
+		position := Point{float32(task.Get(`Position\.X`).Float() * 2), float32(task.Get(`Position\.Y`).Float() * 2)} // Grid is 32x32 in MasterPlan v0.8 compared to 16x16 in v0.7.2
+
+		contentType := ContentTypeCheckbox
+
+		switch task.Get(`TaskType\.CurrentChoice`).Int() {
+		// case 0: // Checkbox
+		case 1: // Progression
+			contentType = ContentTypeNumbered
+		case 2:
+			contentType = ContentTypeNote
+		case 3:
+			contentType = ContentTypeImage
+		case 4:
+			contentType = ContentTypeSound
+		case 5:
+			contentType = ContentTypeTimer
+		case 6:
+			// Line
+			l := line{Page: page, Start: position}
+			endings := task.Get(`LineEndings`).Array()
+			for i := 0; i+1 < len(endings); i += 2 {
+				l.Endings = append(l.Endings, Point{float32(endings[i].Float() * 2), float32(endings[i+1].Float() * 2)})
+			}
+			lines = append(lines, l)
+			continue // Lines don't exist, so we do our best to connect cards that lines were connected to and move on
+		case 7:
+			contentType = ContentTypeMap
+		case 8:
+			// Whiteboards don't exist either
+			continue
+		case 9:
+			contentType = ContentTypeTable
+		}
+
+		card := page.AddCard(contentType)
+		card.Rect.X = position.X
+		card.Rect.Y = position.Y
+
+		switch contentType {
+		case ContentTypeCheckbox, ContentTypeNumbered, ContentTypeNote, ContentTypeTimer:
+			desc := task.Get("Description").String()
+			if desc == "" {
+				desc = task.Get(`TimerName\.Text`).String()
+			}
+			card.Properties.Set("description", desc)
+		}
+
+		switch contentType {
+		case ContentTypeCheckbox:
+			card.Properties.Set("checked", task.Get(`Checkbox\.Checked`).Bool())
+		case ContentTypeNumbered:
+			card.Properties.Set("current", task.Get(`Progression\.Current`).Float())
+			card.Properties.Set("maximum", task.Get(`Progression\.Max`).Float())
+		}
+
+		if card.Completable() && task.Get(`DeadlineDaySpinner\.Number`).Exists() {
+			deadlineDay := int(task.Get(`DeadlineDaySpinner\.Number`).Int())
+			deadlineMonth := time.Month(task.Get(`DeadlineMonthSpinner\.CurrentChoice`).Int() + 1)
+			deadlineYear := int(task.Get(`DeadlineYearSpinner\.Number`).Int())
+			card.Properties.Set("deadline", time.Date(deadlineYear, deadlineMonth, deadlineDay, 0, 0, 0, 0, time.Local).Format(DeadlineFormat))
+		}
+
+		if contentType == ContentTypeImage || contentType == ContentTypeSound {
+			fp := []string{}
+			for _, element := range task.Get(`FilePath`).Array() {
+				fp = append(fp, element.String())
+			}
+			card.Properties.Set("filepath", filepath.ToSlash(filepath.Join(fp...)))
+		}
+
+		if task.Get(`ImageDisplaySize\.X`).Exists() {
+			card.Rect.W = float32(task.Get(`ImageDisplaySize\.X`).Float() * 2)
+			card.Rect.H = float32(task.Get(`ImageDisplaySize\.Y`).Float() * 2)
+		}
+
+		if task.Get(`TimerMode\.CurrentChoice`).Exists() {
+
+			switch task.Get(`TimerMode\.CurrentChoice`).Int() {
+
+			// Countdown
+			case 0:
+				card.Properties.Set("mode group", TimerModeCountdown)
+				minutes := int(task.Get(`TimerMinuteSpinner\.Number`).Int())
+				seconds := int(task.Get(`TimerSecondSpinner\.Number`).Int())
+				minutes += seconds / 60
+				seconds %= 60
+				card.Properties.Set("max time", fmt.Sprintf("%02d:%02d", minutes, seconds))
+				switch task.Get(`TimerTriggerMode\.CurrentChoice`).Int() {
+				case 1:
+					card.Properties.Set("trigger mode", TriggerTypeSet)
+				case 2:
+					card.Properties.Set("trigger mode", TriggerTypeClear)
+				default:
+					card.Properties.Set("trigger mode", TriggerTypeToggle)
+				}
+			case 3:
+				card.Properties.Set("mode group", TimerModeStopwatch)
+
+			}
+
+		}
+
+		if mapData := task.Get(`MapData`); mapData.Exists() {
+
+			card.Rect.H -= gs // There's no header bar for maps in 0.8, so they're one row shorter
+
+			data := &MapData{Data: make([][]int, int(card.Rect.H/gs))}
+			for y := range data.Data {
+				data.Data[y] = make([]int, int(card.Rect.W/gs))
+			}
+
+			for y, row := range mapData.Array() {
+				for x, value := range row.Array() {
+					if y < len(data.Data) && x < len(data.Data[y]) {
+						data.Data[y][x] = int(value.Int())
+					}
+				}
+			}
+
+			card.SetMapData(data)
+
+		}
+
+		if tableData := task.Get(`TableData`); tableData.Exists() {
+
+			columns := tableData.Get("Columns").Array()
+			rows := tableData.Get("Rows").Array()
+
+			card.Rect.W = float32(len(columns)) * gs
+			card.Rect.H = float32(len(rows)) * gs
+
+			td := NewTableData(len(columns), len(rows))
+			for i, s := range columns {
+				td.ColumnHeadings[i] = s.String()
+			}
+			for i, s := range rows {
+				td.RowHeadings[i] = s.String()
+			}
+			for y, row := range tableData.Get("Completion").Array() {
+				for x, value := range row.Array() {
+					td.SetValue(x, y, int(value.Int()))
+				}
+			}
+
+			card.SetTableData(td)
+
+		}
+
+		if contentType != ContentTypeNote && contentType != ContentTypeImage && contentType != ContentTypeMap && contentType != ContentTypeTable {
+			// Collapsing the cards make them align more correctly to the 0.7 "single-line" layout
+			card.Collapsed = CollapsedShade
+			card.UncollapsedSize = Point{card.Rect.W, card.Rect.H}
+			card.Rect.H = gs
+		}
+
+	}
+
+	cardAt := func(page *Page, point Point) *Card {
+		var found *Card
+		for _, card := range page.Cards {
+			// Skip subpages because they don't exist in 0.7
+			if card.ContentType != ContentTypeSubpage && card.Rect.Contains(point.X, point.Y) {
+				found = card
+			}
+		}
+		return found
+	}
+
+	// Attempt to connect relevant Cards
+	for _, l := range lines {
+		for _, dest := range l.Endings {
+			if start, end := cardAt(l.Page, l.Start), cardAt(l.Page, dest); start != nil && end != nil && start != end {
+				start.LinkTo(end)
+			}
+		}
+	}
+
+	// Move the Sub-Page Cards to the right of everything else on the root Page.
+	if len(root.Cards) > 0 {
+
+		x1, x2 := root.Cards[0].Rect.X, root.Cards[0].Rect.X
+
+		for _, card := range root.Cards {
+			if card.ContentType != ContentTypeSubpage {
+				if card.Rect.X < x1 {
+					x1 = card.Rect.X
+				}
+				if card.Rect.X+card.Rect.W > x2 {
+					x2 = card.Rect.X + card.Rect.W
+				}
+			}
+		}
+
+		for _, subpage := range subpages {
+			subpage.Rect.X += x2 - x1
+		}
+
+	}
+
+	return project.Serialize(), nil
+
+}
@@ -0,0 +1,213 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// TestLoadExamples loads every example project through the migration chain, and checks that the result survives being saved and loaded again.
+func TestLoadExamples(t *testing.T) {
+
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*.plan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no example projects found")
+	}
+
+	for _, file := range files {
+
+		t.Run(filepath.Base(file), func(t *testing.T) {
+
+			project, err := Load(file)
+			if err != nil {
+				t.Fatalf("loading failed: %s", err)
+			}
+
+			if project.Root() == nil {
+				t.Fatal("project has no root page")
+			}
+
+			if project.Schema < SchemaVersion && len(project.Migrations) == 0 {
+				t.Errorf("project was in schema %d, but no migrations were recorded", project.Schema)
+			}
+
+			for _, page := range project.Pages[1:] {
+				if project.SubpageCard(page) == nil {
+					t.Errorf("page %d isn't reachable through a Sub-Page card", page.ID)
+				}
+			}
+
+			for _, page := range project.Pages {
+				for _, card := range page.Cards {
+					for _, link := range card.Links {
+						if page.CardByID(link.Start) == nil || page.CardByID(link.End) == nil {
+							t.Errorf("card %d has a link to a card that doesn't exist (%d -> %d)", card.ID, link.Start, link.End)
+						}
+					}
+				}
+			}
+
+			saved := project.Serialize()
+
+			if schema := gjson.Get(saved, "schema").Int(); schema != SchemaVersion {
+				t.Errorf("saved with schema %d, expected %d", schema, SchemaVersion)
+			}
+
+			reloaded, err := Parse([]byte(saved))
+			if err != nil {
+				t.Fatalf("reloading failed: %s", err)
+			}
+
+			if len(reloaded.Migrations) > 0 {
+				t.Errorf("reloading a saved project ran migrations: %v", reloaded.Migrations)
+			}
+
+			if reloaded.Serialize() != saved {
+				t.Error("project changed after being saved and reloaded")
+			}
+
+		})
+
+	}
+
+}
+
+func TestMigrations(t *testing.T) {
+
+	tests := []struct {
+		File       string
+		Schema     int
+		Migrations int
+		Pages      int
+		Cards      int
+	}{
+		{"master.plan", SchemaV07, 2, 3, -1},
+		{"mario.plan", SchemaFolders, 2, 1, 1},
+		{"example.plan", SchemaFolders, 2, 1, 7},
+		{"t.plan", SchemaFolders, 2, 2, 3},
+		{"testingsubpages.plan", SchemaPages, 1, 4, 7},
+		{"boardstest3-alpha4.plan", SchemaPages, 1, 2, 14},
+		{"testOldmap.plan", SchemaPages, 1, 2, 29},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.File, func(t *testing.T) {
+
+			project, err := Load(filepath.Join("..", "examples", test.File))
+			if err != nil {
+				t.Fatalf("loading failed: %s", err)
+			}
+
+			if project.Schema != test.Schema {
+				t.Errorf("detected schema %d, expected %d", project.Schema, test.Schema)
+			}
+
+			if len(project.Migrations) != test.Migrations {
+				t.Errorf("ran %d migrations (%v), expected %d", len(project.Migrations), project.Migrations, test.Migrations)
+			}
+
+			if len(project.Pages) != test.Pages {
+				t.Errorf("loaded %d pages, expected %d", len(project.Pages), test.Pages)
+			}
+
+			cards := 0
+			for _, page := range project.Pages {
+				cards += len(page.Cards)
+			}
+
+			if test.Cards >= 0 && cards != test.Cards {
+				t.Errorf("loaded %d cards, expected %d", cards, test.Cards)
+			}
+
+		})
+
+	}
+
+}
+
+func TestMigrateOldMap(t *testing.T) {
+
+	project, err := Load(filepath.Join("..", "examples", "testOldmap.plan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maps := 0
+
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			if mapData := card.MapData(); mapData != nil {
+				maps++
+				if len(mapData.Data) == 0 {
+					t.Errorf("map card %d has no data", card.ID)
+				}
+			}
+		}
+	}
+
+	if maps == 0 {
+		t.Error("no map cards loaded")
+	}
+
+}
+
+func TestMigrateV07(t *testing.T) {
+
+	data, err := os.ReadFile(filepath.Join("..", "examples", "master.plan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boards := gjson.GetBytes(data, "BoardNames").Array()
+
+	for i, board := range boards[1:] {
+		page := project.Pages[i+1]
+		if name := project.PageName(page); name != board.String() {
+			t.Errorf("page %d is named %q, expected %q", page.ID, name, board.String())
+		}
+	}
+
+	tasks := 0
+	for _, task := range gjson.GetBytes(data, "Tasks").Array() {
+		if taskType := task.Get(`TaskType\.CurrentChoice`).Int(); taskType != 6 && taskType != 8 {
+			tasks++
+		}
+	}
+
+	cards := 0
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			if card.ContentType != ContentTypeSubpage {
+				cards++
+			}
+		}
+	}
+
+	if cards != tasks {
+		t.Errorf("imported %d cards from %d tasks", cards, tasks)
+	}
+
+}
+
+func TestNewerSchema(t *testing.T) {
+
+	newer, _ := sjson.Set(NewProject().Serialize(), "schema", SchemaVersion+1)
+
+	if _, err := Parse([]byte(newer)); err != ErrNewerSchema {
+		t.Errorf("loading a project with a newer schema returned %v, expected ErrNewerSchema", err)
+	}
+
+}
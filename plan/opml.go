@@ -0,0 +1,266 @@
+package plan
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OPML is an OPML 2.0 document, as used by outliners and mind-mapping tools.
+type OPML struct {
+	XMLName  xml.Name       `xml:"opml"`
+	Version  string         `xml:"version,attr"`
+	Title    string         `xml:"head>title,omitempty"`
+	Outlines []*OPMLOutline `xml:"body>outline"`
+}
+
+// OPMLOutline is an outline (item) of an OPML document. Attributes other than text (e.g. "_note", "_status", or MasterPlan's own, like
+// "_deadline") are kept in Attrs.
+type OPMLOutline struct {
+	Text     string         `xml:"text,attr"`
+	Attrs    []xml.Attr     `xml:",any,attr"`
+	Outlines []*OPMLOutline `xml:"outline"`
+}
+
+// NewOPML creates a new, empty OPML document with the given title.
+func NewOPML(title string) *OPML {
+	return &OPML{Version: "2.0", Title: title, Outlines: []*OPMLOutline{}}
+}
+
+// ParseOPML parses an OPML document.
+func ParseOPML(data []byte) (*OPML, error) {
+	opml := &OPML{}
+	if err := xml.Unmarshal(data, opml); err != nil {
+		return nil, err
+	}
+	return opml, nil
+}
+
+// Serialize returns the document as indented XML.
+func (opml *OPML) Serialize() ([]byte, error) {
+	data, err := xml.MarshalIndent(opml, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// Attr returns the value of the outline's attribute with the given name, or an empty string if it doesn't have it.
+func (outline *OPMLOutline) Attr(name string) string {
+	for _, attr := range outline.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// SetAttr sets the outline's attribute with the given name; an empty value removes it.
+func (outline *OPMLOutline) SetAttr(name, value string) {
+
+	for i, attr := range outline.Attrs {
+		if attr.Name.Local == name {
+			if value == "" {
+				outline.Attrs = append(outline.Attrs[:i], outline.Attrs[i+1:]...)
+			} else {
+				outline.Attrs[i].Value = value
+			}
+			return
+		}
+	}
+
+	if value != "" {
+		outline.Attrs = append(outline.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	}
+
+}
+
+// Description returns the outline's text, followed by its note (in the "_note" attribute) on the lines after it, if it has one.
+func (outline *OPMLOutline) Description() string {
+	if note := outline.Attr("_note"); note != "" {
+		return outline.Text + "\n" + note
+	}
+	return outline.Text
+}
+
+// SetDescription sets the outline's text to the first line of the description, and its note to the rest.
+func (outline *OPMLOutline) SetDescription(description string) {
+	lines := strings.SplitN(description, "\n", 2)
+	outline.Text = lines[0]
+	if len(lines) > 1 {
+		outline.SetAttr("_note", lines[1])
+	} else {
+		outline.SetAttr("_note", "")
+	}
+}
+
+// Checked returns whether the outline is marked as checked, either by OmniOutliner's "_status" attribute or Workflowy's "_complete".
+func (outline *OPMLOutline) Checked() bool {
+	return outline.Attr("_status") == "checked" || outline.Attr("_complete") == "true"
+}
+
+// Checkable returns whether the outline is a checkbox, checked or not.
+func (outline *OPMLOutline) Checkable() bool {
+	return outline.Attr("_status") != "" || outline.Attr("_complete") != ""
+}
+
+// opmlAttributeProperties are the Card properties CardOutline() writes as attributes of their own (or as the outline's text); every other
+// property is kept in the "_properties" attribute. Sub-Page IDs and saved images only mean something within their project, so they're left out.
+var opmlAttributeProperties = map[string]bool{
+	"description": true, "checked": true, "current": true, "maximum": true, "deadline": true, "filepath": true, "url": true,
+	"subpage": true, "saveimage": true,
+}
+
+// CardOutline returns an outline for the Card (without any nested outlines). The text is the Card's description (with the lines after the
+// first as its note), or its name for Cards without one; checked state, deadlines, and links (for Web Cards) are attributes other outliners
+// understand. MasterPlan's own attributes hold the Card's type, size, and filepath (relative to baseDir, the directory of the OPML file), and
+// every other property (like a Map's drawing or a Timer's settings) as JSON in "_properties", so OPMLOutline.Card() can recreate the Card.
+func CardOutline(card *Card, baseDir string) *OPMLOutline {
+
+	outline := &OPMLOutline{}
+
+	switch card.ContentType {
+
+	case ContentTypeImage, ContentTypeSound:
+		outline.Text = card.Name()
+		fp := card.Properties.String("filepath")
+		if filepath.IsAbs(fp) {
+			if rel, err := filepath.Rel(baseDir, fp); err == nil {
+				fp = rel
+			}
+		}
+		outline.SetAttr("_filepath", filepath.ToSlash(fp))
+
+	case ContentTypeMap, ContentTypeTable:
+		outline.Text = card.Name()
+
+	case ContentTypeWeb:
+		outline.Text = card.Properties.String("url")
+		outline.SetAttr("type", "link")
+		outline.SetAttr("url", outline.Text)
+
+	default:
+		outline.SetDescription(card.Properties.String("description"))
+
+	}
+
+	outline.SetAttr("_cardType", card.ContentType)
+	outline.SetAttr("_size", fmt.Sprintf("%gx%g", card.Rect.W, card.Rect.H))
+
+	switch card.ContentType {
+
+	case ContentTypeCheckbox:
+		if card.Properties.Bool("checked") {
+			outline.SetAttr("_status", "checked")
+		} else {
+			outline.SetAttr("_status", "unchecked")
+		}
+
+	case ContentTypeNumbered:
+		outline.SetAttr("_current", strconv.FormatFloat(card.Properties.Float("current"), 'f', -1, 64))
+		outline.SetAttr("_maximum", strconv.FormatFloat(card.Properties.Float("maximum"), 'f', -1, 64))
+
+	}
+
+	if card.Properties.Has("deadline") {
+		outline.SetAttr("_deadline", card.Properties.String("deadline"))
+	}
+
+	others := card.Properties.Clone()
+	for name := range opmlAttributeProperties {
+		others.Remove(name)
+	}
+
+	if len(others.DefinitionOrder) > 0 {
+		outline.SetAttr("_properties", others.Serialize())
+	}
+
+	return outline
+
+}
+
+// CardType returns the content type of the Card the outline becomes: the type it was exported from, if it was exported from MasterPlan;
+// otherwise, a Checkbox if it has a checked state, or bulletType if it doesn't.
+func (outline *OPMLOutline) CardType(bulletType string) string {
+
+	// Web Cards aren't made from the Create menu, so they aren't among ContentTypes.
+	if cardType := outline.Attr("_cardType"); cardType == ContentTypeWeb {
+		return ContentTypeWeb
+	} else if contentType := ContentTypeNamed(cardType); contentType != "" {
+		return contentType
+	}
+
+	if outline.Checkable() {
+		return ContentTypeCheckbox
+	}
+
+	return bulletType
+
+}
+
+// Card returns a new Card of the given content type made from the outline (but not the outlines nested in it); it's the reverse of
+// CardOutline(). Relative filepaths are resolved against baseDir, the directory of the OPML file.
+func (outline *OPMLOutline) Card(contentType, baseDir string) *Card {
+
+	card := NewCard(-1, contentType)
+
+	if properties := outline.Attr("_properties"); properties != "" {
+		card.Properties.Deserialize(properties)
+	}
+
+	var w, h float32
+	if _, err := fmt.Sscanf(outline.Attr("_size"), "%gx%g", &w, &h); err == nil && w > 0 && h > 0 {
+		card.Rect.W, card.Rect.H = w, h
+	}
+
+	switch contentType {
+
+	case ContentTypeImage, ContentTypeSound:
+		if fp := filepath.FromSlash(outline.Attr("_filepath")); fp != "" {
+			if !filepath.IsAbs(fp) && !strings.Contains(fp, "://") {
+				fp = filepath.Join(baseDir, fp)
+			}
+			card.Properties.Set("filepath", fp)
+		}
+
+	case ContentTypeMap, ContentTypeTable:
+
+	case ContentTypeWeb:
+		if url := outline.Attr("url"); url != "" {
+			card.Properties.Set("url", url)
+		} else {
+			card.Properties.Set("url", outline.Text)
+		}
+
+	default:
+		card.Properties.Set("description", outline.Description())
+
+	}
+
+	switch contentType {
+
+	case ContentTypeCheckbox:
+		card.Properties.Set("checked", outline.Checked())
+
+	case ContentTypeNumbered:
+		if current, err := strconv.ParseFloat(outline.Attr("_current"), 64); err == nil {
+			card.Properties.Set("current", current)
+		}
+		if maximum, err := strconv.ParseFloat(outline.Attr("_maximum"), 64); err == nil {
+			card.Properties.Set("maximum", maximum)
+		}
+
+	}
+
+	if deadline := outline.Attr("_deadline"); deadline != "" {
+		if _, err := time.Parse(DeadlineFormat, deadline); err == nil {
+			card.Properties.Set("deadline", deadline)
+		}
+	}
+
+	return card
+
+}
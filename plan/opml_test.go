@@ -0,0 +1,139 @@
+package plan
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOPMLRoundTrip(t *testing.T) {
+
+	opml := NewOPML("Groceries")
+
+	milk := &OPMLOutline{}
+	milk.SetDescription("Milk\nThe oat kind")
+	milk.SetAttr("_status", "checked")
+	milk.SetAttr("_deadline", "2026-11-01")
+
+	eggs := &OPMLOutline{Text: "Eggs"}
+	eggs.SetAttr("_status", "unchecked")
+	milk.Outlines = append(milk.Outlines, eggs)
+
+	opml.Outlines = append(opml.Outlines, milk)
+
+	data, err := opml.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseOPML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Title != "Groceries" || len(parsed.Outlines) != 1 || len(parsed.Outlines[0].Outlines) != 1 {
+		t.Fatalf("outlines weren't parsed back:\n%s", data)
+	}
+
+	outline := parsed.Outlines[0]
+
+	if outline.Description() != "Milk\nThe oat kind" || !outline.Checked() || outline.Attr("_deadline") != "2026-11-01" {
+		t.Errorf("attributes weren't parsed back: %+v", outline)
+	}
+
+	if child := outline.Outlines[0]; child.Text != "Eggs" || child.Checked() || !child.Checkable() {
+		t.Errorf("child outline wasn't parsed back: %+v", child)
+	}
+
+	workflowy := `<?xml version="1.0"?><opml version="2.0"><body><outline text="Done" _complete="true"/><outline text="Plain"/></body></opml>`
+
+	parsed, err = ParseOPML([]byte(workflowy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !parsed.Outlines[0].Checked() || parsed.Outlines[1].Checkable() {
+		t.Error("Workflowy's completion attribute wasn't read")
+	}
+
+	milk.SetDescription("Milk")
+	if milk.Attr("_note") != "" || strings.Contains(milk.Description(), "\n") {
+		t.Error("note wasn't removed when the description became a single line")
+	}
+
+}
+
+func TestCardOPMLRoundTrip(t *testing.T) {
+
+	baseDir := filepath.Join(string(filepath.Separator), "home", "plans")
+
+	cards := []*Card{}
+
+	add := func(contentType string, properties map[string]interface{}) *Card {
+		card := NewCard(int64(len(cards)), contentType)
+		card.Rect.W, card.Rect.H = 256, 64
+		for name, value := range properties {
+			card.Properties.Set(name, value)
+		}
+		cards = append(cards, card)
+		return card
+	}
+
+	add(ContentTypeMap, map[string]interface{}{"contents": "[[0,1],[1,0]]"})
+	add(ContentTypeTimer, map[string]interface{}{"description": "Tea", "max time": 180.0, "mode group": 1.0, "trigger mode": 2.0})
+	add(ContentTypeLink, map[string]interface{}{"target": 4.0, "target project": "other.plan", "link mode": 1.0})
+	add(ContentTypeImage, map[string]interface{}{"filepath": filepath.Join(baseDir, "images", "cat.png")})
+	add(ContentTypeCheckbox, map[string]interface{}{"description": "Milk\nThe oat kind", "checked": true, "deadline": "2026-11-01"})
+	add(ContentTypeWeb, map[string]interface{}{"url": "https://example.com"})
+
+	opml := NewOPML("Cards")
+	for _, card := range cards {
+		opml.Outlines = append(opml.Outlines, CardOutline(card, baseDir))
+	}
+
+	data, err := opml.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseOPML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed.Outlines) != len(cards) {
+		t.Fatalf("%d outlines were parsed back, not %d:\n%s", len(parsed.Outlines), len(cards), data)
+	}
+
+	if fp := parsed.Outlines[3].Attr("_filepath"); fp != "images/cat.png" {
+		t.Errorf("image filepath was exported as %q, not relative to the OPML file", fp)
+	}
+
+	for i, card := range cards {
+
+		outline := parsed.Outlines[i]
+		contentType := outline.CardType(ContentTypeNote)
+		if contentType != card.ContentType {
+			t.Errorf("%s card came back as a %s card", card.ContentType, contentType)
+			continue
+		}
+
+		read := outline.Card(contentType, baseDir)
+
+		if read.Rect.W != card.Rect.W || read.Rect.H != card.Rect.H {
+			t.Errorf("%s card's size came back as %gx%g", card.ContentType, read.Rect.W, read.Rect.H)
+		}
+
+		for _, name := range card.Properties.DefinitionOrder {
+			if read.Properties.Get(name) != card.Properties.Get(name) {
+				t.Errorf("%s card's %q property came back as %v, not %v", card.ContentType, name, read.Properties.Get(name), card.Properties.Get(name))
+			}
+		}
+
+	}
+
+	if fp := parsed.Outlines[3].Card(ContentTypeImage, filepath.Join(baseDir, "moved")).Properties.String("filepath"); fp != filepath.Join(baseDir, "moved", "images", "cat.png") {
+		t.Errorf("relative filepath was resolved to %q", fp)
+	}
+
+}
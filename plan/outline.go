@@ -0,0 +1,186 @@
+package plan
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of OutlineItems.
+const (
+	OutlineTask    = iota // A Markdown task list item ("- [ ]" or "- [x]")
+	OutlineHeading        // A Markdown heading ("# Heading")
+	OutlineBullet         // A plain list item ("- ", "* ", "+ ", or "1. "), or a line of an indented outline without any markers
+	OutlineText           // A paragraph (or fenced code block) of a Markdown document
+)
+
+// OutlineItem is an item of a Markdown document or indented outline, to be turned into a Card.
+type OutlineItem struct {
+	Kind    int
+	Depth   int // How far the item's nested, in steps; it's never more than one step deeper than the item before it
+	Text    string
+	Checked bool // If a task is checked
+}
+
+var (
+	outlineHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	outlineTask    = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s*(.*)$`)
+	outlineBullet  = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+(.*)$`)
+	outlineFence   = regexp.MustCompile("^(```|~~~)")
+	outlineRule    = regexp.MustCompile(`^([-*_])(\s*[-*_]){2,}$`)
+)
+
+// ParseOutline parses Markdown (task lists, bullet lists, headings, and paragraphs) or a tab- or space-indented outline into items. Items
+// are nested by their indentation, and under the headings before them. If the text has neither Markdown markers nor indentation (and so is
+// just text), ParseOutline returns false.
+func ParseOutline(text string) ([]*OutlineItem, bool) {
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	markdown := false
+	indented := false
+	nonEmpty := 0
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		nonEmpty++
+		if outlineHeading.MatchString(trimmed) || outlineBullet.MatchString(trimmed) || outlineFence.MatchString(trimmed) {
+			markdown = true
+		}
+		if outlineIndent(line) > 0 {
+			indented = true
+		}
+	}
+
+	if !markdown && (!indented || nonEmpty < 2) {
+		return nil, false
+	}
+
+	items := []*OutlineItem{}
+
+	// The minimum heading level is the top one, so a document starting with "##" isn't indented.
+	minLevel := 7
+	for _, line := range lines {
+		if match := outlineHeading.FindStringSubmatch(strings.TrimSpace(line)); match != nil && len(match[1]) < minLevel {
+			minLevel = len(match[1])
+		}
+	}
+
+	baseDepth := 0     // The depth of items under the last heading
+	indents := []int{} // The indentation of each open level of nesting
+	var last *OutlineItem
+	var fence *OutlineItem
+	fenceMarker := ""
+
+	for _, line := range lines {
+
+		trimmed := strings.TrimSpace(line)
+
+		if fence != nil {
+			if strings.HasPrefix(trimmed, fenceMarker) {
+				fence.Text = strings.Trim(fence.Text, "\n")
+				fence = nil
+			} else {
+				fence.Text += "\n" + strings.TrimRight(line, " \t")
+			}
+			continue
+		}
+
+		if trimmed == "" {
+			last = nil
+			continue
+		}
+
+		item := &OutlineItem{Kind: OutlineText, Text: trimmed}
+		nests := false // If items indented further are nested under this one
+
+		if match := outlineHeading.FindStringSubmatch(trimmed); match != nil {
+			item.Kind = OutlineHeading
+			item.Text = match[2]
+		} else if match := outlineTask.FindStringSubmatch(trimmed); match != nil {
+			item.Kind = OutlineTask
+			item.Text = match[2]
+			item.Checked = match[1] != " "
+			nests = true
+		} else if match := outlineBullet.FindStringSubmatch(trimmed); match != nil {
+			item.Kind = OutlineBullet
+			item.Text = match[1]
+			nests = true
+		} else if match := outlineFence.FindStringSubmatch(trimmed); match != nil {
+			item.Text = ""
+			fence = item
+			fenceMarker = match[1]
+		} else if markdown && outlineRule.MatchString(trimmed) {
+			last = nil
+			continue
+		} else if !markdown {
+			item.Kind = OutlineBullet
+			nests = true
+		} else if last != nil {
+			// Lines right after an item or paragraph (rather than after an empty line) continue it, as in Markdown.
+			last.Text += "\n" + trimmed
+			continue
+		}
+
+		if item.Kind == OutlineHeading {
+
+			item.Depth = len(outlineHeading.FindStringSubmatch(trimmed)[1]) - minLevel
+			baseDepth = item.Depth + 1
+			indents = indents[:0]
+
+		} else {
+
+			// Levels that are indented as far or further are closed, so the item goes at the depth of the level it's indented past.
+			indent := outlineIndent(line)
+			for len(indents) > 0 && indents[len(indents)-1] >= indent {
+				indents = indents[:len(indents)-1]
+			}
+			item.Depth = baseDepth + len(indents)
+			if nests {
+				indents = append(indents, indent)
+			}
+
+		}
+
+		items = append(items, item)
+
+		last = nil
+		if item.Kind != OutlineHeading && fence == nil {
+			last = item
+		}
+
+	}
+
+	if fence != nil {
+		fence.Text = strings.Trim(fence.Text, "\n")
+	}
+
+	// Items can only be nested one step deeper than the one before them, as Cards in a stack are.
+	prevDepth := -1
+	for _, item := range items {
+		if item.Depth > prevDepth+1 {
+			item.Depth = prevDepth + 1
+		}
+		prevDepth = item.Depth
+	}
+
+	return items, true
+
+}
+
+// outlineIndent returns how far the line is indented, counting tabs as four spaces.
+func outlineIndent(line string) int {
+	indent := 0
+	for _, r := range line {
+		if r == ' ' {
+			indent++
+		} else if r == '\t' {
+			indent += 4
+		} else {
+			break
+		}
+	}
+	return indent
+}
@@ -0,0 +1,74 @@
+package plan
+
+import "testing"
+
+func TestParseOutline(t *testing.T) {
+
+	markdown := `## Groceries
+
+- [ ] Milk
+- [x] Eggs
+    - [ ] Free-range
+      if they have them
+* Bread
+
+Paragraph
+over two lines
+
+### Later
+1. Fish
+`
+
+	items, ok := ParseOutline(markdown)
+	if !ok {
+		t.Fatal("Markdown wasn't parsed as an outline")
+	}
+
+	expected := []OutlineItem{
+		{Kind: OutlineHeading, Depth: 0, Text: "Groceries"},
+		{Kind: OutlineTask, Depth: 1, Text: "Milk"},
+		{Kind: OutlineTask, Depth: 1, Text: "Eggs", Checked: true},
+		{Kind: OutlineTask, Depth: 2, Text: "Free-range\nif they have them"},
+		{Kind: OutlineBullet, Depth: 1, Text: "Bread"},
+		{Kind: OutlineText, Depth: 1, Text: "Paragraph\nover two lines"},
+		{Kind: OutlineHeading, Depth: 1, Text: "Later"},
+		{Kind: OutlineBullet, Depth: 2, Text: "Fish"},
+	}
+
+	checkOutline(t, items, expected)
+
+	items, ok = ParseOutline("Project\n\tDesign\n\t\tSketches\n\tBuild\nRelease")
+	if !ok {
+		t.Fatal("indented outline wasn't parsed as an outline")
+	}
+
+	checkOutline(t, items, []OutlineItem{
+		{Kind: OutlineBullet, Depth: 0, Text: "Project"},
+		{Kind: OutlineBullet, Depth: 1, Text: "Design"},
+		{Kind: OutlineBullet, Depth: 2, Text: "Sketches"},
+		{Kind: OutlineBullet, Depth: 1, Text: "Build"},
+		{Kind: OutlineBullet, Depth: 0, Text: "Release"},
+	})
+
+	if _, ok := ParseOutline("Just some text,\nover two lines."); ok {
+		t.Error("plain text was parsed as an outline")
+	}
+
+}
+
+func checkOutline(t *testing.T, items []*OutlineItem, expected []OutlineItem) {
+
+	if len(items) != len(expected) {
+		for _, item := range items {
+			t.Logf("%+v", *item)
+		}
+		t.Fatalf("expected %d items, got %d", len(expected), len(items))
+	}
+
+	for i, item := range items {
+		if *item != expected[i] {
+			t.Errorf("item %d: expected %+v, got %+v", i, expected[i], *item)
+		}
+	}
+
+}
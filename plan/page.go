@@ -0,0 +1,138 @@
+package plan
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+type Page struct {
+	ID      uint64
+	Project *Project
+	Pan     Point
+	Zoom    float32
+	Cards   []*Card
+}
+
+func NewPage(id uint64) *Page {
+	return &Page{
+		ID:    id,
+		Zoom:  1,
+		Cards: []*Card{},
+	}
+}
+
+// AddCard creates a new Card of the given content type with a fresh, project-unique ID and adds it to the Page.
+func (page *Page) AddCard(contentType string) *Card {
+	id := int64(0)
+	if page.Project != nil {
+		id = page.Project.NextCardID()
+	}
+	card := NewCard(id, contentType)
+	page.Add(card)
+	return card
+}
+
+// Add adds an existing Card to the Page.
+func (page *Page) Add(card *Card) {
+	card.Page = page
+	page.Cards = append(page.Cards, card)
+}
+
+// Remove removes a Card from the Page, along with any Links to or from it.
+func (page *Page) Remove(card *Card) {
+
+	for i, c := range page.Cards {
+		if c == card {
+			page.Cards = append(page.Cards[:i], page.Cards[i+1:]...)
+			break
+		}
+	}
+
+	for _, c := range page.Cards {
+		links := []*Link{}
+		for _, link := range c.Links {
+			if link.Start != card.ID && link.End != card.ID {
+				links = append(links, link)
+			}
+		}
+		c.Links = links
+	}
+
+	card.Page = nil
+
+}
+
+func (page *Page) CardByID(id int64) *Card {
+	for _, card := range page.Cards {
+		if card.ID == id {
+			return card
+		}
+	}
+	return nil
+}
+
+// SortedCards returns the Page's Cards sorted by their position, top to bottom, then left to right. This is the order in which Cards are saved.
+func (page *Page) SortedCards() []*Card {
+
+	cards := append([]*Card{}, page.Cards...)
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		return cards[i].Rect.Y < cards[j].Rect.Y || (cards[i].Rect.Y == cards[j].Rect.Y && cards[i].Rect.X < cards[j].Rect.X)
+	})
+
+	return cards
+
+}
+
+// Links returns all Links that start from Cards on this Page.
+func (page *Page) Links() []*Link {
+	links := []*Link{}
+	for _, card := range page.Cards {
+		links = append(links, card.Links...)
+	}
+	return links
+}
+
+func (page *Page) Serialize() string {
+
+	pageData := "{}"
+
+	pageData, _ = sjson.Set(pageData, "id", page.ID)
+	pageData, _ = sjson.Set(pageData, "pan", page.Pan)
+	pageData, _ = sjson.Set(pageData, "zoom", page.Zoom)
+
+	// Sort the cards by their position so the serialization is more stable. (Otherwise, clicking on
+	// a Card adjusts the sort order, and therefore the order in which Cards are serialized.)
+	for _, card := range page.SortedCards() {
+		pageData, _ = sjson.SetRaw(pageData, "cards.-1", card.Serialize())
+	}
+
+	return pageData
+
+}
+
+// ParsePage parses a serialized Page. If the data has no "id" field, the given default ID is used instead.
+func ParsePage(data string, defaultID uint64) *Page {
+
+	page := NewPage(defaultID)
+
+	if id := gjson.Get(data, "id"); id.Exists() {
+		page.ID = id.Uint()
+	}
+
+	page.Pan.X = float32(gjson.Get(data, "pan.X").Float())
+	page.Pan.Y = float32(gjson.Get(data, "pan.Y").Float())
+	page.Zoom = float32(gjson.Get(data, "zoom").Float())
+	if page.Zoom == 0 {
+		page.Zoom = 1
+	}
+
+	for _, cardData := range gjson.Get(data, "cards").Array() {
+		page.Add(ParseCard(cardData.Raw))
+	}
+
+	return page
+
+}
@@ -0,0 +1,117 @@
+// Package plan contains MasterPlan's persisted project model - projects, pages, cards, their properties, and the links between them.
+// It can load, edit, and save .plan files without a window, renderer, or any other part of the GUI, so it can be used from scripts and tools.
+package plan
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	ContentTypeCheckbox = "Checkbox"
+	ContentTypeNumbered = "Number"
+	ContentTypeNote     = "Note"
+	ContentTypeSound    = "Sound"
+	ContentTypeImage    = "Image"
+	ContentTypeTimer    = "Timer"
+	ContentTypeMap      = "Map"
+	ContentTypeSubpage  = "Sub-Page"
+	ContentTypeLink     = "Link"
+	ContentTypeTable    = "Table"
+	ContentTypeWeb      = "web"
+)
+
+// ContentTypes lists the content types of Cards that can be created from the Create menu, in its order.
+var ContentTypes = []string{ContentTypeCheckbox, ContentTypeNumbered, ContentTypeNote, ContentTypeSound, ContentTypeImage, ContentTypeTimer, ContentTypeMap, ContentTypeSubpage, ContentTypeLink, ContentTypeTable}
+
+// ContentTypeNamed returns the content type with the given name, ignoring case (so "checkbox" returns ContentTypeCheckbox), or an empty
+// string if there's none.
+func ContentTypeNamed(name string) string {
+	for _, contentType := range ContentTypes {
+		if strings.EqualFold(contentType, name) {
+			return contentType
+		}
+	}
+	return ""
+}
+
+const (
+	CollapsedNone  = "CollapsedNone"
+	CollapsedShade = "CollapsedShade"
+)
+
+// Timer modes, as stored in a Timer Card's "mode group" property.
+const (
+	TimerModeStopwatch = iota
+	TimerModeCountdown
+)
+
+// Trigger types, as stored in a Timer Card's "trigger mode" property; they're what a Timer does to the Cards it's linked to when it goes off.
+const (
+	TriggerTypeSet = iota
+	TriggerTypeToggle
+	TriggerTypeClear
+)
+
+// Version is the current version of MasterPlan, which is written into every saved project.
+const Version = "0.8.0-alpha.8.1"
+
+// GridSize is the size of a grid cell in world units; Cards are sized and positioned in multiples of it.
+const GridSize = 32
+
+// DeadlineFormat is the format used to store the "deadline" property of a Card.
+const DeadlineFormat = "2006-01-02"
+
+var (
+	// ErrNotAProject is returned when the data given doesn't appear to be a MasterPlan project at all.
+	ErrNotAProject = errors.New("data doesn't appear to be a valid MasterPlan project")
+)
+
+type Point struct {
+	X, Y float32
+}
+
+type Rect struct {
+	X, Y, W, H float32
+}
+
+// Contains returns if the given point lies within the Rect.
+func (rect Rect) Contains(x, y float32) bool {
+	return x >= rect.X && x < rect.X+rect.W && y >= rect.Y && y < rect.Y+rect.H
+}
+
+// DefaultCardSize returns the size a freshly created Card of the given content type has in MasterPlan.
+func DefaultCardSize(contentType string) Point {
+
+	gs := float32(GridSize)
+
+	switch contentType {
+	case ContentTypeNumbered:
+		return Point{gs * 8, gs * 2}
+	case ContentTypeNote:
+		return Point{gs * 8, gs * 1}
+	case ContentTypeSound:
+		return Point{gs * 10, gs * 4}
+	case ContentTypeImage:
+		return Point{gs * 4, gs * 4}
+	case ContentTypeTimer:
+		return Point{gs * 8, gs * 6}
+	case ContentTypeMap:
+		return Point{gs * 8, gs * 8}
+	case ContentTypeSubpage:
+		return Point{gs * 9, gs * 10}
+	case ContentTypeLink:
+		return Point{gs * 13, gs * 3}
+	case ContentTypeTable:
+		return Point{gs * 4, gs * 4}
+	}
+
+	return Point{gs * 9, gs}
+
+}
+
+// escapePath escapes a key so it can be used as a single element of a gjson / sjson path.
+func escapePath(key string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`, ":", `\:`)
+	return replacer.Replace(key)
+}
@@ -0,0 +1,373 @@
+package plan
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ProjectCacheDirectory is the name of the per-project property that points to the directory downloaded resources are cached in.
+const ProjectCacheDirectory = "CacheDirectory"
+
+// ProjectIdentifier is the name of the per-project property holding a random ID that identifies the project, wherever its file is moved.
+const ProjectIdentifier = "Identifier"
+
+type Project struct {
+	Version     string
+	Schema      int      // Schema version the Project was loaded from; see Migrate()
+	Migrations  []string // Descriptions of the Migrations run when loading the Project, in order
+	Pan         Point
+	Zoom        float32
+	CurrentPage int64 // ID of the Page that was open when the Project was saved; -1 if unknown
+	Properties  *Properties
+	Pages       []*Page
+	SavedImages map[string][]byte // Images pasted into the Project, keyed by the filepath their Image Cards point to
+	Passphrase  string            // If set, the Project is encrypted with it when saved; see Encrypt(). It's never saved itself.
+	Keys        *Keys             // The keys derived from Passphrase, kept so they needn't be derived again; copies of the Project share them
+}
+
+// NewProject creates a new, empty Project with only a root Page.
+func NewProject() *Project {
+	project := &Project{
+		Version:     Version,
+		Schema:      SchemaVersion,
+		Zoom:        1,
+		CurrentPage: -1,
+		Properties:  NewProperties(),
+		Pages:       []*Page{},
+		SavedImages: map[string][]byte{},
+	}
+	project.AddPage()
+	return project
+}
+
+// NewProjectIdentifier returns a new random ID for a project; see ProjectIdentifier.
+func NewProjectIdentifier() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Identifier returns the Project's ID (see ProjectIdentifier), giving it a new one if it doesn't have one yet.
+func (project *Project) Identifier() string {
+	if project.Properties.String(ProjectIdentifier) == "" {
+		project.Properties.Set(ProjectIdentifier, NewProjectIdentifier())
+	}
+	return project.Properties.String(ProjectIdentifier)
+}
+
+// Root returns the root Page of the Project.
+func (project *Project) Root() *Page {
+	if len(project.Pages) == 0 {
+		return nil
+	}
+	return project.Pages[0]
+}
+
+// AddPage adds a new, empty Page to the Project with an ID one higher than the highest existing one.
+func (project *Project) AddPage() *Page {
+
+	id := uint64(0)
+	for _, page := range project.Pages {
+		if page.ID >= id {
+			id = page.ID + 1
+		}
+	}
+
+	page := NewPage(id)
+	page.Project = project
+	project.Pages = append(project.Pages, page)
+	return page
+
+}
+
+func (project *Project) PageByID(id uint64) *Page {
+	for _, page := range project.Pages {
+		if page.ID == id {
+			return page
+		}
+	}
+	return nil
+}
+
+// FindCard returns the Card with the given ID; Card IDs are unique throughout a Project.
+func (project *Project) FindCard(id int64) *Card {
+	for _, page := range project.Pages {
+		if card := page.CardByID(id); card != nil {
+			return card
+		}
+	}
+	return nil
+}
+
+// NextCardID returns an ID that isn't used by any Card in the Project.
+func (project *Project) NextCardID() int64 {
+	id := int64(0)
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			if card.ID >= id {
+				id = card.ID + 1
+			}
+		}
+	}
+	return id
+}
+
+// SubpageCard returns the Sub-Page Card that points to the given Page, or nil if there is none (i.e. for the root Page, or an orphaned Page).
+func (project *Project) SubpageCard(page *Page) *Card {
+	for _, p := range project.Pages {
+		for _, card := range p.Cards {
+			if card.ContentType == ContentTypeSubpage && card.Properties.Has("subpage") && uint64(card.Properties.Float("subpage")) == page.ID {
+				return card
+			}
+		}
+	}
+	return nil
+}
+
+// Subpage returns the Page a Sub-Page Card points to, or nil if it doesn't point to an existing Page.
+func (project *Project) Subpage(card *Card) *Page {
+	if card.ContentType != ContentTypeSubpage || !card.Properties.Has("subpage") {
+		return nil
+	}
+	return project.PageByID(uint64(card.Properties.Float("subpage")))
+}
+
+// PageName returns the name of the Page, which is the description of the Sub-Page Card pointing to it, or "Root" for the root Page.
+func (project *Project) PageName(page *Page) string {
+	if sp := project.SubpageCard(page); sp != nil {
+		return sp.Properties.String("description")
+	}
+	return "Root"
+}
+
+func (project *Project) Serialize() string {
+
+	saveData, _ := sjson.Set("{}", "version", project.Version)
+	saveData, _ = sjson.Set(saveData, "schema", SchemaVersion)
+
+	saveData, _ = sjson.Set(saveData, "pan", project.Pan)
+	saveData, _ = sjson.Set(saveData, "zoom", project.Zoom)
+	if project.CurrentPage >= 0 {
+		saveData, _ = sjson.Set(saveData, "currentPage", project.CurrentPage)
+	}
+
+	saveData, _ = sjson.SetRaw(saveData, "properties", project.Properties.Serialize())
+
+	pages := append([]*Page{}, project.Pages...)
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].ID < pages[j].ID })
+
+	pageData := "["
+	for i, page := range pages {
+		pageData += page.Serialize()
+		if i < len(pages)-1 {
+			pageData += ", "
+		}
+	}
+	pageData += "]"
+
+	saveData, _ = sjson.SetRaw(saveData, "pages", pageData)
+
+	savedImages := map[string]string{}
+
+	for fp, imgData := range project.SavedImages {
+
+		out := strings.Builder{}
+		for _, b := range imgData {
+			out.WriteRune(rune(b))
+		}
+
+		savedImages[fp] = out.String()
+
+	}
+
+	saveData, _ = sjson.Set(saveData, "savedimages", savedImages)
+
+	return gjson.Get(saveData, "@pretty").String()
+
+}
+
+// Parse parses a serialized MasterPlan project, migrating it to the current schema version first (see Migrate()). ErrNotAProject is
+// returned if the data isn't a project, and ErrEncrypted if it needs to be decrypted first (see ReadProjectFile()).
+func Parse(data []byte) (*Project, error) {
+
+	if IsEncrypted(data) {
+		return nil, ErrEncrypted
+	}
+
+	schema, err := DetectSchema(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	migrated, applied, err := Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	json := string(migrated)
+
+	project := &Project{
+		Version:     gjson.Get(json, "version").String(),
+		Schema:      schema,
+		Migrations:  applied,
+		CurrentPage: -1,
+		Properties:  NewProperties(),
+		Pages:       []*Page{},
+		SavedImages: map[string][]byte{},
+	}
+
+	project.Pan.X = float32(gjson.Get(json, "pan.X").Float())
+	project.Pan.Y = float32(gjson.Get(json, "pan.Y").Float())
+	project.Zoom = float32(gjson.Get(json, "zoom").Float())
+	if project.Zoom == 0 {
+		project.Zoom = 1
+	}
+
+	if currentPage := gjson.Get(json, "currentPage"); currentPage.Exists() {
+		project.CurrentPage = currentPage.Int()
+	}
+
+	if props := gjson.Get(json, "properties"); props.Exists() {
+		project.Properties.Deserialize(props.Raw)
+	}
+
+	for fpName, imgData := range gjson.Get(json, "savedimages").Map() {
+
+		imgOut := []byte{}
+
+		for _, c := range imgData.String() {
+			imgOut = append(imgOut, byte(c))
+		}
+
+		project.SavedImages[fpName] = imgOut
+
+	}
+
+	for i, pageData := range gjson.Get(json, "pages").Array() {
+		project.addParsedPage(ParsePage(pageData.Raw, uint64(i)))
+	}
+
+	if len(project.Pages) == 0 {
+		project.AddPage()
+	}
+
+	return project, nil
+
+}
+
+func (project *Project) addParsedPage(page *Page) {
+	page.Project = project
+	project.Pages = append(project.Pages, page)
+}
+
+// Load loads the MasterPlan project at the given filepath.
+func Load(filepath string) (*Project, error) {
+
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+
+}
+
+// Save writes the Project to the given filepath, encrypted if it has a Passphrase. The file is written safely - see WriteFileVerified().
+func (project *Project) Save(filepath string) error {
+
+	data, err := project.encode([]byte(project.Serialize()))
+	if err != nil {
+		return err
+	}
+
+	return WriteFileVerified(filepath, data, func(data []byte) error {
+		decoded, err := project.decode(data)
+		if err == nil {
+			_, err = Parse(decoded)
+		}
+		return err
+	})
+
+}
+
+// WriteFileVerified writes data to the given filepath without ever leaving a partially written file in its place. The data is written to a
+// temporary file in the same directory and synced to disk; the temporary file is then read back and checked using verify (if it isn't nil)
+// before being renamed over the target. If anything fails, the target is left untouched and the temporary file is removed.
+func WriteFileVerified(filePath string, data []byte, verify func(data []byte) error) (err error) {
+
+	dir, base := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+
+	temp, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	if _, err = temp.Write(data); err != nil {
+		return err
+	}
+
+	if err = temp.Sync(); err != nil {
+		return err
+	}
+
+	if err = temp.Close(); err != nil {
+		return err
+	}
+
+	written, err := os.ReadFile(temp.Name())
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(written, data) {
+		return fmt.Errorf("verifying %s failed: the written data doesn't match", filePath)
+	}
+
+	if verify != nil {
+		if err = verify(written); err != nil {
+			return fmt.Errorf("verifying %s failed: %w", filePath, err)
+		}
+	}
+
+	// os.CreateTemp() creates files that only the owner can read; the file keeps the permissions it had, or gets the usual ones if it's new.
+	mode := os.FileMode(0644)
+	if info, statErr := os.Stat(filePath); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err = os.Chmod(temp.Name(), mode); err != nil {
+		return err
+	}
+
+	if err = os.Rename(temp.Name(), filePath); err != nil {
+		return err
+	}
+
+	// Sync the directory as well so the rename itself survives a crash; this isn't possible on every OS, so errors are ignored.
+	if d, dirErr := os.Open(dir); dirErr == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+
+}
@@ -0,0 +1,218 @@
+package plan
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProjectRoundTrip(t *testing.T) {
+
+	project := NewProject()
+	project.Pan = Point{120, -48}
+	project.Zoom = 1.5
+	project.CurrentPage = 1
+	project.Properties.Set(ProjectCacheDirectory, "cache")
+	project.SavedImages["/tmp/pasted.png"] = []byte{0, 1, 127, 128, 255}
+
+	root := project.Root()
+
+	task := root.AddCard(ContentTypeCheckbox)
+	task.Rect = Rect{32, 64, 256, 32}
+	task.CustomColor = "FF8000FF"
+	task.Properties.Set("description", "Write the tests")
+	task.Properties.Set("checked", true)
+
+	progress := root.AddCard(ContentTypeNumbered)
+	progress.Rect = Rect{32, 128, 256, 32}
+	progress.Collapsed = CollapsedShade
+	progress.UncollapsedSize = Point{256, 96}
+	progress.FontColor = "102030FF"
+	progress.Properties.Set("current", 3.0)
+	progress.Properties.Set("maximum", 7.0)
+
+	link := task.LinkTo(progress)
+	link.Joints = []Point{{300, 80}, {300, 144}}
+
+	table := root.AddCard(ContentTypeTable)
+	td := NewTableData(3, 2)
+	td.RowHeadings = []string{"Mon", "Tue"}
+	td.ColumnHeadings = []string{"A", "B", "C"}
+	td.ValueDisplayMode = ValueDisplayModeLetter
+	td.SetValue(2, 1, 5)
+	table.SetTableData(td)
+
+	drawing := root.AddCard(ContentTypeMap)
+	drawing.SetMapData(&MapData{Data: [][]int{{0, 1}, {2, 3}}})
+
+	subpage := project.AddPage()
+	subpage.Pan = Point{-16, 16}
+	subpage.Zoom = 0.5
+
+	subpageCard := root.AddCard(ContentTypeSubpage)
+	subpageCard.Properties.Set("description", "Details")
+	subpageCard.Properties.Set("subpage", float64(subpage.ID))
+
+	note := subpage.AddCard(ContentTypeNote)
+	note.Properties.Set("description", "Inside the sub-page")
+
+	filename := filepath.Join(t.TempDir(), "project.plan")
+
+	if err := project.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Serialize() != project.Serialize() {
+		t.Errorf("project changed when saved and loaded:\n%s\n\nvs.\n\n%s", loaded.Serialize(), project.Serialize())
+	}
+
+	if loaded.Pan != project.Pan || loaded.Zoom != project.Zoom || loaded.CurrentPage != project.CurrentPage || loaded.Schema != SchemaVersion {
+		t.Errorf("project view came back as pan %v, zoom %g, current page %d, schema %d", loaded.Pan, loaded.Zoom, loaded.CurrentPage, loaded.Schema)
+	}
+
+	if !bytes.Equal(loaded.SavedImages["/tmp/pasted.png"], project.SavedImages["/tmp/pasted.png"]) {
+		t.Errorf("saved image came back as %v", loaded.SavedImages["/tmp/pasted.png"])
+	}
+
+	if len(loaded.Pages) != 2 || loaded.Subpage(loaded.FindCard(subpageCard.ID)) == nil {
+		t.Fatalf("sub-page wasn't loaded; %d pages", len(loaded.Pages))
+	}
+
+	if page := loaded.Subpage(loaded.FindCard(subpageCard.ID)); page.Pan != subpage.Pan || page.Zoom != subpage.Zoom || page.CardByID(note.ID) == nil {
+		t.Errorf("sub-page came back as pan %v, zoom %g with %d cards", page.Pan, page.Zoom, len(page.Cards))
+	}
+
+	for _, card := range []*Card{task, progress, table, drawing, subpageCard, note} {
+
+		read := loaded.FindCard(card.ID)
+		if read == nil {
+			t.Errorf("%s card %d is missing", card.ContentType, card.ID)
+			continue
+		}
+
+		if read.Rect != card.Rect || read.Collapsed != card.Collapsed || read.UncollapsedSize != card.UncollapsedSize ||
+			read.ContentType != card.ContentType || read.CustomColor != card.CustomColor || read.FontColor != card.FontColor {
+			t.Errorf("%s card came back as %+v, not %+v", card.ContentType, read, card)
+		}
+
+		for _, name := range card.Properties.DefinitionOrder {
+			if !reflect.DeepEqual(read.Properties.Get(name), card.Properties.Get(name)) {
+				t.Errorf("%s card's %q property came back as %v, not %v", card.ContentType, name, read.Properties.Get(name), card.Properties.Get(name))
+			}
+		}
+
+	}
+
+	if links := loaded.FindCard(task.ID).Links; len(links) != 1 || !reflect.DeepEqual(*links[0], *link) {
+		t.Errorf("link came back as %+v", links)
+	}
+
+	if read := loaded.FindCard(table.ID).TableData(); !reflect.DeepEqual(read, td) {
+		t.Errorf("table came back as %+v, not %+v", read, td)
+	}
+
+	if read := loaded.FindCard(drawing.ID).MapData(); !reflect.DeepEqual(read.Data, [][]int{{0, 1}, {2, 3}}) {
+		t.Errorf("map came back as %v", read.Data)
+	}
+
+}
+
+func TestCardRoundTrip(t *testing.T) {
+
+	card := NewCard(12, ContentTypeTimer)
+	card.Rect = Rect{-64, 96, 192, 64}
+	card.Properties.Set("description", "Tea")
+	card.Properties.Set("max time", 180.0)
+	card.Links = []*Link{{Start: 12, End: 3, Joints: []Point{{0, 0}}}}
+
+	read := ParseCard(card.Serialize())
+
+	if read.ID != card.ID || read.Rect != card.Rect || read.ContentType != card.ContentType || read.Collapsed != CollapsedNone {
+		t.Errorf("card came back as %+v, not %+v", read, card)
+	}
+
+	if read.Properties.String("description") != "Tea" || read.Properties.Float("max time") != 180 {
+		t.Errorf("properties came back as %s", read.Properties.Serialize())
+	}
+
+	if len(read.Links) != 1 || !reflect.DeepEqual(*read.Links[0], *card.Links[0]) {
+		t.Errorf("links came back as %+v", read.Links)
+	}
+
+	if pasted := ParseCard(`{"rect": {"X": 0, "Y": 0, "W": 32, "H": 32}, "contents": "Note"}`); pasted.ID != -1 {
+		t.Errorf("card without an ID was parsed with ID %d", pasted.ID)
+	}
+
+}
+
+func TestWriteFileVerified(t *testing.T) {
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "project.plan")
+
+	verified := []byte{}
+	if err := WriteFileVerified(filename, []byte("new"), func(data []byte) error {
+		verified = data
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(filename); string(data) != "new" || string(verified) != "new" {
+		t.Errorf("wrote %q after verifying %q", data, verified)
+	}
+
+	if info, err := os.Stat(filename); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("new file has mode %v, not 0644", info.Mode().Perm())
+	}
+
+	if err := os.Chmod(filename, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileVerified(filename, []byte("private"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(filename); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("rewritten file has mode %v, not the 0600 it had", info.Mode().Perm())
+	}
+
+	if err := WriteFileVerified(filename, []byte("new"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("corrupt")
+	if err := WriteFileVerified(filename, []byte("bad"), func(data []byte) error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("failed verification returned %v", err)
+	}
+
+	if data, _ := os.ReadFile(filename); string(data) != "new" {
+		t.Errorf("failed verification left %q in the file", data)
+	}
+
+	if err := WriteFileVerified(filepath.Join(dir, "missing", "project.plan"), []byte("new"), nil); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("temporary files were left behind: %v", names)
+	}
+
+}
@@ -0,0 +1,182 @@
+package plan
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Properties is an ordered set of named JSON values, as stored in the "properties" object of a Card or Project.
+// Values are stored as they're decoded from JSON - float64 for numbers, string, bool, map[string]interface{}, and []interface{}.
+type Properties struct {
+	Values          map[string]interface{}
+	DefinitionOrder []string
+}
+
+func NewProperties() *Properties {
+	return &Properties{
+		Values:          map[string]interface{}{},
+		DefinitionOrder: []string{},
+	}
+}
+
+func (properties *Properties) Has(name string) bool {
+	_, exists := properties.Values[name]
+	return exists
+}
+
+// Get returns the raw value of the named property, or nil if it doesn't exist.
+func (properties *Properties) Get(name string) interface{} {
+	return properties.Values[name]
+}
+
+func (properties *Properties) String(name string) string {
+	if value, ok := properties.Values[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func (properties *Properties) Float(name string) float64 {
+	if value, ok := properties.Values[name].(float64); ok {
+		return value
+	}
+	return 0
+}
+
+func (properties *Properties) Bool(name string) bool {
+	if value, ok := properties.Values[name].(bool); ok {
+		return value
+	}
+	return false
+}
+
+// Set sets the named property to the given value, adding it to the end of the definition order if it didn't exist before.
+// Integers are stored as float64s, as JSON only has one number type.
+func (properties *Properties) Set(name string, value interface{}) {
+
+	switch v := value.(type) {
+	case int:
+		value = float64(v)
+	case int64:
+		value = float64(v)
+	case uint64:
+		value = float64(v)
+	case float32:
+		value = float64(v)
+	}
+
+	if !properties.Has(name) {
+		properties.DefinitionOrder = append(properties.DefinitionOrder, name)
+	}
+
+	properties.Values[name] = value
+
+}
+
+func (properties *Properties) Remove(name string) {
+
+	delete(properties.Values, name)
+
+	for i, p := range properties.DefinitionOrder {
+		if p == name {
+			properties.DefinitionOrder = append(properties.DefinitionOrder[:i], properties.DefinitionOrder[i+1:]...)
+			break
+		}
+	}
+
+}
+
+func (properties *Properties) Clone() *Properties {
+	clone := NewProperties()
+	clone.Deserialize(properties.Serialize())
+	return clone
+}
+
+func (properties *Properties) Serialize() string {
+
+	data := "{}"
+
+	for _, name := range properties.DefinitionOrder {
+		data, _ = sjson.Set(data, escapePath(name), properties.Values[name])
+	}
+
+	return data
+
+}
+
+func (properties *Properties) Deserialize(data string) {
+
+	gjson.Parse(data).ForEach(func(key, value gjson.Result) bool {
+		properties.Set(key.String(), value.Value())
+		return true
+	})
+
+}
+
+// cardPropertyTypes are the types MasterPlan reads the Card properties it knows about as, whichever kind of Card they're on. Setting one to
+// a value of another type would make it fail to read it.
+var cardPropertyTypes = map[string]string{
+	"description":      "string",
+	"deadline":         "string",
+	"calendar uid":     "string",
+	"checked":          "boolean",
+	"current":          "number",
+	"maximum":          "number",
+	"hideMax":          "boolean",
+	"filepath":         "string",
+	"saveimage":        "boolean",
+	"max time":         "string",
+	"mode group":       "number",
+	"trigger mode":     "number",
+	"contents":         "string",
+	"subpage":          "number",
+	"link mode":        "number",
+	"target":           "number",
+	"target project":   "string",
+	"run":              "string",
+	"args":             "string",
+	"url":              "string",
+	"size":             "string",
+	"aspect ratio":     "string",
+	"update framerate": "string",
+	"update only when": "string",
+}
+
+// propertyType returns the type of a property value as it's named in cardPropertyTypes, or an empty string if it isn't a string, number,
+// or boolean.
+func propertyType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return ""
+}
+
+// CheckPropertyValue returns an error if the value can't be set as the named Card property - if it isn't a string, number, or boolean, or
+// isn't the type MasterPlan reads the property as. Properties MasterPlan doesn't know about can be any of those types, but have to keep the
+// type of their existing value, if it's not nil.
+func CheckPropertyValue(name string, value, existing interface{}) error {
+
+	valueType := propertyType(value)
+	if valueType == "" {
+		return fmt.Errorf("property %s should be a string, number, or boolean", name)
+	}
+
+	expected, known := cardPropertyTypes[name]
+	if !known && existing != nil {
+		expected = propertyType(existing)
+	}
+
+	if expected != "" && valueType != expected {
+		return fmt.Errorf("property %s should be a %s, not a %s", name, expected, valueType)
+	}
+
+	return nil
+
+}
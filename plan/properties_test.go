@@ -0,0 +1,30 @@
+package plan
+
+import "testing"
+
+func TestCheckPropertyValue(t *testing.T) {
+
+	for _, test := range []struct {
+		name            string
+		value, existing interface{}
+		ok              bool
+	}{
+		{"checked", true, nil, true},
+		{"checked", "yes", nil, false},
+		{"checked", "yes", true, false},
+		{"description", 5.0, nil, false},
+		{"description", "Ship it", "", true},
+		{"target", 12.0, nil, true},
+		{"target", "12", nil, false},
+		{"custom", "anything", nil, true},
+		{"custom", 3.0, "text", false},
+		{"custom", 3.0, 2.0, true},
+		{"custom", []interface{}{}, nil, false},
+		{"description", nil, nil, false},
+	} {
+		if err := CheckPropertyValue(test.name, test.value, test.existing); (err == nil) != test.ok {
+			t.Errorf("setting %s to %#v (from %#v): expected ok = %t, got error %v", test.name, test.value, test.existing, test.ok, err)
+		}
+	}
+
+}
@@ -0,0 +1,223 @@
+package plan
+
+import (
+	"sort"
+	"strconv"
+)
+
+// CardBelow returns the Card stacked directly below the given one on its Page - one that a Card's shape, moved down by a grid space, would
+// overlap - or nil if there is none. If there are several, the top-most one is returned.
+func (page *Page) CardBelow(card *Card) *Card {
+
+	var below *Card
+
+	shape := card.Rect
+	shape.Y += GridSize
+
+	for _, other := range page.Cards {
+
+		if other == card || other.Rect.Y <= card.Rect.Y {
+			continue
+		}
+
+		overlaps := shape.X < other.Rect.X+other.Rect.W && other.Rect.X < shape.X+shape.W && shape.Y < other.Rect.Y+other.Rect.H && other.Rect.Y < shape.Y+shape.H
+
+		if overlaps && (below == nil || other.Rect.Y < below.Rect.Y) {
+			below = other
+		}
+
+	}
+
+	return below
+
+}
+
+// CardAbove returns the Card stacked directly above the given one on its Page, or nil if there is none; it's the reverse of CardBelow(). If
+// there are several, the bottom-most one is returned.
+func (page *Page) CardAbove(card *Card) *Card {
+
+	var above *Card
+
+	shape := card.Rect
+	shape.Y -= GridSize
+
+	for _, other := range page.Cards {
+
+		if other == card || other.Rect.Y >= card.Rect.Y {
+			continue
+		}
+
+		overlaps := shape.X < other.Rect.X+other.Rect.W && other.Rect.X < shape.X+shape.W && shape.Y < other.Rect.Y+other.Rect.H && other.Rect.Y < shape.Y+shape.H
+
+		if overlaps && (above == nil || other.Rect.Y > above.Rect.Y) {
+			above = other
+		}
+
+	}
+
+	return above
+
+}
+
+// stackHead returns the Cards stacked above the given one, starting with the top of the stack.
+func (page *Page) stackHead(card *Card) []*Card {
+
+	head := []*Card{}
+	visited := map[*Card]bool{card: true}
+
+	for above := page.CardAbove(card); above != nil && !visited[above]; above = page.CardAbove(above) {
+		visited[above] = true
+		head = append(head, above)
+	}
+
+	sort.Slice(head, func(i, j int) bool { return head[i].Rect.Y < head[j].Rect.Y })
+
+	return head
+
+}
+
+// StackNumber returns the number a numberable Card is shown with in its stack, like [1, 2] for the second Card indented under the first,
+// numbered as MasterPlan numbers them (where each grid space of indentation is another level). It returns nil for Cards that aren't
+// numberable or aren't stacked with any other Card.
+func (page *Page) StackNumber(card *Card) []int {
+
+	if !card.Numberable() || (page.CardAbove(card) == nil && page.CardBelow(card) == nil) {
+		return nil
+	}
+
+	cards := append(page.stackHead(card), card)
+
+	// Numbering starts from the numberable Card closest above this one.
+	var topNumberable *Card
+	for i := len(cards) - 1; i >= 0; i-- {
+		if cards[i].Numberable() {
+			topNumberable = cards[i]
+			if cards[i] != card {
+				break
+			}
+		}
+	}
+
+	numbers := []int{0}
+	indentation := topNumberable.Rect.X
+
+	for _, c := range cards {
+
+		if !c.Numberable() {
+			continue
+		}
+
+		if diff := int(c.Rect.X - indentation); diff > 0 {
+			for i := 0; i < diff; i += GridSize {
+				numbers = append(numbers, 0)
+			}
+			indentation = c.Rect.X
+		} else if diff < 0 {
+			for i := 0; i > diff; i -= GridSize {
+				if len(numbers) > 1 {
+					numbers = numbers[:len(numbers)-1]
+				}
+			}
+			indentation = c.Rect.X
+		}
+
+		numbers[len(numbers)-1]++
+
+	}
+
+	return numbers
+
+}
+
+// StackChildren returns the numberable Cards below the given one in its stack that are numbered under it (see StackNumber()).
+func (page *Page) StackChildren(card *Card) []*Card {
+
+	number := page.StackNumber(card)
+	if number == nil {
+		return []*Card{}
+	}
+
+	children := []*Card{}
+	visited := map[*Card]bool{card: true}
+
+	for below := page.CardBelow(card); below != nil && !visited[below]; below = page.CardBelow(below) {
+
+		visited[below] = true
+
+		if other := page.StackNumber(below); len(other) > len(number) {
+			parent := true
+			for i := range number {
+				parent = parent && other[i] == number[i]
+			}
+			if parent {
+				children = append(children, below)
+			}
+		}
+
+	}
+
+	return children
+
+}
+
+// StackBottom returns the Card at the bottom of the stack the given Card is in (which is the Card itself if nothing is stacked below it).
+func (page *Page) StackBottom(card *Card) *Card {
+
+	visited := map[*Card]bool{card: true}
+
+	for below := page.CardBelow(card); below != nil && !visited[below]; below = page.CardBelow(card) {
+		visited[below] = true
+		card = below
+	}
+
+	return card
+
+}
+
+// AddCardToStack adds a new Card of the given content type to the Page, placing it at the bottom of the stack the given Card is in, lined up
+// with that Card. If no Card is given, the new Card is placed by itself below all of the Page's Cards.
+func (page *Page) AddCardToStack(contentType string, under *Card) *Card {
+
+	card := page.AddCard(contentType)
+
+	if under != nil {
+
+		bottom := page.StackBottom(under)
+		card.Rect.X = under.Rect.X
+		card.Rect.Y = bottom.Rect.Y + bottom.Rect.H
+
+	} else if len(page.Cards) > 1 {
+
+		lowest := page.Cards[0]
+		for _, other := range page.Cards[:len(page.Cards)-1] {
+			if other.Rect.Y+other.Rect.H > lowest.Rect.Y+lowest.Rect.H {
+				lowest = other
+			}
+		}
+
+		// A grid space is left between them, so the new Card isn't stacked with the lowest one.
+		card.Rect.X = lowest.Rect.X
+		card.Rect.Y = lowest.Rect.Y + lowest.Rect.H + GridSize
+
+	}
+
+	return card
+
+}
+
+// FindPage returns the Page with the given name (see PageName()) or ID, or nil if there's none.
+func (project *Project) FindPage(nameOrID string) *Page {
+
+	for _, page := range project.Pages {
+		if project.PageName(page) == nameOrID {
+			return page
+		}
+	}
+
+	if id, err := strconv.ParseUint(nameOrID, 10, 64); err == nil {
+		return project.PageByID(id)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddCardToStack(t *testing.T) {
+
+	project := NewProject()
+	page := project.Root()
+
+	top := page.AddCard(ContentTypeCheckbox)
+
+	middle := page.AddCard(ContentTypeCheckbox)
+	middle.Rect.X = top.Rect.X + GridSize
+	middle.Rect.Y = top.Rect.Y + top.Rect.H
+
+	bottom := page.AddCard(ContentTypeCheckbox)
+	bottom.Rect.Y = middle.Rect.Y + middle.Rect.H
+
+	apart := page.AddCard(ContentTypeNote)
+	apart.Rect.Y = bottom.Rect.Y + bottom.Rect.H + GridSize*4
+
+	if below := page.CardBelow(top); below != middle {
+		t.Errorf("expected the indented card to be below the top card, got %v", below)
+	}
+
+	if stackBottom := page.StackBottom(top); stackBottom != bottom {
+		t.Errorf("expected the bottom of the stack to be card %d, got %d", bottom.ID, stackBottom.ID)
+	}
+
+	card := page.AddCardToStack(ContentTypeCheckbox, middle)
+
+	if card.Rect.X != middle.Rect.X || card.Rect.Y != bottom.Rect.Y+bottom.Rect.H {
+		t.Errorf("card wasn't placed at the bottom of the stack: %+v", card.Rect)
+	}
+
+	if page.StackBottom(top) != card {
+		t.Error("card isn't at the bottom of the stack")
+	}
+
+	loose := page.AddCardToStack(ContentTypeNote, nil)
+
+	if loose.Rect.Y != apart.Rect.Y+apart.Rect.H+GridSize || page.CardBelow(apart) != nil {
+		t.Errorf("card without a stack wasn't placed apart below the page's cards: %+v", loose.Rect)
+	}
+
+	if project.FindPage("Root") != page || project.FindPage("0") != page {
+		t.Error("couldn't find the root page by name or ID")
+	}
+
+}
+
+func TestStackNumbersAndCompletion(t *testing.T) {
+
+	project := NewProject()
+	page := project.Root()
+
+	// A parent Checkbox with two Checkboxes indented under it, and a Numbered Card back at the parent's level.
+	parent := page.AddCard(ContentTypeCheckbox)
+
+	first := page.AddCardToStack(ContentTypeCheckbox, parent)
+	first.Rect.X += GridSize
+	first.Properties.Set("checked", true)
+
+	second := page.AddCardToStack(ContentTypeCheckbox, first)
+	second.Properties.Set("checked", false)
+
+	number := page.AddCardToStack(ContentTypeNumbered, parent)
+	number.Properties.Set("current", 9.0)
+	number.Properties.Set("maximum", 4.0)
+
+	alone := page.AddCardToStack(ContentTypeCheckbox, nil)
+
+	for _, test := range []struct {
+		card *Card
+		want []int
+	}{
+		{parent, []int{1}},
+		{first, []int{1, 1}},
+		{second, []int{1, 2}},
+		{number, []int{2}},
+		{alone, nil},
+	} {
+		if got := page.StackNumber(test.card); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("card %d is numbered %v, not %v", test.card.ID, got, test.want)
+		}
+	}
+
+	if children := page.StackChildren(parent); !reflect.DeepEqual(children, []*Card{first, second}) {
+		t.Errorf("parent has %d children, not 2", len(children))
+	}
+
+	if parent.CompletionLevel() != 1 || parent.MaximumCompletionLevel() != 2 || parent.Completed() {
+		t.Errorf("parent is %g/%g complete", parent.CompletionLevel(), parent.MaximumCompletionLevel())
+	}
+
+	if number.CompletionLevel() != 4 || !number.Completed() {
+		t.Errorf("numbered card is %g/%g complete", number.CompletionLevel(), number.MaximumCompletionLevel())
+	}
+
+	// Linking to a Card outside of the stack makes the parent depend on it too.
+	alone.Properties.Set("checked", true)
+	parent.LinkTo(alone)
+	second.Properties.Set("checked", true)
+
+	if parent.CompletionLevel() != 3 || parent.MaximumCompletionLevel() != 3 || !parent.Completed() {
+		t.Errorf("linked parent is %g/%g complete", parent.CompletionLevel(), parent.MaximumCompletionLevel())
+	}
+
+	// Links that lead around in a loop are ignored.
+	extra := page.AddCardToStack(ContentTypeNote, nil)
+	alone.LinkTo(extra)
+	extra.LinkTo(parent)
+
+	if parent.MaximumCompletionLevel() != 2 {
+		t.Errorf("parent with looping links has a maximum completion of %g", parent.MaximumCompletionLevel())
+	}
+
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
@@ -8,11 +9,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/blang/semver"
 	"github.com/ncruces/zenity"
 	"github.com/pkg/browser"
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
+	"github.com/solarlune/masterplan/plan"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -48,7 +47,9 @@ const (
 
 	// Per-Project Properties
 
-	ProjectCacheDirectory = "CacheDirectory"
+	ProjectCacheDirectory = plan.ProjectCacheDirectory
+	ProjectCalendarFeed   = plan.ProjectCalendarFeed
+	ProjectIdentifier     = plan.ProjectIdentifier
 )
 
 type Project struct {
@@ -64,12 +65,24 @@ type Project struct {
 	Modified       bool
 	justModified   bool
 	HasOrphanPages bool
-	LinkingCard    *Card
 
 	LoadConfirmationTo string
+	RecoveryBackup     string // The backup offered to be restored after a project failed to open
+	RecoveryTarget     string // The project that failed to open
 
 	BackingUp  bool
 	LastBackup time.Time
+	ReadOnly   bool          // Backups being looked through are opened read-only, so they can't be saved over
+	Journal    *plan.Journal // Write-ahead log of the changes made since the Project was last saved
+	Passphrase string        // If set, the project file (and its backups) are encrypted with it
+	Keys       *plan.Keys    // The keys derived from Passphrase
+
+	mediaDirectory string // The Project's private temporary directory, holding its bundled media and pasted images; it's removed along with the Project
+
+	Hierarchy       *Hierarchy
+	nextCardID      int64
+	nextPageID      uint64
+	focusCardOnOpen int64 // The ID of a Card to focus on once the Project's opened in a tab (when jumping to it from a Link Card); -1 if none
 
 	Properties *Properties
 }
@@ -79,27 +92,24 @@ func NewProject() *Project {
 	project := &Project{
 		Camera: NewCamera(),
 		// Pages:           []*Page{},
-		LastCardType: ContentTypeCheckbox,
-		LastBackup:   time.Now(),
-		Properties:   NewProperties(),
+		LastCardType:    ContentTypeCheckbox,
+		LastBackup:      time.Now(),
+		Properties:      NewProperties(),
+		Keys:            plan.NewKeys(),
+		focusCardOnOpen: -1,
 	}
 
-	if globals.Hierarchy != nil {
-		globals.Hierarchy.Destroy()
-		globals.Hierarchy = NewHierarchy(globals.Hierarchy.Container)
-	}
+	project.Hierarchy = NewHierarchy(globals.HierarchyContainer)
 
 	project.UndoHistory = NewUndoHistory(project)
 
-	globalPageID = 0
-
 	project.CurrentPage = project.AddPage()
 
 	project.CreateGridTexture()
 
 	project.Properties.Get(ProjectCacheDirectory).Set("")
-
-	globalCardID = 0
+	project.Properties.Get(ProjectCalendarFeed).Set(false)
+	project.Properties.Get(ProjectIdentifier).Set(plan.NewProjectIdentifier())
 
 	return project
 
@@ -111,6 +121,18 @@ func (project *Project) AddPage() *Page {
 	return page
 }
 
+// CardByID returns the Card with the given ID from any Page of the Project, or nil if there is none.
+func (project *Project) CardByID(id int64) *Card {
+	for _, page := range project.Pages {
+		for _, card := range page.Cards {
+			if card.ID == id {
+				return card
+			}
+		}
+	}
+	return nil
+}
+
 func (project *Project) RemovePage(page *Page) {
 
 	for i, p := range project.Pages {
@@ -179,14 +201,9 @@ func (project *Project) CreateGridTexture() {
 
 func (project *Project) AutoBackup() {
 
-	if globals.ReleaseMode != ReleaseModeDemo && project.Filepath != "" && globals.Settings.Get(SettingsAutoBackup).AsBool() && time.Since(project.LastBackup) > time.Duration(globals.Settings.Get(SettingsAutoBackupTime).AsFloat())*time.Minute {
+	if globals.ReleaseMode != ReleaseModeDemo && project.Filepath != "" && !project.ReadOnly && globals.Settings.Get(SettingsAutoBackup).AsBool() && time.Since(project.LastBackup) > time.Duration(globals.Settings.Get(SettingsAutoBackupTime).AsFloat())*time.Minute {
 
-		filename := project.Filepath
-		if strings.Contains(filename, ".plan"+BackupDelineator) {
-			filename = filename[:strings.Index(filename, ".plan")] + ".plan" + BackupDelineator + time.Now().Format(FileTimeFormat)
-		} else {
-			filename += BackupDelineator + time.Now().Format(FileTimeFormat)
-		}
+		filename := filepath.Join(filepath.Dir(project.Filepath), backupPrefix(project.Filepath)+time.Now().Format(FileTimeFormat))
 
 		ogFilepath := project.Filepath
 		project.Filepath = filename
@@ -196,15 +213,7 @@ func (project *Project) AutoBackup() {
 		project.LastBackup = time.Now()
 		project.Filepath = ogFilepath
 
-		head := filepath.Base(filename)
-		if !strings.Contains(head, ".plan"+BackupDelineator) {
-			head += BackupDelineator
-		} else {
-			ind := strings.Index(head, ".plan"+BackupDelineator)
-			head = head[:ind] + ".plan" + BackupDelineator
-		}
-
-		existingBackups := FilesInDirectory(filepath.Dir(project.Filepath), head)
+		existingBackups := Backups(project.Filepath)
 
 		maxBackups := int(globals.Settings.Get(SettingsMaxAutoBackups).AsFloat())
 
@@ -231,6 +240,86 @@ func (project *Project) AutoBackup() {
 
 }
 
+// backupPrefix returns the prefix of the filenames of backups of the given project file (e.g. "project.plan_bak_" for "project.plan", or for
+// any of its backups).
+func backupPrefix(projectPath string) string {
+	head := filepath.Base(projectPath)
+	if ind := strings.Index(head, BackupDelineator); ind >= 0 {
+		head = head[:ind]
+	}
+	return head + BackupDelineator
+}
+
+// Backups returns the filepaths of the automatic backups of the given project file, sorted from oldest to newest.
+func Backups(projectPath string) []string {
+	return FilesInDirectory(filepath.Dir(projectPath), backupPrefix(projectPath))
+}
+
+// BackupTime returns the time the backup at the given filepath was made, as recorded in its filename.
+func BackupTime(backupPath string) time.Time {
+	split := strings.Split(filepath.Base(backupPath), BackupDelineator)
+	backupTime, _ := time.ParseInLocation(FileTimeFormat, split[len(split)-1], time.Local)
+	return backupTime
+}
+
+// pendingRestoreBackup and pendingRestoreTarget are the backup and project asked about in the "confirm restore over changes" menu.
+var pendingRestoreBackup, pendingRestoreTarget string
+
+// ConfirmRestoreBackup restores the given backup (see RestoreBackup()), first asking if the open project at target has unsaved changes
+// that restoring would throw away.
+func ConfirmRestoreBackup(backup, target string) {
+
+	if project := ProjectTab(target); project != nil && project.Modified {
+		pendingRestoreBackup, pendingRestoreTarget = backup, target
+		confirm := globals.MenuSystem.Get("confirm restore over changes")
+		confirm.Center()
+		confirm.Open()
+		return
+	}
+
+	RestoreBackup(backup, target)
+
+}
+
+// RestoreBackup opens the given backup in place of the project at target; saving it then replaces the project file. The open project at
+// target is closed without asking, along with its crash journal.
+func RestoreBackup(backup, target string) {
+
+	model, bundleMediaDir, err := openProjectModel(backup, globals.Project.Passphrase)
+	if err == zenity.ErrCanceled {
+		return
+	} else if err != nil {
+		globals.EventLog.Log("Error: Couldn't open backup: %s", true, err.Error())
+		return
+	}
+
+	LoadProjectModel(model, target, bundleMediaDir)
+
+	globals.NextProject.Modified = true
+
+	globals.EventLog.Log("Backup from %s restored; save the project to replace %s with it.", true, BackupTime(backup).Format("Jan 2 15:04"), filepath.Base(target))
+
+}
+
+// ViewBackup opens the given backup read-only, so it can be looked through without risking saving over it.
+func ViewBackup(backup string) {
+
+	model, bundleMediaDir, err := openProjectModel(backup, globals.Project.Passphrase)
+	if err == zenity.ErrCanceled {
+		return
+	} else if err != nil {
+		globals.EventLog.Log("Error: Couldn't open backup: %s", true, err.Error())
+		return
+	}
+
+	LoadProjectModel(model, backup, bundleMediaDir)
+
+	globals.NextProject.ReadOnly = true
+
+	globals.EventLog.Log("Viewing backup from %s (read-only).", true, BackupTime(backup).Format("Jan 2 15:04"))
+
+}
+
 func (project *Project) Update() {
 
 	if globals.NextProject != nil && globals.NextProject != project {
@@ -361,33 +450,26 @@ func (project *Project) Draw() {
 
 }
 
-func (project *Project) Save() {
-
-	if globals.ReleaseMode == ReleaseModeDemo {
-		globals.EventLog.Log("Cannot save in demo mode of MasterPlan.", true)
-		return
-	}
-
-	saveData, _ := sjson.Set("{}", "version", globals.Version.String())
-
-	saveData, _ = sjson.Set(saveData, "pan", project.Camera.TargetPosition)
-	saveData, _ = sjson.Set(saveData, "zoom", project.Camera.TargetZoom)
-	saveData, _ = sjson.Set(saveData, "currentPage", project.CurrentPage.ID)
-
-	if cache := project.Properties.Get(ProjectCacheDirectory); cache.AsString() != "" {
-		cache.Set(project.PathToRelative(cache.AsString(), true))
+// ToModel returns the Project as a plan.Project, as it should be saved - filepaths are made relative to the project's location,
+// pasted images are embedded, and orphaned Pages without any Cards are left out.
+func (project *Project) ToModel() (*plan.Project, error) {
+
+	model := &plan.Project{
+		Version:     globals.Version.String(),
+		Pan:         plan.Point{X: project.Camera.TargetPosition.X, Y: project.Camera.TargetPosition.Y},
+		Zoom:        project.Camera.TargetZoom,
+		CurrentPage: int64(project.CurrentPage.ID),
+		Properties:  project.Properties.ToModel(true),
+		Pages:       []*plan.Page{},
+		SavedImages: map[string][]byte{},
+		Passphrase:  project.Passphrase,
+		Keys:        project.Keys,
 	}
 
-	saveData, _ = sjson.SetRaw(saveData, "properties", project.Properties.Serialize(true))
-
-	if cache := project.Properties.Get(ProjectCacheDirectory); cache.AsString() != "" {
-		cache.Set(project.PathToAbsolute(cache.AsString(), true))
+	if cache := model.Properties.String(ProjectCacheDirectory); cache != "" {
+		model.Properties.Set(ProjectCacheDirectory, project.PathToRelative(cache, true))
 	}
 
-	savedImages := map[string]string{}
-
-	pageData := "["
-
 	pagesToSave := []*Page{project.Pages[0]}
 
 	if len(project.Pages) > 1 {
@@ -421,46 +503,28 @@ func (project *Project) Save() {
 
 	}
 
-	sort.SliceStable(pagesToSave, func(i, j int) bool { return pagesToSave[i].ID < pagesToSave[j].ID })
+	for _, page := range pagesToSave {
 
-	type convertedFilepath struct {
-		Original string
-		PropName string
-		Card     *Card
-	}
-
-	for i, page := range pagesToSave {
+		pageModel := page.ToModel()
+		pageModel.Project = model
 
 		// Convert all paths to relative before saving
-		converted := []convertedFilepath{}
-
-		for _, card := range page.Cards {
-			if fp := card.Properties.GetIfExists("filepath"); fp != nil && (globals.Resources.Get(fp.AsString()) == nil || !globals.Resources.Get(fp.AsString()).SaveFile) && FileExists(fp.AsString()) {
-				converted = append(converted, convertedFilepath{Original: fp.AsString(), PropName: "filepath", Card: card})
-				fp.Set(project.PathToRelative(fp.AsString(), false))
+		for _, card := range pageModel.Cards {
+			if fp := card.Properties.String("filepath"); card.Properties.Has("filepath") && (globals.Resources.Get(fp) == nil || !globals.Resources.Get(fp).SaveFile) && FileExists(fp) {
+				card.Properties.Set("filepath", project.PathToRelative(fp, false))
 			}
-			if run := card.Properties.GetIfExists("run"); run != nil && FileExists(run.AsString()) {
-				converted = append(converted, convertedFilepath{Original: run.AsString(), PropName: "run", Card: card})
-				run.Set(project.PathToRelative(run.AsString(), false))
+			if run := card.Properties.String("run"); card.Properties.Has("run") && FileExists(run) {
+				card.Properties.Set("run", project.PathToRelative(run, false))
+			}
+			if targetProject := card.Properties.String("target project"); targetProject != "" && FileExists(targetProject) {
+				card.Properties.Set("target project", project.PathToRelative(targetProject, false))
 			}
 		}
 
-		pageData += page.Serialize()
-		if i < len(pagesToSave)-1 {
-			pageData += ", "
-		}
-
-		// Reset the filepaths after serialization
-		for _, conv := range converted {
-			conv.Card.Properties.Get(conv.PropName).Set(conv.Original)
-		}
+		model.Pages = append(model.Pages, pageModel)
 
 	}
 
-	pageData += "]"
-
-	saveData, _ = sjson.SetRaw(saveData, "pages", pageData)
-
 	for _, page := range project.Pages {
 
 		for _, card := range page.Cards {
@@ -470,15 +534,9 @@ func (project *Project) Save() {
 			if res := globals.Resources.Get(fp); res != nil && res.SaveFile {
 
 				if pngFile, err := os.ReadFile(fp); err != nil {
-					panic(err)
+					return nil, err
 				} else {
-
-					out := ""
-					for _, b := range pngFile {
-						out += string(b)
-					}
-
-					savedImages[fp] = string(out)
+					model.SavedImages[fp] = pngFile
 				}
 
 			} else {
@@ -489,22 +547,52 @@ func (project *Project) Save() {
 
 	}
 
-	saveData, _ = sjson.Set(saveData, "savedimages", savedImages)
+	return model, nil
 
-	saveData = gjson.Get(saveData, "@pretty").String()
+}
 
-	if file, err := os.Create(project.Filepath); err != nil {
-		log.Println(err)
-	} else {
-		file.Write([]byte(saveData))
-		file.Close()
-		file.Sync() // Ensure the save file is written
+func (project *Project) Save() {
+
+	if globals.ReleaseMode == ReleaseModeDemo {
+		globals.EventLog.Log("Cannot save in demo mode of MasterPlan.", true)
+		return
+	}
+
+	if project.ReadOnly {
+		globals.EventLog.Log("This backup is open read-only. Restore it from File > Backups, or use Save As to save a copy.", true)
+		return
+	}
+
+	model, err := project.ToModel()
+
+	if err == nil {
+		// Saving writes to a temporary file first and verifies it, so a failed save never damages the existing file.
+		if project.IsBundle() {
+			err = model.SaveBundle(project.Filepath)
+		} else {
+			err = model.Save(project.Filepath)
+		}
+	}
+
+	if err != nil {
+		if project.BackingUp {
+			globals.EventLog.Log("Error: Couldn't save project back-up: %s", true, err.Error())
+		} else {
+			globals.EventLog.Log("Error: Couldn't save project: %s\nThe file on disk has not been changed.", true, err.Error())
+		}
+		return
 	}
 
 	if project.BackingUp {
 		globals.EventLog.Log("Project back-up successfully saved.", false)
 	} else {
 		globals.EventLog.Log("Project saved successfully.", false)
+		// Everything in the journal is in the saved file now.
+		project.RemoveJournal()
+
+		if err := model.WriteCalendarFeed(project.Filepath); err != nil {
+			globals.EventLog.Log("Error: Couldn't write calendar feed to %s: %s", true, plan.CalendarFeedPath(project.Filepath), err.Error())
+		}
 	}
 
 	AddFileToRecentFilesList(project.Filepath)
@@ -513,15 +601,37 @@ func (project *Project) Save() {
 
 }
 
+// IsBundle returns if the project is saved as a bundle (a single file containing the project and all of the files its Cards point to), rather than a plain .plan file.
+func (project *Project) IsBundle() bool {
+	return filepath.Ext(project.Filepath) == plan.BundleExtension || strings.Contains(filepath.Base(project.Filepath), plan.BundleExtension+BackupDelineator)
+}
+
 func (project *Project) SaveAs() {
 
-	if filename, err := zenity.SelectFileSave(zenity.Title("Save MasterPlan Project..."), zenity.ConfirmOverwrite(), zenity.FileFilter{Name: "Project File (*.plan)", Patterns: []string{"*.plan"}}); err == nil {
+	if filename, err := zenity.SelectFileSave(
+		zenity.Title("Save MasterPlan Project..."),
+		zenity.ConfirmOverwrite(),
+		zenity.FileFilter{Name: "Project File (*.plan)", Patterns: []string{"*.plan"}},
+		zenity.FileFilter{Name: "Project Bundle, Including Media (*" + plan.BundleExtension + ")", Patterns: []string{"*" + plan.BundleExtension}},
+	); err == nil {
 
-		if filepath.Ext(filename) != ".plan" {
+		if ext := filepath.Ext(filename); ext != ".plan" && ext != plan.BundleExtension {
 			filename += ".plan"
 		}
 
+		if project.Passphrase == "" {
+			if zenity.Question("Encrypt the project with a passphrase?\nEncrypted projects (and their backups) can't be opened without it.", zenity.Title("Encrypt Project?"), zenity.OKLabel("Encrypt"), zenity.CancelLabel("Don't Encrypt"), zenity.DefaultCancel()) == nil {
+				if passphrase, err := AskNewPassphrase(); err == nil {
+					project.Passphrase = passphrase
+				} else if err != zenity.ErrCanceled {
+					globals.EventLog.Log("Error: %s", true, err.Error())
+					return
+				}
+			}
+		}
+
 		project.Filepath = filename
+		project.ReadOnly = false
 
 		project.Save()
 
@@ -534,7 +644,7 @@ func (project *Project) SaveAs() {
 // Open a project to load
 func (project *Project) Open() {
 
-	if filename, err := zenity.SelectFile(zenity.Title("Select MasterPlan Project to Open..."), zenity.FileFilter{Name: "Project File (*.plan / *.plan_bak_*)", Patterns: []string{"*.plan", "*.plan_bak_*"}}); err == nil {
+	if filename, err := zenity.SelectFile(zenity.Title("Select MasterPlan Project to Open..."), zenity.FileFilter{Name: "Project File (*.plan / *" + plan.BundleExtension + " / *.plan_bak_*)", Patterns: []string{"*.plan", "*" + plan.BundleExtension, "*.plan_bak_*", "*" + plan.BundleExtension + "_bak_*"}}); err == nil {
 
 		project.LoadConfirmationTo = filename
 		loadConfirm := globals.MenuSystem.Get("confirm load")
@@ -566,483 +676,356 @@ func OpenProjectFrom(filename string) {
 
 	}
 
-	jsonData, err := os.ReadFile(filename)
-	if err != nil {
-		globals.EventLog.Log("Error: %s", true, err.Error())
-	} else {
+	model, bundleMediaDir, err := openProjectModel(filename, "")
 
-		json := string(jsonData)
+	if err == zenity.ErrCanceled {
+		return
+	} else if err != nil {
 
-		if !gjson.Get(json, "version").Exists() && !gjson.Get(json, "Version").Exists() {
-			// if !gjson.Get(json, "pages").Exists() && !gjson.Get(json, "Tasks").Exists() {
+		if err == plan.ErrNotAProject {
 			globals.EventLog.Log("Warning: Cannot open project as it doesn't appear to be a valid MasterPlan project file. Please double-check to ensure it is valid.", true)
-			return
+		} else {
+			globals.EventLog.Log("Error: Cannot open project: %s", true, err.Error())
 		}
 
-		// Destroy resources before we load new ones
-		globals.Resources.Destroy()
-
-		log.Println("Load started.")
-
-		AddFileToRecentFilesList(filename)
-
-		log.Println("Recent files list updated...")
+		// The project might've been damaged; if there's a backup, offer to restore it.
+		backups := Backups(filename)
+		for i := len(backups) - 1; i >= 0; i-- {
+			if backups[i] != filename {
+				globals.Project.RecoveryBackup = backups[i]
+				globals.Project.RecoveryTarget = filename
+				restore := globals.MenuSystem.Get("confirm restore backup")
+				restore.Center()
+				restore.Open()
+				break
+			}
+		}
 
-		globals.EventLog.On = false
+		return
 
-		newProject := NewProject()
-		newProject.Loading = true
-		newProject.UndoHistory.On = false
-		globals.NextProject = newProject
+	}
 
-		brokenProject := false
+	AddFileToRecentFilesList(filename)
 
-		savedImageFileNames := map[string]string{}
+	log.Println("Recent files list updated...")
 
-		if ver, err := semver.Parse(gjson.Get(json, "version").String()); err != nil || ver.Minor < 8 {
+	LoadProjectModel(model, filename, bundleMediaDir)
 
-			globals.EventLog.Log("WARNING: Not all features from MasterPlan v0.7.2 have been re-implemented.\nPlease double-check the project to ensure it has been imported correctly, and\ncheck the roadmap under Help to see what remains to be re-implemented.\nIt would probably be best not to save over the original plan.", true)
+	// If MasterPlan crashed while the project was open, its journal will still be around.
+	if journalPath := plan.JournalPath(filename); FileExists(journalPath) && !JournalInUse(journalPath) {
+		OfferJournalRecovery(journalPath)
+	}
 
-			// IMPORT v0.7!
+}
 
-			// We don't set the filepath here because we explicity want you not to save over the project accidentally.
-			// newProject.Filepath = filename
+// readProjectModel reads the project at the given filepath, decrypting it with the passphrase if it's encrypted. Bundles have their media
+// extracted into a new temporary directory, which is returned as well.
+func readProjectModel(filename, passphrase string) (model *plan.Project, bundleMediaDir string, err error) {
 
-			boardNames := gjson.Get(json, "BoardNames").Array()
-			createdSubpages := make([]*Card, 0, len(boardNames)-1)
+	keys := plan.NewKeys()
 
-			x := float32(0)
+	data, err := plan.ReadProjectFile(filename, passphrase, keys)
+	if err != nil {
+		return nil, "", err
+	}
 
-			for _, b := range boardNames[1:] {
-				t := newProject.CurrentPage.CreateNewCard(ContentTypeSubpage)
-				t.Rect.X = x
-				t.Properties.Get("description").Set(b.String())
-				x += t.Rect.W + globals.GridSize
-				createdSubpages = append(createdSubpages, t)
+	if plan.IsBundleData(data) {
+		if bundleMediaDir, err = os.MkdirTemp(TempDirectory(), "bundle_*"); err == nil {
+			if model, err = plan.ExtractBundle(data, bundleMediaDir); err != nil {
+				os.RemoveAll(bundleMediaDir)
+				bundleMediaDir = ""
 			}
+		}
+	} else {
+		model, err = plan.Parse(data)
+	}
 
-			type Line struct {
-				Page    *Page
-				Start   Point
-				Endings []Point
-			}
+	if model != nil {
+		model.Passphrase = passphrase
+		model.Keys = keys
+	}
 
-			newLine := func(page *Page, x, y float32) Line {
-				return Line{
-					Page:    page,
-					Start:   Point{x, y},
-					Endings: []Point{},
-				}
-			}
+	return model, bundleMediaDir, err
 
-			linePositions := []Line{}
-
-			tasks := gjson.Get(json, "Tasks").Array()
-			for _, task := range tasks {
-
-				boardIndex := task.Get("BoardIndex").Int()
-
-				cardType := ContentTypeCheckbox
-
-				content := task.Get(`TaskType\.CurrentChoice`).Int()
-
-				switch content {
-				// case 0: // Checkbox
-				case 1: // Progression
-					cardType = ContentTypeNumbered
-				case 2:
-					cardType = ContentTypeNote
-				case 3:
-					cardType = ContentTypeImage
-				case 4:
-					cardType = ContentTypeSound
-				case 5:
-					cardType = ContentTypeTimer
-				case 6:
-					// Line
-					line := newLine(newProject.Pages[boardIndex], float32(task.Get(`Position\.X`).Float()*2), float32(task.Get(`Position\.Y`).Float()*2))
-					endings := task.Get(`LineEndings`).Array()
-					for i := 0; i < len(endings); i += 2 {
-						line.Endings = append(line.Endings, Point{float32(endings[i].Float() * 2), float32(endings[i+1].Float() * 2)})
-					}
-					linePositions = append(linePositions, line)
-					continue // Lines don't exist, so we do our best to connect cards that lines wwere connected to and move on
-				case 7:
-					cardType = ContentTypeMap
-				case 8:
-					// cardType = ContentTypeWhiteboard
-					continue
-				case 9:
-					cardType = ContentTypeTable
-				}
+}
 
-				card := newProject.Pages[boardIndex].CreateNewCard(cardType)
-				card.Rect.X = float32(task.Get(`Position\.X`).Float() * 2) // Grid is 32x32 in MasterPlan v0.8 compared to 16x16 in v0.7.2
-				card.Rect.Y = float32(task.Get(`Position\.Y`).Float() * 2)
+// openProjectModel reads the project at the given filepath like readProjectModel(), asking for its passphrase if it's encrypted and the
+// given passphrase doesn't open it. zenity.ErrCanceled is returned if asking was canceled.
+func openProjectModel(filename, passphrase string) (*plan.Project, string, error) {
 
-				if card.Properties.Has("description") {
-					desc := ""
-					if d := task.Get("Description").String(); d != "" {
-						desc = d
-					} else if d := task.Get(`TimerName\.Text`).String(); d != "" {
-						desc = d
-					}
-					card.Properties.Get("description").Set(desc)
-				}
+	if plan.IsEncryptedFile(filename) && passphrase == "" {
+		var err error
+		if passphrase, err = AskPassphrase(filepath.Base(filename) + " is encrypted. Enter its passphrase:"); err != nil {
+			return nil, "", err
+		}
+	}
 
-				if card.Properties.Has("checked") {
-					card.Properties.Get("checked").Set(task.Get(`Checkbox\.Checked`).Bool())
-				}
+	for {
 
-				if card.Properties.Has("current") {
-					card.Properties.Get("current").Set(task.Get(`Progression\.Current`).Float())
-					card.Properties.Get("maximum").Set(task.Get(`Progression\.Max`).Float())
-				}
+		model, bundleMediaDir, err := readProjectModel(filename, passphrase)
+		if err != plan.ErrWrongPassphrase {
+			return model, bundleMediaDir, err
+		}
 
-				if card.Completable() && task.Get(`DeadlineDaySpinner\.Number`).Exists() {
+		if passphrase, err = AskPassphrase("Wrong passphrase for " + filepath.Base(filename) + ", or the file is damaged. Try again:"); err != nil {
+			return nil, "", err
+		}
 
-					deadlineDay := int(task.Get(`DeadlineDaySpinner\.Number`).Int())
-					deadlineMonth := time.Month(task.Get(`DeadlineMonthSpinner\.CurrentChoice`).Int() + 1)
-					deadlineYear := int(task.Get(`DeadlineYearSpinner\.Number`).Int())
-					now := time.Now()
-					deadline := time.Date(deadlineYear, deadlineMonth, deadlineDay, 0, 0, 0, 0, now.Location())
-					card.Properties.Get("deadline").Set(deadline.Format("2006-01-02"))
-				}
+	}
 
-				if card.Properties.Has("filepath") {
+}
 
-					// If it's a saved image from the clipboard, then the path is of no consequence.
-					if !card.Properties.Has("saveimage") {
-						fp := []string{}
-						for _, element := range task.Get(`FilePath`).Array() {
-							fp = append(fp, element.String())
-						}
+// AskPassphrase asks for a passphrase to open an encrypted project.
+func AskPassphrase(text string) (string, error) {
 
-						relativePath := filepath.Join(fp...)
-						relativePath = filepath.ToSlash(relativePath)
-						card.Properties.Get("filepath").Set(relativePath)
-					}
+	passphrase, err := zenity.Entry(text, zenity.Title("Encrypted Project"), zenity.HideText())
+	if err == nil && passphrase == "" {
+		err = zenity.ErrCanceled
+	}
 
-					if sound, ok := card.Contents.(*SoundContents); ok {
-						sound.LoadFile()
-					} else if image, ok := card.Contents.(*ImageContents); ok {
-						image.LoadFile()
-					}
+	return passphrase, err
 
-				}
+}
 
-				if task.Get(`ImageDisplaySize\.X`).Exists() {
+// AskNewPassphrase asks for a new passphrase to encrypt a project with, twice to make sure it wasn't mistyped.
+func AskNewPassphrase() (string, error) {
 
-					w := float32(task.Get(`ImageDisplaySize\.X`).Float() * 2)
-					h := float32(task.Get(`ImageDisplaySize\.Y`).Float() * 2)
+	passphrase, err := zenity.Entry("Enter a passphrase to encrypt the project with.\nIf it's forgotten, the project can't be recovered:", zenity.Title("Set Passphrase"), zenity.HideText())
+	if err != nil {
+		return "", err
+	} else if passphrase == "" {
+		return "", errors.New("the passphrase can't be empty")
+	}
 
-					if image, ok := card.Contents.(*ImageContents); ok {
-						if image.Resource != nil {
-							card.Rect.W = w
-							card.Rect.H = h
-						}
-					} else {
-						card.Rect.W = w
-						card.Rect.H = h
-					}
+	confirmation, err := zenity.Entry("Enter the passphrase again to confirm it:", zenity.Title("Set Passphrase"), zenity.HideText())
+	if err != nil {
+		return "", err
+	} else if confirmation != passphrase {
+		return "", errors.New("the passphrases didn't match")
+	}
 
-				}
+	return passphrase, nil
 
-				if task.Get(`TimerMode\.CurrentChoice`).Exists() {
-					timerType := task.Get(`TimerMode\.CurrentChoice`).Int()
-					switch timerType {
-
-					// Countdown
-					case 0:
-						card.Properties.Get("mode group").Set(TimerModeCountdown)
-						str := card.Contents.(*TimerContents).SetMaxTime(int(task.Get(`TimerMinuteSpinner\.Number`).Int()), int(task.Get(`TimerSecondSpinner\.Number`).Int()))
-						card.Properties.Get("max time").Set(str)
-						triggerMode := task.Get(`TimerTriggerMode\.CurrentChoice`).Int()
-						switch triggerMode {
-						case 1:
-							card.Properties.Get("trigger mode").Set(TriggerTypeSet)
-						case 2:
-							card.Properties.Get("trigger mode").Set(TriggerTypeClear)
-						default:
-							card.Properties.Get("trigger mode").Set(TriggerTypeToggle)
-						}
-					case 3:
-						card.Properties.Get("mode group").Set(TimerModeStopwatch)
+}
 
-					}
-				}
+// SetPassphrase changes (or, if passphrase is empty, removes) the passphrase the Project is encrypted with. For saved projects, the project
+// file and its backups are re-encrypted right away, so none of them stay in the old state on disk; other unsaved changes stay unsaved.
+func (project *Project) SetPassphrase(passphrase string) {
 
-				if task.Get(`MapData`).Exists() {
+	oldPassphrase := project.Passphrase
+	project.Passphrase = passphrase
 
-					card.Rect.H -= globals.GridSize // There's no header bar for maps in 0.8, so they're one row shorter
+	// The journal's encrypted with the old passphrase (if any), so a new one's started with the next change.
+	project.RemoveJournal()
 
-					card.Update() // Allows the map to be set to the correct size
+	// Encrypted projects don't have calendar feeds (see plan.Project.WriteCalendarFeed()), so an existing one is removed rather than left stale.
+	if passphrase != "" && project.Filepath != "" && project.Properties.Get(ProjectCalendarFeed).AsBool() {
+		if err := os.Remove(plan.CalendarFeedPath(project.Filepath)); err != nil && !os.IsNotExist(err) {
+			globals.EventLog.Log("Error: Couldn't remove calendar feed: %s", true, err.Error())
+		}
+	}
 
-					mc := card.Contents.(*MapContents)
-					mc.MapData.Clear()
+	if project.Filepath == "" || project.ReadOnly {
+		project.Modified = true
+		return
+	}
 
-					for y, row := range task.Get(`MapData`).Array() {
+	if err := plan.ReencryptFile(project.Filepath, oldPassphrase, passphrase, project.Keys); err != nil {
+		globals.EventLog.Log("Error: Couldn't re-encrypt %s: %s\nSave the project to write it with the new passphrase.", true, filepath.Base(project.Filepath), err.Error())
+		project.Modified = true
+	}
 
-						for x, value := range row.Array() {
+	// Backups left as they were would leak what the passphrase protects, or become unreadable once it's changed.
+	for _, backup := range Backups(project.Filepath) {
+		if err := plan.ReencryptFile(backup, oldPassphrase, passphrase, project.Keys); err != nil {
+			globals.EventLog.Log("Error: Couldn't re-encrypt backup %s: %s", true, filepath.Base(backup), err.Error())
+		}
+	}
 
-							mc.MapData.SetI(x, y, int(value.Int()))
+}
 
-						}
+// LoadProjectModel creates a Project from the given plan.Project, which becomes the current Project on the next frame. filename is the file
+// the project was read from (empty for projects that were never saved), and bundleMediaDir is where its media were extracted to if it was a bundle.
+func LoadProjectModel(model *plan.Project, filename, bundleMediaDir string) {
 
-					}
+	log.Println("Load started.")
 
-					card.Properties.Get("contents").Set(mc.MapData.Serialize())
-					mc.UpdateTexture()
-				}
+	globals.EventLog.On = false
 
-				if task.Get(`TableData`).Exists() {
+	newProject := NewProject()
+	newProject.Loading = true
+	newProject.UndoHistory.On = false
+	globals.NextProject = newProject
 
-					card.Update()
+	brokenProject := false
 
-					tc := card.Contents.(*TableContents)
+	savedImageFileNames := map[string]string{}
 
-					height := len(task.Get(`TableData.Rows`).Array())
-					width := len(task.Get(`TableData.Columns`).Array())
+	if model.Schema == plan.SchemaV07 {
+		globals.EventLog.Log("WARNING: Not all features from MasterPlan v0.7.2 have been re-implemented.\nPlease double-check the project to ensure it has been imported correctly, and\ncheck the roadmap under Help to see what remains to be re-implemented.\nIt would probably be best not to save over the original plan.", true)
+		// We don't set the filepath here because we explicity want you not to save over the project accidentally.
+	} else {
+		newProject.Filepath = filename
+	}
 
-					card.Recreate(float32(width)*globals.GridSize, float32(height)*globals.GridSize)
-					tc.TableData.Resize(width, height)
+	newProject.Passphrase = model.Passphrase
+	if model.Keys != nil {
+		newProject.Keys = model.Keys
+	}
+	newProject.mediaDirectory = bundleMediaDir
 
-					for i, s := range task.Get(`TableData.Columns`).Array() {
-						ch := tc.TableData.ColumnHeadings[i]
-						ch.Label.SetTextRaw([]rune(s.String()))
-						ch.Label.RecreateTexture()
-					}
-					for i, s := range task.Get(`TableData.Rows`).Array() {
-						tc.TableData.RowHeadings[i].Label.SetTextRaw([]rune(s.String()))
-					}
-					for y, row := range task.Get(`TableData.Completion`).Array() {
-						for x, value := range row.Array() {
-							tc.TableData.SetValue(x, y, int(value.Int()))
-						}
-					}
+	newProject.Properties.FromModel(model.Properties)
 
-				}
+	if cache := newProject.Properties.Get(ProjectCacheDirectory); cache.AsString() != "" {
+		cache.Set(newProject.PathToAbsolute(cache.AsString(), true))
+	}
 
-				card.LockPosition()
+	for fpName, imgData := range model.SavedImages {
 
-				// Autoresize the card to fit the amount of text typed.
-				if auto, ok := card.Contents.(AutosetSizer); ok {
-					auto.AutosetSize()
-				}
+		newFName, _ := WriteImageToTemp(newProject.MediaDirectory(), imgData)
+		savedImageFileNames[fpName] = newFName
 
-				if cardType != ContentTypeNote && cardType != ContentTypeImage && cardType != ContentTypeMap && cardType != ContentTypeTable {
-					card.Collapse() // Collapsing the cards make them align more correctly to the 0.7 "single-line" layout
-				}
+		globals.Resources.Get(newFName).TempFile = true
+		globals.Resources.Get(newFName).SaveFile = true
 
-			}
+	}
 
-			// Attempt to connect relevant Cards
-			for _, line := range linePositions {
+	log.Println("Any saved images loaded.")
 
-				for _, dest := range line.Endings {
+	log.Println("Loading pages...")
 
-					var baseCard *Card
-					var destination *Card
+	for i := 0; i < len(model.Pages)-1; i++ {
+		newProject.AddPage()
+	}
 
-					if cards := line.Page.Grid.NeighboringCards(line.Start.X, line.Start.Y); len(cards) > 0 {
-						for _, c := range cards {
-							// Skip subpages because they don't exist in 0.7
-							if c.ContentType == ContentTypeSubpage {
-								continue
-							}
-							baseCard = c
-						}
-					}
+	for p, pageModel := range model.Pages {
+		newProject.Pages[p].DeserializePageData(pageModel)
+	}
 
-					if cards := line.Page.Grid.NeighboringCards(dest.X, dest.Y); len(cards) > 0 {
-						for _, c := range cards {
-							// Skip subpages because they don't exist in 0.7
-							if c.ContentType == ContentTypeSubpage {
-								continue
-							}
-							destination = c
-						}
-					}
+	for p, pageModel := range model.Pages {
+		newProject.Pages[p].DeserializeCards(pageModel)
+	}
 
-					if baseCard != nil && destination != nil && baseCard != destination {
-						baseCard.Link(destination)
+	if model.Schema == plan.SchemaV07 {
+		// Autoresize imported cards to fit the amount of text typed; v0.7 projects don't store card sizes for text.
+		for _, page := range newProject.Pages {
+			for _, card := range page.Cards {
+				if auto, ok := card.Contents.(AutosetSizer); ok {
+					collapsed := card.Collapsed != CollapsedNone
+					if collapsed {
+						card.Collapse()
 					}
-
-				}
-
-			}
-
-			rootPageBounds := CorrectingRect{}
-			root := newProject.Pages[0]
-
-			if len(root.Cards) > 0 {
-
-				rootPageBounds.X1 = root.Cards[0].Rect.X
-				rootPageBounds.Y1 = root.Cards[0].Rect.Y
-				rootPageBounds.X2 = root.Cards[0].Rect.X
-				rootPageBounds.Y2 = root.Cards[0].Rect.Y
-
-				for _, card := range root.Cards {
-					if card.ContentType != ContentTypeSubpage {
-						rootPageBounds = rootPageBounds.AddXY(card.Rect.X, card.Rect.Y)
-						rootPageBounds = rootPageBounds.AddXY(card.Rect.X+card.Rect.W, card.Rect.Y+card.Rect.H)
+					auto.AutosetSize()
+					if collapsed {
+						card.UncollapsedSize = Point{}
+						card.Collapse() // Collapsing the cards make them align more correctly to the 0.7 "single-line" layout
 					}
+					card.LockPosition()
 				}
-
-				for _, subpage := range createdSubpages {
-					subpage.Rect.X += rootPageBounds.Width()
-					subpage.LockPosition()
-				}
-
 			}
+		}
+	}
 
-		} else {
-
-			newProject.Filepath = filename
+	newProject.SendMessage(NewMessage(MessageProjectLoadingAllCardsCreated, nil, nil))
 
-			if props := gjson.Get(json, "properties"); props.Exists() {
-				newProject.Properties.Deserialize(gjson.Get(json, "properties").String())
-			}
+	for _, page := range newProject.Pages {
 
-			if cache := newProject.Properties.Get(ProjectCacheDirectory); cache.AsString() != "" {
-				cache.Set(newProject.PathToAbsolute(cache.AsString(), true))
-			}
+		if page.PointingSubpageCard == nil && page != newProject.Pages[0] {
+			brokenProject = true
+		}
 
-			for fpName, imgData := range gjson.Get(json, "savedimages").Map() {
+		for _, card := range page.Cards {
 
-				imgOut := []byte{}
+			card.DisplayRect.X = card.Rect.X
+			card.DisplayRect.Y = card.Rect.Y
+			card.DisplayRect.W = card.Rect.W
+			card.DisplayRect.H = card.Rect.H
 
-				for _, c := range imgData.String() {
-					imgOut = append(imgOut, byte(c))
+			// Media extracted from a bundle only live as long as the project is open
+			if fp := card.Properties.GetIfExists("filepath"); fp != nil && bundleMediaDir != "" && strings.HasPrefix(fp.AsString(), bundleMediaDir) {
+				if res := globals.Resources.Get(fp.AsString()); res != nil {
+					res.TempFile = true
 				}
-
-				newFName, _ := WriteImageToTemp(imgOut)
-				savedImageFileNames[fpName] = newFName
-
-				globals.Resources.Get(newFName).TempFile = true
-				globals.Resources.Get(newFName).SaveFile = true
-
 			}
 
-			log.Println("Any saved images loaded.")
-
-			log.Println("Loading pages...")
-
-			if ver.LTE(semver.MustParse("0.8.0-alpha.3")) {
-				page := gjson.Get(json, "root.contents").Array()[0]
-				newProject.Pages[0].DeserializePageData(page.String())
-				newProject.Pages[0].DeserializeCards(page.String())
-			} else {
-
-				// v0.8.0-alpha.3 and below just had one page, but organized into a folder; this is no longer done.
-				for i := 0; i < len(gjson.Get(json, "pages").Array())-1; i++ {
-					newProject.AddPage()
-				}
-
-				for p, pageData := range gjson.Get(json, "pages").Array() {
-					page := newProject.Pages[p]
-					page.DeserializePageData(pageData.String())
-				}
-
-				for p, pageData := range gjson.Get(json, "pages").Array() {
-					newProject.Pages[p].DeserializeCards(pageData.String())
+			if card.Properties.Has("saveimage") {
+				imgPath, exists := savedImageFileNames[card.Properties.Get("filepath").AsString()]
+				if exists {
+					card.Contents.(*ImageContents).LoadFileFrom(imgPath) // Reload the file
+				} else {
+					card.Properties.Remove("saveimage")
+					globals.EventLog.Log("Saved screenshot: %s could not be loaded.\n", true, imgPath)
 				}
-
 			}
 
 		}
 
-		newProject.SendMessage(NewMessage(MessageProjectLoadingAllCardsCreated, nil, nil))
-
-		for _, page := range newProject.Pages {
-
-			if page.PointingSubpageCard == nil && page != newProject.Pages[0] {
-				brokenProject = true
-			}
+		page.UpdateLinks()
 
-			for _, card := range page.Cards {
-
-				card.DisplayRect.X = card.Rect.X
-				card.DisplayRect.Y = card.Rect.Y
-				card.DisplayRect.W = card.Rect.W
-				card.DisplayRect.H = card.Rect.H
-
-				if card.Properties.Has("saveimage") {
-					imgPath, exists := savedImageFileNames[card.Properties.Get("filepath").AsString()]
-					if exists {
-						card.Contents.(*ImageContents).LoadFileFrom(imgPath) // Reload the file
-					} else {
-						card.Properties.Remove("saveimage")
-						globals.EventLog.Log("Saved screenshot: %s could not be loaded.\n", true, imgPath)
-					}
-				}
-
-			}
-
-			page.UpdateLinks()
-
-		}
+	}
 
-		// newProject.Camera.Update()
+	// newProject.Camera.Update()
 
-		// Settle the elements in - we do this a few times because it seems like things might take two steps (create card, set properties, create links, etc)
-		globals.Renderer.SetClipRect(nil)
-		for i := 0; i < 3; i++ {
-			for _, page := range newProject.Pages {
-				newProject.CurrentPage = page
-				page.Update()
-				page.Draw()
-			}
+	// Settle the elements in - we do this a few times because it seems like things might take two steps (create card, set properties, create links, etc)
+	globals.Renderer.SetClipRect(nil)
+	for i := 0; i < 3; i++ {
+		for _, page := range newProject.Pages {
+			newProject.CurrentPage = page
+			page.Update()
+			page.Draw()
 		}
+	}
 
-		// for _, page := range newProject.Pages {
-		// 	newProject.CurrentPage = page
-		// 	for _, card := range page.Cards {
-		// 		card.CreateUndoState = true
-		// 	}
-		// 	page.Update()
-		// 	page.Draw()
-		// }
+	// for _, page := range newProject.Pages {
+	// 	newProject.CurrentPage = page
+	// 	for _, card := range page.Cards {
+	// 		card.CreateUndoState = true
+	// 	}
+	// 	page.Update()
+	// 	page.Draw()
+	// }
 
-		newProject.UndoHistory.On = true
+	newProject.UndoHistory.On = true
 
-		for _, page := range newProject.Pages {
-			for _, card := range page.Cards {
-				card.CreateUndoState = false
-				card.Page.Project.UndoHistory.Capture(NewUndoState(card))
-			}
+	for _, page := range newProject.Pages {
+		for _, card := range page.Cards {
+			card.CreateUndoState = false
+			card.Page.Project.UndoHistory.Capture(NewUndoState(card))
 		}
+	}
 
-		if !brokenProject && gjson.Get(json, "currentPage").Exists() {
-			pageID := uint64(gjson.Get(json, "currentPage").Int())
-			for _, p := range newProject.Pages {
-				if p.ID == pageID {
-					newProject.SetPage(p)
-					break
-				}
+	if !brokenProject && model != nil && model.CurrentPage >= 0 {
+		pageID := uint64(model.CurrentPage)
+		for _, p := range newProject.Pages {
+			if p.ID == pageID {
+				newProject.SetPage(p)
+				break
 			}
-		} else {
-			newProject.SetPage(newProject.Pages[0])
 		}
+	} else {
+		newProject.SetPage(newProject.Pages[0])
+	}
 
-		newProject.Camera.JumpTo(newProject.CurrentPage.Pan, newProject.CurrentPage.Zoom)
+	newProject.Camera.JumpTo(newProject.CurrentPage.Pan, newProject.CurrentPage.Zoom)
 
-		newProject.UndoHistory.Update()
+	newProject.UndoHistory.Update()
 
-		newProject.Modified = false
-		newProject.UndoHistory.MinimumFrame = 1
-		globals.EventLog.On = true
+	newProject.Modified = false
+	newProject.UndoHistory.MinimumFrame = 1
+	globals.EventLog.On = true
 
-		globals.EventLog.Log("Project loaded successfully.", false)
+	globals.EventLog.Log("Project loaded successfully.", false)
 
-		if brokenProject {
-			newProject.HasOrphanPages = true
-			globals.EventLog.Log(
-				"WARNING: This project contains cards on orphaned Pages (Pages that aren't reachable through corresponding Sub-Page Cards).\n"+
-					"You may fix this by accessing orphaned Pages through the Hierarchy view and moving or deleting all cards from those pages.\n"+
-					"Saving will then fix the project. You can also flatten the project and restructure, and then save the project.", true)
-		}
+	if len(model.Migrations) > 0 {
+		globals.EventLog.Log("Project upgraded from an older format:\n- %s\nSaving will store it in the current format.", true, strings.Join(model.Migrations, "\n- "))
+	}
 
+	if brokenProject {
+		newProject.HasOrphanPages = true
+		globals.EventLog.Log(
+			"WARNING: This project contains cards on orphaned Pages (Pages that aren't reachable through corresponding Sub-Page Cards).\n"+
+				"You may fix this by accessing orphaned Pages through the Hierarchy view and moving or deleting all cards from those pages.\n"+
+				"Saving will then fix the project. You can also flatten the project and restructure, and then save the project.", true)
 	}
 
 }
@@ -1057,6 +1040,9 @@ func (project *Project) Reload() {
 
 func (project *Project) Destroy() {
 
+	// The Project's closing normally, so any unsaved changes were discarded on purpose (the user was asked first, if it was modified).
+	project.RemoveJournal()
+
 	project.GridTexture.Destroy()
 	project.GridTexture.StopTracking()
 	for _, page := range project.Pages {
@@ -1065,6 +1051,29 @@ func (project *Project) Destroy() {
 	project.Pages = nil
 	project.Camera = nil
 	project.CurrentPage = nil
+	project.Hierarchy.Destroy()
+
+	// Pasted images and bundled media may belong to an encrypted project, so they don't outlive it.
+	if project.mediaDirectory != "" {
+		os.RemoveAll(project.mediaDirectory)
+	}
+
+}
+
+// MediaDirectory returns the Project's private temporary directory for media that aren't files of their own elsewhere (pasted images, for
+// example), creating it if it doesn't exist yet. Only the current user can read it, and it's removed when the Project's destroyed.
+func (project *Project) MediaDirectory() string {
+
+	if project.mediaDirectory == "" {
+		dir, err := os.MkdirTemp(TempDirectory(), "project_*")
+		if err != nil {
+			globals.EventLog.Log(err.Error(), false)
+			return TempDirectory()
+		}
+		project.mediaDirectory = dir
+	}
+
+	return project.mediaDirectory
 
 }
 
@@ -1199,6 +1208,14 @@ func (project *Project) GlobalShortcuts() {
 		kb.Shortcuts[KBOpenDeadlinesMenu].ConsumeKeys()
 	}
 
+	if kb.Pressed(KBNextTab) {
+		SwitchTab(1)
+		kb.Shortcuts[KBNextTab].ConsumeKeys()
+	} else if kb.Pressed(KBPrevTab) {
+		SwitchTab(-1)
+		kb.Shortcuts[KBPrevTab].ConsumeKeys()
+	}
+
 	if globals.State != StateCardArrow {
 
 		if kb.Pressed(KBUndo) {
@@ -1531,22 +1548,40 @@ func (project *Project) GlobalShortcuts() {
 		globals.Mouse.SetCursor(CursorEyedropper)
 
 		if globals.Mouse.Button(sdl.BUTTON_LEFT).Pressed() {
+			var target *Card
 			for _, card := range project.CurrentPage.Cards {
 				if ClickedInRect(card.Rect, true) {
-					project.LinkingCard.Contents.(*LinkContents).SetTarget(card)
-					project.Camera.FocusOn(false, project.LinkingCard)
-					project.LinkingCard = nil
-					globals.EventLog.Log("Card linking succeeded.", false)
-					globals.State = StateNeutral
+					target = card
 				}
 			}
+
+			linking := globals.linkingCard
+
+			if target != nil && linking.Page.Project != project && project.Filepath == "" {
+				globals.EventLog.Log("Error: This project has to be saved before cards in it can be linked to from other projects.", true)
+			} else if target != nil {
+
+				if linking.Page.Project == project {
+					linking.Contents.(*LinkContents).SetTarget(target)
+				} else {
+					linking.Contents.(*LinkContents).SetRemoteTarget(project.Filepath, target.ID)
+					SwitchToProject(linking.Page.Project)
+				}
+
+				linking.Page.Project.Camera.FocusOn(false, linking)
+				globals.linkingCard = nil
+				globals.EventLog.Log("Card linking succeeded.", false)
+				globals.State = StateNeutral
+
+			}
+
 			globals.Mouse.Button(sdl.BUTTON_LEFT).Consume()
 		}
 
 		if globals.Mouse.Button(sdl.BUTTON_RIGHT).Pressed() || globals.Keyboard.Key(sdl.K_ESCAPE).Pressed() {
 			globals.State = StateNeutral
 			globals.EventLog.Log("Card linking canceled.", false)
-			project.LinkingCard = nil
+			globals.linkingCard = nil
 			globals.Mouse.Button(sdl.BUTTON_RIGHT).Consume()
 			globals.Keyboard.Key(sdl.K_ESCAPE).Consume()
 		}
@@ -1605,6 +1640,23 @@ func (project *Project) SetPage(page *Page) {
 
 }
 
+// FocusOnCard switches to the Page the Card with the given ID is on, and selects and focuses on it.
+func (project *Project) FocusOnCard(cardID int64) {
+
+	card := project.CardByID(cardID)
+
+	if card == nil || !card.Valid {
+		globals.EventLog.Log("Error: The linked card can't be found in %s; it may have been deleted.", true, TabName(project))
+		return
+	}
+
+	project.SetPage(card.Page)
+	card.Page.Selection.Clear()
+	card.Page.Selection.Add(card)
+	project.Camera.FocusOn(false, card)
+
+}
+
 func (project *Project) PathToRelative(fp string, directory bool) string {
 
 	var exists bool
@@ -1651,3 +1703,21 @@ func (project *Project) PathToAbsolute(fp string, directory bool) string {
 	}
 	return final
 }
+
+// backupDiffSummary describes the changes made going from a backup to the current state of the project, page by page.
+func backupDiffSummary(backup, current *plan.Project) string {
+
+	diffs := plan.Diff(backup, current)
+
+	if len(diffs) == 0 {
+		return "No changes"
+	}
+
+	lines := []string{}
+	for _, diff := range diffs {
+		lines = append(lines, diff.String())
+	}
+
+	return strings.Join(lines, "\n")
+
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"strconv"
 
+	"github.com/solarlune/masterplan/plan"
 	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 )
 
 type Property struct {
@@ -175,6 +175,16 @@ func (properties *Properties) Get(name string) *Property {
 
 }
 
+// CheckValue returns an error if the named property can't be set to the value (see plan.CheckPropertyValue()), so values that would fail to
+// be read as the property's type never get set.
+func (properties *Properties) CheckValue(name string, value interface{}) error {
+	var existing interface{}
+	if prop, exists := properties.Props[name]; exists {
+		existing = prop.data
+	}
+	return plan.CheckPropertyValue(name, value, existing)
+}
+
 func (properties *Properties) SetDefault(propertyName string, value any) {
 	if !properties.Has(propertyName) {
 		properties.Get(propertyName).Set(value)
@@ -201,30 +211,39 @@ func (properties *Properties) Remove(propertyName string) {
 
 }
 
-func (properties *Properties) Serialize(saving bool) string {
+// ToModel returns the Properties that are in use as a plan.Properties; if saving is false, Properties that only serialize in saves are skipped.
+func (properties *Properties) ToModel(saving bool) *plan.Properties {
 
-	data := "{}"
+	model := plan.NewProperties()
 
 	for _, name := range properties.DefinitionOrder {
 		prop := properties.Props[name]
 		if prop.InUse && (!prop.OnlySerializeInSaves || saving) {
-			data, _ = sjson.Set(data, name, prop.data)
+			model.Set(name, prop.data)
 		}
 	}
 
-	return data
+	return model
 
 }
 
-func (properties *Properties) Deserialize(data string) {
+// FromModel sets the Properties from the given plan.Properties, without triggering OnChange.
+func (properties *Properties) FromModel(model *plan.Properties) {
 
 	// All Properties contained within this object should probably be cleared before parsing...?
 
-	parsed := gjson.Parse(data)
+	for _, name := range model.DefinitionOrder {
+		properties.Get(name).SetRaw(model.Get(name))
+	}
+
+}
 
-	parsed.ForEach(func(key, value gjson.Result) bool {
-		properties.Get(key.String()).SetRaw(value.Value())
-		return true
-	})
+func (properties *Properties) Serialize(saving bool) string {
+	return properties.ToModel(saving).Serialize()
+}
 
+func (properties *Properties) Deserialize(data string) {
+	model := plan.NewProperties()
+	model.Deserialize(data)
+	properties.FromModel(model)
 }
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/solarlune/masterplan/plan"
+)
+
+// Deadline states as they're named in query output and filters; cards without deadlines have the state "none".
+var queryDeadlineStates = map[int]string{
+	DeadlineStateTimeRemains: "upcoming",
+	DeadlineStateDueToday:    "due-today",
+	DeadlineStateOverdue:     "overdue",
+	DeadlineStateDone:        "done",
+}
+
+type queryCard struct {
+	ID                int64    `json:"id"`
+	Name              string   `json:"name"`
+	Type              string   `json:"type"`
+	Page              uint64   `json:"page"`
+	PagePath          []string `json:"page_path"`              // Names of the Pages from the root down to the Card's Page
+	StackNumber       []int    `json:"stack_number,omitempty"` // e.g. [1, 2] for the second Card indented under the first; only for numberable Cards in stacks
+	Completable       bool     `json:"completable"`
+	Completed         bool     `json:"completed"`
+	Completion        float32  `json:"completion"`
+	MaximumCompletion float32  `json:"maximum_completion"`
+	Deadline          string   `json:"deadline,omitempty"`
+	DeadlineState     string   `json:"deadline_state"`
+}
+
+type queryStats struct {
+	TotalCards        int     `json:"total_cards"`
+	CompletableCards  int     `json:"completable_cards"`
+	CompletedCards    int     `json:"completed_cards"`
+	Percentage        int     `json:"percentage"`
+	Completion        float32 `json:"completion"`
+	MaximumCompletion float32 `json:"maximum_completion"`
+}
+
+type queryDeadlines struct {
+	Overdue  []*queryCard `json:"overdue"`
+	DueToday []*queryCard `json:"due_today"`
+	Upcoming []*queryCard `json:"upcoming"`
+}
+
+type queryResult struct {
+	Project   string          `json:"project"`
+	Cards     []*queryCard    `json:"cards"`
+	Stats     *queryStats     `json:"stats"`
+	Deadlines *queryDeadlines `json:"deadlines"`
+}
+
+// queryFilter decides which Cards are included in a query.
+type queryFilter struct {
+	Page           string          // Page name or ID; empty for all Pages
+	Types          map[string]bool // Lowercase content types; empty for all types
+	Completed      string          // "true" or "false" for only completable Cards that are (or aren't) completed; empty for all Cards
+	DeadlineStates map[string]bool // Deadline states (see queryDeadlineStates); empty for all states
+}
+
+func (filter *queryFilter) Matches(project *plan.Project, card *plan.Card) bool {
+
+	if filter.Page != "" && project.PageName(card.Page) != filter.Page && strconv.FormatUint(card.Page.ID, 10) != filter.Page {
+		return false
+	}
+
+	if len(filter.Types) > 0 && !filter.Types[strings.ToLower(card.ContentType)] {
+		return false
+	}
+
+	if filter.Completed != "" && (!card.Numberable() || strconv.FormatBool(card.Completed()) != filter.Completed) {
+		return false
+	}
+
+	if len(filter.DeadlineStates) > 0 && !filter.DeadlineStates[cardDeadlineState(card)] {
+		return false
+	}
+
+	return true
+
+}
+
+// modelDeadlineState returns the Card's deadline state, as Card.DeadlineState() does for Cards in an open Project.
+func modelDeadlineState(card *plan.Card) int {
+	if !card.Properties.Has("deadline") {
+		return DeadlineStateDone
+	}
+	return deadlineState(card.Properties.String("deadline"), card.Completed())
+}
+
+// cardDeadlineState returns the name of the Card's deadline state, or "none" if it has no deadline.
+func cardDeadlineState(card *plan.Card) string {
+	if !card.Properties.Has("deadline") {
+		return "none"
+	}
+	return queryDeadlineStates[modelDeadlineState(card)]
+}
+
+func newQueryCard(project *plan.Project, card *plan.Card) *queryCard {
+
+	return &queryCard{
+		ID:                card.ID,
+		Name:              card.Name(),
+		Type:              card.ContentType,
+		Page:              card.Page.ID,
+		PagePath:          project.PagePath(card.Page),
+		StackNumber:       card.Page.StackNumber(card),
+		Completable:       card.Numberable(),
+		Completed:         card.Completed(),
+		Completion:        card.CompletionLevel(),
+		MaximumCompletion: card.MaximumCompletionLevel(),
+		Deadline:          card.Properties.String("deadline"),
+		DeadlineState:     cardDeadlineState(card),
+	}
+
+}
+
+// QueryProject returns the Cards in the Project (saved at the given filepath) that pass the filter, along with their completion totals (as
+// the Stats menu counts them) and their deadlines (as the Deadlines menu lists them). It works from the saved project rather than an open
+// one, so it needs neither a window nor the Project's resources.
+func QueryProject(project *plan.Project, projectPath string, filter *queryFilter) *queryResult {
+
+	result := &queryResult{
+		Project:   projectPath,
+		Cards:     []*queryCard{},
+		Stats:     &queryStats{},
+		Deadlines: &queryDeadlines{Overdue: []*queryCard{}, DueToday: []*queryCard{}, Upcoming: []*queryCard{}},
+	}
+
+	deadlineCards := []*plan.Card{}
+	queryCards := map[*plan.Card]*queryCard{}
+
+	reachable := plan.ReachablePages(project)
+
+	for _, page := range project.Pages {
+
+		if !reachable[page] {
+			continue
+		}
+
+		for _, card := range page.Cards {
+
+			if !filter.Matches(project, card) {
+				continue
+			}
+
+			qc := newQueryCard(project, card)
+			queryCards[card] = qc
+			result.Cards = append(result.Cards, qc)
+
+			stats := result.Stats
+			stats.TotalCards++
+
+			if card.Numberable() {
+				stats.MaximumCompletion += qc.MaximumCompletion
+				stats.Completion += qc.Completion
+				stats.CompletableCards++
+				if qc.Completed {
+					stats.CompletedCards++
+				}
+			}
+
+			if card.Properties.Has("deadline") && card.Completable() {
+				deadlineCards = append(deadlineCards, card)
+			}
+
+		}
+
+	}
+
+	if result.Stats.CompletableCards > 0 {
+		result.Stats.Percentage = int(float32(result.Stats.CompletedCards) / float32(result.Stats.CompletableCards) * 100)
+	}
+
+	// Deadlines are sorted by date, and then by ID, like in the Deadlines menu.
+	sort.SliceStable(deadlineCards, func(i, j int) bool {
+		deadlineA, _ := time.ParseInLocation("2006-01-02", deadlineCards[i].Properties.String("deadline"), time.Local)
+		deadlineB, _ := time.ParseInLocation("2006-01-02", deadlineCards[j].Properties.String("deadline"), time.Local)
+		if !deadlineA.Equal(deadlineB) {
+			return deadlineA.Before(deadlineB)
+		}
+		return deadlineCards[i].ID < deadlineCards[j].ID
+	})
+
+	for _, card := range deadlineCards {
+		switch modelDeadlineState(card) {
+		case DeadlineStateOverdue:
+			result.Deadlines.Overdue = append(result.Deadlines.Overdue, queryCards[card])
+		case DeadlineStateDueToday:
+			result.Deadlines.DueToday = append(result.Deadlines.DueToday, queryCards[card])
+		case DeadlineStateTimeRemains:
+			result.Deadlines.Upcoming = append(result.Deadlines.Upcoming, queryCards[card])
+		}
+	}
+
+	return result
+
+}
+
+// commaSet returns a set of the lowercase, comma-separated values in the given string.
+func commaSet(values string) map[string]bool {
+	set := map[string]bool{}
+	for _, value := range strings.Split(values, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			set[value] = true
+		}
+	}
+	return set
+}
+
+func runQueryCommand(command *Command, args []string) int {
+
+	flags := command.Flags()
+	page := flags.String("page", "", "Only include cards on the page with this name or ID.")
+	types := flags.String("type", "", "Only include cards of these content types (comma-separated, e.g. checkbox,number).")
+	completed := flags.String("completed", "", "Only include completable cards that are (true) or aren't (false) completed.")
+	deadlines := flags.String("deadline", "", "Only include cards in these deadline states (comma-separated): none, upcoming, due-today, overdue, done.")
+	if flags.Parse(args) != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	filter := &queryFilter{
+		Page:           *page,
+		Types:          commaSet(*types),
+		Completed:      strings.ToLower(*completed),
+		DeadlineStates: commaSet(*deadlines),
+	}
+
+	if filter.Completed != "" && filter.Completed != "true" && filter.Completed != "false" {
+		fmt.Fprintf(os.Stderr, "--completed should be true or false, not %s.\n", *completed)
+		return 2
+	}
+
+	for state := range filter.DeadlineStates {
+		known := state == "none"
+		for _, name := range queryDeadlineStates {
+			known = known || state == name
+		}
+		if !known {
+			fmt.Fprintf(os.Stderr, "Unknown deadline state %s; it should be none, upcoming, due-today, overdue, or done.\n", state)
+			return 2
+		}
+	}
+
+	projectPath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't find %s: %s\n", flags.Arg(0), err)
+		return 2
+	}
+
+	project, err := plan.ReadProject(projectPath, os.Getenv("MASTERPLAN_PASSPHRASE"), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't load %s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	output, err := json.MarshalIndent(QueryProject(project, projectPath, filter), "", "\t")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write query output: %s\n", err)
+		return 1
+	}
+
+	fmt.Println(string(output))
+
+	return 0
+
+}
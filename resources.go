@@ -60,6 +60,43 @@ func (resourceBank ResourceBank) Destroy() {
 
 }
 
+// DestroyUnused destroys the Resources that aren't used by any of the open Projects (including one being loaded); this is done when a
+// Project is closed.
+func (resourceBank ResourceBank) DestroyUnused() {
+
+	used := map[*Resource]bool{}
+
+	projects := append([]*Project{}, globals.Projects...)
+	if globals.NextProject != nil {
+		projects = append(projects, globals.NextProject)
+	}
+
+	for _, project := range projects {
+		for _, page := range project.Pages {
+			for _, card := range page.Cards {
+				for _, contents := range card.ContentsLibrary {
+					switch c := contents.(type) {
+					case *ImageContents:
+						used[c.Resource] = true
+						used[c.DefaultImage] = true
+						used[c.BrokenImage] = true
+					case *SoundContents:
+						used[c.Resource] = true
+					}
+				}
+			}
+		}
+	}
+
+	for resourceName, resource := range resourceBank {
+		if resource.Destructible && !used[resource] {
+			resource.Destroy()
+			delete(resourceBank, resourceName)
+		}
+	}
+
+}
+
 type Resource struct {
 	Name          string // The ID / name identifying the Resource; for offline files, this is the same as LocalFilepath
 	LocalFilepath string // The actual path to the file on-disk
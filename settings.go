@@ -54,6 +54,11 @@ const (
 	SettingsShowTableHeaders             = "Display Table Headers"
 	SettingsBrowserPath                  = "Browser Path"
 	SettingsBrowserUserDataPath          = "Browser User Data Path"
+	SettingsLocalAPI                     = "Local API"
+	SettingsLocalAPIPort                 = "Local API Port"
+	SettingsLocalAPIToken                = "Local API Token"
+	SettingsImportBulletsAs              = "Import Bullets As"
+	SettingsOPMLSubpageDepth             = "OPML Sub-Page Depth"
 	// SettingsCacheAudioBeforePlayback     = "Cache Audio Before Playback"
 
 	SettingsAudioVolume     = "AudioVolume"
@@ -145,6 +150,11 @@ const (
 	TableHeadersAlways   = "Always"
 )
 
+const (
+	ImportBulletsAsCheckboxes = "Checkboxes"
+	ImportBulletsAsNotes      = "Notes"
+)
+
 func NewProgramSettings() *Properties {
 
 	// We're setting the defaults here; after setting them, we'll attempt to load settings from a preferences file below
@@ -167,6 +177,9 @@ func NewProgramSettings() *Properties {
 	props.Get(SettingsScreenshotPath).Set("")
 	props.Get(SettingsBrowserPath).Set("")
 	props.Get(SettingsBrowserUserDataPath).Set("")
+	props.Get(SettingsLocalAPI).Set(false)
+	props.Get(SettingsLocalAPIPort).Set(7374.0)
+	props.Get(SettingsLocalAPIToken).Set("")
 	props.Get(SettingsAutoLoadLastProject).Set(false)
 	props.Get(SettingsSmoothMovement).Set(true)
 	props.Get(SettingsNumberTopLevelCards).Set(true)
@@ -185,6 +198,8 @@ func NewProgramSettings() *Properties {
 	props.Get(SettingsHideGridOnZoomOut).Set(true)
 	props.Get(SettingsDisplayNumberedPercentagesAs).Set(NumberedPercentagePercent)
 	props.Get(SettingsShowTableHeaders).Set(TableHeadersSelected)
+	props.Get(SettingsImportBulletsAs).Set(ImportBulletsAsCheckboxes)
+	props.Get(SettingsOPMLSubpageDepth).Set(0.0)
 
 	// Audio settings; not shown in MasterPlan because it's very rarely necessary to tweak
 	props.Get(SettingsAudioVolume).Set(80.0)
@@ -255,6 +255,89 @@ func (stack *Stack) Contains(card *Card) bool {
 	return false
 }
 
+// Depth returns how far the Card is indented in its stack. Numberable Cards use the nesting PostUpdate() numbers them with (offset by how
+// far the top numberable Card is indented from the top of the stack); others are indented by grid spaces from the top.
+func (stack *Stack) Depth() int {
+
+	top := stack.Top()
+	depth := int((stack.Card.Rect.X - top.Rect.X) / globals.GridSize)
+
+	if topNumberable := stack.TopNumberable(); stack.Card.Numberable() && topNumberable != nil && len(stack.Number) > 0 {
+		depth = len(stack.Number) - 1 + int((topNumberable.Rect.X-top.Rect.X)/globals.GridSize)
+	}
+
+	if depth < 0 {
+		depth = 0
+	}
+
+	return depth
+
+}
+
+// ReadingOrder returns the valid Cards in reading order - top to bottom, and then left to right.
+func ReadingOrder(cards []*Card) []*Card {
+
+	ordered := []*Card{}
+	for _, card := range cards {
+		if card.Valid {
+			ordered = append(ordered, card)
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Rect.Y != ordered[j].Rect.Y {
+			return ordered[i].Rect.Y < ordered[j].Rect.Y
+		}
+		return ordered[i].Rect.X < ordered[j].Rect.X
+	})
+
+	return ordered
+
+}
+
+// StackedCards groups the given Cards into their stacks, in reading order, along with how far each Card is indented. Depths are relative
+// to the least indented Card of each stack, and only go one step deeper than the Card above, as in an outline.
+func StackedCards(cards []*Card) ([][]*Card, [][]int) {
+
+	stacks := [][]*Card{}
+	indices := map[*Card]int{}
+
+	for _, card := range ReadingOrder(cards) {
+		top := card.Stack.Top()
+		if _, exists := indices[top]; !exists {
+			indices[top] = len(stacks)
+			stacks = append(stacks, []*Card{})
+		}
+		stacks[indices[top]] = append(stacks[indices[top]], card)
+	}
+
+	depths := make([][]int, len(stacks))
+
+	for i, stack := range stacks {
+
+		minDepth := -1
+		for _, card := range stack {
+			if depth := card.Stack.Depth(); minDepth < 0 || depth < minDepth {
+				minDepth = depth
+			}
+		}
+
+		prevDepth := -1
+		for _, card := range stack {
+			depth := card.Stack.Depth() - minDepth
+			if depth > prevDepth+1 {
+				depth = prevDepth + 1
+			}
+			depths[i] = append(depths[i], depth)
+			prevDepth = depth
+		}
+
+	}
+
+	return stacks, depths
+
+}
+
 // func (stack *Stack) MoveNeighborAboveDown() {
 
 // 	above := stack.Above
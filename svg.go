@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// ExportSVG returns the Page drawn as an SVG document. Cards are rectangles in their theme colors, text is real (selectable, editable)
+// text, links are lines through their joints ending in arrowheads, images are embedded, and Tables and Maps are drawn cell by cell.
+// Sub-Page Cards and Link Cards link to the files of the Pages they go to, if they're in pageFiles (see SVGFilenames()).
+func ExportSVG(page *Page, backgroundOption int, pageFiles map[*Page]string) string {
+	href := func(card *Card, target *Page) string { return pageFiles[target] }
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + svgElement(page, backgroundOption, "grid", href)
+}
+
+// svgElement returns the Page drawn as an <svg> element. href returns where clicking on a Card that goes to the target Page links to, or ""
+// for nowhere; gridID is the ID of the background grid's pattern, which has to be unique in the document the element ends up in.
+func svgElement(page *Page, backgroundOption int, gridID string, href func(card *Card, target *Page) string) string {
+
+	area := exportArea(page)
+
+	canvas := &svgCanvas{
+		Document: &strings.Builder{},
+		Href:     href,
+		GridID:   gridID,
+	}
+
+	fmt.Fprintf(canvas.Document, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" viewBox="%s %s %s %s" width="%s" height="%s" font-family="Noto Sans, sans-serif" font-weight="bold" font-size="%d" xml:space="preserve">`+"\n",
+		svgNumber(area.X), svgNumber(area.Y), svgNumber(area.W), svgNumber(area.H), svgNumber(area.W), svgNumber(area.H), vectorFontSize)
+	fmt.Fprintf(canvas.Document, "<title>%s</title>\n", svgEscape(page.Name()))
+
+	drawVectorPage(page, canvas, backgroundOption, area)
+
+	canvas.Document.WriteString("</svg>\n")
+
+	return canvas.Document.String()
+
+}
+
+// svgCanvas draws Pages as SVG elements.
+type svgCanvas struct {
+	Document *strings.Builder
+	Href     func(card *Card, target *Page) string
+	GridID   string
+}
+
+func (sc *svgCanvas) Rect(rect *sdl.FRect, radius float32, fill, stroke Color, strokeWidth float32) {
+	fmt.Fprintf(sc.Document, `<rect x="%s" y="%s" width="%s" height="%s"`, svgNumber(rect.X), svgNumber(rect.Y), svgNumber(rect.W), svgNumber(rect.H))
+	if radius > 0 {
+		fmt.Fprintf(sc.Document, ` rx="%s"`, svgNumber(radius))
+	}
+	sc.Document.WriteString(svgPaint("fill", fill) + svgPaint("stroke", stroke))
+	if stroke != nil && strokeWidth != 1 {
+		fmt.Fprintf(sc.Document, ` stroke-width="%s"`, svgNumber(strokeWidth))
+	}
+	sc.Document.WriteString("/>\n")
+}
+
+func (sc *svgCanvas) Polyline(points []Point, width float32, color Color) {
+	fmt.Fprintf(sc.Document, `<polyline points="%s" fill="none" stroke-width="%s" stroke-linejoin="round" stroke-linecap="round"%s/>`+"\n", svgPoints(points), svgNumber(width), svgPaint("stroke", color))
+}
+
+func (sc *svgCanvas) Polygon(points []Point, fill, stroke Color) {
+	fmt.Fprintf(sc.Document, `<polygon points="%s" stroke-width="2" stroke-linejoin="round"%s%s/>`+"\n", svgPoints(points), svgPaint("fill", fill), svgPaint("stroke", stroke))
+}
+
+func (sc *svgCanvas) Circle(center Point, radius float32, fill, stroke Color) {
+	fmt.Fprintf(sc.Document, `<circle cx="%s" cy="%s" r="%s" stroke-width="2"%s%s/>`+"\n", svgNumber(center.X), svgNumber(center.Y), svgNumber(radius), svgPaint("fill", fill), svgPaint("stroke", stroke))
+}
+
+func (sc *svgCanvas) Grid(rect *sdl.FRect, color Color) {
+	gs := svgNumber(globals.GridSize)
+	fmt.Fprintf(sc.Document, `<defs><pattern id="%s" width="%s" height="%s" patternUnits="userSpaceOnUse"><path d="M %s 0 L 0 0 0 %s" fill="none"%s/></pattern></defs>`+"\n", sc.GridID, gs, gs, gs, gs, svgPaint("stroke", color))
+	fmt.Fprintf(sc.Document, `<rect x="%s" y="%s" width="%s" height="%s" fill="url(#%s)"/>`+"\n", svgNumber(rect.X), svgNumber(rect.Y), svgNumber(rect.W), svgNumber(rect.H), sc.GridID)
+}
+
+func (sc *svgCanvas) Text(lines []string, pos Point, anchor string, color Color, vertical bool) {
+
+	x, y := svgNumber(pos.X), svgNumber(pos.Y+vectorBaseline)
+
+	fmt.Fprintf(sc.Document, `<text x="%s" y="%s"`, x, y)
+	if anchor != "start" {
+		fmt.Fprintf(sc.Document, ` text-anchor="%s"`, anchor)
+	}
+	if vertical {
+		fmt.Fprintf(sc.Document, ` transform="rotate(-90 %s %s)"`, svgNumber(pos.X), svgNumber(pos.Y))
+	}
+	sc.Document.WriteString(svgPaint("fill", color) + ">")
+
+	if len(lines) == 1 {
+		sc.Document.WriteString(svgEscape(lines[0]))
+	} else {
+		for i, line := range lines {
+			if i == 0 {
+				fmt.Fprintf(sc.Document, `<tspan x="%s">%s</tspan>`, x, svgEscape(line))
+			} else {
+				fmt.Fprintf(sc.Document, `<tspan x="%s" dy="%s">%s</tspan>`, x, svgNumber(globals.GridSize), svgEscape(line))
+			}
+		}
+	}
+
+	sc.Document.WriteString("</text>\n")
+
+}
+
+func (sc *svgCanvas) Image(filename string, rect *sdl.FRect) bool {
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return false
+	}
+
+	fmt.Fprintf(sc.Document, `<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none" xlink:href="data:%s;base64,%s"/>`+"\n",
+		svgNumber(rect.X), svgNumber(rect.Y), svgNumber(rect.W), svgNumber(rect.H), mimeType, base64.StdEncoding.EncodeToString(data))
+
+	return true
+
+}
+
+// BeginCard starts a group for the Card, with its type (and whether it's completed, if it can be) as its classes, in a link to the Page it
+// goes to.
+func (sc *svgCanvas) BeginCard(card *Card, target *Page) {
+
+	if href := sc.href(card, target); href != "" {
+		fmt.Fprintf(sc.Document, `<a xlink:href="%s">`+"\n", svgEscape(href))
+	}
+
+	class := "card " + strings.ToLower(strings.ReplaceAll(card.ContentType, " ", "-"))
+	if card.Numberable() {
+		if card.Completed() {
+			class += " completed"
+		} else {
+			class += " incomplete"
+		}
+	}
+
+	fmt.Fprintf(sc.Document, `<g id="card-%d" class="%s">`+"\n", card.ID, class)
+
+}
+
+func (sc *svgCanvas) EndCard(card *Card, target *Page) {
+	sc.Document.WriteString("</g>\n")
+	if sc.href(card, target) != "" {
+		sc.Document.WriteString("</a>\n")
+	}
+}
+
+func (sc *svgCanvas) BeginLink(link *LinkEnding) {
+	fmt.Fprintf(sc.Document, `<g id="link-%d-%d" class="link" data-start="%d" data-end="%d">`+"\n", link.Start.ID, link.End.ID, link.Start.ID, link.End.ID)
+}
+
+func (sc *svgCanvas) EndLink(link *LinkEnding) {
+	sc.Document.WriteString("</g>\n")
+}
+
+func (sc *svgCanvas) href(card *Card, target *Page) string {
+	if target == nil || sc.Href == nil {
+		return ""
+	}
+	return sc.Href(card, target)
+}
+
+// SVGFilenames returns the names of the files the Project's Pages are exported to, based on the given name.
+func SVGFilenames(project *Project, baseName string) map[*Page]string {
+
+	filenames := map[*Page]string{}
+	taken := map[string]bool{}
+
+	for _, page := range exportPages(project) {
+
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|`, r) || r < 32 {
+				return '_'
+			}
+			return r
+		}, oneLine(page.Name()))
+
+		filename := baseName + "_" + name + ".svg"
+		for i := 2; taken[strings.ToLower(filename)]; i++ {
+			filename = baseName + "_" + name + "_" + strconv.Itoa(i) + ".svg"
+		}
+
+		taken[strings.ToLower(filename)] = true
+		filenames[page] = filename
+
+	}
+
+	return filenames
+
+}
+
+// WriteSVGFiles exports each of the Project's Pages as an SVG file in the given directory.
+func WriteSVGFiles(project *Project, backgroundOption int, dir string) error {
+
+	filenames := SVGFilenames(project, exportBaseName(project)+"_Export")
+
+	for _, page := range exportPages(project) {
+		if err := os.WriteFile(filepath.Join(dir, filenames[page]), []byte(ExportSVG(page, backgroundOption, filenames)), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// ExportSVGHeadless loads the project at the given filepath without showing it and writes each of its Pages as an SVG file to the given
+// directory. It's used by the export command.
+func ExportSVGHeadless(filename, passphrase string, backgroundOption int, dir string) error {
+
+	closeHeadless, err := LoadHeadless(filename, passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer closeHeadless()
+
+	return WriteSVGFiles(globals.Project, backgroundOption, dir)
+
+}
+
+// svgPaint returns the attribute setting the given paint ("fill" or "stroke") to the color, along with its opacity if it's translucent.
+func svgPaint(attr string, color Color) string {
+	if color == nil {
+		if attr == "fill" {
+			return ` fill="none"`
+		}
+		return ""
+	}
+	paint := fmt.Sprintf(` %s="#%.2X%.2X%.2X"`, attr, color[0], color[1], color[2])
+	if color[3] < 255 {
+		paint += fmt.Sprintf(` %s-opacity="%s"`, attr, strconv.FormatFloat(float64(color[3])/255, 'f', 2, 64))
+	}
+	return paint
+}
+
+func svgNumber(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
+}
+
+func svgPoints(points []Point) string {
+	coords := []string{}
+	for _, p := range points {
+		coords = append(coords, svgNumber(p.X)+","+svgNumber(p.Y))
+	}
+	return strings.Join(coords, " ")
+}
+
+func svgEscape(text string) string {
+	escaped := &strings.Builder{}
+	xml.EscapeText(escaped, []byte(text))
+	return escaped.String()
+}
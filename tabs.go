@@ -0,0 +1,238 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// Projects are opened in tabs. globals.Projects holds every open Project in tab order, and globals.Project is the one in the current tab;
+// only the current Project is updated and drawn.
+
+// tabsChanged is set when Projects are opened, closed, or switched between, so the tab strip knows to rebuild itself.
+var tabsChanged = true
+
+// pendingTabClose is the Project asked about in the "confirm close tab" menu.
+var pendingTabClose *Project
+
+// ProjectTab returns the open Project saved at the given filepath, or nil if it isn't open.
+func ProjectTab(filename string) *Project {
+	for _, project := range globals.Projects {
+		if project.Filepath != "" && filepath.Clean(project.Filepath) == filepath.Clean(filename) {
+			return project
+		}
+	}
+	return nil
+}
+
+// projectTabIndex returns the index of the given Project's tab, or -1 if it isn't open.
+func projectTabIndex(project *Project) int {
+	for i, p := range globals.Projects {
+		if p == project {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadProject opens the project at the given filepath in a new tab, or switches to its tab if it's open already.
+func LoadProject(filename string) {
+
+	if project := ProjectTab(filename); project != nil {
+		SwitchToProject(project)
+		return
+	}
+
+	OpenProjectFrom(filename)
+
+}
+
+// OpenProjectTab opens the given (newly loaded) Project in a tab and switches to it. If its file is open already (i.e. it was reloaded or
+// restored from a backup), it takes the place of that tab; otherwise, it replaces the current tab if that's an untouched new project, and
+// opens in a new tab next to the current one if not.
+func OpenProjectTab(project *Project) {
+
+	replace := -1
+
+	if project.Filepath != "" {
+		replace = projectTabIndex(ProjectTab(project.Filepath))
+	}
+
+	if replace < 0 && globals.Project != nil && globals.Project.Filepath == "" && !globals.Project.Modified {
+		replace = projectTabIndex(globals.Project)
+	}
+
+	if replace >= 0 {
+		replaced := globals.Projects[replace]
+		globals.Projects[replace] = project
+		SwitchToProject(project)
+		destroyProject(replaced)
+	} else {
+		index := projectTabIndex(globals.Project) + 1
+		globals.Projects = append(globals.Projects[:index], append([]*Project{project}, globals.Projects[index:]...)...)
+		SwitchToProject(project)
+	}
+
+	if project.focusCardOnOpen >= 0 {
+		project.FocusOnCard(project.focusCardOnOpen)
+		project.focusCardOnOpen = -1
+	}
+
+	tabsChanged = true
+
+}
+
+// SwitchToProject makes the given open Project the current one.
+func SwitchToProject(project *Project) {
+
+	if globals.Project == project {
+		return
+	}
+
+	if globals.editingLabel != nil {
+		globals.editingLabel.EndEditing()
+	}
+
+	// Card linking carries on in the other Project, so Link Cards can target Cards in other projects.
+	if globals.State != StateCardLink {
+		globals.State = StateNeutral
+	}
+
+	globals.Project = project
+
+	globals.Dispatcher.Run() // It's not modified, but we'll run the dispatcher manually
+
+	if project.CurrentPage.UpwardPage == nil {
+		globals.MenuSystem.Get("prev sub page").Close()
+	} else {
+		globals.MenuSystem.Get("prev sub page").Open()
+	}
+
+	tabsChanged = true
+
+}
+
+// SwitchTab switches to the tab the given number of tabs away from the current one, wrapping around at either end.
+func SwitchTab(offset int) {
+	count := len(globals.Projects)
+	index := (projectTabIndex(globals.Project) + offset%count + count) % count
+	SwitchToProject(globals.Projects[index])
+}
+
+// FocusCardInProject switches to the project at the given filepath, opening it if it isn't open yet, and focuses on the Card with the given ID.
+func FocusCardInProject(filename string, cardID int64) {
+
+	if project := ProjectTab(filename); project != nil {
+		SwitchToProject(project)
+		project.FocusOnCard(cardID)
+		return
+	}
+
+	OpenProjectFrom(filename)
+
+	// The project opens on the next frame, so it focuses on the Card then.
+	if globals.NextProject != nil {
+		globals.NextProject.focusCardOnOpen = cardID
+	}
+
+}
+
+// CloseProjectTab closes the given Project's tab, first asking to save it if it has unsaved changes.
+func CloseProjectTab(project *Project) {
+
+	if project.Modified {
+		pendingTabClose = project
+		confirm := globals.MenuSystem.Get("confirm close tab")
+		confirm.Center()
+		confirm.Open()
+		return
+	}
+
+	closeProject(project)
+
+}
+
+// closeProject closes the given Project's tab without asking. Closing the last tab leaves a new project open in its place.
+func closeProject(project *Project) {
+
+	index := projectTabIndex(project)
+	if index < 0 {
+		return
+	}
+
+	globals.Projects = append(globals.Projects[:index], globals.Projects[index+1:]...)
+
+	if len(globals.Projects) == 0 {
+		globals.Projects = append(globals.Projects, NewProject())
+	}
+
+	if globals.Project == project {
+		if index >= len(globals.Projects) {
+			index = len(globals.Projects) - 1
+		}
+		SwitchToProject(globals.Projects[index])
+	}
+
+	destroyProject(project)
+
+	tabsChanged = true
+
+}
+
+// destroyProject destroys a Project that's no longer open, along with any Resources only it used.
+func destroyProject(project *Project) {
+
+	// Cut Cards can't be removed from a closed Project, so they can only be pasted as copies now.
+	for _, card := range globals.CopyBuffer.Cards {
+		if card.Page.Project == project {
+			globals.CopyBuffer.CutMode = false
+		}
+	}
+
+	if globals.linkingCard != nil && globals.linkingCard.Page.Project == project {
+		globals.linkingCard = nil
+		globals.State = StateNeutral
+	}
+
+	project.Destroy()
+
+	globals.Resources.DestroyUnused()
+
+	evictLinkedProjects()
+
+}
+
+// TabName returns the name shown on the given Project's tab - its filename (including enough of its directory to tell it apart from other
+// open projects with the same filename), marked if it's modified or read-only.
+func TabName(project *Project) string {
+
+	name := "New Project"
+
+	if project.Filepath != "" {
+		paths := []string{}
+		for _, p := range globals.Projects {
+			if p.Filepath != "" {
+				paths = append(paths, p.Filepath)
+			}
+		}
+		name = unambiguousPathName(project.Filepath, paths)
+	}
+
+	if project.ReadOnly {
+		name += " (Read-Only)"
+	} else if project.Modified {
+		name += " *"
+	}
+
+	return name
+
+}
+
+// ModifiedProjects returns the open Projects with unsaved changes.
+func ModifiedProjects() []*Project {
+	modified := []*Project{}
+	for _, project := range globals.Projects {
+		if project.Modified && !project.ReadOnly {
+			modified = append(modified, project)
+		}
+	}
+	return modified
+}
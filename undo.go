@@ -127,6 +127,8 @@ func (history *UndoHistory) Undo() bool {
 
 		globals.EventLog.Log("Undo event triggered.", false)
 
+		history.Project.JournalCards(affected...)
+
 		history.On = true
 
 		history.Project.SetModifiedState()
@@ -189,6 +191,8 @@ func (history *UndoHistory) Redo() bool {
 
 		globals.EventLog.Log("Redo event triggered.", false)
 
+		history.Project.JournalCards(affected...)
+
 		history.On = true
 
 		history.Project.SetModifiedState()
@@ -213,6 +217,8 @@ func (history *UndoHistory) Update() {
 
 		history.Frames = append(history.Frames, history.CurrentFrame)
 
+		history.Project.JournalFrame(history.CurrentFrame)
+
 		history.CurrentFrame = NewUndoFrame()
 
 		history.Index = len(history.Frames)
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/solarlune/masterplan/plan"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// vectorFontSize is the size of text in vector exports; it's about the size glyphs are drawn at to fit a grid space.
+const vectorFontSize = 23
+
+// vectorBaseline is how far below the top of a line of text its baseline is.
+const vectorBaseline = 23
+
+// vectorCanvas is something Pages can be drawn on as vector graphics by drawVectorPage(), like an SVG document or a PDF page. Positions
+// and sizes are in world coordinates, and nil colors aren't drawn.
+type vectorCanvas interface {
+	Rect(rect *sdl.FRect, radius float32, fill, stroke Color, strokeWidth float32)
+	Polyline(points []Point, width float32, color Color)
+	Polygon(points []Point, fill, stroke Color)
+	Circle(center Point, radius float32, fill, stroke Color)
+	Grid(rect *sdl.FRect, color Color)
+	// Text draws lines of text a grid space apart, with the top of the first line at the position, anchored there by its "start",
+	// "middle", or "end". Vertical text is turned a quarter-turn counter-clockwise around the position, so it reads upwards.
+	Text(lines []string, pos Point, anchor string, color Color, vertical bool)
+	// Image draws the image file stretched over the rectangle, returning false if it couldn't be read.
+	Image(filename string, rect *sdl.FRect) bool
+	// BeginCard and EndCard are called around drawing each Card; target is the Page that clicking on the Card should go to (for
+	// Sub-Page Cards and Link Cards), or nil.
+	BeginCard(card *Card, target *Page)
+	EndCard(card *Card, target *Page)
+	// BeginLink and EndLink are called around drawing each link.
+	BeginLink(link *LinkEnding)
+	EndLink(link *LinkEnding)
+}
+
+// drawVectorPage draws the Page's Cards, sorted by depth, and then their links, onto the canvas, over the background the option asks for.
+// area is the area of the world being drawn, from exportArea().
+func drawVectorPage(page *Page, canvas vectorCanvas, backgroundOption int, area *sdl.FRect) {
+
+	if backgroundOption != BackgroundTransparent {
+		canvas.Rect(area, 0, getThemeColor(GUIBGColor), nil, 0)
+	}
+
+	if backgroundOption == BackgroundNormal {
+		canvas.Grid(area, getThemeColor(GUIGridColor).Mix(getThemeColor(GUIBGColor), 0.5))
+	}
+
+	cards := append([]*Card{}, page.Cards...)
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Depth < cards[j].Depth })
+
+	for _, card := range cards {
+		target := vectorCardTarget(card)
+		canvas.BeginCard(card, target)
+		drawVectorCard(card, canvas)
+		canvas.EndCard(card, target)
+	}
+
+	for _, card := range cards {
+		for _, link := range card.Links {
+			if link.Start == card && link.End != nil && link.End.Valid && link.End.Page == page {
+				canvas.BeginLink(link)
+				drawVectorLink(link, canvas)
+				canvas.EndLink(link)
+			}
+		}
+	}
+
+}
+
+func drawVectorCard(card *Card, canvas vectorCanvas) {
+
+	gs := globals.GridSize
+	rect := card.Rect
+
+	fontColor := getThemeColor(GUIFontColor)
+	if card.FontColor != nil {
+		fontColor = card.FontColor
+	}
+
+	// text draws the text wrapped in the given width, cutting off lines that don't fit in the given height.
+	text := func(text string, x, y, w, h float32) {
+		lines := exportWrapText(text, w)
+		maxLines := int(h / gs)
+		if maxLines < 1 {
+			maxLines = 1
+		}
+		if len(lines) > maxLines {
+			lines = lines[:maxLines]
+		}
+		if len(lines) > 1 || lines[0] != "" {
+			canvas.Text(lines, Point{x, y}, "start", fontColor, false)
+		}
+	}
+
+	if color := card.Color(); color[3] > 0 {
+		canvas.Rect(rect, 4, color, color.Sub(40), 2)
+	}
+
+	switch contents := card.Contents.(type) {
+
+	case *CheckboxContents:
+		box := &sdl.FRect{rect.X + 6, rect.Y + 6, gs - 12, gs - 12}
+		canvas.Rect(box, 3, nil, fontColor, 2)
+		if card.Properties.Get("checked").AsBool() {
+			canvas.Polyline([]Point{{box.X + 4, box.Y + box.H/2}, {box.X + box.W/2 - 1, box.Y + box.H - 5}, {box.X + box.W - 4, box.Y + 4}}, 3, fontColor)
+		}
+		text(card.Properties.Get("description").AsString(), rect.X+gs, rect.Y, rect.W-gs, rect.H)
+
+	case *NumberedContents:
+		current := card.Properties.Get("current").AsFloat()
+		max := card.Properties.Get("maximum").AsFloat()
+		hideMax := card.Properties.Get("hideMax").AsBool()
+		if max > 0 && !hideMax {
+			p := current / max
+			if p > 1 {
+				p = 1
+			}
+			fill := getThemeColor(GUICompletedColor)
+			if card.CustomColor != nil {
+				h, s, v := card.CustomColor.HSV()
+				fill = NewColorFromHSV(h+30, s-0.2, v+0.2)
+			}
+			if p > 0 {
+				canvas.Rect(&sdl.FRect{rect.X, rect.Y, rect.W * float32(p), rect.H}, 4, fill, nil, 0)
+			}
+		}
+		text(card.Properties.Get("description").AsString(), rect.X+gs, rect.Y, rect.W-gs, rect.H-gs)
+		count := formatExportNumber(current)
+		if !hideMax {
+			count += " / " + formatExportNumber(max)
+		}
+		canvas.Text([]string{count}, Point{rect.X + rect.W/2, rect.Y + rect.H - gs}, "middle", fontColor, false)
+
+	case *ImageContents:
+		if contents.Resource == nil || contents.Resource.LocalFilepath == "" || !canvas.Image(contents.Resource.LocalFilepath, rect) {
+			text(card.Name(), rect.X, rect.Y, rect.W, rect.H)
+		}
+
+	case *MapContents:
+		canvas.Rect(rect, 0, getThemeColor(GUIMapColor), nil, 0)
+		mapData := contents.MapData
+		for y := 0; y < mapData.Height; y++ {
+			for x := 0; x < mapData.Width; x++ {
+				value := mapData.GetI(x, y)
+				if value <= 0 {
+					continue
+				}
+				if colorIndex := contents.ColorIndexToColor(value); colorIndex >= 1 && colorIndex <= len(MapPaletteColors) {
+					canvas.Rect(&sdl.FRect{rect.X + float32(x)*gs, rect.Y + float32(y)*gs, gs, gs}, 0, MapPaletteColors[colorIndex-1], nil, 0)
+				}
+			}
+		}
+
+	case *TableContents:
+		drawVectorTable(contents, canvas, fontColor)
+
+	case *WebContents:
+		text(card.Properties.Get("url").AsString(), rect.X+gs, rect.Y, rect.W-gs, rect.H)
+
+	default:
+		text(card.Name(), rect.X+gs, rect.Y, rect.W-gs, rect.H)
+
+	}
+
+	// Deadlines are drawn as tags to the left of the Card, as they are in MasterPlan.
+	if card.Completable() && card.DeadlineState() != DeadlineStateDone {
+
+		deadline := card.DeadlineText()
+
+		color := getThemeColor(GUIMenuColor)
+		if card.DeadlineState() != DeadlineStateTimeRemains {
+			color = getThemeColor(GUICompletedColor)
+		}
+
+		width := globals.TextRenderer.MeasureText([]rune(deadline), 1).X + 32
+		x := rect.X - width - 8
+
+		canvas.Rect(&sdl.FRect{x, rect.Y, width, gs}, 8, color, color.Accent(), 2)
+		canvas.Text([]string{deadline}, Point{x + 16, rect.Y}, "start", getThemeColor(GUIFontColor), false)
+
+	}
+
+}
+
+// drawVectorTable draws the Table's cells as they're displayed, with its row headings to its left and its column headings above it.
+func drawVectorTable(contents *TableContents, canvas vectorCanvas, fontColor Color) {
+
+	gs := globals.GridSize
+	rect := contents.Card.Rect
+	td := plan.ParseTableData(contents.TableData.Serialize())
+
+	completedColor := getThemeColor(GUICompletedColor)
+	if contents.Card.CustomColor != nil {
+		h, s, v := contents.Card.CustomColor.HSV()
+		completedColor = NewColorFromHSV(h+30, s-0.2, v+0.4)
+	}
+
+	for y := 0; y < td.Height; y++ {
+		for x := 0; x < td.Width; x++ {
+			cell := &sdl.FRect{rect.X + float32(x)*gs, rect.Y + float32(y)*gs, gs, gs}
+			value := td.Value(x, y)
+			if value > 0 && td.ValueDisplayMode == plan.ValueDisplayModeCheck {
+				canvas.Rect(&sdl.FRect{cell.X + 2, cell.Y + 2, cell.W - 4, cell.H - 4}, 0, completedColor, nil, 0)
+			}
+			canvas.Rect(cell, 0, nil, contents.Color().Sub(40), 1)
+			if valueText := plan.ValueText(td.ValueDisplayMode, value); valueText != "" {
+				canvas.Text([]string{valueText}, Point{cell.X + gs/2, cell.Y}, "middle", fontColor, false)
+			}
+		}
+	}
+
+	headingColor := getThemeColor(GUIFontColor)
+
+	for y, heading := range td.RowHeadings {
+		if y < td.Height && heading != "" {
+			canvas.Text([]string{oneLine(heading)}, Point{rect.X - 8, rect.Y + float32(y)*gs}, "end", headingColor, false)
+		}
+	}
+
+	for x, heading := range td.ColumnHeadings {
+		if x < td.Width && heading != "" {
+			canvas.Text([]string{oneLine(heading)}, Point{rect.X + float32(x)*gs, rect.Y - 8}, "start", headingColor, true)
+		}
+	}
+
+}
+
+// drawVectorLink draws the LinkEnding as an outlined line through its joints, with an arrowhead pointing into its End Card.
+func drawVectorLink(le *LinkEnding, canvas vectorCanvas) {
+
+	outlineColor := getThemeColor(GUIFontColor)
+	mainColor := le.Start.Color()
+	if mainColor[3] == 0 {
+		mainColor = ColorWhite
+		outlineColor = ColorBlack
+	}
+
+	points := exportLinkPoints(le)
+	end := points[len(points)-1]
+	delta := end.Sub(points[len(points)-2])
+	if points[0].Equals(end) || delta.Length() == 0 {
+		return
+	}
+
+	// The line stops short of the end so the arrowhead's tip sits on the End Card's edge.
+	dir := delta.Normalized()
+	back := end.Sub(dir.Mult(16))
+	line := append(append([]Point{}, points[:len(points)-1]...), back)
+
+	canvas.Polyline(line, 8, outlineColor)
+	canvas.Polyline(line, 4, mainColor)
+
+	side := Point{-dir.Y, dir.X}.Mult(10)
+	base := back.Sub(dir.Mult(4))
+	canvas.Polygon([]Point{end, base.Add(side), base.Sub(side)}, mainColor, outlineColor)
+
+	for _, joint := range le.Joints {
+		canvas.Circle(joint.Position, 6, mainColor, outlineColor)
+	}
+
+}
+
+// vectorCardTarget returns the Page clicking on the Card in an export should go to - a Sub-Page Card's Sub-Page, or the Page of a Link
+// Card's target (if it's in the same project) - or nil if there's none.
+func vectorCardTarget(card *Card) *Page {
+
+	switch contents := card.Contents.(type) {
+
+	case *SubPageContents:
+		return contents.SubPage
+
+	case *LinkContents:
+		if card.Properties.Get("link mode").AsFloat() != 0 || card.Properties.Get("target").AsFloat() < 0 || contents.RemoteTarget() != "" {
+			return nil
+		}
+		id := int64(card.Properties.Get("target").AsFloat())
+		for _, page := range card.Page.Project.Pages {
+			if target := page.CardByID(id); target != nil && target.Valid {
+				return page
+			}
+		}
+
+	}
+
+	return nil
+
+}
+
+// exportLinkPoints returns the points the LinkEnding's line passes through - from the edge of its Start Card, through its joints, to the
+// edge of its End Card - as LinkEnding.Draw() places them, but using the Cards' resting rectangles rather than their animated ones.
+func exportLinkPoints(le *LinkEnding) []Point {
+
+	center := func(rect *sdl.FRect) Point {
+		return Point{rect.X + rect.W/2, rect.Y + rect.H/2}
+	}
+
+	// nearest returns the nearest point on the rectangle to the given point; if perpendicular, it's on the edge facing the point, kept at
+	// the center of the rectangle on axes where the point's inside it.
+	nearest := func(rect *sdl.FRect, in Point, perpendicular bool) Point {
+		out := in
+		if perpendicular {
+			out = center(rect)
+			if in.X < rect.X || in.X > rect.X+rect.W {
+				out.X = in.X
+			}
+			if in.Y < rect.Y || in.Y > rect.Y+rect.H {
+				out.Y = in.Y
+			}
+		}
+		if out.X < rect.X {
+			out.X = rect.X
+		} else if out.X > rect.X+rect.W {
+			out.X = rect.X + rect.W
+		}
+		if out.Y < rect.Y {
+			out.Y = rect.Y
+		} else if out.Y > rect.Y+rect.H {
+			out.Y = rect.Y + rect.H
+		}
+		return out
+	}
+
+	if len(le.Joints) == 0 {
+		return []Point{nearest(le.Start.Rect, center(le.End.Rect), true), nearest(le.End.Rect, center(le.Start.Rect), true)}
+	}
+
+	points := []Point{nearest(le.Start.Rect, le.Joints[0].Position, false)}
+	for _, joint := range le.Joints {
+		points = append(points, joint.Position)
+	}
+	return append(points, nearest(le.End.Rect, le.Joints[len(le.Joints)-1].Position, false))
+
+}
+
+// exportArea returns the area of the world to export for the Page - everything drawn for its Cards (the Cards themselves, their links'
+// joints, their deadlines, and Table headings), with a grid space of margin around it.
+func exportArea(page *Page) *sdl.FRect {
+
+	gs := globals.GridSize
+
+	if len(page.Cards) == 0 {
+		return &sdl.FRect{-gs, -gs, gs * 3, gs * 3}
+	}
+
+	first := page.Cards[0].Rect
+	bounds := NewCorrectingRect(first.X, first.Y, first.X, first.Y)
+
+	for _, card := range page.Cards {
+
+		left, top := card.Rect.X, card.Rect.Y
+
+		if card.Completable() && card.DeadlineState() != DeadlineStateDone {
+			left -= globals.TextRenderer.MeasureText([]rune(card.DeadlineText()), 1).X + 40
+		}
+
+		if tc, ok := card.Contents.(*TableContents); ok {
+			td := plan.ParseTableData(tc.TableData.Serialize())
+			for _, heading := range td.RowHeadings {
+				if x := card.Rect.X - globals.TextRenderer.MeasureText([]rune(oneLine(heading)), 1).X - 8; x < left {
+					left = x
+				}
+			}
+			for _, heading := range td.ColumnHeadings {
+				if y := card.Rect.Y - globals.TextRenderer.MeasureText([]rune(oneLine(heading)), 1).X - 8; y < top {
+					top = y
+				}
+			}
+		}
+
+		bounds = bounds.AddXY(left, top)
+		bounds = bounds.AddXY(card.Rect.X+card.Rect.W, card.Rect.Y+card.Rect.H)
+
+		for _, link := range card.Links {
+			for _, joint := range link.Joints {
+				bounds = bounds.AddXY(joint.Position.X, joint.Position.Y)
+			}
+		}
+
+	}
+
+	return &sdl.FRect{bounds.X1 - gs, bounds.Y1 - gs, bounds.Width() + gs*2, bounds.Height() + gs*2}
+
+}
+
+// exportWrapText splits the text into the lines it's drawn in when wrapped to the given width, as Labels wrap it.
+func exportWrapText(text string, maxWidth float32) []string {
+
+	lines := []string{}
+
+	for _, paragraph := range strings.Split(text, "\n") {
+
+		line := ""
+
+		for i, word := range strings.Split(paragraph, " ") {
+			if i > 0 && globals.TextRenderer.MeasureText([]rune(line+" "+word), 1).X > maxWidth {
+				lines = append(lines, line)
+				line = word
+			} else if i > 0 {
+				line += " " + word
+			} else {
+				line = word
+			}
+		}
+
+		lines = append(lines, line)
+
+	}
+
+	return lines
+
+}
+
+// exportPageTree returns the Project's Pages that can be exported in the order they're reached from the root Page - depth-first, through
+// Sub-Page Cards from top to bottom - along with the Page each of them is a sub-page of (nil for the root Page, and for Pages that somehow
+// can't be reached through Sub-Page Cards, which come last).
+func exportPageTree(project *Project) ([]*Page, map[*Page]*Page) {
+
+	pages := []*Page{}
+	parents := map[*Page]*Page{}
+
+	var addPage func(page, parent *Page)
+	addPage = func(page, parent *Page) {
+		if _, added := parents[page]; added || !page.Valid() {
+			return
+		}
+		pages = append(pages, page)
+		parents[page] = parent
+		for _, card := range ReadingOrder(page.Cards) {
+			if sp, ok := card.Contents.(*SubPageContents); ok && sp.SubPage != nil {
+				addPage(sp.SubPage, page)
+			}
+		}
+	}
+
+	addPage(project.Pages[0], nil)
+	for _, page := range exportPages(project) {
+		addPage(page, nil)
+	}
+
+	return pages, parents
+
+}
+
+// exportPages returns the Project's Pages that can be exported - the root Page, and every Page that's still reachable from it.
+func exportPages(project *Project) []*Page {
+	pages := []*Page{}
+	for _, page := range project.Pages {
+		if page.Valid() {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}